@@ -277,7 +277,7 @@ func (c *GenericContext) serveHealthZHTTP(mux *http.ServeMux, enableHealthzCheck
 	})
 }
 
-// serveProfilingHTTP is used to provide pprof metrics for current running components.
+// serveProfilingHTTP is used to provide pprof metrics and debug info for current running components.
 func serveProfilingHTTP(mux *http.ServeMux) {
 	mux.Handle("/debug/pprof/", http.HandlerFunc(pprof.Index))
 	mux.Handle("/debug/pprof/cmdline", http.HandlerFunc(pprof.Cmdline))
@@ -286,4 +286,5 @@ func serveProfilingHTTP(mux *http.ServeMux) {
 	mux.Handle("/debug/pprof/trace", http.HandlerFunc(pprof.Trace))
 
 	mux.Handle("/debug/metrics", promhttp.Handler())
+	mux.HandleFunc(general.DebugHandlerPathPrefix, general.ServeDebugHandlers)
 }
@@ -95,18 +95,27 @@ func (o *HeadroomReporterOptions) ApplyTo(c *reporter.HeadroomReporterConfigurat
 	return errors.NewAggregate(errList)
 }
 
-type CPUHeadroomManagerOptions struct{}
+type CPUHeadroomManagerOptions struct {
+	CPUNUMAHeadroomReservedRatio      float64
+	CPUNUMAHeadroomReservedMilliCores int64
+}
 
 func NewCPUHeadroomManagerOptions() *CPUHeadroomManagerOptions {
 	return &CPUHeadroomManagerOptions{}
 }
 
 // AddFlags adds flags to the specified FlagSet.
-func (o *CPUHeadroomManagerOptions) AddFlags(*pflag.FlagSet) {
+func (o *CPUHeadroomManagerOptions) AddFlags(fs *pflag.FlagSet) {
+	fs.Float64Var(&o.CPUNUMAHeadroomReservedRatio, "cpu-numa-headroom-reserved-ratio", o.CPUNUMAHeadroomReservedRatio,
+		"the fraction of headroom of each numa to hold back from reporting, on top of node-level reservations")
+	fs.Int64Var(&o.CPUNUMAHeadroomReservedMilliCores, "cpu-numa-headroom-reserved-millicores", o.CPUNUMAHeadroomReservedMilliCores,
+		"the millicores of headroom of each numa to hold back from reporting, and the larger one takes effect along with the ratio")
 }
 
 // ApplyTo fills up config with options
-func (o *CPUHeadroomManagerOptions) ApplyTo(*reporter.CPUHeadroomManagerConfiguration) error {
+func (o *CPUHeadroomManagerOptions) ApplyTo(c *reporter.CPUHeadroomManagerConfiguration) error {
+	c.CPUNUMAHeadroomReservedRatio = o.CPUNUMAHeadroomReservedRatio
+	c.CPUNUMAHeadroomReservedMilliCores = o.CPUNUMAHeadroomReservedMilliCores
 	return nil
 }
 
@@ -17,23 +17,51 @@ limitations under the License.
 package region
 
 import (
+	"fmt"
+
 	"github.com/spf13/pflag"
 
 	"github.com/kubewharf/katalyst-core/pkg/config/agent/sysadvisor/qosaware/resource/cpu/region"
 )
 
-type CPUShareOptions struct{}
+type CPUShareOptions struct {
+	ShareRegionTargetCPUUsageRatio float64
+	ShareRegionHeadroomBufferCores float64
+
+	// targetCPUUsageRatioFlag tells whether the target cpu usage ratio is set explicitly on the command line
+	targetCPUUsageRatioFlag *pflag.Flag
+}
 
 // NewCPUShareOptions creates a new Options with a default config
 func NewCPUShareOptions() *CPUShareOptions {
-	return &CPUShareOptions{}
+	return &CPUShareOptions{
+		ShareRegionTargetCPUUsageRatio: 0,
+		ShareRegionHeadroomBufferCores: 0,
+	}
 }
 
 // AddFlags adds flags to the specified FlagSet.
 func (o *CPUShareOptions) AddFlags(fs *pflag.FlagSet) {
+	fs.Float64Var(&o.ShareRegionTargetCPUUsageRatio, "share-region-target-cpu-usage-ratio", o.ShareRegionTargetCPUUsageRatio,
+		"target cpu usage ratio of share regions in (0, 1], which is only used if no target of cpu usage ratio is given by dynamic config; disabled if not set")
+	o.targetCPUUsageRatioFlag = fs.Lookup("share-region-target-cpu-usage-ratio")
+	fs.Float64Var(&o.ShareRegionHeadroomBufferCores, "share-region-headroom-buffer-cores", o.ShareRegionHeadroomBufferCores,
+		"number of cores added on top of the cpu requirement of share regions when sizing share pools")
 }
 
 // ApplyTo fills up config with options
 func (o *CPUShareOptions) ApplyTo(c *region.CPUShareConfiguration) error {
+	// zero is only allowed as the default, which disables the target
+	explicit := o.targetCPUUsageRatioFlag != nil && o.targetCPUUsageRatioFlag.Changed
+	if (explicit || o.ShareRegionTargetCPUUsageRatio != 0) &&
+		(o.ShareRegionTargetCPUUsageRatio <= 0 || o.ShareRegionTargetCPUUsageRatio > 1) {
+		return fmt.Errorf("share region target cpu usage ratio must be in (0, 1], got %v", o.ShareRegionTargetCPUUsageRatio)
+	}
+	if o.ShareRegionHeadroomBufferCores < 0 {
+		return fmt.Errorf("share region headroom buffer cores must not be negative, got %v", o.ShareRegionHeadroomBufferCores)
+	}
+
+	c.ShareRegionTargetCPUUsageRatio = o.ShareRegionTargetCPUUsageRatio
+	c.ShareRegionHeadroomBufferCores = o.ShareRegionHeadroomBufferCores
 	return nil
 }
@@ -0,0 +1,82 @@
+/*
+Copyright 2022 The Katalyst Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package region
+
+import (
+	"testing"
+
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/kubewharf/katalyst-core/pkg/config/agent/sysadvisor/qosaware/resource/cpu/region"
+)
+
+func TestCPUShareOptions_ApplyTo(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		args      []string
+		wantErr   bool
+		wantRatio float64
+	}{
+		{
+			name:      "default disables the target",
+			wantRatio: 0,
+		},
+		{
+			name:    "explicit zero ratio",
+			args:    []string{"--share-region-target-cpu-usage-ratio=0"},
+			wantErr: true,
+		},
+		{
+			name:      "max ratio",
+			args:      []string{"--share-region-target-cpu-usage-ratio=1"},
+			wantRatio: 1,
+		},
+		{
+			name:    "ratio above max",
+			args:    []string{"--share-region-target-cpu-usage-ratio=1.0001"},
+			wantErr: true,
+		},
+		{
+			name:    "negative buffer",
+			args:    []string{"--share-region-headroom-buffer-cores=-1"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			options := NewCPUShareOptions()
+			fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+			options.AddFlags(fs)
+			assert.NoError(t, fs.Parse(tt.args))
+
+			configuration := region.NewCPUShareConfiguration()
+			err := options.ApplyTo(configuration)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantRatio, configuration.ShareRegionTargetCPUUsageRatio)
+		})
+	}
+}
@@ -17,30 +17,378 @@ limitations under the License.
 package server
 
 import (
+	"time"
+
 	"github.com/spf13/pflag"
 
+	"github.com/kubewharf/katalyst-api/pkg/consts"
 	"github.com/kubewharf/katalyst-core/pkg/config/agent/sysadvisor/qosaware/server"
 )
 
 // QRMServerOptions holds the configurations for qrm servers in qos aware plugin
 type QRMServerOptions struct {
 	QRMServers []string
+
+	CPUServerDeniedControlKnobKeys                []string
+	CPUServerPushCycleDeadline                    time.Duration
+	CPUServerReportNUMAHeadroomQuantity           bool
+	CPUServerUpdateContainerRetryBudget           int
+	CPUServerReconnectOnPluginSocketLost          bool
+	CPUServerContainerInfoMaxAge                  time.Duration
+	CPUServerExtraPluginSocketAbsPaths            []string
+	CPUServerSyncFreshnessWindow                  time.Duration
+	CPUServerHeadroomNUMAKeyFormat                string
+	CPUServerMinReadySuccessCycles                int
+	CPUServerAdvicePushWindow                     string
+	CPUServerContainerGCCapPerCycle               int
+	CPUServerEnableExplicitCPUList                bool
+	CPUServerPoolHeadroomDivergenceThreshold      float64
+	CPUServerSkipPodFetchFailedContainers         bool
+	CPUServerDisableGC                            bool
+	CPUServerMaxBlocksPerNUMAPerPool              int
+	CPUServerAggregatorAddress                    string
+	CPUServerAggregatorBufferSize                 int
+	CPUServerAggregatorMaxRetries                 int
+	CPUServerRefusePushOnReserveReclaimOverlap    bool
+	CPUServerAggregateMetricsInterval             time.Duration
+	CPUServerMaxHeadroomRatio                     float64
+	CPUServerEnableTracing                        bool
+	CPUServerEmptyDedicatedAssignmentsPolicy      string
+	CPUServerMergeIdenticalPoolNUMABlocks         bool
+	CPUServerAdviceInputSnapshotLimit             int
+	CPUServerOrphanContainerFallbackPool          string
+	CPUServerGCAfterAdvisorUpdate                 bool
+	CPUServerHeadroomUnit                         string
+	CPUServerPoolSizeUnits                        map[string]string
+	CPUServerLWWatchdogWindow                     time.Duration
+	CPUServerAbsentPoolCarryForwardWindow         time.Duration
+	CPUServerIsolationTransitionMinGap            time.Duration
+	CPUServerValidateNUMAHeadroomAgainstDedicated bool
+	CPUServerMetaCacheSnapshotPath                string
+	CPUServerMetaCacheSnapshotInterval            time.Duration
+	CPUServerMetaCacheSnapshotMaxAge              time.Duration
+	CPUServerPoolOverlapPriorities                map[string]int
+	CPUServerReportCPUManagerPolicy               bool
+	CPUServerContainerMinCPUFloors                map[string]int
+	CPUServerAdviceAuditLogPath                   string
+	CPUServerDrainTimeout                         time.Duration
+	CPUServerReclaimPoolMaxShrinkPerCycle         int
+	CPUServerPluginDialBackoffInitialInterval     time.Duration
+	CPUServerPluginDialBackoffMaxElapsedTime      time.Duration
+	CPUServerGetPodTimeout                        time.Duration
+	CPUServerPoolStabilityWindow                  int
+	CPUServerEmptyReclaimBlocksPolicy             string
+	CPUServerStartUpPeriod                        time.Duration
+	CPUServerReclaimDisablingNodeConditions       []string
+	CPUServerCallTimeout                          time.Duration
+	CPUServerContainerSettleDelay                 time.Duration
+	CPUServerSuspectCheckpointDropRatio           float64
+	CPUServerStrictAssembly                       bool
+	CPUServerDryRun                               bool
+	CPUServerGateGetAdvice                        bool
+	CPUServerImmutableQoSLevels                   []string
+	CPUServerSecondaryPluginSocketAbsPath         string
+	CPUServerDeterministicBlockIDs                bool
+	CPUServerReservePoolMinNUMACoverage           int
+	QRMServerPeriodJitterFactor                   float64
+	CPUServerPersistLastAdvice                    bool
+	CPUServerLastAdviceMaxAge                     time.Duration
+	CPUServerDiscountOverlappedHeadroom           bool
+	CPUServerManagedQoSLevels                     []string
+	CPUServerMaxPoolMissingContainers             int
+	CPUServerGetCheckpointMaxAttempts             int
+	CPUServerLWSendTimeout                        time.Duration
+	CPUServerLWChunkMaxEntries                    int
+	CPUServerEmitReclaimOverlapMetrics            bool
+	CPUServerReclaimPoolMinCoresPerNUMA           int
+	CPUServerReclaimPoolMinRatioPerNUMA           float64
+	CPUServerAdviceTracePath                      string
+	CPUServerAdviceTraceMaxBytes                  int64
+	CPUServerAdviceTraceMaxBackups                int
+	CPUServerAdviceTraceHashPodUIDs               bool
+	CPUServerCheckpointFrozenCycles               int
+	CPUServerCheckpointCompareMethod              string
+	CPUServerPodEntryAssemblyWorkers              int
 }
 
 // NewQRMServerOptions creates a new Options with a default config
 func NewQRMServerOptions() *QRMServerOptions {
 	return &QRMServerOptions{
-		QRMServers: []string{"cpu", "memory"},
+		QRMServers:                                []string{"cpu", "memory"},
+		CPUServerHeadroomNUMAKeyFormat:            "plain",
+		CPUServerAggregatorBufferSize:             16,
+		CPUServerAggregatorMaxRetries:             3,
+		CPUServerEmptyDedicatedAssignmentsPolicy:  "skip",
+		CPUServerHeadroomUnit:                     "cores",
+		CPUServerMetaCacheSnapshotInterval:        time.Minute,
+		CPUServerMetaCacheSnapshotMaxAge:          10 * time.Minute,
+		CPUServerContainerMinCPUFloors:            map[string]int{consts.PodAnnotationQoSLevelSharedCores: 1},
+		CPUServerPluginDialBackoffInitialInterval: 200 * time.Millisecond,
+		CPUServerPluginDialBackoffMaxElapsedTime:  30 * time.Second,
+		CPUServerEmptyReclaimBlocksPolicy:         "keep",
+		CPUServerStartUpPeriod:                    30 * time.Second,
+		CPUServerCallTimeout:                      30 * time.Second,
+		CPUServerReservePoolMinNUMACoverage:       1,
+		CPUServerLastAdviceMaxAge:                 5 * time.Minute,
+		CPUServerManagedQoSLevels: []string{
+			consts.PodAnnotationQoSLevelSharedCores, consts.PodAnnotationQoSLevelReclaimedCores,
+			consts.PodAnnotationQoSLevelDedicatedCores, consts.PodAnnotationQoSLevelSystemCores,
+		},
+		CPUServerGetCheckpointMaxAttempts: 3,
+		CPUServerAdviceTraceMaxBytes:      64 << 20,
+		CPUServerAdviceTraceMaxBackups:    3,
+		CPUServerCheckpointCompareMethod:  "bytes",
+		CPUServerPodEntryAssemblyWorkers:  1,
 	}
 }
 
 // AddFlags adds flags to the specified FlagSet.
 func (o *QRMServerOptions) AddFlags(fs *pflag.FlagSet) {
 	fs.StringSliceVar(&o.QRMServers, "qrm-servers", o.QRMServers, "active dimensions for qrm servers")
+	fs.StringSliceVar(&o.CPUServerDeniedControlKnobKeys, "cpu-server-denied-control-knob-keys", o.CPUServerDeniedControlKnobKeys,
+		"control knob keys which will be filtered out of extra entries sent by cpu server, e.g. cpu_numa_headroom")
+	fs.DurationVar(&o.CPUServerPushCycleDeadline, "cpu-server-push-cycle-deadline", o.CPUServerPushCycleDeadline,
+		"hard deadline for a whole push cycle of cpu server, the health check will be not ready if exceeded; 0 means no deadline")
+	fs.BoolVar(&o.CPUServerReportNUMAHeadroomQuantity, "cpu-server-report-numa-headroom-quantity", o.CPUServerReportNUMAHeadroomQuantity,
+		"if set as true, cpu server reports raw quantity of per-numa headroom alongside the float cores")
+	fs.IntVar(&o.CPUServerUpdateContainerRetryBudget, "cpu-server-update-container-retry-budget", o.CPUServerUpdateContainerRetryBudget,
+		"max number of retries for updating container info with transient errors within a single checkpoint sync of cpu server")
+	fs.BoolVar(&o.CPUServerReconnectOnPluginSocketLost, "cpu-server-reconnect-on-plugin-socket-lost", o.CPUServerReconnectOnPluginSocketLost,
+		"if set as true, cpu server recreates the plugin client within ListAndWatch loop once the plugin socket is removed or recreated")
+	fs.DurationVar(&o.CPUServerContainerInfoMaxAge, "cpu-server-container-info-max-age", o.CPUServerContainerInfoMaxAge,
+		"max age of cached container info used in cpu server assembly, stale containers are excluded; 0 means no limit")
+	fs.StringSliceVar(&o.CPUServerExtraPluginSocketAbsPaths, "cpu-server-extra-plugin-socket-abs-paths", o.CPUServerExtraPluginSocketAbsPaths,
+		"extra cpu plugin sockets for cpu server to fan out checkpoint fetching and advice pushing, besides the primary cpu plugin socket")
+	fs.DurationVar(&o.CPUServerSyncFreshnessWindow, "cpu-server-sync-freshness-window", o.CPUServerSyncFreshnessWindow,
+		"max age of the latest successful checkpoint sync for cpu server to push advice, zero means no limit")
+	fs.StringVar(&o.CPUServerHeadroomNUMAKeyFormat, "cpu-server-headroom-numa-key-format", o.CPUServerHeadroomNUMAKeyFormat,
+		"format of numa keys in cpu headroom payload, one of plain, zero-padded and prefixed")
+	fs.IntVar(&o.CPUServerMinReadySuccessCycles, "cpu-server-min-ready-success-cycles", o.CPUServerMinReadySuccessCycles,
+		"number of consecutive successful push cycles required before cpu server ListAndWatch health check reports ready")
+	fs.StringVar(&o.CPUServerAdvicePushWindow, "cpu-server-advice-push-window", o.CPUServerAdvicePushWindow,
+		"daily time window in local time (HH:MM-HH:MM) during which cpu server is allowed to push or return advice, empty means always allowed")
+	fs.IntVar(&o.CPUServerContainerGCCapPerCycle, "cpu-server-container-gc-cap-per-cycle", o.CPUServerContainerGCCapPerCycle,
+		"max number of containers absent from checkpoint deleted by cpu server in a single sync, zero means no limit")
+	fs.BoolVar(&o.CPUServerEnableExplicitCPUList, "cpu-server-enable-explicit-cpu-list", o.CPUServerEnableExplicitCPUList,
+		"negotiate with cpu plugin to carry explicit cpu lists of blocks in advice, besides the default size-based blocks")
+	fs.Float64Var(&o.CPUServerPoolHeadroomDivergenceThreshold, "cpu-server-pool-headroom-divergence-threshold", o.CPUServerPoolHeadroomDivergenceThreshold,
+		"max ratio that the sum of pool sizes and headroom may diverge from the cpu count per numa before it is flagged, zero means disabled")
+	fs.BoolVar(&o.CPUServerSkipPodFetchFailedContainers, "cpu-server-skip-pod-fetch-failed-containers", o.CPUServerSkipPodFetchFailedContainers,
+		"skip assembling containers whose pod failed to be fetched from meta server in the latest checkpoint sync")
+	fs.BoolVar(&o.CPUServerDisableGC, "cpu-server-disable-gc", o.CPUServerDisableGC,
+		"if set, cpu server keeps all containers and pools in meta cache without gc, which leaks memory and is intended for short debugging sessions only")
+	fs.IntVar(&o.CPUServerMaxBlocksPerNUMAPerPool, "cpu-server-max-blocks-per-numa-per-pool", o.CPUServerMaxBlocksPerNUMAPerPool,
+		"max number of blocks a single pool may have on one numa, blocks without overlap targets are merged if it is exceeded, zero means no limit")
+	fs.StringVar(&o.CPUServerAggregatorAddress, "cpu-server-aggregator-address", o.CPUServerAggregatorAddress,
+		"grpc address of the central aggregator that cpu server forwards assembled advice to besides local cpu plugin, empty means disabled")
+	fs.IntVar(&o.CPUServerAggregatorBufferSize, "cpu-server-aggregator-buffer-size", o.CPUServerAggregatorBufferSize,
+		"max number of advice buffered to be forwarded to the aggregator, the oldest one is dropped once it is full")
+	fs.IntVar(&o.CPUServerAggregatorMaxRetries, "cpu-server-aggregator-max-retries", o.CPUServerAggregatorMaxRetries,
+		"max number of retries for forwarding a single advice to the aggregator")
+	fs.BoolVar(&o.CPUServerRefusePushOnReserveReclaimOverlap, "cpu-server-refuse-push-on-reserve-reclaim-overlap", o.CPUServerRefusePushOnReserveReclaimOverlap,
+		"if set, cpu server refuses to push advice once reclaim pool is found overlapping with the exclusive reserve pool")
+	fs.DurationVar(&o.CPUServerAggregateMetricsInterval, "cpu-server-aggregate-metrics-interval", o.CPUServerAggregateMetricsInterval,
+		"min interval for cpu server to emit expensive aggregate metrics (overlap, pool headroom consistency and pool numa distribution), 0 means emitting them in every push")
+	fs.Float64Var(&o.CPUServerMaxHeadroomRatio, "cpu-server-max-headroom-ratio", o.CPUServerMaxHeadroomRatio,
+		"max fraction of node cpus that total reported numa headroom may take, headroom of each numa is scaled down proportionally if exceeded; 0 means no limit")
+	fs.BoolVar(&o.CPUServerEnableTracing, "cpu-server-enable-tracing", o.CPUServerEnableTracing,
+		"if set, cpu server emits opentelemetry spans for each push cycle through the global tracer provider")
+	fs.StringVar(&o.CPUServerEmptyDedicatedAssignmentsPolicy, "cpu-server-empty-dedicated-assignments-policy", o.CPUServerEmptyDedicatedAssignmentsPolicy,
+		"policy to handle dedicated numa binding containers without topology aware assignments, one of skip and fallback-pool")
+	fs.BoolVar(&o.CPUServerMergeIdenticalPoolNUMABlocks, "cpu-server-merge-identical-pool-numa-blocks", o.CPUServerMergeIdenticalPoolNUMABlocks,
+		"if set, blocks of a pool spanning multiple numa nodes identically are merged into a single block without numa affinity")
+	fs.IntVar(&o.CPUServerAdviceInputSnapshotLimit, "cpu-server-advice-input-snapshot-limit", o.CPUServerAdviceInputSnapshotLimit,
+		"number of latest push cycles whose advisor input snapshots (node metrics and region status) are kept for the debug endpoint, 0 means disabled")
+	fs.StringVar(&o.CPUServerOrphanContainerFallbackPool, "cpu-server-orphan-container-fallback-pool", o.CPUServerOrphanContainerFallbackPool,
+		"pool (e.g. share) that shared_cores and reclaimed_cores containers are placed in if their owner pool is gone during assembly, empty means such containers are dropped")
+	fs.BoolVar(&o.CPUServerGCAfterAdvisorUpdate, "cpu-server-gc-after-advisor-update", o.CPUServerGCAfterAdvisorUpdate,
+		"if set, gc of containers and pools synced from checkpoint is deferred until advisor is updated successfully in the same push cycle")
+	fs.StringVar(&o.CPUServerHeadroomUnit, "cpu-server-headroom-unit", o.CPUServerHeadroomUnit,
+		"unit of per-numa headroom values in cpu headroom payload, one of cores and millicores")
+	fs.StringToStringVar(&o.CPUServerPoolSizeUnits, "cpu-server-pool-size-units", o.CPUServerPoolSizeUnits,
+		"units of pool sizes in advisor results keyed by pool name (e.g. share=millicores), one of cores and millicores and default to cores")
+	fs.DurationVar(&o.CPUServerLWWatchdogWindow, "cpu-server-lw-watchdog-window", o.CPUServerLWWatchdogWindow,
+		"max duration without any successful push before cpu server returns from ListAndWatch to force qrm plugin to reconnect, 0 means disabled")
+	fs.DurationVar(&o.CPUServerAbsentPoolCarryForwardWindow, "cpu-server-absent-pool-carry-forward-window", o.CPUServerAbsentPoolCarryForwardWindow,
+		"grace window during which pools cached but absent from advisor result are carried forward at their cached sizes, 0 means such pools are dropped immediately")
+	fs.DurationVar(&o.CPUServerIsolationTransitionMinGap, "cpu-server-isolation-transition-min-gap", o.CPUServerIsolationTransitionMinGap,
+		"min duration a container must stay isolated or non-isolated before the owner-pool switch is reflected in advice, zero means no damping")
+	fs.BoolVar(&o.CPUServerValidateNUMAHeadroomAgainstDedicated, "cpu-server-validate-numa-headroom-against-dedicated", o.CPUServerValidateNUMAHeadroomAgainstDedicated,
+		"if set, check that per-numa headroom plus cpus bound by dedicated containers does not exceed numa capacity")
+	fs.StringVar(&o.CPUServerMetaCacheSnapshotPath, "cpu-server-metacache-snapshot-path", o.CPUServerMetaCacheSnapshotPath,
+		"file that compact snapshots of pools and containers in meta cache are written to periodically and loaded from at startup, empty means snapshots are disabled")
+	fs.DurationVar(&o.CPUServerMetaCacheSnapshotInterval, "cpu-server-metacache-snapshot-interval", o.CPUServerMetaCacheSnapshotInterval,
+		"interval of writing meta cache snapshots")
+	fs.DurationVar(&o.CPUServerMetaCacheSnapshotMaxAge, "cpu-server-metacache-snapshot-max-age", o.CPUServerMetaCacheSnapshotMaxAge,
+		"max age of a meta cache snapshot to be trusted at startup")
+	fs.StringToIntVar(&o.CPUServerPoolOverlapPriorities, "cpu-server-pool-overlap-priorities", o.CPUServerPoolOverlapPriorities,
+		"priorities of shared pools keyed by pool name when reclaim overlaps them, and reclaim overlaps lower-priority pools first; pools not listed are of priority zero")
+	fs.BoolVar(&o.CPUServerReportCPUManagerPolicy, "cpu-server-report-cpu-manager-policy", o.CPUServerReportCPUManagerPolicy,
+		"if set, report the effective kubelet cpu manager policy in advice")
+	fs.StringToIntVar(&o.CPUServerContainerMinCPUFloors, "cpu-server-container-min-cpu-floors", o.CPUServerContainerMinCPUFloors,
+		"min cpus in cores that containers of each qos level keep in assembly, and the pool (or dedicated pod) a container is placed in is clamped up to the floor if it is sized below")
+	fs.StringVar(&o.CPUServerAdviceAuditLogPath, "cpu-server-advice-audit-log-path", o.CPUServerAdviceAuditLogPath,
+		"file that change events between consecutively pushed advice are appended to as json lines, empty means audit is disabled")
+	fs.DurationVar(&o.CPUServerDrainTimeout, "cpu-server-drain-timeout", o.CPUServerDrainTimeout,
+		"timeout of the last advice push of ListAndWatch loop when cpu server stops, zero means the loop exits without draining")
+	fs.IntVar(&o.CPUServerReclaimPoolMaxShrinkPerCycle, "cpu-server-reclaim-pool-max-shrink-per-cycle", o.CPUServerReclaimPoolMaxShrinkPerCycle,
+		"max cpus in cores that reclaim pool may shrink on each numa in a single push, zero means no limit")
+	fs.DurationVar(&o.CPUServerPluginDialBackoffInitialInterval, "cpu-server-plugin-dial-backoff-initial-interval", o.CPUServerPluginDialBackoffInitialInterval,
+		"initial interval to retry dialing cpu plugin socket, and it doubles after each failure until capped at sync period")
+	fs.DurationVar(&o.CPUServerPluginDialBackoffMaxElapsedTime, "cpu-server-plugin-dial-backoff-max-elapsed-time", o.CPUServerPluginDialBackoffMaxElapsedTime,
+		"max elapsed time to retry dialing cpu plugin socket before ListAndWatch gives up, zero means no retry")
+	fs.DurationVar(&o.CPUServerGetPodTimeout, "cpu-server-get-pod-timeout", o.CPUServerGetPodTimeout,
+		"timeout to get each pod from meta server in checkpoint sync, and the pod is handled as failed to be fetched on timeout; zero means no timeout")
+	fs.IntVar(&o.CPUServerPoolStabilityWindow, "cpu-server-pool-stability-window", o.CPUServerPoolStabilityWindow,
+		"number of latest cycles over which the stability score of each pool is computed from changes of its numa distribution, zero means the score is disabled")
+	fs.StringVar(&o.CPUServerEmptyReclaimBlocksPolicy, "cpu-server-empty-reclaim-blocks-policy", o.CPUServerEmptyReclaimBlocksPolicy,
+		"policy to represent reclaim pool on numa nodes without reclaim capacity, one of keep (zero-size blocks are kept), omit (zero-size blocks and numa results left without blocks are dropped) and empty-marker (zero-size blocks are dropped, and numa results without blocks are kept as an explicit empty marker)")
+	fs.DurationVar(&o.CPUServerStartUpPeriod, "cpu-server-start-up-period", o.CPUServerStartUpPeriod,
+		"the duration after startup during which pushing advice is skipped, zero means no skipping")
+	fs.StringSliceVar(&o.CPUServerReclaimDisablingNodeConditions, "cpu-server-reclaim-disabling-node-conditions", o.CPUServerReclaimDisablingNodeConditions,
+		"node condition types under which overlap between reclaim pool and others is turned off, e.g. MemoryPressure")
+	fs.DurationVar(&o.CPUServerCallTimeout, "cpu-server-call-timeout", o.CPUServerCallTimeout,
+		"the timeout of each GetCheckpoint call to cpu plugins and each advisor update, zero means no timeout")
+	fs.DurationVar(&o.CPUServerContainerSettleDelay, "cpu-server-container-settle-delay", o.CPUServerContainerSettleDelay,
+		"the min duration since a container is first seen before it is assembled, and unsettled containers fall back to the defaults of the qrm plugin; zero means no delay")
+	fs.Float64Var(&o.CPUServerSuspectCheckpointDropRatio, "cpu-server-suspect-checkpoint-drop-ratio", o.CPUServerSuspectCheckpointDropRatio,
+		"the max ratio that the number of containers in a checkpoint may drop versus the previous one, beyond which gc of containers and pools is skipped for the checkpoint; zero means no check")
+	fs.BoolVar(&o.CPUServerStrictAssembly, "cpu-server-strict-assembly", o.CPUServerStrictAssembly,
+		"if set, pushing advice is aborted on any inconsistency found in assembly, e.g. containers referring to missing or empty owner pools; otherwise inconsistent entries are skipped")
+	fs.BoolVar(&o.CPUServerDryRun, "cpu-server-dry-run", o.CPUServerDryRun,
+		"if set, advice is computed, logged and reported in metrics but never sent to cpu plugins, which keep their current allocation; checkpoint is still synced")
+	fs.BoolVar(&o.CPUServerGateGetAdvice, "cpu-server-gate-get-advice", o.CPUServerGateGetAdvice,
+		"if set, GetAdvice is subject to the same gates (e.g. startup period and reserve pool coverage), dry-run mode and post-processing (e.g. response hooks, audit and persistence) as ListAndWatch; otherwise GetAdvice answers with the advisor result whenever it is within the push window")
+	fs.StringSliceVar(&o.CPUServerImmutableQoSLevels, "cpu-server-immutable-qos-levels", o.CPUServerImmutableQoSLevels,
+		"qos levels that containers are not allowed to change to or from during their lifetime, e.g. dedicated_cores; such changes are rejected and the previous qos level is kept")
+	fs.StringVar(&o.CPUServerSecondaryPluginSocketAbsPath, "cpu-server-secondary-plugin-socket-abs-path", o.CPUServerSecondaryPluginSocketAbsPath,
+		"the socket of a canary cpu plugin to observe side by side, whose checkpoint is never synced into meta cache; disabled if empty")
+	fs.BoolVar(&o.CPUServerDeterministicBlockIDs, "cpu-server-deterministic-block-ids", o.CPUServerDeterministicBlockIDs,
+		"if set, block ids are derived from the owner, numa and size of blocks instead of random uuids, so that they are stable cycle-to-cycle")
+	fs.IntVar(&o.CPUServerReservePoolMinNUMACoverage, "cpu-server-reserve-pool-min-numa-coverage", o.CPUServerReservePoolMinNUMACoverage,
+		"minimum number of numas with non-empty cpus the reserve pool must cover for advice to be pushed, and 0 only requires the reserve pool to exist")
+	fs.Float64Var(&o.QRMServerPeriodJitterFactor, "qrm-server-period-jitter-factor", o.QRMServerPeriodJitterFactor,
+		"max fraction of period randomly added to each ListAndWatch cycle of qrm servers to spread out advisor runs, and non-positive disables jitter")
+	fs.BoolVar(&o.CPUServerPersistLastAdvice, "cpu-server-persist-last-advice", o.CPUServerPersistLastAdvice,
+		"if set, the last advice sent by ListAndWatch is persisted under the state file directory, and re-sent once the first loop after restart starts")
+	fs.DurationVar(&o.CPUServerLastAdviceMaxAge, "cpu-server-last-advice-max-age", o.CPUServerLastAdviceMaxAge,
+		"max age of persisted advice to be re-sent after restart, and 0 means no limit")
+	fs.BoolVar(&o.CPUServerDiscountOverlappedHeadroom, "cpu-server-discount-overlapped-headroom", o.CPUServerDiscountOverlappedHeadroom,
+		"if set, cores of shared pools overlapped by reclaim pool are discounted from reported numa headroom")
+	fs.StringSliceVar(&o.CPUServerManagedQoSLevels, "cpu-server-managed-qos-levels", o.CPUServerManagedQoSLevels,
+		"qos levels whose containers are assembled into advice, and containers of other qos levels are left out; empty means all qos levels are managed")
+	fs.IntVar(&o.CPUServerMaxPoolMissingContainers, "cpu-server-max-pool-missing-containers", o.CPUServerMaxPoolMissingContainers,
+		"max number of containers referring to empty or missing owner pools in a single assembly, above which the cycle fails; 0 means no limit")
+	fs.IntVar(&o.CPUServerGetCheckpointMaxAttempts, "cpu-server-get-checkpoint-max-attempts", o.CPUServerGetCheckpointMaxAttempts,
+		"max number of GetCheckpoint calls to each cpu plugin within a single cycle, retried while the checkpoint is nil or empty")
+	fs.DurationVar(&o.CPUServerLWSendTimeout, "cpu-server-lw-send-timeout", o.CPUServerLWSendTimeout,
+		"the timeout of each Send of ListAndWatch response to a stream, after which the stream is regarded as broken; 0 means no timeout")
+	fs.IntVar(&o.CPUServerLWChunkMaxEntries, "cpu-server-lw-chunk-max-entries", o.CPUServerLWChunkMaxEntries,
+		"max number of entries in a single Send of ListAndWatch response, and larger responses are split into chunks for plugins negotiated to reassemble them; 0 means never split")
+	fs.BoolVar(&o.CPUServerEmitReclaimOverlapMetrics, "cpu-server-emit-reclaim-overlap-metrics", o.CPUServerEmitReclaimOverlapMetrics,
+		"if set, the size of overlap between reclaim pool and each shared pool on each numa is emitted along with each sent advice")
+	fs.IntVar(&o.CPUServerReclaimPoolMinCoresPerNUMA, "cpu-server-reclaim-pool-min-cores-per-numa", o.CPUServerReclaimPoolMinCoresPerNUMA,
+		"the min size in cores of reclaim pool on each numa, borrowed from shared pools if necessary, zero means no floor")
+	fs.Float64Var(&o.CPUServerReclaimPoolMinRatioPerNUMA, "cpu-server-reclaim-pool-min-ratio-per-numa", o.CPUServerReclaimPoolMinRatioPerNUMA,
+		"the min size of reclaim pool on each numa as a fraction of numa cpus, the larger one of it and the min cores takes effect")
+	fs.StringVar(&o.CPUServerAdviceTracePath, "cpu-server-advice-trace-path", o.CPUServerAdviceTracePath,
+		"the file each assembled ListAndWatch response is appended to along with its inputs, empty means disabled")
+	fs.Int64Var(&o.CPUServerAdviceTraceMaxBytes, "cpu-server-advice-trace-max-bytes", o.CPUServerAdviceTraceMaxBytes,
+		"the max size in bytes of the advice trace file, above which it is rotated")
+	fs.IntVar(&o.CPUServerAdviceTraceMaxBackups, "cpu-server-advice-trace-max-backups", o.CPUServerAdviceTraceMaxBackups,
+		"the max number of rotated advice trace files kept")
+	fs.BoolVar(&o.CPUServerAdviceTraceHashPodUIDs, "cpu-server-advice-trace-hash-pod-uids", o.CPUServerAdviceTraceHashPodUIDs,
+		"if set, pod uids in advice traces are replaced with their hashes")
+	fs.IntVar(&o.CPUServerCheckpointFrozenCycles, "cpu-server-checkpoint-frozen-cycles", o.CPUServerCheckpointFrozenCycles,
+		"the max number of consecutive cycles with an unchanged checkpoint despite pod churn before the plugin is regarded as frozen, zero means disabled")
+	fs.StringVar(&o.CPUServerCheckpointCompareMethod, "cpu-server-checkpoint-compare-method", o.CPUServerCheckpointCompareMethod,
+		"the method to tell whether checkpoints of consecutive cycles are unchanged, one of bytes and entries")
+	fs.IntVar(&o.CPUServerPodEntryAssemblyWorkers, "cpu-server-pod-entry-assembly-workers", o.CPUServerPodEntryAssemblyWorkers,
+		"the number of workers assembling entries of dedicated numa binding pods in parallel, one means serial")
 }
 
 // ApplyTo fills up config with options
 func (o *QRMServerOptions) ApplyTo(c *server.QRMServerConfiguration) error {
 	c.QRMServers = o.QRMServers
+	c.CPUServerDeniedControlKnobKeys = o.CPUServerDeniedControlKnobKeys
+	c.CPUServerPushCycleDeadline = o.CPUServerPushCycleDeadline
+	c.CPUServerReportNUMAHeadroomQuantity = o.CPUServerReportNUMAHeadroomQuantity
+	c.CPUServerUpdateContainerRetryBudget = o.CPUServerUpdateContainerRetryBudget
+	c.CPUServerReconnectOnPluginSocketLost = o.CPUServerReconnectOnPluginSocketLost
+	c.CPUServerContainerInfoMaxAge = o.CPUServerContainerInfoMaxAge
+	c.CPUServerExtraPluginSocketAbsPaths = o.CPUServerExtraPluginSocketAbsPaths
+	c.CPUServerSyncFreshnessWindow = o.CPUServerSyncFreshnessWindow
+	c.CPUServerHeadroomNUMAKeyFormat = o.CPUServerHeadroomNUMAKeyFormat
+	c.CPUServerMinReadySuccessCycles = o.CPUServerMinReadySuccessCycles
+	c.CPUServerAdvicePushWindow = o.CPUServerAdvicePushWindow
+	c.CPUServerContainerGCCapPerCycle = o.CPUServerContainerGCCapPerCycle
+	c.CPUServerEnableExplicitCPUList = o.CPUServerEnableExplicitCPUList
+	c.CPUServerPoolHeadroomDivergenceThreshold = o.CPUServerPoolHeadroomDivergenceThreshold
+	c.CPUServerSkipPodFetchFailedContainers = o.CPUServerSkipPodFetchFailedContainers
+	c.CPUServerDisableGC = o.CPUServerDisableGC
+	c.CPUServerMaxBlocksPerNUMAPerPool = o.CPUServerMaxBlocksPerNUMAPerPool
+	c.CPUServerAggregatorAddress = o.CPUServerAggregatorAddress
+	c.CPUServerAggregatorBufferSize = o.CPUServerAggregatorBufferSize
+	c.CPUServerAggregatorMaxRetries = o.CPUServerAggregatorMaxRetries
+	c.CPUServerRefusePushOnReserveReclaimOverlap = o.CPUServerRefusePushOnReserveReclaimOverlap
+	c.CPUServerAggregateMetricsInterval = o.CPUServerAggregateMetricsInterval
+	c.CPUServerMaxHeadroomRatio = o.CPUServerMaxHeadroomRatio
+	c.CPUServerEnableTracing = o.CPUServerEnableTracing
+	c.CPUServerEmptyDedicatedAssignmentsPolicy = o.CPUServerEmptyDedicatedAssignmentsPolicy
+	c.CPUServerMergeIdenticalPoolNUMABlocks = o.CPUServerMergeIdenticalPoolNUMABlocks
+	c.CPUServerAdviceInputSnapshotLimit = o.CPUServerAdviceInputSnapshotLimit
+	c.CPUServerOrphanContainerFallbackPool = o.CPUServerOrphanContainerFallbackPool
+	c.CPUServerGCAfterAdvisorUpdate = o.CPUServerGCAfterAdvisorUpdate
+	c.CPUServerHeadroomUnit = o.CPUServerHeadroomUnit
+	c.CPUServerPoolSizeUnits = o.CPUServerPoolSizeUnits
+	c.CPUServerLWWatchdogWindow = o.CPUServerLWWatchdogWindow
+	c.CPUServerAbsentPoolCarryForwardWindow = o.CPUServerAbsentPoolCarryForwardWindow
+	c.CPUServerIsolationTransitionMinGap = o.CPUServerIsolationTransitionMinGap
+	c.CPUServerValidateNUMAHeadroomAgainstDedicated = o.CPUServerValidateNUMAHeadroomAgainstDedicated
+	c.CPUServerMetaCacheSnapshotPath = o.CPUServerMetaCacheSnapshotPath
+	c.CPUServerMetaCacheSnapshotInterval = o.CPUServerMetaCacheSnapshotInterval
+	c.CPUServerMetaCacheSnapshotMaxAge = o.CPUServerMetaCacheSnapshotMaxAge
+	c.CPUServerPoolOverlapPriorities = o.CPUServerPoolOverlapPriorities
+	c.CPUServerReportCPUManagerPolicy = o.CPUServerReportCPUManagerPolicy
+	c.CPUServerContainerMinCPUFloors = o.CPUServerContainerMinCPUFloors
+	c.CPUServerAdviceAuditLogPath = o.CPUServerAdviceAuditLogPath
+	c.CPUServerDrainTimeout = o.CPUServerDrainTimeout
+	c.CPUServerReclaimPoolMaxShrinkPerCycle = o.CPUServerReclaimPoolMaxShrinkPerCycle
+	c.CPUServerPluginDialBackoffInitialInterval = o.CPUServerPluginDialBackoffInitialInterval
+	c.CPUServerPluginDialBackoffMaxElapsedTime = o.CPUServerPluginDialBackoffMaxElapsedTime
+	c.CPUServerGetPodTimeout = o.CPUServerGetPodTimeout
+	c.CPUServerPoolStabilityWindow = o.CPUServerPoolStabilityWindow
+	c.CPUServerEmptyReclaimBlocksPolicy = o.CPUServerEmptyReclaimBlocksPolicy
+	c.CPUServerStartUpPeriod = o.CPUServerStartUpPeriod
+	c.CPUServerReclaimDisablingNodeConditions = o.CPUServerReclaimDisablingNodeConditions
+	c.CPUServerCallTimeout = o.CPUServerCallTimeout
+	c.CPUServerContainerSettleDelay = o.CPUServerContainerSettleDelay
+	c.CPUServerSuspectCheckpointDropRatio = o.CPUServerSuspectCheckpointDropRatio
+	c.CPUServerStrictAssembly = o.CPUServerStrictAssembly
+	c.CPUServerDryRun = o.CPUServerDryRun
+	c.CPUServerGateGetAdvice = o.CPUServerGateGetAdvice
+	c.CPUServerImmutableQoSLevels = o.CPUServerImmutableQoSLevels
+	c.CPUServerSecondaryPluginSocketAbsPath = o.CPUServerSecondaryPluginSocketAbsPath
+	c.CPUServerDeterministicBlockIDs = o.CPUServerDeterministicBlockIDs
+	c.CPUServerReservePoolMinNUMACoverage = o.CPUServerReservePoolMinNUMACoverage
+	c.QRMServerPeriodJitterFactor = o.QRMServerPeriodJitterFactor
+	c.CPUServerPersistLastAdvice = o.CPUServerPersistLastAdvice
+	c.CPUServerLastAdviceMaxAge = o.CPUServerLastAdviceMaxAge
+	c.CPUServerDiscountOverlappedHeadroom = o.CPUServerDiscountOverlappedHeadroom
+	c.CPUServerManagedQoSLevels = o.CPUServerManagedQoSLevels
+	c.CPUServerMaxPoolMissingContainers = o.CPUServerMaxPoolMissingContainers
+	c.CPUServerGetCheckpointMaxAttempts = o.CPUServerGetCheckpointMaxAttempts
+	c.CPUServerLWSendTimeout = o.CPUServerLWSendTimeout
+	c.CPUServerLWChunkMaxEntries = o.CPUServerLWChunkMaxEntries
+	c.CPUServerEmitReclaimOverlapMetrics = o.CPUServerEmitReclaimOverlapMetrics
+	c.CPUServerReclaimPoolMinCoresPerNUMA = o.CPUServerReclaimPoolMinCoresPerNUMA
+	c.CPUServerReclaimPoolMinRatioPerNUMA = o.CPUServerReclaimPoolMinRatioPerNUMA
+	c.CPUServerAdviceTracePath = o.CPUServerAdviceTracePath
+	c.CPUServerAdviceTraceMaxBytes = o.CPUServerAdviceTraceMaxBytes
+	c.CPUServerAdviceTraceMaxBackups = o.CPUServerAdviceTraceMaxBackups
+	c.CPUServerAdviceTraceHashPodUIDs = o.CPUServerAdviceTraceHashPodUIDs
+	c.CPUServerCheckpointFrozenCycles = o.CPUServerCheckpointFrozenCycles
+	c.CPUServerCheckpointCompareMethod = o.CPUServerCheckpointCompareMethod
+	c.CPUServerPodEntryAssemblyWorkers = o.CPUServerPodEntryAssemblyWorkers
 	return nil
 }
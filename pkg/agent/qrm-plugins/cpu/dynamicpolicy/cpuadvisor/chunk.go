@@ -0,0 +1,139 @@
+/*
+Copyright 2022 The Katalyst Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cpuadvisor
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/kubewharf/katalyst-core/pkg/agent/qrm-plugins/advisorsvc"
+)
+
+// SplitListAndWatchResponse splits entries of the response into chunks of at most maxEntries entries each,
+// in the order of entry names; all chunks carry ControlKnobKeyListAndWatchChunk, and extra entries are carried
+// by the last one only. The response itself is returned if no split is needed. Receivers must be able to
+// reassemble chunks, which is negotiated by feature gate before splitting.
+func SplitListAndWatchResponse(resp *ListAndWatchResponse, maxEntries int) []*ListAndWatchResponse {
+	if resp == nil || maxEntries <= 0 || len(resp.Entries) <= maxEntries {
+		return []*ListAndWatchResponse{resp}
+	}
+
+	entryNames := make([]string, 0, len(resp.Entries))
+	for entryName := range resp.Entries {
+		entryNames = append(entryNames, entryName)
+	}
+	sort.Strings(entryNames)
+
+	total := (len(entryNames) + maxEntries - 1) / maxEntries
+	chunks := make([]*ListAndWatchResponse, 0, total)
+	for start := 0; start < len(entryNames); start += maxEntries {
+		end := start + maxEntries
+		if end > len(entryNames) {
+			end = len(entryNames)
+		}
+
+		chunk := &ListAndWatchResponse{
+			Entries:                               make(map[string]*CalculationEntries, end-start),
+			AllowSharedCoresOverlapReclaimedCores: resp.AllowSharedCoresOverlapReclaimedCores,
+		}
+		for _, entryName := range entryNames[start:end] {
+			chunk.Entries[entryName] = resp.Entries[entryName]
+		}
+		if end == len(entryNames) {
+			chunk.ExtraEntries = append(chunk.ExtraEntries, resp.ExtraEntries...)
+		}
+		chunk.ExtraEntries = append(chunk.ExtraEntries, &advisorsvc.CalculationInfo{
+			CalculationResult: &advisorsvc.CalculationResult{
+				Values: map[string]string{string(ControlKnobKeyListAndWatchChunk): fmt.Sprintf("%d/%d", len(chunks)+1, total)},
+			},
+		})
+		chunks = append(chunks, chunk)
+	}
+	return chunks
+}
+
+// GetChunkIndex returns the 1-based index of the chunk and the total number of chunks of the same response,
+// and ok is false if the response is not a chunk
+func (lwr *ListAndWatchResponse) GetChunkIndex() (index, total int, ok bool) {
+	if lwr == nil {
+		return 0, 0, false
+	}
+
+	for _, extraEntry := range lwr.ExtraEntries {
+		value, found := extraEntry.GetCalculationResult().GetValues()[string(ControlKnobKeyListAndWatchChunk)]
+		if !found {
+			continue
+		}
+		if _, err := fmt.Sscanf(value, "%d/%d", &index, &total); err != nil || index < 1 || index > total {
+			return 0, 0, false
+		}
+		return index, total, true
+	}
+	return 0, 0, false
+}
+
+// ListAndWatchResponseAssembler reassembles chunks split by SplitListAndWatchResponse, and responses
+// which are not split are passed through as is
+type ListAndWatchResponseAssembler struct {
+	pending *ListAndWatchResponse
+	// next is the index of the chunk expected next, and total is the number of chunks of the pending response
+	next  int
+	total int
+}
+
+// Add adds a received response, and returns the reassembled response once the last chunk is added. A pending
+// response is dropped once a new response starts or a chunk arrives out of order, since the sender may give up
+// a response halfway, and its chunks are never merged into another response.
+func (a *ListAndWatchResponseAssembler) Add(resp *ListAndWatchResponse) (*ListAndWatchResponse, bool) {
+	index, total, ok := resp.GetChunkIndex()
+	if !ok {
+		a.reset()
+		return resp, true
+	}
+
+	if index == 1 {
+		a.pending = &ListAndWatchResponse{Entries: make(map[string]*CalculationEntries)}
+		a.next, a.total = 1, total
+	}
+	if a.pending == nil || index != a.next || total != a.total {
+		a.reset()
+		return nil, false
+	}
+
+	for entryName, entry := range resp.GetEntries() {
+		a.pending.Entries[entryName] = entry
+	}
+	a.next++
+	if index < total {
+		return nil, false
+	}
+
+	assembled := a.pending
+	assembled.AllowSharedCoresOverlapReclaimedCores = resp.AllowSharedCoresOverlapReclaimedCores
+	for _, extraEntry := range resp.ExtraEntries {
+		if _, found := extraEntry.GetCalculationResult().GetValues()[string(ControlKnobKeyListAndWatchChunk)]; !found {
+			assembled.ExtraEntries = append(assembled.ExtraEntries, extraEntry)
+		}
+	}
+	a.reset()
+	return assembled, true
+}
+
+func (a *ListAndWatchResponseAssembler) reset() {
+	a.pending = nil
+	a.next, a.total = 0, 0
+}
@@ -0,0 +1,96 @@
+/*
+Copyright 2022 The Katalyst Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cpuadvisor
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kubewharf/katalyst-core/pkg/agent/qrm-plugins/advisorsvc"
+)
+
+func newTestListAndWatchResponse(entryNames ...string) *ListAndWatchResponse {
+	resp := &ListAndWatchResponse{
+		Entries:                               map[string]*CalculationEntries{},
+		AllowSharedCoresOverlapReclaimedCores: true,
+		ExtraEntries: []*advisorsvc.CalculationInfo{{
+			CalculationResult: &advisorsvc.CalculationResult{
+				Values: map[string]string{string(ControlKnobKeyCPUManagerPolicy): "static"},
+			},
+		}},
+	}
+	for _, entryName := range entryNames {
+		resp.Entries[entryName] = &CalculationEntries{
+			Entries: map[string]*CalculationInfo{"c1": {OwnerPoolName: entryName}},
+		}
+	}
+	return resp
+}
+
+func TestListAndWatchResponseAssembler(t *testing.T) {
+	t.Parallel()
+
+	first := newTestListAndWatchResponse("pod1", "pod2", "pod3", "pod4", "pod5")
+	firstChunks := SplitListAndWatchResponse(first, 2)
+	require.Len(t, firstChunks, 3)
+	for i, chunk := range firstChunks {
+		index, total, ok := chunk.GetChunkIndex()
+		require.True(t, ok)
+		require.Equal(t, i+1, index)
+		require.Equal(t, 3, total)
+	}
+
+	// chunks are reassembled into the original response
+	assembler := &ListAndWatchResponseAssembler{}
+	for i, chunk := range firstChunks {
+		assembled, ok := assembler.Add(chunk)
+		require.Equal(t, i == 2, ok, i)
+		if ok {
+			require.Equal(t, first.String(), assembled.String())
+		}
+	}
+
+	// a response given up halfway is dropped once the next one starts, never merged into it
+	second := newTestListAndWatchResponse("pod6", "pod7", "pod8")
+	secondChunks := SplitListAndWatchResponse(second, 2)
+	_, ok := assembler.Add(firstChunks[0])
+	require.False(t, ok)
+	_, ok = assembler.Add(secondChunks[0])
+	require.False(t, ok)
+	assembled, ok := assembler.Add(secondChunks[1])
+	require.True(t, ok)
+	require.Equal(t, second.String(), assembled.String())
+
+	// chunks out of order are dropped along with the pending response
+	_, ok = assembler.Add(firstChunks[0])
+	require.False(t, ok)
+	_, ok = assembler.Add(firstChunks[2])
+	require.False(t, ok)
+	_, ok = assembler.Add(firstChunks[1])
+	require.False(t, ok)
+
+	// a response which is not split is passed through, and drops the pending one
+	_, ok = assembler.Add(firstChunks[0])
+	require.False(t, ok)
+	whole := newTestListAndWatchResponse("pod1")
+	assembled, ok = assembler.Add(whole)
+	require.True(t, ok)
+	require.Same(t, whole, assembled)
+	_, ok = assembler.Add(firstChunks[1])
+	require.False(t, ok)
+}
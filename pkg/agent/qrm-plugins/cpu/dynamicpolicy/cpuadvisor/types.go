@@ -16,11 +16,99 @@ limitations under the License.
 
 package cpuadvisor
 
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
 type CPUControlKnobName string
 
 const (
-	ControlKnobKeyCPUNUMAHeadroom CPUControlKnobName = "cpu_numa_headroom"
-	ControlKnobKeyCgroupConfig    CPUControlKnobName = "cgroup_config"
+	ControlKnobKeyCPUNUMAHeadroom          CPUControlKnobName = "cpu_numa_headroom"
+	ControlKnobKeyCPUNUMAHeadroomQuantity  CPUControlKnobName = "cpu_numa_headroom_quantity"
+	ControlKnobKeyCPUNUMAHeadroomTimestamp CPUControlKnobName = "cpu_numa_headroom_timestamp"
+	ControlKnobKeyCgroupConfig             CPUControlKnobName = "cgroup_config"
+	ControlKnobKeyCPUBlockCPUList          CPUControlKnobName = "cpu_block_cpu_list"
+	// ControlKnobKeyCPUBlockProvenance carries which region and provision policy produced each pool block,
+	// it is informational and ignored by cpu plugin
+	ControlKnobKeyCPUBlockProvenance CPUControlKnobName = "cpu_block_provenance"
+	// ControlKnobKeyCPUManagerPolicy carries the effective kubelet cpu manager policy as a plain string
+	ControlKnobKeyCPUManagerPolicy CPUControlKnobName = "cpu_manager_policy"
+	// ControlKnobKeyCPUNodeHeadroom carries the sum of per-numa headroom as a plain float,
+	// in the same unit as ControlKnobKeyCPUNUMAHeadroom
+	ControlKnobKeyCPUNodeHeadroom CPUControlKnobName = "cpu_node_headroom"
+	// ControlKnobKeyListAndWatchChunk marks a chunk of ListAndWatchResponse with its 1-based index and the total
+	// number of chunks of the same response, e.g. "2/3", and it is carried by all chunks of a split response
+	ControlKnobKeyListAndWatchChunk CPUControlKnobName = "list_and_watch_chunk"
 )
 
 type CPUNUMAHeadroom map[int]float64
+
+// UnmarshalJSON decodes per-numa headroom with numa keys in any NUMAKeyFormat
+func (h *CPUNUMAHeadroom) UnmarshalJSON(data []byte) error {
+	raw := make(map[string]float64)
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	headroom := make(CPUNUMAHeadroom, len(raw))
+	for key, value := range raw {
+		numaID, err := ParseNUMAKey(key)
+		if err != nil {
+			return err
+		}
+		headroom[numaID] = value
+	}
+	*h = headroom
+	return nil
+}
+
+// CPUNUMAHeadroomQuantity stores the raw resource.Quantity string of per-numa headroom
+type CPUNUMAHeadroomQuantity map[int]string
+
+// CPUNUMAHeadroomTimestamp stores the unix time in milliseconds when per-numa headroom is computed,
+// so that stale headroom can be detected
+type CPUNUMAHeadroomTimestamp map[int]int64
+
+// CPUBlockCPUList stores the explicit cpu list (e.g. "0-3,8") of each block, keyed by block id
+type CPUBlockCPUList map[string]string
+
+// CPUBlockProvenance stores the provenance (e.g. "share/canonical") of each pool block, keyed by block id
+type CPUBlockProvenance map[string]string
+
+// NUMAKeyFormat is the format of numa keys in the json payload of per-numa headroom
+type NUMAKeyFormat string
+
+const (
+	// NUMAKeyFormatPlain formats numa keys as plain integers, e.g. "1"
+	NUMAKeyFormatPlain NUMAKeyFormat = "plain"
+	// NUMAKeyFormatZeroPadded formats numa keys as integers zero-padded to two digits, e.g. "01"
+	NUMAKeyFormatZeroPadded NUMAKeyFormat = "zero-padded"
+	// NUMAKeyFormatPrefixed formats numa keys as integers prefixed with "numa", e.g. "numa1"
+	NUMAKeyFormatPrefixed NUMAKeyFormat = "prefixed"
+)
+
+// FormatNUMAKey formats the numa id as a json key according to the given format
+func FormatNUMAKey(format NUMAKeyFormat, numaID int) (string, error) {
+	switch format {
+	case NUMAKeyFormatPlain, "":
+		return strconv.Itoa(numaID), nil
+	case NUMAKeyFormatZeroPadded:
+		return fmt.Sprintf("%02d", numaID), nil
+	case NUMAKeyFormatPrefixed:
+		return fmt.Sprintf("numa%d", numaID), nil
+	default:
+		return "", fmt.Errorf("unknown numa key format: %s", format)
+	}
+}
+
+// ParseNUMAKey parses the numa id from a json key formatted in any NUMAKeyFormat
+func ParseNUMAKey(key string) (int, error) {
+	numaID, err := strconv.Atoi(strings.TrimPrefix(key, "numa"))
+	if err != nil {
+		return 0, fmt.Errorf("invalid numa key %q: %v", key, err)
+	}
+	return numaID, nil
+}
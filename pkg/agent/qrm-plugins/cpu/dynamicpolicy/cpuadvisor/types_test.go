@@ -0,0 +1,47 @@
+/*
+Copyright 2022 The Katalyst Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cpuadvisor
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCPUNUMAHeadroomNUMAKeyFormats(t *testing.T) {
+	t.Parallel()
+
+	for _, format := range []NUMAKeyFormat{NUMAKeyFormatPlain, NUMAKeyFormatZeroPadded, NUMAKeyFormatPrefixed} {
+		raw := make(map[string]float64)
+		for numaID, value := range map[int]float64{0: 1.5, 1: 2, 12: 3} {
+			key, err := FormatNUMAKey(format, numaID)
+			require.NoError(t, err)
+			raw[key] = value
+		}
+		data, err := json.Marshal(raw)
+		require.NoError(t, err)
+
+		// headroom formatted by sys-advisor is parsed back by cpu plugin in any format
+		headroom := CPUNUMAHeadroom{}
+		require.NoError(t, json.Unmarshal(data, &headroom), format)
+		require.Equal(t, CPUNUMAHeadroom{0: 1.5, 1: 2, 12: 3}, headroom, format)
+	}
+
+	headroom := CPUNUMAHeadroom{}
+	require.Error(t, json.Unmarshal([]byte(`{"node1": 1}`), &headroom))
+}
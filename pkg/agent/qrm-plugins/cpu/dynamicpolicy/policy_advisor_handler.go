@@ -48,6 +48,7 @@ import (
 	"github.com/kubewharf/katalyst-core/pkg/agent/qrm-plugins/util"
 	"github.com/kubewharf/katalyst-core/pkg/agent/utilcomponent/featuregatenegotiation"
 	"github.com/kubewharf/katalyst-core/pkg/agent/utilcomponent/featuregatenegotiation/finders"
+	"github.com/kubewharf/katalyst-core/pkg/agent/utilcomponent/featuregatenegotiation/finders/feature_cpu"
 	"github.com/kubewharf/katalyst-core/pkg/metrics"
 	"github.com/kubewharf/katalyst-core/pkg/util/cgroup/common"
 	cgroupmgr "github.com/kubewharf/katalyst-core/pkg/util/cgroup/manager"
@@ -430,18 +431,34 @@ func (p *DynamicPolicy) lwCPUAdvisorServer(stopCh <-chan struct{}) error {
 		cancel()
 	}()
 
+	// ListAndWatch has no request to carry wanted feature gates, so those applicable to it are carried by metadata
+	if !lo.IsNil(p.featureGateManager) {
+		wantedFeatureGates, err := p.featureGateManager.GetWantedFeatureGates(finders.FeatureGateTypeCPU)
+		if err != nil {
+			return fmt.Errorf("get wanted feature gates failed with error: %v", err)
+		}
+		ctx = featuregatenegotiation.AppendWantedFeatureGatesToOutgoingContext(ctx,
+			lo.PickByKeys(wantedFeatureGates, []string{feature_cpu.NegotiationFeatureGateListAndWatchChunk}))
+	}
+
 	stream, err := p.advisorClient.ListAndWatch(ctx, &advisorsvc.Empty{})
 	if err != nil {
 		return fmt.Errorf("call ListAndWatch of CPUAdvisorServer failed with error: %v", err)
 	}
 
+	// large responses may be split into chunks by cpu advisor once negotiated, which are reassembled before allocation
+	assembler := &advisorapi.ListAndWatchResponseAssembler{}
 	for {
-		resp, err := stream.Recv()
+		chunk, err := stream.Recv()
 		if err != nil {
 			_ = p.emitter.StoreInt64(util.MetricNameLWAdvisorServerFailed, 1, metrics.MetricTypeNameRaw)
 			return fmt.Errorf("receive ListAndWatch response of CPUAdvisorServer failed with error: %v, grpc code: %v",
 				err, status.Code(err))
 		}
+		resp, ok := assembler.Add(chunk)
+		if !ok {
+			continue
+		}
 
 		// old asynchronous communication interface does not support feature gate negotiation. If necessary, upgrade to the synchronization interface.
 		emptyMap := map[string]*advisorsvc.FeatureGate{}
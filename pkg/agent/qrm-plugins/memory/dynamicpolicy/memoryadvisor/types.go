@@ -27,6 +27,8 @@ const (
 	ControlKnobKeySwapMax            MemoryControlKnobName = "swap_max"
 	ControlKnowKeyMemoryOffloading   MemoryControlKnobName = "memory_offloading"
 	ControlKnobKeyMemoryNUMAHeadroom MemoryControlKnobName = "memory_numa_headroom"
+
+	ControlKnobKeyAllowSharedCoresOverlapReclaimedCores MemoryControlKnobName = "allow_shared_cores_overlap_reclaimed_cores"
 )
 
 type MemoryNUMAHeadroom map[int]int64
@@ -119,6 +119,10 @@ type DynamicPolicy struct {
 	topology *machine.CPUTopology
 	state    state.State
 
+	// allowSharedCoresOverlapReclaimedCores is the overlap flag advised by memory-advisor in the latest
+	// response, and it is false if the flag is absent, i.e. reclaimed_cores are isolated from shared_cores
+	allowSharedCoresOverlapReclaimedCores bool
+
 	migrateMemoryLock sync.Mutex
 	migratingMemory   map[string]map[string]bool
 	residualHitMap    map[string]int64
@@ -280,6 +284,8 @@ func NewDynamicPolicy(agentCtx *agent.GenericContext, conf *config.Configuration
 		memoryadvisor.ControlKnobHandlerWithChecker(policyImplement.handleAdvisorMemoryOffloading))
 	memoryadvisor.RegisterControlKnobHandler(memoryadvisor.ControlKnobKeyMemoryNUMAHeadroom,
 		memoryadvisor.ControlKnobHandlerWithChecker(policyImplement.handleAdvisorMemoryNUMAHeadroom))
+	memoryadvisor.RegisterControlKnobHandler(memoryadvisor.ControlKnobKeyAllowSharedCoresOverlapReclaimedCores,
+		memoryadvisor.ControlKnobHandlerWithChecker(policyImplement.handleAdvisorAllowSharedCoresOverlapReclaimedCores))
 
 	if policyImplement.enableEvictingLogCache {
 		policyImplement.logCacheEvictionManager = logcache.NewManager(conf, agentCtx.MetaServer)
@@ -289,6 +289,16 @@ func (p *DynamicPolicy) handleAdvisorResp(advisorResp *advisorsvc.ListAndWatchRe
 
 	handlers := memoryadvisor.GetRegisteredControlKnobHandlers()
 
+	// the overlap flag is only attached if overlap is allowed, so it is reset before handling the response
+	p.allowSharedCoresOverlapReclaimedCores = false
+	defer func() {
+		overlapActive := int64(0)
+		if p.allowSharedCoresOverlapReclaimedCores {
+			overlapActive = 1
+		}
+		_ = p.emitter.StoreInt64(util.MetricNameMemoryAllowSharedCoresOverlapReclaimed, overlapActive, metrics.MetricTypeNameRaw)
+	}()
+
 	for entryName, entry := range advisorResp.PodEntries {
 		if entry == nil {
 			general.Warningf("entryName: %s has nil entry", entryName)
@@ -538,6 +548,32 @@ func (p *DynamicPolicy) handleAdvisorMemoryNUMAHeadroom(
 	return nil
 }
 
+func (p *DynamicPolicy) handleAdvisorAllowSharedCoresOverlapReclaimedCores(
+	_ *config.Configuration,
+	_ interface{},
+	_ *dynamicconfig.DynamicAgentConfiguration,
+	_ metrics.MetricEmitter,
+	_ *metaserver.MetaServer,
+	_, _ string,
+	calculationInfo *advisorsvc.CalculationInfo, _ state.PodResourceEntries,
+) error {
+	if calculationInfo.CgroupPath != "" {
+		return fmt.Errorf("setting %s for cgroup path: %s isn't supported",
+			memoryadvisor.ControlKnobKeyAllowSharedCoresOverlapReclaimedCores, calculationInfo.CgroupPath)
+	}
+
+	value := calculationInfo.CalculationResult.Values[string(memoryadvisor.ControlKnobKeyAllowSharedCoresOverlapReclaimedCores)]
+	allowSharedCoresOverlapReclaimedCores, err := strconv.ParseBool(value)
+	if err != nil {
+		return fmt.Errorf("parse %s: %s failed with error: %v",
+			memoryadvisor.ControlKnobKeyAllowSharedCoresOverlapReclaimedCores, value, err)
+	}
+
+	general.Infof("allowSharedCoresOverlapReclaimedCores: %v", allowSharedCoresOverlapReclaimedCores)
+	p.allowSharedCoresOverlapReclaimedCores = allowSharedCoresOverlapReclaimedCores
+	return nil
+}
+
 // pushMemoryAdvisor pushes state info to memory-advisor
 func (p *DynamicPolicy) pushMemoryAdvisor() error {
 	podEntries := p.state.GetPodResourceEntries()[v1.ResourceMemory]
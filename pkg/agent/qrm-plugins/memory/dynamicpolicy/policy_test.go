@@ -2796,6 +2796,51 @@ func TestHandleAdvisorResp(t *testing.T) {
 	}
 }
 
+func TestHandleAdvisorRespAllowSharedCoresOverlapReclaimedCores(t *testing.T) {
+	t.Parallel()
+
+	as := require.New(t)
+	cpuTopology, err := machine.GenerateDummyCPUTopology(16, 2, 4)
+	as.Nil(err)
+	machineInfo, err := machine.GenerateDummyMachineInfo(4, 32)
+	as.Nil(err)
+
+	tmpDir, err := ioutil.TempDir("", "checkpoint-TestHandleAdvisorRespAllowSharedCoresOverlapReclaimedCores")
+	as.Nil(err)
+	defer os.RemoveAll(tmpDir)
+
+	dynamicPolicy, err := getTestDynamicPolicyWithInitialization(cpuTopology, machineInfo, tmpDir)
+	as.Nil(err)
+	dynamicPolicy.metaServer = &metaserver.MetaServer{}
+	memoryadvisor.RegisterControlKnobHandler(memoryadvisor.ControlKnobKeyAllowSharedCoresOverlapReclaimedCores,
+		memoryadvisor.ControlKnobHandlerWithChecker(dynamicPolicy.handleAdvisorAllowSharedCoresOverlapReclaimedCores))
+
+	newResp := func(values map[string]string) *advisorsvc.ListAndWatchResponse {
+		return &advisorsvc.ListAndWatchResponse{
+			ExtraEntries: []*advisorsvc.CalculationInfo{
+				{CalculationResult: &advisorsvc.CalculationResult{Values: values}},
+			},
+		}
+	}
+	emptyMap := map[string]*advisorsvc.FeatureGate{}
+
+	// the flag attached by memory-advisor is recorded
+	as.Nil(dynamicPolicy.handleAdvisorResp(newResp(map[string]string{
+		string(memoryadvisor.ControlKnobKeyAllowSharedCoresOverlapReclaimedCores): "true",
+	}), emptyMap))
+	as.True(dynamicPolicy.allowSharedCoresOverlapReclaimedCores)
+
+	// the flag is reset once it is absent, i.e. overlap is no longer allowed
+	as.Nil(dynamicPolicy.handleAdvisorResp(newResp(map[string]string{}), emptyMap))
+	as.False(dynamicPolicy.allowSharedCoresOverlapReclaimedCores)
+
+	// an invalid flag is regarded as not allowed
+	as.Nil(dynamicPolicy.handleAdvisorResp(newResp(map[string]string{
+		string(memoryadvisor.ControlKnobKeyAllowSharedCoresOverlapReclaimedCores): "invalid",
+	}), emptyMap))
+	as.False(dynamicPolicy.allowSharedCoresOverlapReclaimedCores)
+}
+
 func TestSetExtraControlKnobByConfigForAllocationInfo(t *testing.T) {
 	t.Parallel()
 
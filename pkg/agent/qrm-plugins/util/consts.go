@@ -52,6 +52,7 @@ const (
 	MetricNameMemoryHandleAdvisorCPUSetMems           = "memory_handle_advisor_cpuset_mems"
 	MetricNameMemoryHandlerAdvisorMemoryOffload       = "memory_handler_advisor_memory_offloading"
 	MetricNameMemoryHandlerAdvisorMemoryNUMAHeadroom  = "memory_handler_advisor_memory_numa_headroom"
+	MetricNameMemoryAllowSharedCoresOverlapReclaimed  = "memory_allow_shared_cores_overlap_reclaimed_cores"
 	MetricNameMemoryOOMPriorityDeleteFailed           = "memory_oom_priority_delete_failed"
 	MetricNameMemoryOOMPriorityUpdateFailed           = "memory_oom_priority_update_failed"
 	MetricNameMemoryNumaBalance                       = "memory_handle_numa_balance"
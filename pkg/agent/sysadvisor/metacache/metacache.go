@@ -68,6 +68,9 @@ type MetaReader interface {
 	GetPoolInfo(poolName string) (*types.PoolInfo, bool)
 	// GetPoolSize returns the size of pool as integer
 	GetPoolSize(poolName string) (int, bool)
+	// RangePoolInfo applies a function to every poolName, poolInfo set.
+	// If f returns false, range stops the iteration.
+	RangePoolInfo(f func(poolName string, poolInfo *types.PoolInfo) bool)
 
 	// GetRegionInfo returns a RegionInfo copy by region name
 	GetRegionInfo(regionName string) (*types.RegionInfo, bool)
@@ -285,6 +288,17 @@ func (mc *MetaCacheImp) GetPoolSize(poolName string) (int, bool) {
 	return machine.CountCPUAssignmentCPUs(pi.TopologyAwareAssignments), true
 }
 
+func (mc *MetaCacheImp) RangePoolInfo(f func(poolName string, poolInfo *types.PoolInfo) bool) {
+	mc.poolMutex.RLock()
+	defer mc.poolMutex.RUnlock()
+
+	for poolName, poolInfo := range mc.poolEntries.Clone() {
+		if !f(poolName, poolInfo) {
+			break
+		}
+	}
+}
+
 func (mc *MetaCacheImp) GetRegionInfo(regionName string) (*types.RegionInfo, bool) {
 	mc.regionMutex.RLock()
 	defer mc.regionMutex.RUnlock()
@@ -35,3 +35,13 @@ func IsQuotaCtrlKnobEnabled(mr MetaReader) (bool, error) {
 
 	return quotaCtrlKnobEnabled, nil
 }
+
+func IsExplicitCPUListEnabled(mr MetaReader) (bool, error) {
+	featureGates, err := mr.GetSupportedWantedFeatureGates()
+	if err != nil {
+		return false, fmt.Errorf("get feature gates failed: %v", err)
+	}
+
+	feature, ok := featureGates[feature_cpu.NegotiationFeatureGateExplicitCPUList]
+	return ok && feature != nil, nil
+}
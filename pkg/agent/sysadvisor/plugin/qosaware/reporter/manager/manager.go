@@ -19,6 +19,7 @@ package manager
 import (
 	"context"
 	"sync"
+	"time"
 
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
@@ -62,6 +63,13 @@ type NumaResourceManager interface {
 	GetNumaCapacity() (map[int]resource.Quantity, error)
 }
 
+// NumaResourceTimestampGetter is optionally implemented by NumaResourceManager to tell when
+// the NUMA-specific resource returned by GetNumaAllocatable is computed
+type NumaResourceTimestampGetter interface {
+	// GetNumaAllocatableTimestamp returns the time when the allocatable resource for each NUMA node is computed
+	GetNumaAllocatableTimestamp() (map[int]time.Time, error)
+}
+
 // InitFunc is used to init headroom manager
 type InitFunc func(emitter metrics.MetricEmitter, metaServer *metaserver.MetaServer, metaCache metacache.MetaCache,
 	conf *config.Configuration, headroomAdvisor hmadvisor.ResourceAdvisor) (HeadroomManager, error)
@@ -68,6 +68,8 @@ type GenericHeadroomManager struct {
 	lastReportResult *resource.Quantity
 	// the latest transformed reporter result per numa
 	lastNUMAReportResult map[int]resource.Quantity
+	// the time when the latest reporter result per numa is computed
+	lastNUMAReportTime map[int]time.Time
 
 	metaServer              *metaserver.MetaServer
 	metaCache               metacache.MetaCache
@@ -106,6 +108,7 @@ func NewGenericHeadroomManager(name v1.ResourceName, useMilliValue, reportMilliV
 	return &GenericHeadroomManager{
 		resourceName:            name,
 		lastNUMAReportResult:    make(map[int]resource.Quantity),
+		lastNUMAReportTime:      make(map[int]time.Time),
 		reportResultTransformer: reportResultTransformer,
 		syncPeriod:              syncPeriod,
 		headroomAdvisor:         headroomAdvisor,
@@ -154,6 +157,20 @@ func (m *GenericHeadroomManager) GetNumaAllocatable() (map[int]resource.Quantity
 	return m.getLastNUMAReportResult()
 }
 
+func (m *GenericHeadroomManager) GetNumaAllocatableTimestamp() (map[int]time.Time, error) {
+	m.RLock()
+	defer m.RUnlock()
+	if len(m.lastNUMAReportTime) == 0 {
+		return nil, fmt.Errorf("resource %s last numa report time not found", m.resourceName)
+	}
+
+	timestamps := make(map[int]time.Time, len(m.lastNUMAReportTime))
+	for numaID, timestamp := range m.lastNUMAReportTime {
+		timestamps[numaID] = timestamp
+	}
+	return timestamps, nil
+}
+
 func (m *GenericHeadroomManager) GetNumaCapacity() (map[int]resource.Quantity, error) {
 	m.RLock()
 	defer m.RUnlock()
@@ -211,6 +228,7 @@ func (m *GenericHeadroomManager) sync(_ context.Context) {
 
 		for _, numaID := range m.metaServer.CPUDetails.NUMANodes().ToSliceInt() {
 			m.lastNUMAReportResult[numaID] = resource.Quantity{}
+			m.lastNUMAReportTime[numaID] = time.Now()
 			m.emitNUMAResourceToMetric(numaID, metricsNameHeadroomReportNUMAResult, resource.Quantity{})
 		}
 		return
@@ -279,6 +297,7 @@ func (m *GenericHeadroomManager) sync(_ context.Context) {
 		}
 		result := m.reportResultTransformer(*res)
 		m.lastNUMAReportResult[numaID] = result
+		m.lastNUMAReportTime[numaID] = time.Now()
 		headroomInfo.NUMAHeadroom[numaID] = float64(res.MilliValue()) / 1000
 		m.emitNUMAResourceToMetric(numaID, metricsNameHeadroomReportNUMAResult, result)
 		klog.Infof("%s headroom manager for NUMA: %d, headroom: %d", m.resourceName, numaID, result.Value())
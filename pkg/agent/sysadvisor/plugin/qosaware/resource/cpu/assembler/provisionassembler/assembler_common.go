@@ -292,15 +292,18 @@ func (pa *ProvisionAssemblerCommon) assembleWithoutNUMAExclusivePool(
 		"shareAndIsolatedDedicatedPoolAvailable", shareAndIsolatedDedicatedPoolAvailable)
 
 	// fill in regulated share-and-isolated pool entries
+	poolProvenances := getPoolProvenances(shareRegions, isolationRegions, dedicatedRegions)
 	for poolName, poolSize := range shareAndIsolateDedicatedPoolSizes {
 		if podSet, ok := dedicatedInfo.podSet[poolName]; ok {
 			// fill in dedicated pool entries with pod uid for each pod
 			for uid := range podSet {
 				result.SetPoolEntry(uid, numaID, poolSize, -1)
+				result.SetPoolEntryProvenance(uid, numaID, poolProvenances[poolName])
 			}
 		} else {
 			// fill in share pool or isolation pool entries with pool name for each pod
 			result.SetPoolEntry(poolName, numaID, poolSize, -1)
+			result.SetPoolEntryProvenance(poolName, numaID, poolProvenances[poolName])
 		}
 	}
 
@@ -515,6 +518,28 @@ type regionInfo struct {
 	minReclaimedCoresCPUQuota float64
 }
 
+// regionProvenance formats the region and its provision policy in use as "<region name>/<policy>"
+func regionProvenance(r region.QoSRegion) string {
+	_, policyInUse := r.GetProvisionPolicy()
+	return fmt.Sprintf("%s/%s", r.Name(), policyInUse)
+}
+
+// getPoolProvenances returns provenance of regions keyed by the same pool names as regulated pool sizes,
+// i.e. owner pool names for share regions and region names for isolation and dedicated regions
+func getPoolProvenances(shareRegions, isolationRegions, dedicatedRegions []region.QoSRegion) map[string]string {
+	provenances := make(map[string]string)
+	for _, r := range shareRegions {
+		provenances[r.OwnerPoolName()] = regionProvenance(r)
+	}
+	for _, r := range isolationRegions {
+		provenances[r.Name()] = regionProvenance(r)
+	}
+	for _, r := range dedicatedRegions {
+		provenances[r.Name()] = regionProvenance(r)
+	}
+	return provenances
+}
+
 func extractShareRegionInfo(shareRegions []region.QoSRegion) (regionInfo, error) {
 	shareRequirements := make(map[string]int)
 	shareRequests := make(map[string]int)
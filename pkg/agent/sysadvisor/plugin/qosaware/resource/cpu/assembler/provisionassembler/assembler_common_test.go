@@ -29,6 +29,7 @@ import (
 	"github.com/kubewharf/katalyst-api/pkg/consts"
 	katalyst_base "github.com/kubewharf/katalyst-core/cmd/base"
 	"github.com/kubewharf/katalyst-core/cmd/katalyst-agent/app/options"
+	"github.com/kubewharf/katalyst-core/pkg/agent/qrm-plugins/commonstate"
 	"github.com/kubewharf/katalyst-core/pkg/agent/sysadvisor/metacache"
 	"github.com/kubewharf/katalyst-core/pkg/agent/sysadvisor/plugin/qosaware/resource/cpu/region"
 	"github.com/kubewharf/katalyst-core/pkg/agent/sysadvisor/types"
@@ -1052,6 +1053,14 @@ func TestAssembleProvision(t *testing.T) {
 			if len(tt.expectPoolOverlapInfo) > 0 {
 				require.Equal(t, tt.expectPoolOverlapInfo, result.PoolOverlapInfo, "unexpected result")
 			}
+			// provenance is only attached to entries produced by regions
+			for poolName, numaProvenances := range result.PoolEntryProvenance {
+				for numaID, provenance := range numaProvenances {
+					require.Contains(t, result.PoolEntries[poolName], numaID, "provenance of absent entry %s", poolName)
+					require.NotEmpty(t, provenance)
+				}
+			}
+			require.NotContains(t, result.PoolEntryProvenance, commonstate.PoolNameReserve)
 		})
 	}
 }
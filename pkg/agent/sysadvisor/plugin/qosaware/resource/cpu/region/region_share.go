@@ -85,6 +85,7 @@ func (r *QoSRegionShare) TryUpdateProvision() {
 
 	// get raw provision control knob
 	rawControlKnobs := r.getProvisionControlKnob()
+	r.addHeadroomBuffer(rawControlKnobs)
 
 	// restrict control knobs by reference policy
 	restrictedControlKnobs := r.restrictProvisionControlKnob(rawControlKnobs)
@@ -103,6 +104,7 @@ func (r *QoSRegionShare) updateProvisionPolicy() {
 	if err != nil {
 		klog.Warningf("[qosaware-cpu] failed to get indicators, ignore it: %v", err)
 	} else {
+		r.complementCPUUsageRatioIndicator(indicators)
 		r.ControlEssentials.Indicators = indicators
 		general.Infof("indicators %v for region %v", indicators, r.name)
 	}
@@ -125,6 +127,44 @@ func (r *QoSRegionShare) updateProvisionPolicy() {
 	}
 }
 
+// addHeadroomBuffer adds the configured buffer on top of the cpu requirement given by each provision policy
+func (r *QoSRegionShare) addHeadroomBuffer(controlKnobs map[types.CPUProvisionPolicyName]types.ControlKnob) {
+	buffer := r.conf.ShareRegionHeadroomBufferCores
+	if buffer <= 0 {
+		return
+	}
+
+	for _, controlKnob := range controlKnobs {
+		if item, ok := controlKnob[configapi.ControlKnobNonReclaimedCPURequirement]; ok {
+			item.Value += buffer
+			controlKnob[configapi.ControlKnobNonReclaimedCPURequirement] = item
+		}
+	}
+}
+
+// complementCPUUsageRatioIndicator adds the cpu usage ratio indicator with the statically configured target,
+// if the target is configured and the dynamic indicator targets of share region give no target of it
+func (r *QoSRegionShare) complementCPUUsageRatioIndicator(indicators types.Indicator) {
+	indicatorName := v1alpha1.ServiceSystemIndicatorNameCPUUsageRatio
+	if r.conf.ShareRegionTargetCPUUsageRatio <= 0 {
+		return
+	}
+	for _, indicator := range r.conf.GetDynamicConfiguration().RegionIndicatorTargetConfiguration[r.regionType] {
+		if indicator.Name == indicatorName {
+			return
+		}
+	}
+
+	current, err := r.getPoolCPUUsageRatio()
+	if err != nil || current <= 0 {
+		return
+	}
+	indicators[string(indicatorName)] = types.IndicatorValue{
+		Current: current,
+		Target:  r.conf.ShareRegionTargetCPUUsageRatio,
+	}
+}
+
 func (r *QoSRegionShare) getEffectiveControlKnobs() types.ControlKnob {
 	quota, _, err := r.getEffectiveReclaimResource()
 	if err != nil {
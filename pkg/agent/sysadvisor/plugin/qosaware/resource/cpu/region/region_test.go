@@ -259,3 +259,107 @@ func TestRestrictProvisionControlKnob(t *testing.T) {
 		})
 	}
 }
+
+func TestAddHeadroomBuffer(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name              string
+		buffer            float64
+		originControlKnob map[types.CPUProvisionPolicyName]types.ControlKnob
+		wantControlKnob   map[types.CPUProvisionPolicyName]types.ControlKnob
+	}{
+		{
+			name:              "no buffer",
+			buffer:            0,
+			originControlKnob: map[types.CPUProvisionPolicyName]types.ControlKnob{"p1": {configapi.ControlKnobNonReclaimedCPURequirement: types.ControlKnobItem{Value: 8}}},
+			wantControlKnob:   map[types.CPUProvisionPolicyName]types.ControlKnob{"p1": {configapi.ControlKnobNonReclaimedCPURequirement: types.ControlKnobItem{Value: 8}}},
+		},
+		{
+			name:   "buffer added to cpu requirement only",
+			buffer: 2,
+			originControlKnob: map[types.CPUProvisionPolicyName]types.ControlKnob{
+				"p1": {configapi.ControlKnobNonReclaimedCPURequirement: types.ControlKnobItem{Value: 8}},
+				"p2": {configapi.ControlKnobReclaimedCoresCPUQuota: types.ControlKnobItem{Value: 10}},
+			},
+			wantControlKnob: map[types.CPUProvisionPolicyName]types.ControlKnob{
+				"p1": {configapi.ControlKnobNonReclaimedCPURequirement: types.ControlKnobItem{Value: 10}},
+				"p2": {configapi.ControlKnobReclaimedCoresCPUQuota: types.ControlKnobItem{Value: 10}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			conf, err := options.NewOptions().Config()
+			require.NoError(t, err)
+			require.NotNil(t, conf)
+
+			stateFileDir := "stateFileDir" + uuid.New().String()
+			checkpointDir := "checkpointDir" + uuid.New().String()
+
+			conf.GenericSysAdvisorConfiguration.StateFileDirectory = stateFileDir
+			conf.MetaServerConfiguration.CheckpointManagerDir = checkpointDir
+			conf.ShareRegionHeadroomBufferCores = tt.buffer
+
+			genericCtx, err := katalyst_base.GenerateFakeGenericContext([]runtime.Object{})
+			require.NoError(t, err)
+
+			metaServer, err := metaserver.NewMetaServer(genericCtx.Client, metrics.DummyMetrics{}, conf)
+			require.NoError(t, err)
+			defer func() {
+				os.RemoveAll(stateFileDir)
+				os.RemoveAll(checkpointDir)
+			}()
+
+			metaCache, err := metacache.NewMetaCacheImp(conf, metricspool.DummyMetricsEmitterPool{}, metric.NewFakeMetricsFetcher(metrics.DummyMetrics{}))
+			require.NoError(t, err)
+			ci := types.ContainerInfo{
+				QoSLevel:    consts.PodAnnotationQoSLevelSharedCores,
+				RegionNames: sets.NewString("share"),
+			}
+			share := NewQoSRegionShare(&ci, conf, nil, commonstate.FakedNUMAID, metaCache, metaServer, metrics.DummyMetrics{})
+			share.(*QoSRegionShare).addHeadroomBuffer(tt.originControlKnob)
+			assert.Equal(t, tt.wantControlKnob, tt.originControlKnob)
+		})
+	}
+}
+
+func TestComplementCPUUsageRatioIndicatorDisabledByDefault(t *testing.T) {
+	t.Parallel()
+
+	conf, err := options.NewOptions().Config()
+	require.NoError(t, err)
+	require.Zero(t, conf.ShareRegionTargetCPUUsageRatio)
+
+	stateFileDir := "stateFileDir" + uuid.New().String()
+	checkpointDir := "checkpointDir" + uuid.New().String()
+	conf.GenericSysAdvisorConfiguration.StateFileDirectory = stateFileDir
+	conf.MetaServerConfiguration.CheckpointManagerDir = checkpointDir
+
+	genericCtx, err := katalyst_base.GenerateFakeGenericContext([]runtime.Object{})
+	require.NoError(t, err)
+
+	metaServer, err := metaserver.NewMetaServer(genericCtx.Client, metrics.DummyMetrics{}, conf)
+	require.NoError(t, err)
+	defer func() {
+		os.RemoveAll(stateFileDir)
+		os.RemoveAll(checkpointDir)
+	}()
+
+	metaCache, err := metacache.NewMetaCacheImp(conf, metricspool.DummyMetricsEmitterPool{}, metric.NewFakeMetricsFetcher(metrics.DummyMetrics{}))
+	require.NoError(t, err)
+	ci := types.ContainerInfo{
+		QoSLevel:    consts.PodAnnotationQoSLevelSharedCores,
+		RegionNames: sets.NewString("share"),
+	}
+	share := NewQoSRegionShare(&ci, conf, nil, commonstate.FakedNUMAID, metaCache, metaServer, metrics.DummyMetrics{})
+
+	// no indicator is injected unless the target is configured
+	indicators := types.Indicator{}
+	share.(*QoSRegionShare).complementCPUUsageRatioIndicator(indicators)
+	assert.Empty(t, indicators)
+}
@@ -221,7 +221,10 @@ func (ra *memoryResourceAdvisor) update() (*types.InternalMemoryCalculationResul
 		NUMAConditions: NUMAConditions,
 	}
 
-	result := types.InternalMemoryCalculationResult{TimeStamp: time.Now()}
+	result := types.InternalMemoryCalculationResult{
+		TimeStamp:                             time.Now(),
+		AllowSharedCoresOverlapReclaimedCores: ra.conf.GetDynamicConfiguration().AllowSharedCoresOverlapReclaimedCores,
+	}
 	for _, plugin := range ra.plugins {
 		if err := plugin.Reconcile(&memoryPressureStatus); err != nil {
 			general.Errorf("plugin %T reconcile failed: %v", plugin, err)
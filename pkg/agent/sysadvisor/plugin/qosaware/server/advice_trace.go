@@ -0,0 +1,340 @@
+/*
+Copyright 2022 The Katalyst Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	k8types "k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+
+	"github.com/kubewharf/katalyst-core/pkg/agent/qrm-plugins/commonstate"
+	"github.com/kubewharf/katalyst-core/pkg/agent/qrm-plugins/cpu/dynamicpolicy/cpuadvisor"
+	"github.com/kubewharf/katalyst-core/pkg/agent/sysadvisor/types"
+	"github.com/kubewharf/katalyst-core/pkg/metaserver/agent/pod"
+	"github.com/kubewharf/katalyst-core/pkg/metrics"
+)
+
+// Metric names for advice traces
+const (
+	metricAdviceTraceRecorded     = "advice_trace_recorded"
+	metricAdviceTraceRecordFailed = "advice_trace_record_failed"
+)
+
+// maxAdviceTraceLineBytes bounds a single trace when loading, since a trace of a large node exceeds
+// the default token size of bufio.Scanner
+const maxAdviceTraceLineBytes = 64 << 20
+
+// AdviceTrace is a replayable record of a single assembly, i.e. the checkpoint synced into meta cache along with
+// its pods, and the advisor result that the ListAndWatch response is assembled from.
+type AdviceTrace struct {
+	Timestamp     time.Time                           `json:"timestamp"`
+	Checkpoint    *cpuadvisor.GetCheckpointResponse   `json:"checkpoint"`
+	AdvisorResult *types.InternalCPUCalculationResult `json:"advisorResult"`
+	Response      *cpuadvisor.ListAndWatchResponse    `json:"response"`
+	// Pods are those of the container entries in checkpoint, so that the trace is replayed without the pod fetcher
+	// of the traced node; pods failed to be fetched are absent, just as they are skipped by the sync
+	Pods []*v1.Pod `json:"pods,omitempty"`
+	// PodUIDsHashed indicates whether pod uids are replaced with their hashes, and they are replaced consistently
+	// in all parts of the trace, so that the trace is still replayable against pods with the hashed uids
+	PodUIDsHashed bool `json:"podUIDsHashed,omitempty"`
+}
+
+// fileAdviceTraceSink appends advice traces to a file as json lines, and the file is rotated to
+// <path>.1, <path>.2, ... once it would exceed maxBytes, keeping at most maxBackups rotated files
+type fileAdviceTraceSink struct {
+	path       string
+	maxBytes   int64
+	maxBackups int
+}
+
+func (s *fileAdviceTraceSink) Record(trace *AdviceTrace) error {
+	data, err := json.Marshal(trace)
+	if err != nil {
+		return fmt.Errorf("encode advice trace failed: %w", err)
+	}
+	data = append(data, '\n')
+
+	if info, err := os.Stat(s.path); err == nil && info.Size() > 0 && info.Size()+int64(len(data)) > s.maxBytes {
+		if err := s.rotate(); err != nil {
+			return fmt.Errorf("rotate advice trace failed: %w", err)
+		}
+	}
+
+	file, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		_ = file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// rotate shifts each rotated file by one, and the oldest one is dropped
+func (s *fileAdviceTraceSink) rotate() error {
+	if s.maxBackups <= 0 {
+		return os.Remove(s.path)
+	}
+	for i := s.maxBackups - 1; i >= 0; i-- {
+		src := s.path
+		if i > 0 {
+			src = fmt.Sprintf("%s.%d", s.path, i)
+		}
+		if err := os.Rename(src, fmt.Sprintf("%s.%d", s.path, i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// LoadAdviceTraces loads advice traces from a file written by the advice trace sink, in the order they are recorded
+func LoadAdviceTraces(path string) ([]*AdviceTrace, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	traces := make([]*AdviceTrace, 0)
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, maxAdviceTraceLineBytes)
+	for scanner.Scan() {
+		trace := &AdviceTrace{}
+		if err := json.Unmarshal(scanner.Bytes(), trace); err != nil {
+			return nil, fmt.Errorf("decode advice trace %d failed: %w", len(traces), err)
+		}
+		traces = append(traces, trace)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return traces, nil
+}
+
+// adviceTracer records assembled advice along with its inputs to the sink
+type adviceTracer struct {
+	sink        *fileAdviceTraceSink
+	hashPodUIDs bool
+	// mutex protects checkpoint, which is the checkpoint synced into meta cache in the latest cycle
+	mutex      sync.Mutex
+	checkpoint *cpuadvisor.GetCheckpointResponse
+}
+
+// setTracedCheckpoint keeps the checkpoint synced into meta cache, if advice trace is enabled
+func (cs *cpuServer) setTracedCheckpoint(checkpoint *cpuadvisor.GetCheckpointResponse) {
+	if cs.adviceTracer == nil {
+		return
+	}
+
+	cs.adviceTracer.mutex.Lock()
+	defer cs.adviceTracer.mutex.Unlock()
+	cs.adviceTracer.checkpoint = checkpoint
+}
+
+// getAdviceRequestCheckpoint returns the allocation carried by a GetAdvice request in the form of checkpoint,
+// so that advice of GetAdvice is traced and replayed just like that of ListAndWatch
+func getAdviceRequestCheckpoint(req *cpuadvisor.GetAdviceRequest) *cpuadvisor.GetCheckpointResponse {
+	checkpoint := &cpuadvisor.GetCheckpointResponse{Entries: make(map[string]*cpuadvisor.AllocationEntries, len(req.Entries))}
+	for entryName, entry := range req.Entries {
+		entries := &cpuadvisor.AllocationEntries{Entries: make(map[string]*cpuadvisor.AllocationInfo, len(entry.Entries))}
+		for subEntryName, info := range entry.Entries {
+			entries.Entries[subEntryName] = info.AllocationInfo
+		}
+		checkpoint.Entries[entryName] = entries
+	}
+	return checkpoint
+}
+
+// traceAdvice records the assembled response along with its inputs, if advice trace is enabled; failures
+// are only reported, never affecting the push
+func (cs *cpuServer) traceAdvice(advisorResp *types.InternalCPUCalculationResult, resp *cpuadvisor.ListAndWatchResponse) {
+	if cs.adviceTracer == nil {
+		return
+	}
+
+	cs.adviceTracer.mutex.Lock()
+	defer cs.adviceTracer.mutex.Unlock()
+
+	trace := &AdviceTrace{
+		Timestamp:     cs.clock.Now(),
+		Checkpoint:    cs.adviceTracer.checkpoint,
+		AdvisorResult: advisorResp,
+		Response:      resp,
+		Pods:          cs.getAdviceTracePods(cs.adviceTracer.checkpoint),
+	}
+	if cs.adviceTracer.hashPodUIDs {
+		hashed, err := cs.hashAdviceTracePodUIDs(trace)
+		if err != nil {
+			klog.Errorf("[qosaware-server-cpu] hash pod uids of advice trace failed: %v", err)
+			_ = cs.emitter.StoreInt64(cs.genMetricsName(metricAdviceTraceRecordFailed), 1, metrics.MetricTypeNameCount)
+			return
+		}
+		trace = hashed
+	}
+
+	if err := cs.adviceTracer.sink.Record(trace); err != nil {
+		klog.Errorf("[qosaware-server-cpu] record advice trace failed: %v", err)
+		_ = cs.emitter.StoreInt64(cs.genMetricsName(metricAdviceTraceRecordFailed), 1, metrics.MetricTypeNameCount)
+		return
+	}
+	_ = cs.emitter.StoreInt64(cs.genMetricsName(metricAdviceTraceRecorded), 1, metrics.MetricTypeNameCount)
+}
+
+// getAdviceTracePods fetches pods of the container entries in checkpoint, and managed fields are dropped
+// since they are never referred to by the sync
+func (cs *cpuServer) getAdviceTracePods(checkpoint *cpuadvisor.GetCheckpointResponse) []*v1.Pod {
+	if checkpoint == nil {
+		return nil
+	}
+
+	pods := make([]*v1.Pod, 0, len(checkpoint.Entries))
+	for entryName, entries := range checkpoint.Entries {
+		if _, ok := entries.Entries[commonstate.FakedContainerName]; ok {
+			continue
+		}
+		p, err := cs.getPodWithTimeout(context.Background(), entryName)
+		if err != nil {
+			klog.V(4).Infof("[qosaware-server-cpu] pod %s of advice trace is skipped: %v", entryName, err)
+			continue
+		}
+		p = p.DeepCopy()
+		p.ManagedFields = nil
+		pods = append(pods, p)
+	}
+	return pods
+}
+
+// hashAdviceTracePodUIDs returns a copy of the trace with pod uids replaced with their hashes; pod uids are
+// those in meta cache, and those of checkpoint entries without pool entries. The original trace is never
+// modified since its parts are referred to by the push cycle.
+func (cs *cpuServer) hashAdviceTracePodUIDs(trace *AdviceTrace) (*AdviceTrace, error) {
+	podUIDs := sets.NewString()
+	cs.metaCache.RangeContainer(func(podUID string, _ string, _ *types.ContainerInfo) bool {
+		podUIDs.Insert(podUID)
+		return true
+	})
+	if trace.Checkpoint != nil {
+		for entryName, entries := range trace.Checkpoint.Entries {
+			if _, ok := entries.Entries[commonstate.FakedContainerName]; !ok {
+				podUIDs.Insert(entryName)
+			}
+		}
+	}
+	hash := func(name string) string {
+		if !podUIDs.Has(name) {
+			return name
+		}
+		sum := sha256.Sum256([]byte(name))
+		return "pod-" + hex.EncodeToString(sum[:8])
+	}
+
+	hashed := *trace
+	hashed.PodUIDsHashed = true
+	if trace.Checkpoint != nil {
+		// allocation entries refer to no pods, so they are shared with the original checkpoint
+		hashed.Checkpoint = &cpuadvisor.GetCheckpointResponse{Entries: make(map[string]*cpuadvisor.AllocationEntries, len(trace.Checkpoint.Entries))}
+		for entryName, entries := range trace.Checkpoint.Entries {
+			hashed.Checkpoint.Entries[hash(entryName)] = entries
+		}
+	}
+
+	if trace.Pods != nil {
+		// pod names identify workloads just as uids do, so they are replaced with the hashes as well
+		hashed.Pods = make([]*v1.Pod, 0, len(trace.Pods))
+		for _, p := range trace.Pods {
+			p = p.DeepCopy()
+			p.UID = k8types.UID(hash(string(p.UID)))
+			p.Name = string(p.UID)
+			hashed.Pods = append(hashed.Pods, p)
+		}
+	}
+
+	if trace.AdvisorResult != nil {
+		advisorResp := *trace.AdvisorResult
+		advisorResp.PoolEntries = make(map[string]map[int]types.CPUResource, len(trace.AdvisorResult.PoolEntries))
+		for poolName, entries := range trace.AdvisorResult.PoolEntries {
+			advisorResp.PoolEntries[hash(poolName)] = entries
+		}
+		advisorResp.PoolEntryProvenance = make(map[string]map[int]string, len(trace.AdvisorResult.PoolEntryProvenance))
+		for poolName, provenance := range trace.AdvisorResult.PoolEntryProvenance {
+			advisorResp.PoolEntryProvenance[hash(poolName)] = provenance
+		}
+		advisorResp.PoolOverlapPodContainerInfo = make(map[string]map[int]map[string]map[string]int, len(trace.AdvisorResult.PoolOverlapPodContainerInfo))
+		for poolName, numaInfo := range trace.AdvisorResult.PoolOverlapPodContainerInfo {
+			advisorResp.PoolOverlapPodContainerInfo[poolName] = make(map[int]map[string]map[string]int, len(numaInfo))
+			for numaID, podInfo := range numaInfo {
+				advisorResp.PoolOverlapPodContainerInfo[poolName][numaID] = make(map[string]map[string]int, len(podInfo))
+				for podUID, containerInfo := range podInfo {
+					advisorResp.PoolOverlapPodContainerInfo[poolName][numaID][hash(podUID)] = containerInfo
+				}
+			}
+		}
+		hashed.AdvisorResult = &advisorResp
+	}
+
+	if trace.Response != nil {
+		// overlap targets in blocks refer to pods, so the response is deep copied
+		resp, err := deepCopyListAndWatchResponse(trace.Response)
+		if err != nil {
+			return nil, err
+		}
+		entries := make(map[string]*cpuadvisor.CalculationEntries, len(resp.Entries))
+		for entryName, calculationEntries := range resp.Entries {
+			for _, calculationInfo := range calculationEntries.Entries {
+				for _, numaCalculationResult := range calculationInfo.CalculationResultsByNumas {
+					for _, block := range numaCalculationResult.Blocks {
+						for _, target := range block.OverlapTargets {
+							target.OverlapTargetPodUid = hash(target.OverlapTargetPodUid)
+						}
+					}
+				}
+			}
+			entries[hash(entryName)] = calculationEntries
+		}
+		resp.Entries = entries
+		hashed.Response = resp
+	}
+	return &hashed, nil
+}
+
+// replayAdviceTrace feeds the checkpoint of the trace through syncCheckpoint, and assembles its advisor result
+// against the synced meta cache; the result is deterministic if block ids are generated deterministically.
+// Pods are fetched from those recorded in the trace, so the pod fetcher of the server is replaced, and it
+// is only kept for traces recorded without pods.
+func (cs *cpuServer) replayAdviceTrace(ctx context.Context, trace *AdviceTrace) *cpuInternalResult {
+	if trace.Pods != nil {
+		cs.metaServer.PodFetcher = &pod.PodFetcherStub{PodList: trace.Pods}
+	}
+	if trace.Checkpoint != nil {
+		cs.syncCheckpoint(ctx, trace.Checkpoint, time.Now().UnixNano())
+	}
+	return cs.assembleResponse(trace.AdvisorResult)
+}
@@ -0,0 +1,165 @@
+/*
+Copyright 2022 The Katalyst Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/kubewharf/katalyst-api/pkg/consts"
+	"github.com/kubewharf/katalyst-core/pkg/agent/qrm-plugins/commonstate"
+	"github.com/kubewharf/katalyst-core/pkg/agent/qrm-plugins/cpu/dynamicpolicy/cpuadvisor"
+	"github.com/kubewharf/katalyst-core/pkg/agent/sysadvisor/types"
+)
+
+func TestFileAdviceTraceSinkRotate(t *testing.T) {
+	t.Parallel()
+
+	tracePath := path.Join(t.TempDir(), "advice-trace.log")
+	sink := &fileAdviceTraceSink{path: tracePath, maxBytes: 1, maxBackups: 1}
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		require.NoError(t, sink.Record(&AdviceTrace{Timestamp: base.Add(time.Duration(i) * time.Second)}))
+	}
+
+	// each trace exceeds max bytes, so the file is rotated on each record and only one rotated file is kept
+	traces, err := LoadAdviceTraces(tracePath)
+	require.NoError(t, err)
+	require.Len(t, traces, 1)
+	require.True(t, base.Add(2*time.Second).Equal(traces[0].Timestamp))
+	traces, err = LoadAdviceTraces(tracePath + ".1")
+	require.NoError(t, err)
+	require.Len(t, traces, 1)
+	require.True(t, base.Add(time.Second).Equal(traces[0].Timestamp))
+	_, err = os.Stat(tracePath + ".2")
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestCPUServerAdviceTraceReplay(t *testing.T) {
+	t.Parallel()
+
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			UID: "pod1",
+			Annotations: map[string]string{
+				consts.PodAnnotationQoSLevelKey: consts.PodAnnotationQoSLevelSharedCores,
+			},
+		},
+	}
+	newServer := func() *cpuServer {
+		cs := newTestCPUServer(t, nil, []*v1.Pod{pod})
+		cs.blockIDGenerator = NewSequentialBlockIDGenerator("block-")
+		require.NoError(t, cs.metaCache.AddContainer("pod1", "c1", &types.ContainerInfo{
+			PodUID:        "pod1",
+			ContainerName: "c1",
+			QoSLevel:      consts.PodAnnotationQoSLevelSharedCores,
+		}))
+		return cs
+	}
+	checkpoint := &cpuadvisor.GetCheckpointResponse{
+		Entries: map[string]*cpuadvisor.AllocationEntries{
+			commonstate.PoolNameShare: {
+				Entries: map[string]*cpuadvisor.AllocationInfo{
+					commonstate.FakedContainerName: {
+						OwnerPoolName:            commonstate.PoolNameShare,
+						TopologyAwareAssignments: map[uint64]string{0: "1-3"},
+					},
+				},
+			},
+			"pod1": {
+				Entries: map[string]*cpuadvisor.AllocationInfo{
+					"c1": {
+						OwnerPoolName:            commonstate.PoolNameShare,
+						TopologyAwareAssignments: map[uint64]string{0: "1-3"},
+					},
+				},
+			},
+		},
+	}
+	advisorResp := &types.InternalCPUCalculationResult{
+		PoolEntries: map[string]map[int]types.CPUResource{
+			commonstate.PoolNameShare:   {commonstate.FakedNUMAID: {Size: 4}},
+			commonstate.PoolNameReclaim: {0: {Size: 2}},
+		},
+		PoolOverlapInfo: map[string]map[int]map[string]int{},
+	}
+
+	// record a trace as is, and another one with pod uids hashed
+	tracePath := path.Join(t.TempDir(), "advice-trace.log")
+	cs := newServer()
+	cs.adviceTracer = &adviceTracer{sink: &fileAdviceTraceSink{path: tracePath, maxBytes: 64 << 20}}
+	cs.syncCheckpoint(context.TODO(), checkpoint, time.Now().UnixNano())
+	cs.setTracedCheckpoint(checkpoint)
+	result := cs.assembleResponse(advisorResp)
+	lwResp := &cpuadvisor.ListAndWatchResponse{Entries: result.Entries}
+	cs.traceAdvice(advisorResp, lwResp)
+	cs.adviceTracer.hashPodUIDs = true
+	cs.traceAdvice(advisorResp, lwResp)
+	// the original response is not modified by hashing
+	require.Contains(t, lwResp.Entries, "pod1")
+
+	traces, err := LoadAdviceTraces(tracePath)
+	require.NoError(t, err)
+	require.Len(t, traces, 2)
+
+	// replaying either trace on a fresh server of another node reproduces the recorded response,
+	// since pods are served from the trace rather than the pod fetcher of the server
+	for _, trace := range traces {
+		require.Len(t, trace.Pods, 1)
+		podUID := string(trace.Pods[0].UID)
+		replayServer := newTestCPUServer(t, nil, []*v1.Pod{})
+		replayServer.blockIDGenerator = NewSequentialBlockIDGenerator("block-")
+		require.NoError(t, replayServer.metaCache.AddContainer(podUID, "c1", &types.ContainerInfo{
+			PodUID:        podUID,
+			ContainerName: "c1",
+			QoSLevel:      consts.PodAnnotationQoSLevelSharedCores,
+		}))
+		replayed := replayServer.replayAdviceTrace(context.TODO(), trace)
+		want, err := json.Marshal(trace.Response.Entries)
+		require.NoError(t, err)
+		got, err := json.Marshal(replayed.Entries)
+		require.NoError(t, err)
+		require.JSONEq(t, string(want), string(got))
+	}
+
+	// pod uids are hashed consistently in all parts of the trace, while pool names are kept
+	hashed := traces[1]
+	require.True(t, hashed.PodUIDsHashed)
+	require.NotContains(t, hashed.Checkpoint.Entries, "pod1")
+	require.NotContains(t, hashed.Response.Entries, "pod1")
+	require.Contains(t, hashed.Checkpoint.Entries, commonstate.PoolNameShare)
+	require.Contains(t, hashed.Response.Entries, commonstate.PoolNameShare)
+	var hashedPodUID string
+	for entryName := range hashed.Response.Entries {
+		if strings.HasPrefix(entryName, "pod-") {
+			hashedPodUID = entryName
+		}
+	}
+	require.NotEmpty(t, hashedPodUID)
+	require.Contains(t, hashed.Checkpoint.Entries, hashedPodUID)
+	require.Equal(t, hashedPodUID, string(hashed.Pods[0].UID))
+	require.Equal(t, hashedPodUID, hashed.Pods[0].Name)
+}
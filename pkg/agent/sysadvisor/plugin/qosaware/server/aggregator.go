@@ -0,0 +1,191 @@
+/*
+Copyright 2022 The Katalyst Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"k8s.io/klog/v2"
+
+	"github.com/kubewharf/katalyst-core/pkg/agent/qrm-plugins/advisorsvc"
+	"github.com/kubewharf/katalyst-core/pkg/agent/qrm-plugins/cpu/dynamicpolicy/cpuadvisor"
+	"github.com/kubewharf/katalyst-core/pkg/metrics"
+)
+
+const (
+	cpuAdviceAggregatorServiceName  = "cpuadvisor.CPUAdviceAggregator"
+	cpuAdviceAggregatorReportMethod = "/" + cpuAdviceAggregatorServiceName + "/Report"
+
+	// AggregatorMetadataKeyNodeName is the grpc metadata key carrying the name of node that advice comes from
+	AggregatorMetadataKeyNodeName = "node_name"
+
+	aggregatorRetryInterval = time.Second
+)
+
+// Metric names for aggregator client
+const (
+	metricAggregatorReportSucceeded = "aggregator_report_succeeded"
+	metricAggregatorReportFailed    = "aggregator_report_failed"
+	metricAggregatorAdviceDropped   = "aggregator_advice_dropped"
+)
+
+// CPUAdviceAggregatorServer is the server API for the central aggregator receiving cpu advice from each node;
+// advice is forwarded as cpuadvisor.ListAndWatchResponse, and the node identity is carried by grpc metadata
+// with the key AggregatorMetadataKeyNodeName.
+type CPUAdviceAggregatorServer interface {
+	Report(context.Context, *cpuadvisor.ListAndWatchResponse) (*advisorsvc.Empty, error)
+}
+
+func RegisterCPUAdviceAggregatorServer(s *grpc.Server, srv CPUAdviceAggregatorServer) {
+	s.RegisterService(&cpuAdviceAggregatorServiceDesc, srv)
+}
+
+func cpuAdviceAggregatorReportHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(cpuadvisor.ListAndWatchResponse)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CPUAdviceAggregatorServer).Report(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: cpuAdviceAggregatorReportMethod,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CPUAdviceAggregatorServer).Report(ctx, req.(*cpuadvisor.ListAndWatchResponse))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var cpuAdviceAggregatorServiceDesc = grpc.ServiceDesc{
+	ServiceName: cpuAdviceAggregatorServiceName,
+	HandlerType: (*CPUAdviceAggregatorServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Report",
+			Handler:    cpuAdviceAggregatorReportHandler,
+		},
+	},
+	Streams: []grpc.StreamDesc{},
+}
+
+// aggregatorClient forwards advice to the central aggregator asynchronously; advice is buffered and the
+// oldest one is dropped once the buffer is full, so that pushing advice to local plugin is never blocked.
+type aggregatorClient struct {
+	conn       *grpc.ClientConn
+	nodeName   string
+	timeout    time.Duration
+	maxRetries int
+	// retryInterval is the interval between retries of forwarding a single advice
+	retryInterval time.Duration
+	buffer        chan *cpuadvisor.ListAndWatchResponse
+
+	emitter        metrics.MetricEmitter
+	genMetricsName func(string) string
+}
+
+func newAggregatorClient(address, nodeName string, timeout time.Duration, bufferSize, maxRetries int,
+	emitter metrics.MetricEmitter, genMetricsName func(string) string,
+) (*aggregatorClient, error) {
+	if bufferSize <= 0 {
+		return nil, fmt.Errorf("invalid aggregator buffer size %d", bufferSize)
+	}
+
+	// nolint
+	conn, err := grpc.Dial(address, grpc.WithInsecure())
+	if err != nil {
+		return nil, fmt.Errorf("dial aggregator %s failed: %w", address, err)
+	}
+
+	return &aggregatorClient{
+		conn:           conn,
+		nodeName:       nodeName,
+		timeout:        timeout,
+		maxRetries:     maxRetries,
+		retryInterval:  aggregatorRetryInterval,
+		buffer:         make(chan *cpuadvisor.ListAndWatchResponse, bufferSize),
+		emitter:        emitter,
+		genMetricsName: genMetricsName,
+	}, nil
+}
+
+// enqueue buffers the advice to be forwarded without blocking
+func (c *aggregatorClient) enqueue(resp *cpuadvisor.ListAndWatchResponse) {
+	for {
+		select {
+		case c.buffer <- resp:
+			return
+		default:
+		}
+
+		// drop the oldest advice to make room for the latest one
+		select {
+		case <-c.buffer:
+			klog.Warningf("[qosaware-server-cpu] aggregator buffer is full, drop the oldest advice")
+			_ = c.emitter.StoreInt64(c.genMetricsName(metricAggregatorAdviceDropped), 1, metrics.MetricTypeNameCount)
+		default:
+		}
+	}
+}
+
+// run forwards buffered advice to the aggregator one by one until stopCh is closed
+func (c *aggregatorClient) run(stopCh <-chan struct{}) {
+	defer func() {
+		_ = c.conn.Close()
+	}()
+
+	for {
+		select {
+		case <-stopCh:
+			return
+		case resp := <-c.buffer:
+			c.report(resp, stopCh)
+		}
+	}
+}
+
+// report forwards a single advice to the aggregator with the node identity, and retries on failure
+func (c *aggregatorClient) report(resp *cpuadvisor.ListAndWatchResponse, stopCh <-chan struct{}) {
+	ctx := metadata.AppendToOutgoingContext(context.Background(), AggregatorMetadataKeyNodeName, c.nodeName)
+	for retries := 0; ; retries++ {
+		reqCtx, cancel := context.WithTimeout(ctx, c.timeout)
+		err := c.conn.Invoke(reqCtx, cpuAdviceAggregatorReportMethod, resp, &advisorsvc.Empty{})
+		cancel()
+		if err == nil {
+			_ = c.emitter.StoreInt64(c.genMetricsName(metricAggregatorReportSucceeded), 1, metrics.MetricTypeNameCount)
+			return
+		}
+
+		if retries >= c.maxRetries {
+			klog.Errorf("[qosaware-server-cpu] report advice to aggregator failed after %d retries: %v", retries, err)
+			_ = c.emitter.StoreInt64(c.genMetricsName(metricAggregatorReportFailed), 1, metrics.MetricTypeNameCount)
+			return
+		}
+
+		klog.Warningf("[qosaware-server-cpu] report advice to aggregator failed, retry later: %v", err)
+		select {
+		case <-stopCh:
+			return
+		case <-time.After(c.retryInterval):
+		}
+	}
+}
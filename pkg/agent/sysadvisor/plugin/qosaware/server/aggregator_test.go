@@ -0,0 +1,158 @@
+/*
+Copyright 2022 The Katalyst Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/kubewharf/katalyst-core/pkg/agent/qrm-plugins/advisorsvc"
+	"github.com/kubewharf/katalyst-core/pkg/agent/qrm-plugins/cpu/dynamicpolicy/cpuadvisor"
+)
+
+type nodeAdvice struct {
+	nodeName string
+	resp     *cpuadvisor.ListAndWatchResponse
+}
+
+// fakeAggregatorServer records advice received along with node names, and fails the first failures calls
+type fakeAggregatorServer struct {
+	failures int32
+	received chan nodeAdvice
+}
+
+func (f *fakeAggregatorServer) Report(ctx context.Context, resp *cpuadvisor.ListAndWatchResponse) (*advisorsvc.Empty, error) {
+	if atomic.AddInt32(&f.failures, -1) >= 0 {
+		return nil, fmt.Errorf("fake error")
+	}
+
+	nodeName := ""
+	if md, ok := metadata.FromIncomingContext(ctx); ok && len(md.Get(AggregatorMetadataKeyNodeName)) > 0 {
+		nodeName = md.Get(AggregatorMetadataKeyNodeName)[0]
+	}
+	f.received <- nodeAdvice{nodeName: nodeName, resp: resp}
+	return &advisorsvc.Empty{}, nil
+}
+
+func startFakeAggregatorServer(t *testing.T, failures int32) (*fakeAggregatorServer, string) {
+	dir, err := ioutil.TempDir("", "aggregator-test")
+	require.NoError(t, err)
+	socketPath := path.Join(dir, "aggregator.sock")
+	sock, err := net.Listen("unix", socketPath)
+	require.NoError(t, err)
+
+	srv := &fakeAggregatorServer{failures: failures, received: make(chan nodeAdvice, 10)}
+	grpcServer := grpc.NewServer()
+	RegisterCPUAdviceAggregatorServer(grpcServer, srv)
+	go func() {
+		_ = grpcServer.Serve(sock)
+	}()
+	t.Cleanup(func() {
+		grpcServer.Stop()
+		_ = os.RemoveAll(dir)
+	})
+
+	return srv, "unix://" + socketPath
+}
+
+func newTestAdvice(poolName string) *cpuadvisor.ListAndWatchResponse {
+	return &cpuadvisor.ListAndWatchResponse{
+		Entries: map[string]*cpuadvisor.CalculationEntries{poolName: NewPoolCalculationEntries(poolName)},
+	}
+}
+
+func TestAggregatorClientReport(t *testing.T) {
+	t.Parallel()
+
+	// the first report fails and succeeds on retry
+	srv, address := startFakeAggregatorServer(t, 1)
+	emitter := newFakeMetricEmitter()
+	client, err := newAggregatorClient(address, "node1", time.Second, 4, 1, emitter, func(name string) string { return name })
+	require.NoError(t, err)
+	client.retryInterval = 10 * time.Millisecond
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	go client.run(stopCh)
+
+	client.enqueue(newTestAdvice("share"))
+	select {
+	case advice := <-srv.received:
+		require.Equal(t, "node1", advice.nodeName)
+		require.Contains(t, advice.resp.Entries, "share")
+	case <-time.After(5 * time.Second):
+		t.Fatal("advice not received by aggregator")
+	}
+
+	require.Eventually(t, func() bool {
+		succeeded, ok := emitter.get(metricAggregatorReportSucceeded)
+		return ok && succeeded == 1
+	}, time.Second, 10*time.Millisecond)
+	_, ok := emitter.get(metricAggregatorReportFailed)
+	require.False(t, ok)
+}
+
+func TestAggregatorClientReportFailed(t *testing.T) {
+	t.Parallel()
+
+	srv, address := startFakeAggregatorServer(t, 10)
+	emitter := newFakeMetricEmitter()
+	client, err := newAggregatorClient(address, "node1", time.Second, 4, 2, emitter, func(name string) string { return name })
+	require.NoError(t, err)
+	client.retryInterval = 10 * time.Millisecond
+
+	// advice is given up after retries are exhausted
+	client.report(newTestAdvice("share"), make(chan struct{}))
+	failed, ok := emitter.get(metricAggregatorReportFailed)
+	require.True(t, ok)
+	require.Equal(t, int64(1), failed)
+	require.Equal(t, int32(7), atomic.LoadInt32(&srv.failures))
+	require.Empty(t, srv.received)
+}
+
+func TestAggregatorClientEnqueueNonBlocking(t *testing.T) {
+	t.Parallel()
+
+	emitter := newFakeMetricEmitter()
+	// the aggregator is unreachable and the client is not running
+	client, err := newAggregatorClient("unix:///non-existent/aggregator.sock", "node1", time.Second, 2, 0,
+		emitter, func(name string) string { return name })
+	require.NoError(t, err)
+
+	for _, poolName := range []string{"pool1", "pool2", "pool3"} {
+		client.enqueue(newTestAdvice(poolName))
+	}
+
+	// the oldest advice is dropped to make room for the latest one
+	require.Len(t, client.buffer, 2)
+	require.Contains(t, (<-client.buffer).Entries, "pool2")
+	require.Contains(t, (<-client.buffer).Entries, "pool3")
+	dropped, ok := emitter.get(metricAggregatorAdviceDropped)
+	require.True(t, ok)
+	require.Equal(t, int64(1), dropped)
+}
@@ -0,0 +1,214 @@
+/*
+Copyright 2022 The Katalyst Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+
+	"github.com/kubewharf/katalyst-core/pkg/agent/qrm-plugins/commonstate"
+	"github.com/kubewharf/katalyst-core/pkg/agent/qrm-plugins/cpu/dynamicpolicy/cpuadvisor"
+	"github.com/kubewharf/katalyst-core/pkg/metrics"
+)
+
+// Metric names for advice audit
+const (
+	metricAdviceAuditEventsRecorded = "advice_audit_events_recorded"
+	metricAdviceAuditRecordFailed   = "advice_audit_record_failed"
+)
+
+// AdviceAuditEventType is the type of change between consecutively pushed advice
+type AdviceAuditEventType string
+
+const (
+	AdviceAuditEventPoolAdded        AdviceAuditEventType = "pool-added"
+	AdviceAuditEventPoolRemoved      AdviceAuditEventType = "pool-removed"
+	AdviceAuditEventPoolResized      AdviceAuditEventType = "pool-resized"
+	AdviceAuditEventContainerPlaced  AdviceAuditEventType = "container-placed"
+	AdviceAuditEventContainerMoved   AdviceAuditEventType = "container-moved"
+	AdviceAuditEventContainerRemoved AdviceAuditEventType = "container-removed"
+)
+
+// AdviceAuditEvent is a structured record of a single change between consecutively pushed advice;
+// pool sizes are the number of cpus keyed by numa id.
+type AdviceAuditEvent struct {
+	Timestamp     time.Time            `json:"timestamp"`
+	Type          AdviceAuditEventType `json:"type"`
+	PoolName      string               `json:"poolName,omitempty"`
+	OldSizes      map[int64]uint64     `json:"oldSizes,omitempty"`
+	NewSizes      map[int64]uint64     `json:"newSizes,omitempty"`
+	PodUID        string               `json:"podUID,omitempty"`
+	ContainerName string               `json:"containerName,omitempty"`
+	OldPoolName   string               `json:"oldPoolName,omitempty"`
+	NewPoolName   string               `json:"newPoolName,omitempty"`
+}
+
+// adviceAuditSink records advice audit events, and it must be append-only
+type adviceAuditSink interface {
+	Record(events []AdviceAuditEvent) error
+}
+
+// fileAdviceAuditSink appends advice audit events to a file as json lines
+type fileAdviceAuditSink struct {
+	path string
+}
+
+func (s *fileAdviceAuditSink) Record(events []AdviceAuditEvent) error {
+	file, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(file)
+	for _, event := range events {
+		if err := encoder.Encode(event); err != nil {
+			_ = file.Close()
+			return fmt.Errorf("encode audit event failed: %w", err)
+		}
+	}
+	return file.Close()
+}
+
+// adviceAuditState is the part of pushed advice tracked by audit
+type adviceAuditState struct {
+	poolSizes      map[string]map[int64]uint64
+	containerPools map[ContainerMeta]string
+}
+
+func newAdviceAuditState(calculationEntriesMap map[string]*cpuadvisor.CalculationEntries) *adviceAuditState {
+	state := &adviceAuditState{
+		poolSizes:      make(map[string]map[int64]uint64),
+		containerPools: make(map[ContainerMeta]string),
+	}
+	for entryName, entries := range calculationEntriesMap {
+		if poolInfo, ok := entries.Entries[commonstate.FakedContainerName]; ok {
+			sizes := make(map[int64]uint64, len(poolInfo.CalculationResultsByNumas))
+			for numaID, numaCalculationResult := range poolInfo.CalculationResultsByNumas {
+				for _, block := range numaCalculationResult.Blocks {
+					sizes[numaID] += block.Result
+				}
+			}
+			state.poolSizes[entryName] = sizes
+			continue
+		}
+
+		for containerName, calculationInfo := range entries.Entries {
+			state.containerPools[ContainerMeta{PodUID: entryName, ContainerName: containerName}] = calculationInfo.OwnerPoolName
+		}
+	}
+	return state
+}
+
+// diffAdviceAuditStates returns change events from prev to cur in a deterministic order;
+// all pools and containers are regarded as added if prev is nil
+func diffAdviceAuditStates(prev, cur *adviceAuditState, now time.Time) []AdviceAuditEvent {
+	if prev == nil {
+		prev = &adviceAuditState{}
+	}
+
+	var events []AdviceAuditEvent
+	for poolName, newSizes := range cur.poolSizes {
+		oldSizes, ok := prev.poolSizes[poolName]
+		if !ok {
+			events = append(events, AdviceAuditEvent{Timestamp: now, Type: AdviceAuditEventPoolAdded, PoolName: poolName, NewSizes: newSizes})
+		} else if !reflect.DeepEqual(oldSizes, newSizes) {
+			events = append(events, AdviceAuditEvent{
+				Timestamp: now, Type: AdviceAuditEventPoolResized, PoolName: poolName, OldSizes: oldSizes, NewSizes: newSizes,
+			})
+		}
+	}
+	for poolName, oldSizes := range prev.poolSizes {
+		if _, ok := cur.poolSizes[poolName]; !ok {
+			events = append(events, AdviceAuditEvent{Timestamp: now, Type: AdviceAuditEventPoolRemoved, PoolName: poolName, OldSizes: oldSizes})
+		}
+	}
+
+	for meta, newPoolName := range cur.containerPools {
+		event := AdviceAuditEvent{Timestamp: now, PodUID: meta.PodUID, ContainerName: meta.ContainerName, NewPoolName: newPoolName}
+		oldPoolName, ok := prev.containerPools[meta]
+		if !ok {
+			event.Type = AdviceAuditEventContainerPlaced
+		} else if oldPoolName != newPoolName {
+			event.Type = AdviceAuditEventContainerMoved
+			event.OldPoolName = oldPoolName
+		} else {
+			continue
+		}
+		events = append(events, event)
+	}
+	for meta, oldPoolName := range prev.containerPools {
+		if _, ok := cur.containerPools[meta]; !ok {
+			events = append(events, AdviceAuditEvent{
+				Timestamp: now, Type: AdviceAuditEventContainerRemoved, PodUID: meta.PodUID, ContainerName: meta.ContainerName, OldPoolName: oldPoolName,
+			})
+		}
+	}
+
+	sort.Slice(events, func(i, j int) bool {
+		if events[i].Type != events[j].Type {
+			return events[i].Type < events[j].Type
+		}
+		if events[i].PoolName != events[j].PoolName {
+			return events[i].PoolName < events[j].PoolName
+		}
+		if events[i].PodUID != events[j].PodUID {
+			return events[i].PodUID < events[j].PodUID
+		}
+		return events[i].ContainerName < events[j].ContainerName
+	})
+	return events
+}
+
+// adviceAuditor records changes between consecutively pushed advice to the sink
+type adviceAuditor struct {
+	sink adviceAuditSink
+	// mutex protects lastState, since advice may be pushed by both ListAndWatch and GetAdvice
+	mutex     sync.Mutex
+	lastState *adviceAuditState
+}
+
+// auditAdvice records changes of the pushed advice compared with the last one, if audit is enabled
+func (cs *cpuServer) auditAdvice(calculationEntriesMap map[string]*cpuadvisor.CalculationEntries) {
+	if cs.adviceAuditor == nil {
+		return
+	}
+
+	cs.adviceAuditor.mutex.Lock()
+	defer cs.adviceAuditor.mutex.Unlock()
+
+	state := newAdviceAuditState(calculationEntriesMap)
+	events := diffAdviceAuditStates(cs.adviceAuditor.lastState, state, cs.clock.Now())
+	if len(events) == 0 {
+		return
+	}
+
+	// the last state is kept on failure, so that changes are recorded along with the next advice
+	if err := cs.adviceAuditor.sink.Record(events); err != nil {
+		klog.Errorf("[qosaware-server-cpu] record %d advice audit events failed: %v", len(events), err)
+		_ = cs.emitter.StoreInt64(cs.genMetricsName(metricAdviceAuditRecordFailed), 1, metrics.MetricTypeNameCount)
+		return
+	}
+	cs.adviceAuditor.lastState = state
+	_ = cs.emitter.StoreInt64(cs.genMetricsName(metricAdviceAuditEventsRecorded), int64(len(events)), metrics.MetricTypeNameCount)
+}
@@ -0,0 +1,116 @@
+/*
+Copyright 2022 The Katalyst Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+
+	"github.com/kubewharf/katalyst-api/pkg/consts"
+	"github.com/kubewharf/katalyst-core/pkg/agent/qrm-plugins/commonstate"
+	"github.com/kubewharf/katalyst-core/pkg/agent/sysadvisor/types"
+)
+
+func readAdviceAuditEvents(t *testing.T, auditLogPath string) []AdviceAuditEvent {
+	file, err := os.Open(auditLogPath)
+	require.NoError(t, err)
+	defer func() {
+		_ = file.Close()
+	}()
+
+	events := make([]AdviceAuditEvent, 0)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		event := AdviceAuditEvent{}
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &event))
+		events = append(events, event)
+	}
+	require.NoError(t, scanner.Err())
+	return events
+}
+
+func TestCPUServerAuditAdvice(t *testing.T) {
+	t.Parallel()
+
+	auditLogPath := path.Join(t.TempDir(), "advice-audit.log")
+	cs := newTestCPUServer(t, nil, []*v1.Pod{})
+	cs.adviceAuditor = &adviceAuditor{sink: &fileAdviceAuditSink{path: auditLogPath}}
+
+	ci := &types.ContainerInfo{
+		PodUID:              "pod1",
+		ContainerName:       "c1",
+		QoSLevel:            consts.PodAnnotationQoSLevelSharedCores,
+		OwnerPoolName:       commonstate.PoolNameShare,
+		OriginOwnerPoolName: commonstate.PoolNameShare,
+	}
+	require.NoError(t, cs.metaCache.AddContainer("pod1", "c1", ci))
+	cs.auditAdvice(cs.assembleResponse(&types.InternalCPUCalculationResult{
+		PoolEntries: map[string]map[int]types.CPUResource{
+			commonstate.PoolNameShare: {-1: {Size: 4}},
+			"share-a":                 {-1: {Size: 2}},
+		},
+	}).Entries)
+
+	// all pools and containers are recorded as added in the first advice
+	events := readAdviceAuditEvents(t, auditLogPath)
+	require.Len(t, events, 3)
+	require.Equal(t, AdviceAuditEventContainerPlaced, events[0].Type)
+	require.Equal(t, commonstate.PoolNameShare, events[0].NewPoolName)
+	require.Equal(t, AdviceAuditEventPoolAdded, events[1].Type)
+	require.Equal(t, commonstate.PoolNameShare, events[1].PoolName)
+	require.Equal(t, AdviceAuditEventPoolAdded, events[2].Type)
+	require.Equal(t, "share-a", events[2].PoolName)
+
+	// no events are recorded if nothing changes
+	cs.auditAdvice(cs.assembleResponse(&types.InternalCPUCalculationResult{
+		PoolEntries: map[string]map[int]types.CPUResource{
+			commonstate.PoolNameShare: {-1: {Size: 4}},
+			"share-a":                 {-1: {Size: 2}},
+		},
+	}).Entries)
+	require.Len(t, readAdviceAuditEvents(t, auditLogPath), 3)
+
+	// share pool is resized, share-a is removed, and the container is moved to share-b
+	ci.OwnerPoolName, ci.OriginOwnerPoolName = "share-b", "share-b"
+	require.NoError(t, cs.metaCache.SetContainerInfo("pod1", "c1", ci))
+	cs.auditAdvice(cs.assembleResponse(&types.InternalCPUCalculationResult{
+		PoolEntries: map[string]map[int]types.CPUResource{
+			commonstate.PoolNameShare: {-1: {Size: 6}},
+			"share-b":                 {-1: {Size: 2}},
+		},
+	}).Entries)
+
+	events = readAdviceAuditEvents(t, auditLogPath)[3:]
+	require.Len(t, events, 4)
+	require.Equal(t, AdviceAuditEventContainerMoved, events[0].Type)
+	require.Equal(t, commonstate.PoolNameShare, events[0].OldPoolName)
+	require.Equal(t, "share-b", events[0].NewPoolName)
+	require.Equal(t, AdviceAuditEventPoolAdded, events[1].Type)
+	require.Equal(t, "share-b", events[1].PoolName)
+	require.Equal(t, AdviceAuditEventPoolRemoved, events[2].Type)
+	require.Equal(t, "share-a", events[2].PoolName)
+	require.Equal(t, AdviceAuditEventPoolResized, events[3].Type)
+	require.Equal(t, commonstate.PoolNameShare, events[3].PoolName)
+	require.Equal(t, map[int64]uint64{-1: 4}, events[3].OldSizes)
+	require.Equal(t, map[int64]uint64{-1: 6}, events[3].NewSizes)
+}
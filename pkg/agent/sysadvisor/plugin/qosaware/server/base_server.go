@@ -20,6 +20,7 @@ import (
 	"context"
 	"fmt"
 	"net"
+	"net/http"
 	"os"
 	"path"
 	"reflect"
@@ -72,6 +73,12 @@ type baseServer struct {
 	pluginSocketPath              string
 	reclaimRelativeRootCgroupPath string
 	stopCh                        chan struct{}
+	// drainTimeout bounds the last push of ListAndWatch loop on shutdown, and zero disables draining
+	drainTimeout time.Duration
+	// periodJitterFactor is the max fraction of period added to each ListAndWatch cycle by jitter,
+	// which is injectable for tests and defaults to wait.Jitter
+	periodJitterFactor float64
+	jitter             func(duration time.Duration, maxFactor float64) time.Duration
 	// resourceRequestName and resourceLimitName are field names of types.ContainerInfo
 	resourceRequestName string
 	resourceLimitName   string
@@ -85,15 +92,26 @@ type baseServer struct {
 	grpcServer      *grpc.Server
 	resourceServer  subQRMServer
 	resourceAdvisor subResourceAdvisor
+
+	// debugHandlers are registered to the debug endpoint on start and unregistered on stop,
+	// keyed by handler name
+	debugHandlers map[string]http.HandlerFunc
+	// cpuResponseHooks post-process the response of cpu ListAndWatch before sending, and
+	// they are given by WithCPUResponseHook at construction
+	cpuResponseHooks []namedCPUResponseHook
 }
 
+// ServerOption configures a qrm plugin server at construction
+type ServerOption func(bs *baseServer)
+
 func newBaseServer(
 	name string, conf *config.Configuration,
 	metaCache metacache.MetaCache, metaServer *metaserver.MetaServer, emitter metrics.MetricEmitter,
 	resourceAdvisor subResourceAdvisor,
 	resourceServer subQRMServer,
+	opts ...ServerOption,
 ) *baseServer {
-	return &baseServer{
+	bs := &baseServer{
 		name:                          name,
 		period:                        conf.QoSAwarePluginConfiguration.SyncPeriod,
 		qosConf:                       conf.QoSConfiguration,
@@ -104,13 +122,29 @@ func newBaseServer(
 		resourceAdvisor:               resourceAdvisor,
 		resourceServer:                resourceServer,
 		reclaimRelativeRootCgroupPath: conf.ReclaimRelativeRootCgroupPath,
+		periodJitterFactor:            conf.QRMServerPeriodJitterFactor,
+		jitter:                        wait.Jitter,
+		debugHandlers:                 make(map[string]http.HandlerFunc),
+	}
+	for _, opt := range opts {
+		opt(bs)
 	}
+	return bs
 }
 
 func (bs *baseServer) Name() string {
 	return bs.name
 }
 
+// jitteredPeriod returns the interval to the next ListAndWatch cycle, which is period with jitter if enabled,
+// so that servers restarted together do not hit plugins at aligned intervals
+func (bs *baseServer) jitteredPeriod() time.Duration {
+	if bs.periodJitterFactor <= 0 {
+		return bs.period
+	}
+	return bs.jitter(bs.period, bs.periodJitterFactor)
+}
+
 func (bs *baseServer) genMetricsName(name string) string {
 	prefix := strings.ReplaceAll(bs.name, "-", "_")
 	name = strings.Join([]string{prefix, name}, "_")
@@ -120,6 +154,10 @@ func (bs *baseServer) genMetricsName(name string) string {
 func (bs *baseServer) Start() error {
 	_ = bs.emitter.StoreInt64(bs.genMetricsName(metricServerStartCalled), int64(bs.period.Seconds()), metrics.MetricTypeNameCount)
 
+	for name, handler := range bs.debugHandlers {
+		general.RegisterDebugHandler(name, handler)
+	}
+
 	go wait.PollImmediateUntil(2*time.Second, func() (bool, error) {
 		klog.Infof("[qosaware-server] starting %s", bs.name)
 		if err := bs.serve(); err != nil {
@@ -198,6 +236,10 @@ func (bs *baseServer) Stop() error {
 	close(bs.stopCh)
 	_ = bs.emitter.StoreInt64(bs.genMetricsName(metricServerStopCalled), int64(bs.period.Seconds()), metrics.MetricTypeNameCount)
 
+	for name := range bs.debugHandlers {
+		general.UnregisterDebugHandler(name)
+	}
+
 	if bs.grpcServer != nil {
 		bs.grpcServer.Stop()
 		klog.Infof("[qosaware-server] %v stopped", bs.name)
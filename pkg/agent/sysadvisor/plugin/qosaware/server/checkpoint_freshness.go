@@ -0,0 +1,190 @@
+/*
+Copyright 2022 The Katalyst Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/samber/lo"
+	"k8s.io/klog/v2"
+
+	"github.com/kubewharf/katalyst-core/pkg/agent/qrm-plugins/cpu/dynamicpolicy/cpuadvisor"
+	"github.com/kubewharf/katalyst-core/pkg/metrics"
+	"github.com/kubewharf/katalyst-core/pkg/util/general"
+)
+
+// cpuServerCheckpointFreshnessHealthCheckName is the name of health check on whether checkpoints of cpu plugins
+// keep changing along with pods, in addition to liveness of ListAndWatch loop checked by cpuServerLWHealthCheckName
+const cpuServerCheckpointFreshnessHealthCheckName = "cpu-server-checkpoint-freshness"
+
+// Metric names for checkpoint freshness
+const (
+	metricCPUServerCheckpointUnchangedCycles = "checkpoint_unchanged_cycles"
+)
+
+// CheckpointCompareMethod is the method to tell whether checkpoints of consecutive cycles are unchanged
+type CheckpointCompareMethod string
+
+const (
+	// CheckpointCompareMethodBytes regards checkpoints as unchanged if they are byte-identical in a canonical
+	// encoding, i.e. all fields of all entries are identical
+	CheckpointCompareMethodBytes CheckpointCompareMethod = "bytes"
+	// CheckpointCompareMethodEntries regards checkpoints as unchanged if they have the same pool and container
+	// entries, so that changes of assignments alone never make a checkpoint fresh
+	CheckpointCompareMethodEntries CheckpointCompareMethod = "entries"
+)
+
+// checkpointFreshness tracks how long the checkpoint stays unchanged, and the pods observed when it last changed
+type checkpointFreshness struct {
+	initialized     bool
+	fingerprint     [sha256.Size]byte
+	unchangedCycles int
+	// podsFingerprint is unknown if pods failed to be listed when the checkpoint last changed
+	podsKnown       bool
+	podsFingerprint [sha256.Size]byte
+}
+
+// fingerprintCheckpoint digests the checkpoint by the compare method. Protobuf encoding is never digested,
+// since maps are encoded in random order; all maps are encoded with sorted keys instead.
+func fingerprintCheckpoint(resp *cpuadvisor.GetCheckpointResponse, method CheckpointCompareMethod) [sha256.Size]byte {
+	switch method {
+	case CheckpointCompareMethodEntries:
+		keys := make([]string, 0, len(resp.Entries))
+		for entryName, entries := range resp.Entries {
+			for containerName := range entries.GetEntries() {
+				keys = append(keys, entryName+"/"+containerName)
+			}
+		}
+		return fingerprintStrings(keys)
+	default:
+		return fingerprintCheckpointContent(resp)
+	}
+}
+
+// fingerprintCheckpointContent digests all fields of all entries, in the order of entry names and container names
+func fingerprintCheckpointContent(resp *cpuadvisor.GetCheckpointResponse) [sha256.Size]byte {
+	h := sha256.New()
+	write := func(values ...string) {
+		for _, value := range values {
+			h.Write([]byte(value))
+			h.Write([]byte{0})
+		}
+	}
+	writeAssignments := func(assignments map[uint64]string) {
+		numaIDs := lo.Keys(assignments)
+		sort.Slice(numaIDs, func(i, j int) bool { return numaIDs[i] < numaIDs[j] })
+		write(strconv.Itoa(len(numaIDs)))
+		for _, numaID := range numaIDs {
+			write(strconv.FormatUint(numaID, 10), assignments[numaID])
+		}
+	}
+
+	entryNames := lo.Keys(resp.Entries)
+	sort.Strings(entryNames)
+	for _, entryName := range entryNames {
+		entries := resp.Entries[entryName].GetEntries()
+		containerNames := lo.Keys(entries)
+		sort.Strings(containerNames)
+		write(entryName, strconv.Itoa(len(containerNames)))
+		for _, containerName := range containerNames {
+			info := entries[containerName]
+			write(containerName, strconv.FormatBool(info.GetRampUp()), info.GetOwnerPoolName())
+			writeAssignments(info.GetTopologyAwareAssignments())
+			writeAssignments(info.GetOriginalTopologyAwareAssignments())
+		}
+	}
+
+	var sum [sha256.Size]byte
+	copy(sum[:], h.Sum(nil))
+	return sum
+}
+
+func fingerprintStrings(values []string) [sha256.Size]byte {
+	sort.Strings(values)
+	h := sha256.New()
+	for _, value := range values {
+		h.Write([]byte(value))
+		h.Write([]byte{0})
+	}
+	var sum [sha256.Size]byte
+	copy(sum[:], h.Sum(nil))
+	return sum
+}
+
+// checkCheckpointFreshness counts consecutive cycles with an unchanged checkpoint, and the checkpoint freshness
+// health check is not ready if it exceeds checkpointFrozenCycles although pods have changed since the checkpoint
+// last changed, i.e. the plugin keeps returning a stale checkpoint while its loop is still alive
+func (cs *cpuServer) checkCheckpointFreshness(ctx context.Context, resp *cpuadvisor.GetCheckpointResponse) {
+	if cs.checkpointFrozenCycles <= 0 {
+		return
+	}
+
+	fingerprint := fingerprintCheckpoint(resp, cs.checkpointCompareMethod)
+	podsFingerprint, podsErr := cs.fingerprintPods(ctx)
+	if podsErr != nil {
+		klog.Warningf("[qosaware-server-cpu] list pods failed, pod churn is unknown: %v", podsErr)
+	}
+
+	cs.lwHealthMutex.Lock()
+	defer cs.lwHealthMutex.Unlock()
+
+	freshness := &cs.checkpointFreshness
+	if !freshness.initialized || freshness.fingerprint != fingerprint {
+		freshness.initialized = true
+		freshness.fingerprint = fingerprint
+		freshness.unchangedCycles = 0
+		freshness.podsKnown = podsErr == nil
+		freshness.podsFingerprint = podsFingerprint
+	} else {
+		freshness.unchangedCycles++
+	}
+	cs.lwHealthDetail.CheckpointUnchangedCycles = freshness.unchangedCycles
+	_ = cs.emitter.StoreInt64(cs.genMetricsName(metricCPUServerCheckpointUnchangedCycles), int64(freshness.unchangedCycles), metrics.MetricTypeNameRaw,
+		metrics.MetricTag{Key: "socket", Val: cs.advisorSocketPath})
+
+	// churn is never assumed if pods are unknown either now or when the checkpoint last changed
+	podChurned := podsErr == nil && freshness.podsKnown && podsFingerprint != freshness.podsFingerprint
+	if freshness.unchangedCycles > cs.checkpointFrozenCycles && podChurned {
+		if !cs.lwHealthDetail.CheckpointFrozen {
+			klog.Warningf("[qosaware-server-cpu] checkpoint is unchanged for %d cycles despite pod churn, the plugin may be frozen",
+				freshness.unchangedCycles)
+		}
+		cs.lwHealthDetail.CheckpointFrozen = true
+		_ = general.UpdateHealthzState(cpuServerCheckpointFreshnessHealthCheckName, general.HealthzCheckStateNotReady,
+			fmt.Sprintf("checkpoint is unchanged for %d cycles despite pod churn", freshness.unchangedCycles))
+		return
+	}
+	cs.lwHealthDetail.CheckpointFrozen = false
+	_ = general.UpdateHealthzState(cpuServerCheckpointFreshnessHealthCheckName, general.HealthzCheckStateReady, "")
+}
+
+// fingerprintPods digests uids of pods currently observed via meta server
+func (cs *cpuServer) fingerprintPods(ctx context.Context) ([sha256.Size]byte, error) {
+	pods, err := cs.metaServer.GetPodList(ctx, nil)
+	if err != nil {
+		return [sha256.Size]byte{}, err
+	}
+	podUIDs := make([]string, 0, len(pods))
+	for _, pod := range pods {
+		podUIDs = append(podUIDs, string(pod.UID))
+	}
+	return fingerprintStrings(podUIDs), nil
+}
@@ -19,18 +19,34 @@ package server
 import (
 	"context"
 	"encoding/json"
+	stdErrors "errors"
 	"fmt"
 	"io"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/samber/lo"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"google.golang.org/grpc"
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/apimachinery/pkg/util/errors"
 	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/util/workqueue"
 	"k8s.io/klog/v2"
+	"k8s.io/utils/clock"
 
 	"github.com/kubewharf/katalyst-api/pkg/consts"
 	"github.com/kubewharf/katalyst-core/pkg/agent/qrm-plugins/advisorsvc"
@@ -38,15 +54,21 @@ import (
 	"github.com/kubewharf/katalyst-core/pkg/agent/qrm-plugins/cpu/dynamicpolicy/cpuadvisor"
 	"github.com/kubewharf/katalyst-core/pkg/agent/sysadvisor/metacache"
 	"github.com/kubewharf/katalyst-core/pkg/agent/sysadvisor/plugin/qosaware/reporter"
+	"github.com/kubewharf/katalyst-core/pkg/agent/sysadvisor/plugin/qosaware/reporter/manager"
 	"github.com/kubewharf/katalyst-core/pkg/agent/sysadvisor/plugin/qosaware/resource/cpu"
 	"github.com/kubewharf/katalyst-core/pkg/agent/sysadvisor/types"
 	"github.com/kubewharf/katalyst-core/pkg/agent/utilcomponent/featuregatenegotiation"
 	"github.com/kubewharf/katalyst-core/pkg/agent/utilcomponent/featuregatenegotiation/finders"
+	"github.com/kubewharf/katalyst-core/pkg/agent/utilcomponent/featuregatenegotiation/finders/feature_cpu"
 	"github.com/kubewharf/katalyst-core/pkg/config"
+	"github.com/kubewharf/katalyst-core/pkg/config/generic"
+	coreconsts "github.com/kubewharf/katalyst-core/pkg/consts"
 	"github.com/kubewharf/katalyst-core/pkg/metaserver"
+	metaserverpod "github.com/kubewharf/katalyst-core/pkg/metaserver/agent/pod"
 	"github.com/kubewharf/katalyst-core/pkg/metrics"
 	"github.com/kubewharf/katalyst-core/pkg/util/cgroup/common"
 	"github.com/kubewharf/katalyst-core/pkg/util/general"
+	utilkubeconfig "github.com/kubewharf/katalyst-core/pkg/util/kubelet/config"
 	"github.com/kubewharf/katalyst-core/pkg/util/machine"
 )
 
@@ -54,17 +76,446 @@ const (
 	cpuServerName string = "cpu-server"
 
 	cpuServerLWHealthCheckName = "cpu-server-lw"
+	// cpuServerTracerName is the name of tracer emitting spans of push cycles
+	cpuServerTracerName = "katalyst-core/cpu-server"
+	// cpuServerAssignmentsDebugHandlerName is the name of debug handler exporting container cpu assignments
+	cpuServerAssignmentsDebugHandlerName = "cpu-server-assignments"
+	// cpuServerBlocksDebugHandlerName is the name of debug handler exporting the latest blocks and overlaps as Graphviz DOT
+	cpuServerBlocksDebugHandlerName = "cpu-server-blocks"
+	// cpuServerBlockAssignmentsDebugHandlerName is the name of debug handler exporting the latest calculation entries and blocks as json
+	cpuServerBlockAssignmentsDebugHandlerName = "cpu-server-block-assignments"
+	// cpuServerAdviceInputsDebugHandlerName is the name of debug handler exporting advisor input snapshots of latest push cycles
+	cpuServerAdviceInputsDebugHandlerName = "cpu-server-advice-inputs"
+	// cpuServerHealthDebugHandlerName is the name of debug handler exporting the health detail of ListAndWatch loop as json
+	cpuServerHealthDebugHandlerName = "cpu-server-health"
+	// cpuServerReclaimOverlapDebugHandlerName is the name of debug handler exporting the reclaim overlap of the latest sent advice as json
+	cpuServerReclaimOverlapDebugHandlerName = "cpu-server-reclaim-overlap"
+	// getCheckpointRetryInterval is the interval between GetCheckpoint calls retried on nil or empty checkpoint
+	getCheckpointRetryInterval = 100 * time.Millisecond
 
 	DefaultCFSCPUPeriod = 100000
 )
 
+// Metric names for cpu server
+const (
+	metricCPUServerControlKnobSuppressed     = "control_knob_suppressed"
+	metricCPUServerPushCycleDeadlineExceeded = "push_cycle_deadline_exceeded"
+	metricCPUServerOverlapActive             = "overlap_active"
+	metricCPUServerOverlapActiveNUMACount    = "overlap_active_numa_count"
+	metricCPUServerPluginReconnected         = "plugin_reconnected"
+	metricCPUServerStaleContainerCount       = "stale_container_count"
+	metricCPUServerCheckpointConflicted      = "checkpoint_conflicted"
+	metricCPUServerSkipPushStaleSync         = "skip_push_stale_sync"
+	metricCPUServerOverlapExcludedContainers = "overlap_excluded_containers"
+	metricCPUServerBlocksReused              = "blocks_reused"
+	metricCPUServerBlocksCreated             = "blocks_created"
+	metricCPUServerSkipPushOutOfWindow       = "skip_push_out_of_window"
+	metricCPUServerContainerGCDeferred       = "container_gc_deferred"
+	metricCPUServerPoolHeadroomTotal         = "pool_headroom_total"
+	metricCPUServerPoolHeadroomDiverged      = "pool_headroom_diverged"
+	metricCPUServerPodFetchFailedContainers  = "pod_fetch_failed_containers"
+	metricCPUServerAdviceLatency             = "advice_latency"
+	metricCPUServerGCDisabled                = "gc_disabled"
+	metricCPUServerPoolNUMADistributionDrift = "pool_numa_distribution_drift"
+	metricCPUServerPoolBlocksMerged          = "pool_blocks_merged"
+	metricCPUServerPoolBlocksExceeded        = "pool_blocks_exceeded"
+	metricCPUServerReserveReclaimOverlapped  = "reserve_reclaim_overlapped"
+	metricCPUServerRampUpOverridden          = "ramp_up_overridden"
+	metricCPUServerPoolMembershipViolations  = "pool_membership_violations"
+	metricCPUServerHeadroomClamped           = "headroom_clamped"
+	metricCPUServerEmptyDedicatedAssignments = "empty_dedicated_assignments"
+	metricCPUServerPoolNUMABlocksMerged      = "pool_numa_blocks_merged"
+	metricCPUServerOrphanContainerFallback   = "orphan_container_fallback"
+	metricCPUServerGCSkippedOnUpdateFailure  = "gc_skipped_on_update_failure"
+	metricCPUServerLWWatchdogTriggered       = "lw_watchdog_triggered"
+	metricCPUServerAbsentPoolCarriedForward  = "absent_pool_carried_forward"
+	metricCPUServerIsolationTransitionDamped = "isolation_transition_damped"
+	metricCPUServerPoolGCProtected           = "pool_gc_protected"
+	metricCPUServerPoolGCProtectedCount      = "pool_gc_protected_count"
+	metricCPUServerNUMAHeadroomOvercommitted = "numa_headroom_overcommitted"
+	metricCPUServerContainerCPUFloorApplied  = "container_cpu_floor_applied"
+	metricCPUServerLWDrainPush               = "lw_drain_push"
+	metricCPUServerReclaimPoolShrinkClamped  = "reclaim_pool_shrink_clamped"
+	metricCPUServerPluginDialFailed          = "plugin_dial_failed"
+	metricCPUServerDuplicateBlocksRemoved    = "duplicate_blocks_removed"
+	metricCPUServerGetPodTimeout             = "get_pod_timeout"
+	metricCPUServerPoolStabilityScore        = "pool_stability_score"
+	metricCPUServerReclaimOverlapInvalid     = "reclaim_overlap_invalid"
+	metricCPUServerSkipPushStartingUp        = "skip_push_starting_up"
+	metricCPUServerReclaimOverlapDisabled    = "reclaim_overlap_disabled"
+	metricCPUServerCallTimeout               = "call_timeout"
+	metricCPUServerUnsettledContainerCount   = "unsettled_container_count"
+	metricCPUServerSuspectCheckpoint         = "suspect_checkpoint"
+	metricCPUServerBlockSetBlocks            = "block_set_blocks"
+	metricCPUServerBlockSetOverlapJoins      = "block_set_overlap_joins"
+	metricCPUServerBlockSetMaxOverlapFanOut  = "block_set_max_overlap_fan_out"
+	metricCPUServerPoolNUMABlocks            = "pool_numa_blocks"
+	metricCPUServerStrictAssemblyAborted     = "strict_assembly_aborted"
+	metricCPUServerDryRunAdvice              = "dry_run_advice"
+	metricCPUServerQoSLevelChangeRejected    = "qos_level_change_rejected"
+	metricCPUServerQoSLevelResolutionCost    = "qos_level_resolution_cost"
+	metricCPUServerStageDuration             = "stage_duration"
+	metricCPUServerSecondaryObserveFailed    = "secondary_plugin_observe_failed"
+	metricCPUServerSecondaryDiverged         = "secondary_plugin_diverged_containers"
+	metricCPUServerGetPodFailed              = "get_pod_failed"
+	metricCPUServerSkipPushReserveUncovered  = "skip_push_reserve_uncovered"
+	metricCPUServerCheckpointUpdates         = "checkpoint_updates"
+	metricCPUServerLWLoopRestarts            = "lw_loop_restarts"
+	metricCPUServerLastCheckpointSuccess     = "last_checkpoint_success_timestamp"
+	metricCPUServerNUMAHeadroomRaw           = "numa_headroom_raw"
+	metricCPUServerNUMAHeadroomAdjusted      = "numa_headroom_overlap_adjusted"
+	metricCPUServerUnmanagedContainerCount   = "unmanaged_container_count"
+	metricCPUServerPoolMissingContainers     = "pool_missing_containers"
+	metricCPUServerSidecarNUMAMismatch       = "sidecar_numa_mismatch"
+	metricCPUServerCheckpointResponses       = "checkpoint_responses"
+	metricCPUServerLWResponseBytes           = "lw_response_bytes"
+	metricCPUServerLWResponseEntries         = "lw_response_entries"
+	metricCPUServerLWResponseChunks          = "lw_response_chunks"
+	metricCPUServerLWSendTimeout             = "lw_send_timeout"
+	metricCPUServerReclaimFloorBorrowed      = "reclaim_floor_borrowed"
+	metricCPUServerReclaimFloorUnsatisfied   = "reclaim_floor_unsatisfied"
+	metricCPUServerBlockIDCollided           = "block_id_collided"
+	metricCPUServerNUMAHeadroomPreReserve    = "numa_headroom_pre_reservation"
+	metricCPUServerNUMAHeadroomPostReserve   = "numa_headroom_post_reservation"
+	metricCPUServerAdvisorUpdateInFlight     = "advisor_update_in_flight"
+)
+
+// poolTypeCompatibleQoSLevels are qos levels of containers allowed to be members of each type of pool;
+// pools of other types (e.g. reserve, interrupt and fallback) are not validated
+var poolTypeCompatibleQoSLevels = map[string]sets.String{
+	commonstate.PoolNameShare:           sets.NewString(consts.PodAnnotationQoSLevelSharedCores),
+	commonstate.PoolNamePrefixIsolation: sets.NewString(consts.PodAnnotationQoSLevelSharedCores),
+	commonstate.PoolNameReclaim:         sets.NewString(consts.PodAnnotationQoSLevelReclaimedCores),
+	// both isolated shared_cores and dedicated_cores fall into dedicated pool
+	commonstate.PoolNameDedicated:    sets.NewString(consts.PodAnnotationQoSLevelSharedCores, consts.PodAnnotationQoSLevelDedicatedCores),
+	commonstate.PoolNamePrefixSystem: sets.NewString(consts.PodAnnotationQoSLevelSystemCores),
+}
+
+// podCountBucketBounds are the upper bounds (exclusive) of pod count buckets used to tag advice latency
+var podCountBucketBounds = []int{50, 200}
+
 var registerCPUAdvisorHealthCheckOnce sync.Once
 
+var (
+	// ErrEmptyOwnerPool is returned if a shared or reclaimed container has an empty owner pool name
+	ErrEmptyOwnerPool = stdErrors.New("owner pool name is empty")
+	// ErrPoolNotFound is returned if a shared or reclaimed container refers to a pool absent from the assembly
+	ErrPoolNotFound = stdErrors.New("owner pool not found")
+)
+
+// errContainerNotExist is a permanent error for updating container info, which is not worth retrying
+var errContainerNotExist = fmt.Errorf("container not exist")
+
+// errIllegalQoSLevelChange is a permanent error for updating container info with a qos level change
+// to or from immutable qos levels, which is not worth retrying
+var errIllegalQoSLevelChange = fmt.Errorf("illegal qos level change")
+
+// errPluginSocketMissing indicates the cpu plugin socket is not created yet, e.g. the plugin is still starting up
+var errPluginSocketMissing = fmt.Errorf("cpu plugin socket path does not exist")
+
+// errLWSendTimedOut indicates Send on a ListAndWatch stream is timed out, and the stream must never be sent to
+// again since the timed-out Send may still be blocked on it
+var errLWSendTimedOut = fmt.Errorf("send timed out")
+
+// errAdvisorUpdateInFlight indicates an abandoned advisor update is still running, and no more update is started
+// until it finishes, so that a stuck advisor never piles up goroutines
+var errAdvisorUpdateInFlight = fmt.Errorf("previous advisor update is still in flight")
+
 type cpuServer struct {
 	*baseServer
-	startTime               time.Time
-	hasListAndWatchLoop     atomic.Value
+	startTime           time.Time
+	hasListAndWatchLoop atomic.Value
+	// advisorUpdateInFlight is non-zero while an advisor update is running, including abandoned ones
+	advisorUpdateInFlight   int32
 	headroomResourceManager reporter.HeadroomResourceManager
+	// adviceCycleMutex serializes syncing plugin state into meta cache and updating advisor between GetAdvice
+	// calls and the ListAndWatch loop, since both of them mutate meta cache
+	adviceCycleMutex sync.Mutex
+	// deniedControlKnobKeys are control knob keys filtered out of ExtraEntries
+	deniedControlKnobKeys sets.String
+	// pushCycleDeadline is the hard deadline for a whole push cycle, zero means no deadline
+	pushCycleDeadline time.Duration
+	// lwWatchdogWindow is the max duration without any successful push before ListAndWatch loop is restarted,
+	// zero means the watchdog is disabled
+	lwWatchdogWindow time.Duration
+	// lastPushSuccessTime is the last time advice is sent to the ListAndWatch stream successfully,
+	// and it is accessed by both the ListAndWatch loop and its watchdog
+	lastPushSuccessTimeMutex sync.RWMutex
+	lastPushSuccessTime      time.Time
+	// maxHeadroomRatio is the max fraction of node cpus that total reported headroom may take, zero means no limit
+	maxHeadroomRatio float64
+	// numaHeadroomReservedRatio and numaHeadroomReservedMilliCores hold back a safety margin of each numa
+	// from reported headroom, and the larger one takes effect
+	numaHeadroomReservedRatio      float64
+	numaHeadroomReservedMilliCores int64
+	// discountOverlappedHeadroom indicates whether to discount cores of shared pools overlapped by reclaim pool
+	// from reported numa headroom
+	discountOverlappedHeadroom bool
+	// reportNUMAHeadroomQuantity indicates whether to report raw quantity of per-numa headroom
+	reportNUMAHeadroomQuantity bool
+	// updateContainerRetryBudget is the max number of retries for updating container info within a single sync
+	updateContainerRetryBudget int
+	// reconnectOnPluginSocketLost indicates whether to recreate plugin client once the plugin socket is lost
+	reconnectOnPluginSocketLost bool
+	// containerInfoMaxAge is the max age of cached container info used in assembly, zero means no limit
+	containerInfoMaxAge time.Duration
+	// pushWindow is the daily time window during which advice is pushed by ListAndWatch or returned by
+	// GetAdvice, nil means always allowed
+	pushWindow *dailyTimeWindow
+	clock      clock.Clock
+	// minReadySuccessCycles is the number of consecutive successful push cycles required before reporting ready
+	minReadySuccessCycles int
+	// headroomNUMAKeyFormat is the format of numa keys in headroom payload
+	headroomNUMAKeyFormat cpuadvisor.NUMAKeyFormat
+	// headroomUnit is the unit of per-numa headroom values in headroom payload
+	headroomUnit CPUUnit
+	// poolSizeUnits are units of pool sizes in advisor results keyed by pool name, and default to cores
+	poolSizeUnits map[string]CPUUnit
+	// syncFreshnessWindow is the max age of the latest successful checkpoint sync to push advice, zero means no limit
+	syncFreshnessWindow time.Duration
+	// startUpPeriod is the duration after startTime during which pushing advice is skipped, zero means no skipping
+	startUpPeriod time.Duration
+	// blockIDGenerator generates ids of blocks constructed in assembly, and defaults to random uuids
+	blockIDGenerator BlockIDGenerator
+	// reclaimDisablingNodeConditions are node condition types under which overlap between reclaim pool and others
+	// is turned off
+	reclaimDisablingNodeConditions sets.String
+	// callTimeout bounds each GetCheckpoint call to plugins and each advisor update, zero means no bound
+	callTimeout time.Duration
+	// getCheckpointMaxAttempts is the max number of GetCheckpoint calls to each plugin within a single cycle,
+	// which are retried while the checkpoint is nil or empty
+	getCheckpointMaxAttempts int
+	// lwSendTimeout bounds each Send of ListAndWatch response to a stream, zero means no bound
+	lwSendTimeout time.Duration
+	// lwChunkMaxEntries is the max number of entries in a single Send of ListAndWatch response, and larger
+	// responses are split into chunks for plugins negotiated to reassemble them; zero means never split
+	lwChunkMaxEntries int
+	// containerSettleDelay is the min duration since a container is first seen before it is assembled,
+	// zero means no delay
+	containerSettleDelay time.Duration
+	// suspectCheckpointDropRatio is the max ratio that the number of containers in a checkpoint may drop versus
+	// the previous one before gc is skipped for it, zero means no check
+	suspectCheckpointDropRatio float64
+
+	// lastCheckpointContainerCountMutex protects lastCheckpointContainerCount, which records the number of
+	// containers in the previous checkpoint, and it is negative before the first checkpoint
+	lastCheckpointContainerCountMutex sync.Mutex
+	lastCheckpointContainerCount      int
+
+	// lastSyncSuccessTimeMutex protects lastSyncSuccessTime, which records the last time
+	// checkpoint (or GetAdvice request) is synced successfully
+	lastSyncSuccessTimeMutex sync.RWMutex
+	lastSyncSuccessTime      time.Time
+
+	// containerUpdateTimeMutex protects containerUpdateTime, which records the last time
+	// each container info is updated by the qrm plugin
+	containerUpdateTimeMutex sync.RWMutex
+	containerUpdateTime      map[ContainerMeta]time.Time
+
+	// containerFirstSeenTimeMutex protects containerFirstSeenTime, which records the first time
+	// each container is seen in assembly
+	containerFirstSeenTimeMutex sync.Mutex
+	containerFirstSeenTime      map[ContainerMeta]time.Time
+
+	// managedQoSLevels are qos levels whose containers are assembled, empty means all qos levels are managed
+	managedQoSLevels sets.String
+	// unmanagedContainersMutex protects unmanagedContainers, which are containers left out of assembly for
+	// their qos levels and already logged, so that each of them is logged only once
+	unmanagedContainersMutex sync.Mutex
+	unmanagedContainers      containerMetaSet
+
+	// poolHeadroomDivergenceThreshold is the max ratio that the sum of pool sizes and headroom may diverge
+	// from the cpu count per numa, zero means the check is disabled
+	poolHeadroomDivergenceThreshold float64
+	// validateNUMAHeadroomAgainstDedicated indicates whether to check that per-numa headroom plus cpus bound
+	// by dedicated containers does not exceed numa capacity
+	validateNUMAHeadroomAgainstDedicated bool
+	// getPodTimeout is the timeout to get each pod from meta server in checkpoint sync, zero means no timeout
+	getPodTimeout time.Duration
+	// skipPodFetchFailedContainers indicates whether to skip assembling containers whose pod fetch failed in the latest sync
+	skipPodFetchFailedContainers bool
+	// podFetchFailedMutex protects podFetchFailed, which records pods failed to be fetched in the latest sync
+	podFetchFailedMutex sync.RWMutex
+	podFetchFailed      sets.String
+	// containerGCCapPerCycle is the max number of absent containers deleted in a single sync, zero means no limit
+	containerGCCapPerCycle int
+	// maxBlocksPerNUMAPerPool is the max number of blocks a single pool may have on one numa, zero means no limit
+	maxBlocksPerNUMAPerPool int
+	// absentPoolCarryForwardWindow is the grace window during which cached pools absent from advisor result are
+	// carried forward at their cached sizes, zero means such pools are dropped immediately
+	absentPoolCarryForwardWindow time.Duration
+	// poolAbsentSinceMutex protects poolAbsentSince, which records the first time each cached pool is found
+	// absent from advisor result
+	poolAbsentSinceMutex sync.Mutex
+	poolAbsentSince      map[string]time.Time
+	// isolationTransitionMinGap is the min duration a container must stay isolated or non-isolated before
+	// the owner-pool switch is reflected in advice, zero means no damping
+	isolationTransitionMinGap time.Duration
+	// isolationTransitionsMutex protects isolationTransitions, which records the latest isolation transition
+	// and the owner pool reflected in advice for each normal container
+	isolationTransitionsMutex sync.Mutex
+	isolationTransitions      map[ContainerMeta]*isolationTransition
+	// orphanContainerFallbackPool is the pool that containers are placed in if their owner pool is gone during
+	// assembly, empty means such containers are dropped
+	orphanContainerFallbackPool string
+	// poolStabilityWindow is the number of latest cycles over which pool stability scores are computed,
+	// zero means the score is disabled
+	poolStabilityWindow int
+	// poolSizeHistoryMutex protects poolSizeHistory, which records pool sizes by numa of the latest cycles
+	poolSizeHistoryMutex sync.Mutex
+	poolSizeHistory      []map[string]map[int]int
+	// reclaimPoolMaxShrinkPerCycle is the max cpus in cores that reclaim pool may shrink on each numa in a single
+	// push, zero means no limit
+	reclaimPoolMaxShrinkPerCycle int
+	// reclaimPoolSizesMutex protects reclaimPoolSizes, which records the latest assembled size of reclaim pool
+	// on each numa, excluding the part overlapping with other pools or containers
+	reclaimPoolSizesMutex sync.Mutex
+	reclaimPoolSizes      map[int]uint64
+	// containerMinCPUFloors are the min cpus in cores that containers of each qos level keep in assembly
+	containerMinCPUFloors map[string]int
+	// podEntryAssemblyWorkers is the number of workers assembling entries of dedicated numa binding pods in parallel
+	podEntryAssemblyWorkers int
+	// reclaimPoolMinCoresPerNUMA and reclaimPoolMinRatioPerNUMA are the floor of reclaim pool on each numa
+	// in cores and as a fraction of numa cpus, and the larger one takes effect
+	reclaimPoolMinCoresPerNUMA int
+	reclaimPoolMinRatioPerNUMA float64
+	// poolOverlapPriorities are priorities of shared pools when reclaim overlaps them, and reclaim
+	// overlaps lower-priority pools first
+	poolOverlapPriorities map[string]int
+	// mergeIdenticalPoolNUMABlocks indicates whether to merge identical per-numa blocks of a pool into a single one
+	mergeIdenticalPoolNUMABlocks bool
+	// refusePushOnReserveReclaimOverlap indicates whether to refuse pushing advice if reclaim overlaps with reserve
+	refusePushOnReserveReclaimOverlap bool
+	// strictAssembly indicates whether to refuse pushing advice if any inconsistency is found in assembly
+	strictAssembly bool
+	// maxPoolMissingContainers is the max number of containers referring to empty or missing owner pools
+	// in a single assembly, above which the cycle fails; zero means no limit
+	maxPoolMissingContainers int
+	// reservePoolMinNUMACoverage is the minimum number of numas with non-empty cpus the reserve pool must cover
+	reservePoolMinNUMACoverage int
+	// dryRun indicates whether to compute advice without sending it to cpu plugins
+	dryRun bool
+	// gateGetAdvice indicates whether GetAdvice is subject to the same gates, dry-run mode and post-processing
+	// as ListAndWatch
+	gateGetAdvice bool
+	// immutableQoSLevels are qos levels that containers are not allowed to change to or from
+	immutableQoSLevels sets.String
+	// aggregateMetricsInterval is the min interval to emit expensive aggregate metrics, zero means every push
+	aggregateMetricsInterval time.Duration
+	// aggregateMetricsMutex protects lastAggregateMetricsTime, which is the latest time aggregate metrics are emitted
+	aggregateMetricsMutex    sync.Mutex
+	lastAggregateMetricsTime time.Time
+	// disableGC indicates whether to keep all containers and pools in meta cache without gc, only for debugging
+	disableGC bool
+	// gcAfterAdvisorUpdate indicates whether to defer gc of synced checkpoint until advisor is updated successfully
+	gcAfterAdvisorUpdate bool
+	// pendingGC is the deferred gc of the latest synced checkpoint, and it is only accessed by the ListAndWatch loop
+	pendingGC func()
+	// containerAbsentSinceMutex protects containerAbsentSince, which records the first time
+	// each cached container is found absent from checkpoint
+	containerAbsentSinceMutex sync.Mutex
+	containerAbsentSince      map[ContainerMeta]time.Time
+	// emptyDedicatedAssignmentsPolicy is the policy to handle dedicated numa binding containers without assignments
+	emptyDedicatedAssignmentsPolicy EmptyDedicatedAssignmentsPolicy
+	// emptyReclaimBlocksPolicy is the policy to represent reclaim pool on numa nodes without reclaim capacity
+	emptyReclaimBlocksPolicy EmptyReclaimBlocksPolicy
+	// latestBlockSetMutex protects latestBlockSet, latestCalculationEntries and latestBlockProvenance, which are
+	// the blockSet, calculation entries and block provenance of the latest assembled advice
+	latestBlockSetMutex      sync.RWMutex
+	latestBlockSet           blockSet
+	latestCalculationEntries map[string]*cpuadvisor.CalculationEntries
+	latestBlockProvenance    cpuadvisor.CPUBlockProvenance
+	// sentReclaimOverlapMutex protects sentReclaimOverlap, which is the reclaim overlap of the latest sent advice
+	sentReclaimOverlapMutex sync.RWMutex
+	sentReclaimOverlap      *ReclaimOverlapSnapshot
+	// emitReclaimOverlapMetrics indicates whether to emit overlapped sizes of reclaim pool along with each sent advice
+	emitReclaimOverlapMetrics bool
+	// adviceInputSnapshotLimit is the number of latest push cycles whose advisor input snapshots are kept, zero means disabled
+	adviceInputSnapshotLimit int
+	// adviceInputSnapshotsMutex protects adviceSequence and adviceInputSnapshots, which are the sequence of
+	// the latest advice and advisor input snapshots of latest push cycles keyed by sequence
+	adviceInputSnapshotsMutex sync.RWMutex
+	adviceSequence            uint64
+	adviceInputSnapshots      map[uint64]*AdviceInputSnapshot
+	// tracer emits spans of push cycles, and it is a noop one if tracing is disabled
+	tracer trace.Tracer
+	// reportCPUManagerPolicy indicates whether to report the effective kubelet cpu manager policy in advice
+	reportCPUManagerPolicy bool
+	// cpuManagerPolicyMutex protects cpuManagerPolicy, which caches the effective kubelet cpu manager policy
+	cpuManagerPolicyMutex sync.Mutex
+	cpuManagerPolicy      string
+	// metaCacheSnapshotPath is the file that meta cache snapshots are written to and loaded from,
+	// empty means snapshots are disabled
+	metaCacheSnapshotPath     string
+	metaCacheSnapshotInterval time.Duration
+	// metaCacheSnapshotMaxAge is the max age of a meta cache snapshot to be trusted at startup
+	metaCacheSnapshotMaxAge time.Duration
+	// lastAdvicePath is the file that the last advice sent by ListAndWatch is persisted to and restored from,
+	// empty means persisting is disabled; lastAdviceMaxAge is the max age of persisted advice to be re-sent
+	lastAdvicePath   string
+	lastAdviceMaxAge time.Duration
+	// restoredAdviceMutex protects restoredAdvice, which is the advice restored at startup and not re-sent yet,
+	// and restoredAdviceTimestamp, which is the time the advice was persisted at
+	restoredAdviceMutex     sync.Mutex
+	restoredAdvice          *cpuadvisor.ListAndWatchResponse
+	restoredAdviceTimestamp time.Time
+	// adviceAuditor records changes between consecutively pushed advice, and it is nil if audit is disabled
+	adviceAuditor *adviceAuditor
+	// adviceTracer records assembled advice along with its inputs as replayable traces, and it is nil if trace is disabled
+	adviceTracer *adviceTracer
+	// aggregator forwards assembled advice to the central aggregator, and it is nil if forwarding is disabled
+	aggregator *aggregatorClient
+
+	// pluginSocketPaths are all cpu plugin sockets to fan out, and the first one is the primary
+	pluginSocketPaths []string
+	// secondaryPluginSocketPath is the socket of a canary cpu plugin, which is purely observational: its checkpoint
+	// is never synced into meta cache, and it gets advice by joining the running ListAndWatch loop
+	secondaryPluginSocketPath string
+	// pluginDialBackoffInitialInterval is the initial interval to retry dialing cpu plugin sockets, and it doubles
+	// after each failure until capped at period
+	pluginDialBackoffInitialInterval time.Duration
+	// pluginDialBackoffMaxElapsedTime is the max elapsed time to retry dialing before giving up, zero means no retry
+	pluginDialBackoffMaxElapsedTime time.Duration
+	// lwStreamsMutex protects lwStreams and lwLoopDone; in multi-plugin mode, lwStreams are extra
+	// ListAndWatch streams joined into the running loop, and lwLoopDone is closed once the loop exits
+	lwStreamsMutex sync.Mutex
+	lwStreams      []cpuadvisor.CPUAdvisor_ListAndWatchServer
+	lwLoopDone     chan struct{}
+
+	// lwHealthMutex protects lwHealthDetail, which records recent outcomes of ListAndWatch loop,
+	// and lwLoopStarted, which indicates whether any ListAndWatch loop has ever started
+	lwHealthMutex  sync.RWMutex
+	lwHealthDetail CPUServerHealthDetail
+	lwLoopStarted  bool
+	// checkpointFreshness is protected by lwHealthMutex as well, and the checkpoint freshness health check is
+	// disabled if checkpointFrozenCycles is zero
+	checkpointFreshness     checkpointFreshness
+	checkpointFrozenCycles  int
+	checkpointCompareMethod CheckpointCompareMethod
+}
+
+// CPUServerHealthDetail describes the current state of the cpu-server-lw health check,
+// along with the time of latest failed and succeeded push.
+type CPUServerHealthDetail struct {
+	// Ready and Message are consistent with the readiness result of the health check;
+	// Ready is false if there is no ListAndWatch loop running.
+	Ready   bool
+	Message string
+
+	LastError       string
+	LastErrorTime   time.Time
+	LastSuccessTime time.Time
+	// ConsecutiveSuccesses is the number of successful push cycles since the latest failure
+	ConsecutiveSuccesses int
+	// LoopRestarts is the number of ListAndWatch loops started after the first one, and it is
+	// monotonic for the lifetime of the agent, so a flapping plugin connection keeps increasing it
+	LoopRestarts int64
+	// LastCheckpointSuccessTime is the time of the latest successful checkpoint sync
+	LastCheckpointSuccessTime time.Time
+	// CheckpointUnchangedCycles is the number of consecutive cycles with an unchanged checkpoint, and
+	// CheckpointFrozen indicates the plugin is regarded as frozen since pods have changed meanwhile
+	CheckpointUnchangedCycles int
+	CheckpointFrozen          bool
 }
 
 func NewCPUServer(
@@ -74,29 +525,435 @@ func NewCPUServer(
 	metaServer *metaserver.MetaServer,
 	advisor subResourceAdvisor,
 	emitter metrics.MetricEmitter,
+	opts ...ServerOption,
 ) (*cpuServer, error) {
 	cs := &cpuServer{}
-	cs.baseServer = newBaseServer(cpuServerName, conf, metaCache, metaServer, emitter, advisor, cs)
+	cs.baseServer = newBaseServer(cpuServerName, conf, metaCache, metaServer, emitter, advisor, cs, opts...)
 	cs.hasListAndWatchLoop.Store(false)
 	cs.startTime = time.Now()
 	cs.advisorSocketPath = conf.CPUAdvisorSocketAbsPath
 	cs.pluginSocketPath = conf.CPUPluginSocketAbsPath
 	cs.headroomResourceManager = headroomResourceManager
 	cs.resourceRequestName = "CPURequest"
+	cs.deniedControlKnobKeys = sets.NewString(conf.CPUServerDeniedControlKnobKeys...)
+	cs.pushCycleDeadline = conf.CPUServerPushCycleDeadline
+	cs.lwWatchdogWindow = conf.CPUServerLWWatchdogWindow
+	cs.reportNUMAHeadroomQuantity = conf.CPUServerReportNUMAHeadroomQuantity
+	cs.maxHeadroomRatio = conf.CPUServerMaxHeadroomRatio
+	cs.numaHeadroomReservedRatio = conf.CPUNUMAHeadroomReservedRatio
+	cs.numaHeadroomReservedMilliCores = conf.CPUNUMAHeadroomReservedMilliCores
+	cs.discountOverlappedHeadroom = conf.CPUServerDiscountOverlappedHeadroom
+	if cs.numaHeadroomReservedRatio < 0 || cs.numaHeadroomReservedRatio > 1 {
+		return nil, fmt.Errorf("invalid numa headroom reserved ratio %v", cs.numaHeadroomReservedRatio)
+	}
+	if cs.numaHeadroomReservedMilliCores < 0 {
+		return nil, fmt.Errorf("invalid numa headroom reserved millicores %v", cs.numaHeadroomReservedMilliCores)
+	}
+	cs.updateContainerRetryBudget = conf.CPUServerUpdateContainerRetryBudget
+	cs.reconnectOnPluginSocketLost = conf.CPUServerReconnectOnPluginSocketLost
+	cs.containerInfoMaxAge = conf.CPUServerContainerInfoMaxAge
+	cs.syncFreshnessWindow = conf.CPUServerSyncFreshnessWindow
+	cs.startUpPeriod = conf.CPUServerStartUpPeriod
+	cs.blockIDGenerator = NewUUIDBlockIDGenerator()
+	cs.reclaimDisablingNodeConditions = sets.NewString(conf.CPUServerReclaimDisablingNodeConditions...)
+	cs.callTimeout = conf.CPUServerCallTimeout
+	cs.getCheckpointMaxAttempts = conf.CPUServerGetCheckpointMaxAttempts
+	if cs.getCheckpointMaxAttempts < 1 {
+		return nil, fmt.Errorf("invalid get checkpoint max attempts %v", cs.getCheckpointMaxAttempts)
+	}
+	cs.lwSendTimeout = conf.CPUServerLWSendTimeout
+	cs.lwChunkMaxEntries = conf.CPUServerLWChunkMaxEntries
+	if cs.lwChunkMaxEntries < 0 {
+		return nil, fmt.Errorf("invalid lw chunk max entries %v", cs.lwChunkMaxEntries)
+	}
+	cs.containerSettleDelay = conf.CPUServerContainerSettleDelay
+	cs.suspectCheckpointDropRatio = conf.CPUServerSuspectCheckpointDropRatio
+	cs.lastCheckpointContainerCount = -1
+	cs.minReadySuccessCycles = conf.CPUServerMinReadySuccessCycles
+	cs.checkpointFrozenCycles = conf.CPUServerCheckpointFrozenCycles
+	if cs.checkpointFrozenCycles < 0 {
+		return nil, fmt.Errorf("invalid checkpoint frozen cycles %v", cs.checkpointFrozenCycles)
+	}
+	cs.checkpointCompareMethod = CheckpointCompareMethod(conf.CPUServerCheckpointCompareMethod)
+	switch cs.checkpointCompareMethod {
+	case CheckpointCompareMethodBytes, CheckpointCompareMethodEntries:
+	default:
+		return nil, fmt.Errorf("invalid checkpoint compare method %q", cs.checkpointCompareMethod)
+	}
+	cs.clock = clock.RealClock{}
+	cs.tracer = trace.NewNoopTracerProvider().Tracer(cpuServerTracerName)
+	if conf.CPUServerEnableTracing {
+		cs.tracer = otel.Tracer(cpuServerTracerName)
+	}
+	if conf.CPUServerAdvicePushWindow != "" {
+		pushWindow, err := parseDailyTimeWindow(conf.CPUServerAdvicePushWindow)
+		if err != nil {
+			return nil, err
+		}
+		cs.pushWindow = pushWindow
+	}
+	cs.debugHandlers[cpuServerAssignmentsDebugHandlerName] = cs.serveCPUAssignments
+	cs.debugHandlers[cpuServerBlocksDebugHandlerName] = cs.serveBlocksDOT
+	cs.debugHandlers[cpuServerBlockAssignmentsDebugHandlerName] = cs.serveBlockAssignments
+	cs.debugHandlers[cpuServerAdviceInputsDebugHandlerName] = cs.serveAdviceInputSnapshots
+	cs.debugHandlers[cpuServerHealthDebugHandlerName] = cs.serveLWHealthDetail
+	cs.debugHandlers[cpuServerReclaimOverlapDebugHandlerName] = cs.serveReclaimOverlap
+	cs.headroomNUMAKeyFormat = cpuadvisor.NUMAKeyFormat(conf.CPUServerHeadroomNUMAKeyFormat)
+	if _, err := cpuadvisor.FormatNUMAKey(cs.headroomNUMAKeyFormat, 0); err != nil {
+		return nil, err
+	}
+	cs.headroomUnit = CPUUnit(conf.CPUServerHeadroomUnit)
+	if _, err := ConvertCPUValue(0, CPUUnitMilliCores, cs.headroomUnit); err != nil {
+		return nil, err
+	}
+	cs.poolSizeUnits = make(map[string]CPUUnit, len(conf.CPUServerPoolSizeUnits))
+	for poolName, unit := range conf.CPUServerPoolSizeUnits {
+		if _, err := ConvertCPUValue(0, CPUUnit(unit), CPUUnitCores); err != nil {
+			return nil, fmt.Errorf("invalid size unit of pool %s: %w", poolName, err)
+		}
+		cs.poolSizeUnits[poolName] = CPUUnit(unit)
+	}
+	cs.containerUpdateTime = make(map[ContainerMeta]time.Time)
+	cs.containerFirstSeenTime = make(map[ContainerMeta]time.Time)
+	cs.managedQoSLevels = sets.NewString(conf.CPUServerManagedQoSLevels...)
+	for _, qosLevel := range cs.managedQoSLevels.UnsortedList() {
+		switch qosLevel {
+		case consts.PodAnnotationQoSLevelSharedCores, consts.PodAnnotationQoSLevelReclaimedCores,
+			consts.PodAnnotationQoSLevelDedicatedCores, consts.PodAnnotationQoSLevelSystemCores:
+		default:
+			return nil, fmt.Errorf("invalid managed qos level %s", qosLevel)
+		}
+	}
+	cs.unmanagedContainers = make(containerMetaSet)
+	cs.containerGCCapPerCycle = conf.CPUServerContainerGCCapPerCycle
+	cs.disableGC = conf.CPUServerDisableGC
+	cs.gcAfterAdvisorUpdate = conf.CPUServerGCAfterAdvisorUpdate
+	cs.aggregateMetricsInterval = conf.CPUServerAggregateMetricsInterval
+	cs.refusePushOnReserveReclaimOverlap = conf.CPUServerRefusePushOnReserveReclaimOverlap
+	cs.strictAssembly = conf.CPUServerStrictAssembly
+	cs.emitReclaimOverlapMetrics = conf.CPUServerEmitReclaimOverlapMetrics
+	cs.maxPoolMissingContainers = conf.CPUServerMaxPoolMissingContainers
+	if cs.maxPoolMissingContainers < 0 {
+		return nil, fmt.Errorf("invalid max pool missing containers %v", cs.maxPoolMissingContainers)
+	}
+	if conf.CPUServerReservePoolMinNUMACoverage < 0 {
+		return nil, fmt.Errorf("invalid reserve pool min numa coverage %d", conf.CPUServerReservePoolMinNUMACoverage)
+	}
+	cs.reservePoolMinNUMACoverage = conf.CPUServerReservePoolMinNUMACoverage
+	if conf.CPUServerDeterministicBlockIDs {
+		cs.blockIDGenerator = NewDeterministicBlockIDGenerator()
+	}
+	cs.dryRun = conf.CPUServerDryRun
+	cs.gateGetAdvice = conf.CPUServerGateGetAdvice
+	cs.immutableQoSLevels = sets.NewString(conf.CPUServerImmutableQoSLevels...)
+	cs.maxBlocksPerNUMAPerPool = conf.CPUServerMaxBlocksPerNUMAPerPool
+	cs.mergeIdenticalPoolNUMABlocks = conf.CPUServerMergeIdenticalPoolNUMABlocks
+	cs.poolOverlapPriorities = conf.CPUServerPoolOverlapPriorities
+	cs.containerMinCPUFloors = conf.CPUServerContainerMinCPUFloors
+	cs.podEntryAssemblyWorkers = conf.CPUServerPodEntryAssemblyWorkers
+	if cs.podEntryAssemblyWorkers < 1 {
+		return nil, fmt.Errorf("invalid pod entry assembly workers %v", cs.podEntryAssemblyWorkers)
+	}
+	cs.reclaimPoolMinCoresPerNUMA = conf.CPUServerReclaimPoolMinCoresPerNUMA
+	if cs.reclaimPoolMinCoresPerNUMA < 0 {
+		return nil, fmt.Errorf("invalid reclaim pool min cores per numa %v", cs.reclaimPoolMinCoresPerNUMA)
+	}
+	cs.reclaimPoolMinRatioPerNUMA = conf.CPUServerReclaimPoolMinRatioPerNUMA
+	if cs.reclaimPoolMinRatioPerNUMA < 0 || cs.reclaimPoolMinRatioPerNUMA > 1 {
+		return nil, fmt.Errorf("invalid reclaim pool min ratio per numa %v", cs.reclaimPoolMinRatioPerNUMA)
+	}
+	cs.reclaimPoolMaxShrinkPerCycle = conf.CPUServerReclaimPoolMaxShrinkPerCycle
+	cs.poolStabilityWindow = conf.CPUServerPoolStabilityWindow
+	cs.reclaimPoolSizes = make(map[int]uint64)
+	cs.orphanContainerFallbackPool = conf.CPUServerOrphanContainerFallbackPool
+	cs.absentPoolCarryForwardWindow = conf.CPUServerAbsentPoolCarryForwardWindow
+	cs.poolAbsentSince = make(map[string]time.Time)
+	cs.isolationTransitionMinGap = conf.CPUServerIsolationTransitionMinGap
+	cs.isolationTransitions = make(map[ContainerMeta]*isolationTransition)
+	cs.adviceInputSnapshotLimit = conf.CPUServerAdviceInputSnapshotLimit
+	cs.adviceInputSnapshots = make(map[uint64]*AdviceInputSnapshot)
+	cs.poolHeadroomDivergenceThreshold = conf.CPUServerPoolHeadroomDivergenceThreshold
+	cs.skipPodFetchFailedContainers = conf.CPUServerSkipPodFetchFailedContainers
+	cs.getPodTimeout = conf.CPUServerGetPodTimeout
+	cs.validateNUMAHeadroomAgainstDedicated = conf.CPUServerValidateNUMAHeadroomAgainstDedicated
+	cs.reportCPUManagerPolicy = conf.CPUServerReportCPUManagerPolicy
+	cs.drainTimeout = conf.CPUServerDrainTimeout
+	if conf.CPUServerAdviceAuditLogPath != "" {
+		cs.adviceAuditor = &adviceAuditor{sink: &fileAdviceAuditSink{path: conf.CPUServerAdviceAuditLogPath}}
+	}
+	if conf.CPUServerAdviceTracePath != "" {
+		if conf.CPUServerAdviceTraceMaxBytes <= 0 {
+			return nil, fmt.Errorf("invalid advice trace max bytes %v", conf.CPUServerAdviceTraceMaxBytes)
+		}
+		if conf.CPUServerAdviceTraceMaxBackups < 0 {
+			return nil, fmt.Errorf("invalid advice trace max backups %v", conf.CPUServerAdviceTraceMaxBackups)
+		}
+		cs.adviceTracer = &adviceTracer{
+			sink: &fileAdviceTraceSink{
+				path:       conf.CPUServerAdviceTracePath,
+				maxBytes:   conf.CPUServerAdviceTraceMaxBytes,
+				maxBackups: conf.CPUServerAdviceTraceMaxBackups,
+			},
+			hashPodUIDs: conf.CPUServerAdviceTraceHashPodUIDs,
+		}
+	}
+	cs.metaCacheSnapshotPath = conf.CPUServerMetaCacheSnapshotPath
+	cs.metaCacheSnapshotInterval = conf.CPUServerMetaCacheSnapshotInterval
+	cs.metaCacheSnapshotMaxAge = conf.CPUServerMetaCacheSnapshotMaxAge
+	if conf.CPUServerPersistLastAdvice {
+		cs.lastAdvicePath = filepath.Join(conf.GenericSysAdvisorConfiguration.StateFileDirectory, lastAdviceFileName)
+	}
+	cs.lastAdviceMaxAge = conf.CPUServerLastAdviceMaxAge
+	if cs.metaCacheSnapshotPath != "" && cs.metaCacheSnapshotInterval <= 0 {
+		return nil, fmt.Errorf("invalid meta cache snapshot interval %v", cs.metaCacheSnapshotInterval)
+	}
+	cs.emptyDedicatedAssignmentsPolicy = EmptyDedicatedAssignmentsPolicy(conf.CPUServerEmptyDedicatedAssignmentsPolicy)
+	switch cs.emptyDedicatedAssignmentsPolicy {
+	case EmptyDedicatedAssignmentsPolicySkip, EmptyDedicatedAssignmentsPolicyFallbackPool:
+	default:
+		return nil, fmt.Errorf("invalid empty dedicated assignments policy %q", cs.emptyDedicatedAssignmentsPolicy)
+	}
+	cs.emptyReclaimBlocksPolicy = EmptyReclaimBlocksPolicy(conf.CPUServerEmptyReclaimBlocksPolicy)
+	switch cs.emptyReclaimBlocksPolicy {
+	case EmptyReclaimBlocksPolicyKeep, EmptyReclaimBlocksPolicyOmit, EmptyReclaimBlocksPolicyEmptyMarker:
+	default:
+		return nil, fmt.Errorf("invalid empty reclaim blocks policy %q", cs.emptyReclaimBlocksPolicy)
+	}
+	cs.podFetchFailed = sets.NewString()
+	cs.containerAbsentSince = make(map[ContainerMeta]time.Time)
+	cs.pluginSocketPaths = append([]string{conf.CPUPluginSocketAbsPath}, conf.CPUServerExtraPluginSocketAbsPaths...)
+	cs.secondaryPluginSocketPath = conf.CPUServerSecondaryPluginSocketAbsPath
+	cs.pluginDialBackoffInitialInterval = conf.CPUServerPluginDialBackoffInitialInterval
+	cs.pluginDialBackoffMaxElapsedTime = conf.CPUServerPluginDialBackoffMaxElapsedTime
+	if cs.pluginDialBackoffMaxElapsedTime > 0 && cs.pluginDialBackoffInitialInterval <= 0 {
+		return nil, fmt.Errorf("invalid plugin dial backoff initial interval %v", cs.pluginDialBackoffInitialInterval)
+	}
+	if conf.CPUServerAggregatorAddress != "" {
+		aggregator, err := newAggregatorClient(conf.CPUServerAggregatorAddress, conf.NodeName, cs.period,
+			conf.CPUServerAggregatorBufferSize, conf.CPUServerAggregatorMaxRetries, emitter, cs.genMetricsName)
+		if err != nil {
+			return nil, err
+		}
+		cs.aggregator = aggregator
+	}
 	return cs, nil
 }
 
-func (cs *cpuServer) createQRMClient() (cpuadvisor.CPUPluginClient, io.Closer, error) {
-	if !general.IsPathExists(cs.pluginSocketPath) {
-		return nil, nil, fmt.Errorf("memory plugin socket path %s does not exist", cs.pluginSocketPath)
+func (cs *cpuServer) Start() error {
+	if cs.aggregator != nil {
+		go cs.aggregator.run(cs.stopCh)
+	}
+	if cs.metaCacheSnapshotPath != "" {
+		// a snapshot failed to be loaded only makes warmup slower, so it does not fail the start
+		if err := cs.loadMetaCacheSnapshot(context.Background()); err != nil {
+			klog.Warningf("[qosaware-server-cpu] load meta cache snapshot failed: %v", err)
+		}
+		go wait.Until(cs.writeMetaCacheSnapshot, cs.metaCacheSnapshotInterval, cs.stopCh)
+	}
+	cs.restoreLastAdvice()
+	return cs.baseServer.Start()
+}
+
+// forwardToAggregator forwards the advice to the central aggregator if it is enabled, without blocking
+func (cs *cpuServer) forwardToAggregator(resp *cpuadvisor.ListAndWatchResponse) {
+	if cs.aggregator != nil {
+		cs.aggregator.enqueue(resp)
+	}
+}
+
+func (cs *cpuServer) createQRMClient(socketPath string) (cpuadvisor.CPUPluginClient, io.Closer, error) {
+	if !general.IsPathExists(socketPath) {
+		return nil, nil, fmt.Errorf("%w: %s", errPluginSocketMissing, socketPath)
 	}
-	conn, err := cs.dial(cs.pluginSocketPath, cs.period)
+	conn, err := cs.dial(socketPath, cs.period)
 	if err != nil {
-		return nil, nil, fmt.Errorf("dial memory plugin socket failed: %w", err)
+		return nil, nil, fmt.Errorf("dial cpu plugin socket failed: %w", err)
 	}
 	return cpuadvisor.NewCPUPluginClient(conn), conn, nil
 }
 
+// cpuPluginConn packs the cpu plugin client with its connection and the socket file it dials
+type cpuPluginConn struct {
+	socketPath string
+	client     cpuadvisor.CPUPluginClient
+	closer     io.Closer
+	socketInfo os.FileInfo
+}
+
+func (cs *cpuServer) connectPlugin(socketPath string) (*cpuPluginConn, error) {
+	client, closer, err := cs.createQRMClient(socketPath)
+	if err != nil {
+		return nil, err
+	}
+
+	socketInfo, err := os.Stat(socketPath)
+	if err != nil {
+		_ = closer.Close()
+		return nil, fmt.Errorf("stat cpu plugin socket failed: %w", err)
+	}
+
+	return &cpuPluginConn{
+		socketPath: socketPath,
+		client:     client,
+		closer:     closer,
+		socketInfo: socketInfo,
+	}, nil
+}
+
+// connectPluginWithBackoff retries connecting to the cpu plugin socket with exponential backoff capped at period,
+// until pluginDialBackoffMaxElapsedTime elapses, ctx (i.e. the ListAndWatch stream) is done or cpu server stops
+func (cs *cpuServer) connectPluginWithBackoff(ctx context.Context, socketPath string) (*cpuPluginConn, error) {
+	start := cs.clock.Now()
+	interval := cs.pluginDialBackoffInitialInterval
+	for {
+		pluginConn, err := cs.connectPlugin(socketPath)
+		if err == nil {
+			return pluginConn, nil
+		}
+
+		reason := "dial-failed"
+		if stdErrors.Is(err, errPluginSocketMissing) {
+			reason = "socket-missing"
+		}
+		_ = cs.emitter.StoreInt64(cs.genMetricsName(metricCPUServerPluginDialFailed), 1, metrics.MetricTypeNameCount,
+			metrics.MetricTag{Key: "reason", Val: reason})
+
+		remaining := cs.pluginDialBackoffMaxElapsedTime - cs.clock.Since(start)
+		if remaining <= 0 {
+			return nil, err
+		}
+		if interval > remaining {
+			interval = remaining
+		}
+		klog.Warningf("[qosaware-server-cpu] connect cpu plugin %s failed, retry after %v: %v", socketPath, interval, err)
+
+		select {
+		case <-cs.stopCh:
+			return nil, fmt.Errorf("cpu server stopped: %w", err)
+		case <-ctx.Done():
+			return nil, fmt.Errorf("stream is done (%v): %w", ctx.Err(), err)
+		case <-cs.clock.After(interval):
+		}
+
+		interval *= 2
+		if interval > cs.period {
+			interval = cs.period
+		}
+	}
+}
+
+// connectPlugins connects to all cpu plugin sockets, and the connections
+// are kept in the same order as pluginSocketPaths
+func (cs *cpuServer) connectPlugins(ctx context.Context) ([]*cpuPluginConn, error) {
+	pluginConns := make([]*cpuPluginConn, 0, len(cs.pluginSocketPaths))
+	for _, socketPath := range cs.pluginSocketPaths {
+		pluginConn, err := cs.connectPluginWithBackoff(ctx, socketPath)
+		if err != nil {
+			closePluginConns(pluginConns)
+			return nil, fmt.Errorf("connect cpu plugin %s failed: %w", socketPath, err)
+		}
+		pluginConns = append(pluginConns, pluginConn)
+	}
+	return pluginConns, nil
+}
+
+func closePluginConns(pluginConns []*cpuPluginConn) {
+	for _, pluginConn := range pluginConns {
+		_ = pluginConn.closer.Close()
+	}
+}
+
+func pluginClients(pluginConns []*cpuPluginConn) []cpuadvisor.CPUPluginClient {
+	clients := make([]cpuadvisor.CPUPluginClient, 0, len(pluginConns))
+	for _, pluginConn := range pluginConns {
+		clients = append(clients, pluginConn.client)
+	}
+	return clients
+}
+
+// socketLost returns true if the plugin socket has been removed or recreated since connected
+func (c *cpuPluginConn) socketLost() bool {
+	socketInfo, err := os.Stat(c.socketPath)
+	if err != nil {
+		return true
+	}
+	return !os.SameFile(c.socketInfo, socketInfo)
+}
+
+// reconnectPluginsIfSocketLost tears down and recreates the plugin connections whose socket is lost,
+// and the original connection is kept if the socket is still there or reconnection fails.
+func (cs *cpuServer) reconnectPluginsIfSocketLost(pluginConns []*cpuPluginConn) error {
+	if !cs.reconnectOnPluginSocketLost {
+		return nil
+	}
+
+	var errList []error
+	for i, pluginConn := range pluginConns {
+		if !pluginConn.socketLost() {
+			continue
+		}
+
+		klog.Warningf("[qosaware-server-cpu] cpu plugin socket %s is lost, try to reconnect", pluginConn.socketPath)
+		newPluginConn, err := cs.connectPlugin(pluginConn.socketPath)
+		if err != nil {
+			errList = append(errList, fmt.Errorf("reconnect cpu plugin %s failed: %w", pluginConn.socketPath, err))
+			continue
+		}
+
+		_ = pluginConn.closer.Close()
+		pluginConns[i] = newPluginConn
+		_ = cs.emitter.StoreInt64(cs.genMetricsName(metricCPUServerPluginReconnected), 1, metrics.MetricTypeNameCount)
+		klog.Infof("[qosaware-server-cpu] reconnected to cpu plugin socket %s", pluginConn.socketPath)
+	}
+	return errors.NewAggregate(errList)
+}
+
+// joinListAndWatchLoop adds the stream into the running ListAndWatch loop in multi-plugin mode,
+// and it blocks until the stream exits or the running loop exits.
+func (cs *cpuServer) joinListAndWatchLoop(server cpuadvisor.CPUAdvisor_ListAndWatchServer) error {
+	cs.lwStreamsMutex.Lock()
+	loopDone := cs.lwLoopDone
+	if loopDone == nil {
+		cs.lwStreamsMutex.Unlock()
+		return fmt.Errorf("another ListAndWatch loop is running")
+	}
+	cs.lwStreams = append(cs.lwStreams, server)
+	cs.lwStreamsMutex.Unlock()
+	defer cs.removeLWStream(server)
+
+	klog.Infof("[qosaware-server-cpu] lw stream joined the running loop")
+	select {
+	case <-server.Context().Done():
+		klog.Infof("[qosaware-server-cpu] joined lw stream server exited")
+		return nil
+	case <-cs.stopCh:
+		klog.Infof("[qosaware-server-cpu] joined lw stopped because cpu server stopped")
+		return nil
+	case <-loopDone:
+		return fmt.Errorf("the running ListAndWatch loop exited")
+	}
+}
+
+func (cs *cpuServer) removeLWStream(server cpuadvisor.CPUAdvisor_ListAndWatchServer) {
+	cs.lwStreamsMutex.Lock()
+	defer cs.lwStreamsMutex.Unlock()
+
+	for i, stream := range cs.lwStreams {
+		if stream == server {
+			cs.lwStreams = append(cs.lwStreams[:i], cs.lwStreams[i+1:]...)
+			return
+		}
+	}
+}
+
+// getLWStreams returns the stream of the running loop along with all joined streams
+func (cs *cpuServer) getLWStreams(server cpuadvisor.CPUAdvisor_ListAndWatchServer) []cpuadvisor.CPUAdvisor_ListAndWatchServer {
+	cs.lwStreamsMutex.Lock()
+	defer cs.lwStreamsMutex.Unlock()
+
+	return append([]cpuadvisor.CPUAdvisor_ListAndWatchServer{server}, cs.lwStreams...)
+}
+
 func (cs *cpuServer) RegisterAdvisorServer() {
 	cs.mutex.Lock()
 	defer cs.mutex.Unlock()
@@ -116,6 +973,10 @@ func (cs *cpuServer) GetAdvice(ctx context.Context, request *cpuadvisor.GetAdvic
 	_ = cs.emitter.StoreInt64(cs.genMetricsName(metricServerGetAdviceCalled), 1, metrics.MetricTypeNameCount)
 	general.Infof("get advice request: %v", general.ToString(request))
 
+	cs.adviceCycleMutex.Lock()
+	defer cs.adviceCycleMutex.Unlock()
+	general.InfoS("acquired advice cycle lock", "duration", time.Since(startTime))
+
 	if err := cs.updateMetaCacheInput(ctx, request); err != nil {
 		general.Errorf("update meta cache failed: %v", err)
 		return nil, fmt.Errorf("update meta cache failed: %w", err)
@@ -123,6 +984,17 @@ func (cs *cpuServer) GetAdvice(ctx context.Context, request *cpuadvisor.GetAdvic
 
 	general.InfoS("updated meta cache input", "duration", time.Since(startTime))
 
+	// the plugin keeps its current allocation on error
+	if cs.gateGetAdvice {
+		cs.setTracedCheckpoint(getAdviceRequestCheckpoint(request))
+		cs.recordSyncSuccess()
+		if err := cs.checkAdviceGates(); err != nil {
+			return nil, fmt.Errorf("advice is skipped: %w", err)
+		}
+	} else if err := cs.checkPushWindow(); err != nil {
+		return nil, fmt.Errorf("advice is skipped: %w", err)
+	}
+
 	// generate both sys advisor supported and qrm wanted feature gates
 	supportedWantedFeatureGates, err := featuregatenegotiation.GenerateSupportedWantedFeatureGates(request.WantedFeatureGates, finders.FeatureGateTypeCPU)
 	if err != nil {
@@ -130,22 +1002,49 @@ func (cs *cpuServer) GetAdvice(ctx context.Context, request *cpuadvisor.GetAdvic
 	}
 
 	general.InfofV(6, "QRM CPU Plugin wanted feature gates: %v, among them sysadvisor supported feature gates: %v", lo.Keys(request.WantedFeatureGates), lo.Keys(supportedWantedFeatureGates))
-	result, err := cs.updateAdvisor(supportedWantedFeatureGates)
+	result, err := cs.updateAdvisor(ctx, supportedWantedFeatureGates)
 	if err != nil {
 		general.Errorf("update advisor failed: %v", err)
 		return nil, fmt.Errorf("update advisor failed: %w", err)
 	}
+	if !cs.gateGetAdvice {
+		resp := &cpuadvisor.GetAdviceResponse{
+			Entries:                               result.Entries,
+			AllowSharedCoresOverlapReclaimedCores: result.AllowSharedCoresOverlapReclaimedCores,
+			ExtraEntries:                          result.ExtraEntries,
+			SupportedFeatureGates:                 supportedWantedFeatureGates,
+		}
+		general.Infof("get advice response: %v", general.ToString(resp))
+		general.InfoS("get advice", "duration", time.Since(startTime))
+		return resp, nil
+	}
+
+	lwResp := cs.finalizeAdvice(result)
+	if cs.dryRun {
+		// the plugin keeps its current allocation on error
+		cs.reportDryRunAdvice("GetAdvice", result)
+		return nil, fmt.Errorf("advice is not returned in dry-run mode")
+	}
+
 	resp := &cpuadvisor.GetAdviceResponse{
-		Entries:                               result.Entries,
-		AllowSharedCoresOverlapReclaimedCores: result.AllowSharedCoresOverlapReclaimedCores,
-		ExtraEntries:                          result.ExtraEntries,
+		Entries:                               lwResp.Entries,
+		AllowSharedCoresOverlapReclaimedCores: lwResp.AllowSharedCoresOverlapReclaimedCores,
+		ExtraEntries:                          lwResp.ExtraEntries,
 		SupportedFeatureGates:                 supportedWantedFeatureGates,
 	}
 	general.Infof("get advice response: %v", general.ToString(resp))
+	cs.recordSentAdvice(result, lwResp)
 	general.InfoS("get advice", "duration", time.Since(startTime))
 	return resp, nil
 }
 
+// reportDryRunAdvice logs and reports the advice computed in dry-run mode, which is never sent to cpu plugins
+func (cs *cpuServer) reportDryRunAdvice(api string, result *cpuInternalResult) {
+	klog.Infof("[qosaware-server-cpu] dry-run advice of %s is not sent: %v", api, general.ToString(result))
+	_ = cs.emitter.StoreInt64(cs.genMetricsName(metricCPUServerDryRunAdvice), 1, metrics.MetricTypeNameCount,
+		metrics.MetricTag{Key: "api", Val: api})
+}
+
 func (cs *cpuServer) ListAndWatch(_ *advisorsvc.Empty, server cpuadvisor.CPUAdvisor_ListAndWatchServer) error {
 	// Register health check only when the QRM cpu plugins actually calls the sysadvisor GetAdvice or ListAndWatch method
 	registerCPUAdvisorHealthCheckOnce.Do(func() {
@@ -154,25 +1053,81 @@ func (cs *cpuServer) ListAndWatch(_ *advisorsvc.Empty, server cpuadvisor.CPUAdvi
 
 	_ = cs.emitter.StoreInt64(cs.genMetricsName(metricServerLWCalled), int64(cs.period.Seconds()), metrics.MetricTypeNameCount)
 
-	if cs.hasListAndWatchLoop.Swap(true).(bool) {
+	// the loop flag and lwLoopDone are updated in the same critical section,
+	// so that a stream never sees a running loop without lwLoopDone to join
+	cs.lwStreamsMutex.Lock()
+	running := cs.hasListAndWatchLoop.Swap(true).(bool)
+	if !running {
+		cs.lwLoopDone = make(chan struct{})
+	}
+	cs.lwStreamsMutex.Unlock()
+	if running {
+		if len(cs.pluginSocketPaths) > 1 || cs.secondaryPluginSocketPath != "" {
+			return cs.joinListAndWatchLoop(server)
+		}
 		klog.Warningf("[qosaware-server-cpu] another ListAndWatch loop is running")
 		return fmt.Errorf("another ListAndWatch loop is running")
 	}
-	defer cs.hasListAndWatchLoop.Store(false)
+	defer func() {
+		cs.lwStreamsMutex.Lock()
+		close(cs.lwLoopDone)
+		cs.lwLoopDone = nil
+		cs.lwStreams = nil
+		cs.hasListAndWatchLoop.Store(false)
+		cs.lwStreamsMutex.Unlock()
+	}()
+	cs.recordLWLoopStart()
 
-	cpuPluginClient, conn, err := cs.createQRMClient()
+	pluginConns, err := cs.connectPlugins(server.Context())
 	if err != nil {
 		_ = cs.emitter.StoreInt64(cs.genMetricsName(metricServerLWGetCheckpointFailed), int64(cs.period.Seconds()), metrics.MetricTypeNameCount)
 		klog.Errorf("[qosaware-server-cpu] create cpu plugin client failed: %v", err)
 		return fmt.Errorf("create cpu plugin client failed: %w", err)
 	}
-	defer conn.Close()
+	defer func() {
+		closePluginConns(pluginConns)
+	}()
+
+	// the secondary plugin is connected lazily, so that it never blocks the loop from starting
+	var secondaryConn *cpuPluginConn
+	defer func() {
+		if secondaryConn != nil {
+			_ = secondaryConn.closer.Close()
+		}
+	}()
 
 	klog.Infof("[qosaware-server-cpu] start to push cpu advices")
 	general.RegisterTemporaryHeartbeatCheck(cpuServerLWHealthCheckName, healthCheckTolerationDuration, general.HealthzCheckStateNotReady, healthCheckTolerationDuration)
 	defer general.UnregisterTemporaryHeartbeatCheck(cpuServerLWHealthCheckName)
+	if cs.checkpointFrozenCycles > 0 {
+		general.RegisterTemporaryHeartbeatCheck(cpuServerCheckpointFreshnessHealthCheckName, healthCheckTolerationDuration,
+			general.HealthzCheckStateNotReady, healthCheckTolerationDuration)
+		defer general.UnregisterTemporaryHeartbeatCheck(cpuServerCheckpointFreshnessHealthCheckName)
+	}
+
+	// a new loop needs to warm up again before reporting ready
+	cs.lwHealthMutex.Lock()
+	cs.lwHealthDetail.ConsecutiveSuccesses = 0
+	cs.lwHealthMutex.Unlock()
+
+	// the watchdog starts counting since the loop starts
+	cs.setLastPushSuccessTime(cs.clock.Now())
 
-	timer := time.NewTimer(cs.period)
+	// push cycles run with the loop context, which is cancelled by the watchdog if the loop gets stuck
+	loopCtx, cancelLoop := context.WithCancel(server.Context())
+	defer cancelLoop()
+	loopServer := &boundedListAndWatchServer{CPUAdvisor_ListAndWatchServer: server, ctx: loopCtx}
+	watchdogCh := make(chan error, 1)
+	if cs.lwWatchdogWindow > 0 {
+		go cs.watchLWLoop(loopCtx, cancelLoop, watchdogCh)
+	}
+
+	// re-send the advice persisted before restart, if any, before the first cycle computes fresh advice
+	if err := cs.sendRestoredAdvice(loopServer); stdErrors.Is(err, errLWSendTimedOut) {
+		return err
+	}
+
+	timer := time.NewTimer(cs.jitteredPeriod())
 	defer timer.Stop()
 
 	for {
@@ -182,170 +1137,2294 @@ func (cs *cpuServer) ListAndWatch(_ *advisorsvc.Empty, server cpuadvisor.CPUAdvi
 			return nil
 		case <-cs.stopCh:
 			klog.Infof("[qosaware-server-cpu] lw stopped because cpu server stopped")
+			cs.drainListAndWatch(pluginClients(pluginConns), server)
 			return nil
+		case err := <-watchdogCh:
+			klog.Errorf("[qosaware-server-cpu] %v", err)
+			return err
 		case <-timer.C:
+			if err := cs.reconnectPluginsIfSocketLost(pluginConns); err != nil {
+				klog.Errorf("[qosaware-server-cpu] %v", err)
+				cs.updateLWHealthState(err)
+				timer.Reset(cs.jitteredPeriod())
+				continue
+			}
+
 			klog.Infof("[qosaware-server-cpu] trigger advisor update")
-			if err := cs.getAndPushAdvice(cpuPluginClient, server); err != nil {
-				klog.Errorf("[qosaware-server-cpu] get and push advice failed: %v", err)
-				_ = general.UpdateHealthzStateByError(cpuServerLWHealthCheckName, err)
-			} else {
-				_ = general.UpdateHealthzStateByError(cpuServerLWHealthCheckName, nil)
+			if err := cs.runPushCycle(pluginClients(pluginConns), loopServer); stdErrors.Is(err, errLWSendTimedOut) {
+				// the loop exits to cancel the stream, which unblocks the timed-out Send, instead of sending to it
+				// concurrently in the next cycle; the plugin then reconnects with a fresh stream
+				klog.Errorf("[qosaware-server-cpu] lw stream is stuck in Send, exit the loop")
+				return err
 			}
-			timer.Reset(cs.period)
+			secondaryConn = cs.observeSecondaryPlugin(loopCtx, secondaryConn)
+			timer.Reset(cs.jitteredPeriod())
 		}
 	}
 }
 
-func (cs *cpuServer) getAndSyncCheckpoint(ctx context.Context, client cpuadvisor.CPUPluginClient) error {
-	safeTime := time.Now().UnixNano()
+// observeSecondaryPlugin compares the checkpoint of the secondary plugin with meta cache synced from primary plugins,
+// and returns the connection to reuse in the next cycle; failures are only reported, never affecting the loop
+func (cs *cpuServer) observeSecondaryPlugin(ctx context.Context, secondaryConn *cpuPluginConn) *cpuPluginConn {
+	if cs.secondaryPluginSocketPath == "" {
+		return nil
+	}
 
-	// get checkpoint
-	getCheckpointResp, err := client.GetCheckpoint(ctx, &cpuadvisor.GetCheckpointRequest{})
-	if err != nil {
-		_ = cs.emitter.StoreInt64(cs.genMetricsName(metricServerLWGetCheckpointFailed), int64(cs.period.Seconds()), metrics.MetricTypeNameCount)
-		return fmt.Errorf("get checkpoint failed: %w", err)
-	} else if getCheckpointResp == nil {
-		_ = cs.emitter.StoreInt64(cs.genMetricsName(metricServerLWGetCheckpointFailed), int64(cs.period.Seconds()), metrics.MetricTypeNameCount)
-		return fmt.Errorf("got nil checkpoint")
+	if secondaryConn != nil && secondaryConn.socketLost() {
+		_ = secondaryConn.closer.Close()
+		secondaryConn = nil
+	}
+	if secondaryConn == nil {
+		pluginConn, err := cs.connectPlugin(cs.secondaryPluginSocketPath)
+		if err != nil {
+			klog.Warningf("[qosaware-server-cpu] connect secondary cpu plugin %s failed: %v", cs.secondaryPluginSocketPath, err)
+			_ = cs.emitter.StoreInt64(cs.genMetricsName(metricCPUServerSecondaryObserveFailed), 1, metrics.MetricTypeNameCount,
+				metrics.MetricTag{Key: "reason", Val: "connect"})
+			return nil
+		}
+		secondaryConn = pluginConn
 	}
 
-	if klog.V(6).Enabled() {
-		klog.Infof("[qosaware-server-cpu] got checkpoint: %v", general.ToString(getCheckpointResp.Entries))
+	// the call is always bounded, so that a stuck secondary plugin never delays the next cycle by more than a period
+	ctx, cancel := context.WithTimeout(ctx, cs.period)
+	defer cancel()
+	resp, err := cs.getCheckpointWithTimeout(ctx, secondaryConn.client)
+	if err != nil || resp == nil {
+		klog.Warningf("[qosaware-server-cpu] get checkpoint of secondary cpu plugin failed: %v", err)
+		_ = cs.emitter.StoreInt64(cs.genMetricsName(metricCPUServerSecondaryObserveFailed), 1, metrics.MetricTypeNameCount,
+			metrics.MetricTag{Key: "reason", Val: "checkpoint"})
+		return secondaryConn
 	}
 
-	_ = cs.emitter.StoreInt64(cs.genMetricsName(metricServerLWGetCheckpointSucceeded), int64(cs.period.Seconds()), metrics.MetricTypeNameCount)
+	_ = cs.emitter.StoreInt64(cs.genMetricsName(metricCPUServerSecondaryDiverged), int64(cs.countCheckpointDivergence(resp)), metrics.MetricTypeNameRaw)
+	return secondaryConn
+}
+
+// countCheckpointDivergence returns the number of containers in the checkpoint whose owner pool
+// differs from that in meta cache, including those missing from meta cache
+func (cs *cpuServer) countCheckpointDivergence(resp *cpuadvisor.GetCheckpointResponse) int {
+	diverged := 0
+	for entryName, entry := range resp.Entries {
+		for containerName, info := range entry.Entries {
+			if containerName == commonstate.FakedContainerName || info == nil {
+				continue
+			}
+			ci, ok := cs.metaCache.GetContainerInfo(entryName, containerName)
+			if !ok || ci.OwnerPoolName != info.OwnerPoolName {
+				diverged++
+			}
+		}
+	}
+	return diverged
+}
+
+// checkLWWatchdog returns error if no advice is pushed successfully within lwWatchdogWindow, so that
+// ListAndWatch loop returns to force qrm plugin to reconnect and re-establish the state
+func (cs *cpuServer) checkLWWatchdog() error {
+	if cs.lwWatchdogWindow <= 0 {
+		return nil
+	}
 
-	cs.syncCheckpoint(ctx, getCheckpointResp, safeTime)
+	cs.lastPushSuccessTimeMutex.RLock()
+	lastPushSuccessTime := cs.lastPushSuccessTime
+	cs.lastPushSuccessTimeMutex.RUnlock()
+
+	if elapsed := cs.clock.Since(lastPushSuccessTime); elapsed > cs.lwWatchdogWindow {
+		_ = cs.emitter.StoreInt64(cs.genMetricsName(metricCPUServerLWWatchdogTriggered), 1, metrics.MetricTypeNameCount)
+		return fmt.Errorf("no advice is pushed successfully for %v, exceeding watchdog window %v", elapsed, cs.lwWatchdogWindow)
+	}
 	return nil
 }
 
-func (cs *cpuServer) shouldTriggerAdvisorUpdate() bool {
-	// TODO: do we still need this check?
-	// skip pushing advice during startup
-	if time.Now().Before(cs.startTime.Add(types.StartUpPeriod)) {
-		klog.Infof("[qosaware-cpu] skip pushing advice: starting up")
-		return false
+// watchLWLoop checks the watchdog every period independently of ListAndWatch loop, so that a loop stuck in a push
+// cycle is also detected; once the watchdog fires, the loop context is cancelled to unblock the stuck cycle, and
+// the error is sent to watchdogCh for the loop to exit with, so that a fresh loop can take over.
+func (cs *cpuServer) watchLWLoop(ctx context.Context, cancel context.CancelFunc, watchdogCh chan<- error) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-cs.clock.After(cs.period):
+			if err := cs.checkLWWatchdog(); err != nil {
+				watchdogCh <- err
+				cancel()
+				return
+			}
+		}
 	}
+}
 
-	// sanity check: if reserve pool exists
-	reservePoolInfo, ok := cs.metaCache.GetPoolInfo(commonstate.PoolNameReserve)
-	if !ok || reservePoolInfo == nil {
-		klog.Errorf("[qosaware-cpu] skip pushing advice: reserve pool does not exist")
-		return false
+func (cs *cpuServer) setLastPushSuccessTime(t time.Time) {
+	cs.lastPushSuccessTimeMutex.Lock()
+	defer cs.lastPushSuccessTimeMutex.Unlock()
+	cs.lastPushSuccessTime = t
+}
+
+// runPushCycle gets and pushes advice once, and updates the health state according to
+// both the outcome and the cost of the whole cycle, which is also returned
+func (cs *cpuServer) runPushCycle(clients []cpuadvisor.CPUPluginClient, server cpuadvisor.CPUAdvisor_ListAndWatchServer) error {
+	start := time.Now()
+	err := cs.getAndPushAdvice(clients, server)
+	if err != nil {
+		klog.Errorf("[qosaware-server-cpu] get and push advice failed: %v", err)
 	}
 
-	return true
+	cost := time.Since(start)
+	if cs.pushCycleDeadline > 0 && cost > cs.pushCycleDeadline {
+		klog.Errorf("[qosaware-server-cpu] push cycle cost %v, exceeding deadline %v", cost, cs.pushCycleDeadline)
+		_ = cs.emitter.StoreInt64(cs.genMetricsName(metricCPUServerPushCycleDeadlineExceeded), cost.Milliseconds(), metrics.MetricTypeNameRaw)
+		err = errors.NewAggregate([]error{err, fmt.Errorf("push cycle cost %v, exceeding deadline %v", cost, cs.pushCycleDeadline)})
+	}
+
+	cs.updateLWHealthState(err)
+	return err
+}
+
+// drainListAndWatch pushes the last advice before ListAndWatch loop exits on shutdown, and it is bounded
+// by drainTimeout so that shutdown never hangs on an unresponsive plugin or advisor
+func (cs *cpuServer) drainListAndWatch(clients []cpuadvisor.CPUPluginClient, server cpuadvisor.CPUAdvisor_ListAndWatchServer) {
+	if cs.drainTimeout <= 0 {
+		return
+	}
+
+	// report not ready before draining, since the loop is exiting whatever the last push results in
+	_ = general.UpdateHealthzState(cpuServerLWHealthCheckName, general.HealthzCheckStateNotReady, "cpu server is stopping")
+
+	ctx, cancel := context.WithTimeout(server.Context(), cs.drainTimeout)
+	defer cancel()
+
+	// the push is left behind on timeout, and it fails soon after plugin connections are closed
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- cs.getAndPushAdvice(clients, &boundedListAndWatchServer{CPUAdvisor_ListAndWatchServer: server, ctx: ctx})
+	}()
+
+	var err error
+	select {
+	case err = <-errCh:
+	case <-ctx.Done():
+		err = fmt.Errorf("drain push timed out after %v: %w", cs.drainTimeout, ctx.Err())
+	}
+
+	if err != nil {
+		klog.Errorf("[qosaware-server-cpu] drain push failed: %v", err)
+	} else {
+		klog.Infof("[qosaware-server-cpu] drain push succeeded")
+	}
+	_ = cs.emitter.StoreInt64(cs.genMetricsName(metricCPUServerLWDrainPush), 1, metrics.MetricTypeNameCount,
+		metrics.MetricTag{Key: "success", Val: strconv.FormatBool(err == nil)})
+}
+
+// boundedListAndWatchServer bounds the context of ListAndWatch stream, e.g. during drain or under the watchdog
+type boundedListAndWatchServer struct {
+	cpuadvisor.CPUAdvisor_ListAndWatchServer
+	ctx context.Context
+}
+
+func (s *boundedListAndWatchServer) Context() context.Context {
+	return s.ctx
+}
+
+// updateLWHealthState updates the cpu-server-lw health check and records the outcome in lwHealthDetail
+func (cs *cpuServer) updateLWHealthState(err error) {
+	cs.lwHealthMutex.Lock()
+	defer cs.lwHealthMutex.Unlock()
+
+	now := time.Now()
+	if err != nil {
+		cs.lwHealthDetail.LastError = err.Error()
+		cs.lwHealthDetail.LastErrorTime = now
+		cs.lwHealthDetail.ConsecutiveSuccesses = 0
+	} else {
+		cs.lwHealthDetail.LastSuccessTime = now
+		cs.lwHealthDetail.ConsecutiveSuccesses++
+
+		// keep not ready until enough consecutive successes to avoid flapping
+		if cs.lwHealthDetail.ConsecutiveSuccesses < cs.minReadySuccessCycles {
+			err = fmt.Errorf("warming up: %d/%d consecutive successful push cycles",
+				cs.lwHealthDetail.ConsecutiveSuccesses, cs.minReadySuccessCycles)
+		}
+	}
+	_ = general.UpdateHealthzStateByError(cpuServerLWHealthCheckName, err)
+}
+
+// recordLWLoopStart counts restarts of ListAndWatch loop, which are reported by the advisor socket
+// so that cpu and memory servers are distinguishable
+func (cs *cpuServer) recordLWLoopStart() {
+	cs.lwHealthMutex.Lock()
+	defer cs.lwHealthMutex.Unlock()
+
+	if cs.lwLoopStarted {
+		cs.lwHealthDetail.LoopRestarts++
+		klog.Infof("[qosaware-server-cpu] ListAndWatch loop restarted, %d restarts in total", cs.lwHealthDetail.LoopRestarts)
+	}
+	cs.lwLoopStarted = true
+	_ = cs.emitter.StoreInt64(cs.genMetricsName(metricCPUServerLWLoopRestarts), cs.lwHealthDetail.LoopRestarts, metrics.MetricTypeNameRaw,
+		metrics.MetricTag{Key: "socket", Val: cs.advisorSocketPath})
 }
 
-// Deprecated: getAndPushAdvice implements the legacy asynchronous bidirectional communication model between
-// qrm plugins and sys-advisor. This is kept for backward compatibility.
-// TODO: remove this function after all qrm plugins are migrated to the new synchronous model
-func (cs *cpuServer) getAndPushAdvice(client cpuadvisor.CPUPluginClient, server cpuadvisor.CPUAdvisor_ListAndWatchServer) error {
-	if err := cs.getAndSyncCheckpoint(server.Context(), client); err != nil {
-		return err
-	}
+// GetLWHealthDetail returns the current health detail of the cpu-server-lw check,
+// which can be used by a parent readiness aggregator.
+func (cs *cpuServer) GetLWHealthDetail() CPUServerHealthDetail {
+	cs.lwHealthMutex.RLock()
+	detail := cs.lwHealthDetail
+	cs.lwHealthMutex.RUnlock()
+
+	cs.lastSyncSuccessTimeMutex.RLock()
+	detail.LastCheckpointSuccessTime = cs.lastSyncSuccessTime
+	cs.lastSyncSuccessTimeMutex.RUnlock()
+
+	result, ok := general.GetRegisterReadinessCheckResult()[cpuServerLWHealthCheckName]
+	if !ok {
+		detail.Ready = false
+		detail.Message = "no ListAndWatch loop is running"
+		return detail
+	}
+
+	detail.Ready = result.Ready
+	detail.Message = result.Message
+	return detail
+}
+
+// serveLWHealthDetail exports the health detail of ListAndWatch loop as json
+func (cs *cpuServer) serveLWHealthDetail(w http.ResponseWriter, _ *http.Request) {
+	data, err := json.Marshal(cs.GetLWHealthDetail())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("marshal health detail failed: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(data)
+}
+
+// ContainerCPUAssignment describes the effective cpuset of a container in the cpu list format,
+// which can be cross-checked with numactl --show or taskset -c directly.
+type ContainerCPUAssignment struct {
+	PodNamespace string         `json:"podNamespace"`
+	PodName      string         `json:"podName"`
+	CPUSet       string         `json:"cpuset"`
+	CPUSetByNUMA map[int]string `json:"cpusetByNUMA"`
+}
+
+// getCPUAssignments renders the cached cpu assignments of all containers, keyed by pod uid and container name
+func (cs *cpuServer) getCPUAssignments() map[string]map[string]ContainerCPUAssignment {
+	assignments := make(map[string]map[string]ContainerCPUAssignment)
+	cs.metaCache.RangeContainer(func(podUID string, containerName string, ci *types.ContainerInfo) bool {
+		assignment := ContainerCPUAssignment{
+			PodNamespace: ci.PodNamespace,
+			PodName:      ci.PodName,
+			CPUSetByNUMA: make(map[int]string, len(ci.TopologyAwareAssignments)),
+		}
+
+		cpuset := machine.NewCPUSet()
+		for numaID, numaCPUSet := range ci.TopologyAwareAssignments {
+			assignment.CPUSetByNUMA[numaID] = numaCPUSet.String()
+			cpuset = cpuset.Union(numaCPUSet)
+		}
+		assignment.CPUSet = cpuset.String()
+
+		if _, ok := assignments[podUID]; !ok {
+			assignments[podUID] = make(map[string]ContainerCPUAssignment)
+		}
+		assignments[podUID][containerName] = assignment
+		return true
+	})
+	return assignments
+}
+
+func (cs *cpuServer) serveCPUAssignments(w http.ResponseWriter, _ *http.Request) {
+	data, err := json.Marshal(cs.getCPUAssignments())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("marshal cpu assignments failed: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(data)
+}
+
+// serveBlocksDOT exports blocks and overlaps of the latest assembled advice as Graphviz DOT
+func (cs *cpuServer) serveBlocksDOT(w http.ResponseWriter, _ *http.Request) {
+	cs.latestBlockSetMutex.RLock()
+	bs := cs.latestBlockSet
+	cs.latestBlockSetMutex.RUnlock()
+
+	w.Header().Set("Content-Type", "text/vnd.graphviz")
+	_, _ = w.Write([]byte(bs.renderDOT()))
+}
+
+// BlockAssignments are the calculation entries and blocks of the latest assembled advice
+type BlockAssignments struct {
+	Entries map[string]*cpuadvisor.CalculationEntries `json:"entries"`
+	Blocks  []BlockSnapshot                           `json:"blocks"`
+	// ReclaimOverlaps are pools and containers sharing blocks with reclaim pool, keyed by numa id
+	ReclaimOverlaps map[int64][]string `json:"reclaimOverlaps"`
+	// Provenance is the region and provision policy producing each pool block, keyed by block id
+	Provenance cpuadvisor.CPUBlockProvenance `json:"provenance,omitempty"`
+}
+
+// serveBlockAssignments exports the latest assembled advice as json without recomputing it
+func (cs *cpuServer) serveBlockAssignments(w http.ResponseWriter, _ *http.Request) {
+	cs.latestBlockSetMutex.RLock()
+	data, err := json.Marshal(&BlockAssignments{
+		Entries:         cs.latestCalculationEntries,
+		Blocks:          cs.latestBlockSet.snapshot(),
+		ReclaimOverlaps: cs.latestBlockSet.reclaimOverlaps(),
+		Provenance:      cs.latestBlockProvenance,
+	})
+	cs.latestBlockSetMutex.RUnlock()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("marshal block assignments failed: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(data)
+}
+
+// adviceInputNodeMetrics are node metrics recorded in advisor input snapshots
+var adviceInputNodeMetrics = []string{
+	coreconsts.MetricCPUUsageSystem,
+	coreconsts.MetricLoad1MinSystem,
+}
+
+// RegionInputSnapshot is the status of a region driving its sizing decision in a push cycle
+type RegionInputSnapshot struct {
+	OwnerPoolName        string            `json:"ownerPoolName"`
+	ProvisionPolicyInUse string            `json:"provisionPolicyInUse"`
+	HeadroomPolicyInUse  string            `json:"headroomPolicyInUse"`
+	ControlKnobs         types.ControlKnob `json:"controlKnobs"`
+	Headroom             float64           `json:"headroom"`
+	OvershootStatus      map[string]string `json:"overshootStatus"`
+	BoundType            string            `json:"boundType"`
+}
+
+// AdviceInputSnapshot summarizes the inputs of advisor for the advice of a push cycle along with the decided
+// pool sizes, so that operators can verify why the advice is made.
+type AdviceInputSnapshot struct {
+	Sequence  uint64    `json:"sequence"`
+	Timestamp time.Time `json:"timestamp"`
+	// NodeMetrics are node-level utilization and pressure metrics read from meta server
+	NodeMetrics map[string]float64 `json:"nodeMetrics"`
+	// Regions are keyed by region name
+	Regions map[string]RegionInputSnapshot `json:"regions"`
+	// PoolSizes are the decided pool sizes keyed by pool name and numa id
+	PoolSizes map[string]map[int]int `json:"poolSizes"`
+	// CPUManagerPolicy is the effective kubelet cpu manager policy, empty if it is unknown
+	CPUManagerPolicy string `json:"cpuManagerPolicy"`
+}
+
+// recordAdviceInputSnapshot captures advisor inputs for the advice, and only snapshots of the latest
+// adviceInputSnapshotLimit push cycles are kept
+func (cs *cpuServer) recordAdviceInputSnapshot(advisorResp *types.InternalCPUCalculationResult) {
+	if cs.adviceInputSnapshotLimit <= 0 {
+		return
+	}
+
+	snapshot := &AdviceInputSnapshot{
+		Timestamp:   advisorResp.TimeStamp,
+		NodeMetrics: make(map[string]float64),
+		Regions:     make(map[string]RegionInputSnapshot),
+		PoolSizes:   make(map[string]map[int]int, len(advisorResp.PoolEntries)),
+	}
+	if policy, err := cs.getCPUManagerPolicy(context.Background()); err == nil {
+		snapshot.CPUManagerPolicy = policy
+	}
+	if cs.metaServer != nil && cs.metaServer.MetricsFetcher != nil {
+		for _, metricName := range adviceInputNodeMetrics {
+			if data, err := cs.metaServer.GetNodeMetric(metricName); err == nil {
+				snapshot.NodeMetrics[metricName] = data.Value
+			}
+		}
+	}
+	cs.metaCache.RangeRegionInfo(func(regionName string, regionInfo *types.RegionInfo) bool {
+		overshootStatus := make(map[string]string, len(regionInfo.RegionStatus.OvershootStatus))
+		for indicator, overshootType := range regionInfo.RegionStatus.OvershootStatus {
+			overshootStatus[indicator] = string(overshootType)
+		}
+		snapshot.Regions[regionName] = RegionInputSnapshot{
+			OwnerPoolName:        regionInfo.OwnerPoolName,
+			ProvisionPolicyInUse: string(regionInfo.ProvisionPolicyInUse),
+			HeadroomPolicyInUse:  string(regionInfo.HeadroomPolicyInUse),
+			ControlKnobs:         regionInfo.ControlKnobMap,
+			Headroom:             regionInfo.Headroom,
+			OvershootStatus:      overshootStatus,
+			BoundType:            string(regionInfo.RegionStatus.BoundType),
+		}
+		return true
+	})
+	for poolName, entries := range advisorResp.PoolEntries {
+		snapshot.PoolSizes[poolName] = make(map[int]int, len(entries))
+		for numaID, cpuResource := range entries {
+			snapshot.PoolSizes[poolName][numaID] = cpuResource.Size
+		}
+	}
+
+	cs.adviceInputSnapshotsMutex.Lock()
+	defer cs.adviceInputSnapshotsMutex.Unlock()
+	cs.adviceSequence++
+	snapshot.Sequence = cs.adviceSequence
+	cs.adviceInputSnapshots[snapshot.Sequence] = snapshot
+	if cs.adviceSequence > uint64(cs.adviceInputSnapshotLimit) {
+		delete(cs.adviceInputSnapshots, cs.adviceSequence-uint64(cs.adviceInputSnapshotLimit))
+	}
+}
+
+// getCPUManagerPolicy returns the effective kubelet cpu manager policy; since changing the policy requires
+// restarting kubelet with its state cleaned, the policy is fetched from kubelet config only until it succeeds
+func (cs *cpuServer) getCPUManagerPolicy(ctx context.Context) (string, error) {
+	cs.cpuManagerPolicyMutex.Lock()
+	defer cs.cpuManagerPolicyMutex.Unlock()
+	if cs.cpuManagerPolicy != "" {
+		return cs.cpuManagerPolicy, nil
+	}
+
+	if cs.metaServer == nil || cs.metaServer.MetaAgent == nil || cs.metaServer.KubeletConfigFetcher == nil {
+		return "", fmt.Errorf("kubelet config fetcher is not initialized")
+	}
+	klConfig, err := cs.metaServer.GetKubeletConfig(ctx)
+	if err != nil {
+		return "", fmt.Errorf("get kubelet config failed: %w", err)
+	}
+	policies, err := utilkubeconfig.GetInTreeProviderPolicies(klConfig)
+	if err != nil {
+		return "", err
+	}
+
+	cs.cpuManagerPolicy = policies[consts.KCNRAnnotationCPUManager]
+	return cs.cpuManagerPolicy, nil
+}
+
+// assembleCPUManagerPolicy reports the effective kubelet cpu manager policy, so that advisor behavior can be
+// correlated with the underlying policy of each node
+func (cs *cpuServer) assembleCPUManagerPolicy() *advisorsvc.CalculationInfo {
+	if !cs.reportCPUManagerPolicy {
+		return nil
+	}
+
+	policy, err := cs.getCPUManagerPolicy(context.Background())
+	if err != nil {
+		klog.Errorf("[qosaware-server-cpu] get cpu manager policy failed: %v", err)
+		return nil
+	}
+	return &advisorsvc.CalculationInfo{
+		CgroupPath: "",
+		CalculationResult: &advisorsvc.CalculationResult{
+			Values: map[string]string{
+				string(cpuadvisor.ControlKnobKeyCPUManagerPolicy): policy,
+			},
+		},
+	}
+}
+
+// serveAdviceInputSnapshots exports advisor input snapshots of latest push cycles keyed by sequence
+func (cs *cpuServer) serveAdviceInputSnapshots(w http.ResponseWriter, _ *http.Request) {
+	cs.adviceInputSnapshotsMutex.RLock()
+	data, err := json.Marshal(cs.adviceInputSnapshots)
+	cs.adviceInputSnapshotsMutex.RUnlock()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("marshal advice input snapshots failed: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(data)
+}
+
+// getCheckpointWithTimeout gets checkpoint from the plugin, bounded by callTimeout
+func (cs *cpuServer) getCheckpointWithTimeout(ctx context.Context, client cpuadvisor.CPUPluginClient) (*cpuadvisor.GetCheckpointResponse, error) {
+	if cs.callTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cs.callTimeout)
+		defer cancel()
+	}
+
+	resp, err := client.GetCheckpoint(ctx, &cpuadvisor.GetCheckpointRequest{})
+	// grpc reports deadline exceeded by status code, so the context is checked instead
+	if err != nil && ctx.Err() == context.DeadlineExceeded {
+		_ = cs.emitter.StoreInt64(cs.genMetricsName(metricCPUServerCallTimeout), 1, metrics.MetricTypeNameCount,
+			metrics.MetricTag{Key: "call", Val: "GetCheckpoint"})
+		return nil, fmt.Errorf("%v: %w", err, context.DeadlineExceeded)
+	}
+	return resp, err
+}
+
+// getCheckpointWithRetry gets checkpoint from the plugin, and retries up to getCheckpointMaxAttempts in total
+// while the checkpoint is nil or empty; errors are returned immediately, otherwise the last checkpoint is returned
+func (cs *cpuServer) getCheckpointWithRetry(ctx context.Context, client cpuadvisor.CPUPluginClient) (*cpuadvisor.GetCheckpointResponse, error) {
+	for attempt := 1; ; attempt++ {
+		resp, err := cs.getCheckpointWithTimeout(ctx, client)
+		if err != nil || (resp != nil && len(resp.Entries) > 0) || attempt >= cs.getCheckpointMaxAttempts {
+			return resp, err
+		}
+
+		klog.Infof("[qosaware-server-cpu] got nil or empty checkpoint at attempt %d, retry in %v", attempt, getCheckpointRetryInterval)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(getCheckpointRetryInterval):
+		}
+	}
+}
+
+// updateAndGetAdviceWithTimeout updates advisor and gets the latest advice, bounded by both ctx and callTimeout;
+// since advisor update is not cancellable, it is left behind to finish in background once abandoned, and no
+// more update is started until it finishes.
+func (cs *cpuServer) updateAndGetAdviceWithTimeout(ctx context.Context) (interface{}, error) {
+	if !atomic.CompareAndSwapInt32(&cs.advisorUpdateInFlight, 0, 1) {
+		klog.Warningf("[qosaware-server-cpu] skip advisor update: %v", errAdvisorUpdateInFlight)
+		_ = cs.emitter.StoreInt64(cs.genMetricsName(metricCPUServerAdvisorUpdateInFlight), 1, metrics.MetricTypeNameCount)
+		return nil, errAdvisorUpdateInFlight
+	}
+
+	if cs.callTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cs.callTimeout)
+		defer cancel()
+	}
+
+	type adviceResult struct {
+		advice interface{}
+		err    error
+	}
+	resultCh := make(chan adviceResult, 1)
+	go func() {
+		defer atomic.StoreInt32(&cs.advisorUpdateInFlight, 0)
+		advice, err := cs.resourceAdvisor.UpdateAndGetAdvice()
+		resultCh <- adviceResult{advice: advice, err: err}
+	}()
+
+	select {
+	case result := <-resultCh:
+		return result.advice, result.err
+	case <-ctx.Done():
+		if ctx.Err() == context.DeadlineExceeded {
+			_ = cs.emitter.StoreInt64(cs.genMetricsName(metricCPUServerCallTimeout), 1, metrics.MetricTypeNameCount,
+				metrics.MetricTag{Key: "call", Val: "UpdateAndGetAdvice"})
+		}
+		return nil, fmt.Errorf("advisor update is abandoned: %w", ctx.Err())
+	}
+}
+
+func (cs *cpuServer) getAndSyncCheckpoint(ctx context.Context, clients []cpuadvisor.CPUPluginClient) error {
+	safeTime := time.Now().UnixNano()
+
+	// get checkpoint from all plugins
+	getCheckpointResps := make([]*cpuadvisor.GetCheckpointResponse, 0, len(clients))
+	allowGC := true
+	for _, client := range clients {
+		// the cycle is given up on failure, and ListAndWatch loop retries in the next one
+		getCheckpointResp, err := cs.getCheckpointWithRetry(ctx, client)
+		if err != nil {
+			reason := "error"
+			if stdErrors.Is(err, context.DeadlineExceeded) {
+				reason = "timeout"
+			}
+			_ = cs.emitter.StoreInt64(cs.genMetricsName(metricServerLWGetCheckpointFailed), int64(cs.period.Seconds()), metrics.MetricTypeNameCount,
+				metrics.MetricTag{Key: "reason", Val: reason})
+			return fmt.Errorf("get checkpoint failed: %w", err)
+		} else if getCheckpointResp == nil {
+			_ = cs.emitter.StoreInt64(cs.genMetricsName(metricCPUServerCheckpointResponses), 1, metrics.MetricTypeNameCount,
+				metrics.MetricTag{Key: "result", Val: "nil"})
+			_ = cs.emitter.StoreInt64(cs.genMetricsName(metricServerLWGetCheckpointFailed), int64(cs.period.Seconds()), metrics.MetricTypeNameCount,
+				metrics.MetricTag{Key: "reason", Val: "nil-checkpoint"})
+			return fmt.Errorf("got nil checkpoint")
+		}
+
+		// an empty checkpoint is regarded as incomplete, e.g. the plugin is warming up, so it is synced
+		// without gc to avoid deleting all cached containers
+		if len(getCheckpointResp.Entries) == 0 {
+			klog.Warningf("[qosaware-server-cpu] got empty checkpoint after %d attempts, skip gc", cs.getCheckpointMaxAttempts)
+			_ = cs.emitter.StoreInt64(cs.genMetricsName(metricCPUServerCheckpointResponses), 1, metrics.MetricTypeNameCount,
+				metrics.MetricTag{Key: "result", Val: "empty-after-retry"})
+			allowGC = false
+		} else {
+			_ = cs.emitter.StoreInt64(cs.genMetricsName(metricCPUServerCheckpointResponses), 1, metrics.MetricTypeNameCount,
+				metrics.MetricTag{Key: "result", Val: "populated"})
+		}
+
+		if klog.V(6).Enabled() {
+			klog.Infof("[qosaware-server-cpu] got checkpoint: %v", general.ToString(getCheckpointResp.Entries))
+		}
+		getCheckpointResps = append(getCheckpointResps, getCheckpointResp)
+	}
+
+	_ = cs.emitter.StoreInt64(cs.genMetricsName(metricServerLWGetCheckpointSucceeded), int64(cs.period.Seconds()), metrics.MetricTypeNameCount)
+
+	checkpoint := cs.mergeCheckpoints(getCheckpointResps)
+	cs.syncCheckpointEntries(ctx, checkpoint, safeTime, allowGC)
+	cs.setTracedCheckpoint(checkpoint)
+	cs.checkCheckpointFreshness(ctx, checkpoint)
+	cs.recordSyncSuccess()
+	return nil
+}
+
+// recordSyncSuccess records that meta cache is synced with the allocation of plugins, either from checkpoint
+// or from GetAdvice requests
+func (cs *cpuServer) recordSyncSuccess() {
+	now := time.Now()
+	cs.lastSyncSuccessTimeMutex.Lock()
+	cs.lastSyncSuccessTime = now
+	cs.lastSyncSuccessTimeMutex.Unlock()
+	_ = cs.emitter.StoreInt64(cs.genMetricsName(metricCPUServerLastCheckpointSuccess), now.Unix(), metrics.MetricTypeNameRaw,
+		metrics.MetricTag{Key: "socket", Val: cs.advisorSocketPath})
+}
+
+// isSyncFresh returns true if the latest successful checkpoint sync is within the freshness window
+func (cs *cpuServer) isSyncFresh() bool {
+	if cs.syncFreshnessWindow <= 0 {
+		return true
+	}
+
+	cs.lastSyncSuccessTimeMutex.RLock()
+	defer cs.lastSyncSuccessTimeMutex.RUnlock()
+	return time.Since(cs.lastSyncSuccessTime) <= cs.syncFreshnessWindow
+}
+
+// mergeCheckpoints aggregates checkpoints from multiple plugins; if the same container (or pool)
+// exists in multiple checkpoints with different allocation, the former one takes precedence.
+func (cs *cpuServer) mergeCheckpoints(resps []*cpuadvisor.GetCheckpointResponse) *cpuadvisor.GetCheckpointResponse {
+	if len(resps) == 1 {
+		return resps[0]
+	}
+
+	merged := &cpuadvisor.GetCheckpointResponse{
+		Entries: make(map[string]*cpuadvisor.AllocationEntries),
+	}
+	for _, resp := range resps {
+		for entryName, entry := range resp.Entries {
+			mergedEntry, ok := merged.Entries[entryName]
+			if !ok {
+				mergedEntry = &cpuadvisor.AllocationEntries{
+					Entries: make(map[string]*cpuadvisor.AllocationInfo),
+				}
+				merged.Entries[entryName] = mergedEntry
+			}
+
+			for containerName, info := range entry.Entries {
+				existing, ok := mergedEntry.Entries[containerName]
+				if !ok {
+					mergedEntry.Entries[containerName] = info
+					continue
+				}
+
+				if existing.String() != info.String() {
+					klog.Warningf("[qosaware-server-cpu] checkpoint of %s/%s conflicts among plugins, keep the former one",
+						entryName, containerName)
+					_ = cs.emitter.StoreInt64(cs.genMetricsName(metricCPUServerCheckpointConflicted), 1, metrics.MetricTypeNameCount)
+				}
+			}
+		}
+	}
+	return merged
+}
+
+// checkAdviceGates returns an error if advice should not be computed and sent to plugins in this cycle; it is
+// shared by ListAndWatch, which skips the cycle, and GetAdvice, which fails so that plugins keep current allocation
+func (cs *cpuServer) checkAdviceGates() error {
+	// TODO: do we still need this check?
+	// skip advice during startup
+	if remaining := cs.startTime.Add(cs.startUpPeriod).Sub(time.Now()); remaining > 0 {
+		klog.Infof("[qosaware-cpu] skip advice: starting up, %v remaining", remaining)
+		_ = cs.emitter.StoreInt64(cs.genMetricsName(metricCPUServerSkipPushStartingUp), 1, metrics.MetricTypeNameCount)
+		return fmt.Errorf("starting up, %v remaining", remaining)
+	}
+
+	// sanity check: if reserve pool exists
+	reservePoolInfo, ok := cs.metaCache.GetPoolInfo(commonstate.PoolNameReserve)
+	if !ok || reservePoolInfo == nil {
+		klog.Errorf("[qosaware-cpu] skip advice: reserve pool does not exist")
+		return fmt.Errorf("reserve pool does not exist")
+	}
+
+	// sanity check: if reserve pool covers enough numas, otherwise the advice is assembled with degenerate
+	// blocks during transient states of meta cache, and may strand all cores
+	if covered := countCoveredNUMAs(reservePoolInfo.TopologyAwareAssignments); covered < cs.reservePoolMinNUMACoverage {
+		klog.Errorf("[qosaware-cpu] skip advice: reserve pool covers %d numas, less than %d",
+			covered, cs.reservePoolMinNUMACoverage)
+		_ = cs.emitter.StoreInt64(cs.genMetricsName(metricCPUServerSkipPushReserveUncovered), 1, metrics.MetricTypeNameCount)
+		return fmt.Errorf("reserve pool covers %d numas, less than %d", covered, cs.reservePoolMinNUMACoverage)
+	}
+
+	// skip advice outside the maintenance window
+	if err := cs.checkPushWindow(); err != nil {
+		return err
+	}
+
+	// skip advice computed against a stale cache
+	if !cs.isSyncFresh() {
+		klog.Warningf("[qosaware-cpu] skip advice: no successful sync within %v", cs.syncFreshnessWindow)
+		_ = cs.emitter.StoreInt64(cs.genMetricsName(metricCPUServerSkipPushStaleSync), 1, metrics.MetricTypeNameCount)
+		return fmt.Errorf("no successful sync within %v", cs.syncFreshnessWindow)
+	}
+
+	return nil
+}
+
+// checkPushWindow returns an error if advice is out of the maintenance window, which applies to GetAdvice
+// whether it is gated or not
+func (cs *cpuServer) checkPushWindow() error {
+	if cs.pushWindow != nil && !cs.pushWindow.contains(cs.clock.Now()) {
+		klog.Infof("[qosaware-cpu] skip advice: out of push window")
+		_ = cs.emitter.StoreInt64(cs.genMetricsName(metricCPUServerSkipPushOutOfWindow), 1, metrics.MetricTypeNameCount)
+		return fmt.Errorf("out of push window")
+	}
+	return nil
+}
+
+// countCoveredNUMAs returns the number of numas with non-empty cpus in the assignments
+func countCoveredNUMAs(assignments types.TopologyAwareAssignment) int {
+	covered := 0
+	for _, cpus := range assignments {
+		if cpus.Size() > 0 {
+			covered++
+		}
+	}
+	return covered
+}
+
+// Deprecated: getAndPushAdvice implements the legacy asynchronous bidirectional communication model between
+// qrm plugins and sys-advisor. This is kept for backward compatibility.
+// TODO: remove this function after all qrm plugins are migrated to the new synchronous model
+func (cs *cpuServer) getAndPushAdvice(clients []cpuadvisor.CPUPluginClient, server cpuadvisor.CPUAdvisor_ListAndWatchServer) (err error) {
+	ctx, span := cs.tracer.Start(server.Context(), "push-cycle")
+	defer func() {
+		endSpan(span, err)
+	}()
+
+	// the lock is released before sending, so that a slow stream never blocks GetAdvice calls
+	cs.adviceCycleMutex.Lock()
+	result, err := cs.syncAndUpdateAdvisor(ctx, clients)
+	cs.adviceCycleMutex.Unlock()
+	if err != nil || result == nil {
+		return err
+	}
+	span.SetAttributes(entriesCountAttributes(result.Entries)...)
+
+	lwResp := cs.finalizeAdvice(result)
+	if cs.dryRun {
+		cs.reportDryRunAdvice("ListAndWatch", result)
+		// a dry-run cycle still makes progress, so that the watchdog never restarts the loop for it
+		cs.setLastPushSuccessTime(cs.clock.Now())
+		return nil
+	}
+
+	_, sendSpan := cs.tracer.Start(ctx, "send")
+	sendStartTime := cs.clock.Now()
+	err = cs.sendToLWStreams(server, lwResp)
+	cs.emitStageDuration("send", cs.clock.Since(sendStartTime))
+	endSpan(sendSpan, err)
+	if err != nil {
+		return err
+	}
+
+	cs.recordSentAdvice(result, lwResp)
+	return nil
+}
+
+// finalizeAdvice turns the assembled advice into the response to be sent, which is shared by gated GetAdvice and
+// ListAndWatch; the response is traced after hooks, so that the trace records what is sent
+func (cs *cpuServer) finalizeAdvice(result *cpuInternalResult) *cpuadvisor.ListAndWatchResponse {
+	resp := cs.runResponseHooks(&cpuadvisor.ListAndWatchResponse{
+		Entries:                               result.Entries,
+		AllowSharedCoresOverlapReclaimedCores: result.AllowSharedCoresOverlapReclaimedCores,
+		ExtraEntries:                          result.ExtraEntries,
+	})
+	cs.traceAdvice(result.AdvisorResult, resp)
+	cs.forwardToAggregator(resp)
+	return resp
+}
+
+// recordSentAdvice records the advice once it is sent to plugins by either GetAdvice or ListAndWatch
+func (cs *cpuServer) recordSentAdvice(result *cpuInternalResult, resp *cpuadvisor.ListAndWatchResponse) {
+	cs.auditAdvice(resp.Entries)
+	cs.recordSentReclaimOverlap(result)
+	cs.persistLastAdvice(resp)
+}
+
+// syncAndUpdateAdvisor syncs checkpoint of plugins into meta cache and updates advisor, and the result is nil
+// if advisor update is not triggered in this cycle; it must be called with adviceCycleMutex held
+func (cs *cpuServer) syncAndUpdateAdvisor(ctx context.Context, clients []cpuadvisor.CPUPluginClient) (*cpuInternalResult, error) {
+	syncCtx, syncSpan := cs.tracer.Start(ctx, "sync")
+	err := cs.getAndSyncCheckpoint(syncCtx, clients)
+	endSpan(syncSpan, err)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cs.checkAdviceGates(); err != nil {
+		return nil, nil
+	}
+
+	// old asynchronous communication interface does not support feature gate negotiation. If necessary, upgrade to the synchronization interface.
+	emptyMap := map[string]*advisorsvc.FeatureGate{}
+	result, err := cs.updateAdvisor(ctx, emptyMap)
+	cs.runPendingGC(err == nil)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// sendToLWStreams sends the response to the ListAndWatch stream of current loop along with joined ones;
+// only failures of current stream are returned, since joined streams are removed once they exit. The response
+// is split into chunks only for streams of plugins negotiated to reassemble them.
+func (cs *cpuServer) sendToLWStreams(server cpuadvisor.CPUAdvisor_ListAndWatchServer, lwResp *cpuadvisor.ListAndWatchResponse) error {
+	whole := []*cpuadvisor.ListAndWatchResponse{lwResp}
+	chunks := cpuadvisor.SplitListAndWatchResponse(lwResp, cs.lwChunkMaxEntries)
+	_ = cs.emitter.StoreInt64(cs.genMetricsName(metricCPUServerLWResponseBytes), int64(lwResp.Size()), metrics.MetricTypeNameRaw)
+	_ = cs.emitter.StoreInt64(cs.genMetricsName(metricCPUServerLWResponseEntries), int64(len(lwResp.Entries)), metrics.MetricTypeNameRaw)
+	_ = cs.emitter.StoreInt64(cs.genMetricsName(metricCPUServerLWResponseChunks), int64(len(chunks)), metrics.MetricTypeNameRaw)
+
+	for _, stream := range cs.getLWStreams(server) {
+		streamChunks := whole
+		if len(chunks) > 1 && isLWChunkNegotiated(stream) {
+			streamChunks = chunks
+		}
+		if err := cs.sendChunks(stream, streamChunks); err != nil {
+			_ = cs.emitter.StoreInt64(cs.genMetricsName(metricServerLWSendResponseFailed), int64(cs.period.Seconds()), metrics.MetricTypeNameCount)
+			if stream == server {
+				return fmt.Errorf("send listWatch response failed: %w", err)
+			}
+			// joined stream will be removed once it exits, so just skip it here
+			klog.Errorf("[qosaware-server-cpu] send listWatch response to joined stream failed: %v", err)
+			// but a timed-out one may still be blocked in Send, so remove it now to never send to it concurrently
+			if stdErrors.Is(err, errLWSendTimedOut) {
+				cs.removeLWStream(stream)
+			}
+		}
+	}
+
+	if klog.V(6).Enabled() {
+		klog.Infof("[qosaware-server-cpu] sent listWatch resp: %v", general.ToString(lwResp))
+	}
+
+	cs.setLastPushSuccessTime(cs.clock.Now())
+	_ = cs.emitter.StoreInt64(cs.genMetricsName(metricServerLWSendResponseSucceeded), int64(cs.period.Seconds()), metrics.MetricTypeNameCount)
+	return nil
+}
+
+// sendChunks sends chunks of a response to the stream in order, and gives up on the first failure
+func (cs *cpuServer) sendChunks(stream cpuadvisor.CPUAdvisor_ListAndWatchServer, chunks []*cpuadvisor.ListAndWatchResponse) error {
+	for i, chunk := range chunks {
+		if err := cs.sendWithTimeout(stream, chunk); err != nil {
+			return fmt.Errorf("send chunk %d/%d failed: %w", i+1, len(chunks), err)
+		}
+	}
+	return nil
+}
+
+// sendWithTimeout sends the response to the stream, bounded by lwSendTimeout; since Send is not cancellable,
+// it is left behind to return in background once the stream is closed
+func (cs *cpuServer) sendWithTimeout(stream cpuadvisor.CPUAdvisor_ListAndWatchServer, resp *cpuadvisor.ListAndWatchResponse) error {
+	if cs.lwSendTimeout <= 0 {
+		return stream.Send(resp)
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- stream.Send(resp)
+	}()
+
+	timer := time.NewTimer(cs.lwSendTimeout)
+	defer timer.Stop()
+	select {
+	case err := <-errCh:
+		return err
+	case <-timer.C:
+		_ = cs.emitter.StoreInt64(cs.genMetricsName(metricCPUServerLWSendTimeout), 1, metrics.MetricTypeNameCount)
+		return fmt.Errorf("%w after %v", errLWSendTimedOut, cs.lwSendTimeout)
+	}
+}
+
+// isLWChunkNegotiated returns true if the plugin of the stream reassembles chunks, which is negotiated with
+// feature gates carried by grpc metadata, since ListAndWatch has no request to carry them
+func isLWChunkNegotiated(stream cpuadvisor.CPUAdvisor_ListAndWatchServer) bool {
+	wantedFeatureGates := featuregatenegotiation.GetWantedFeatureGatesFromIncomingContext(stream.Context(), finders.FeatureGateTypeCPU)
+	supportedWantedFeatureGates, err := featuregatenegotiation.GenerateSupportedWantedFeatureGates(wantedFeatureGates, finders.FeatureGateTypeCPU)
+	if err != nil {
+		return false
+	}
+	_, ok := supportedWantedFeatureGates[feature_cpu.NegotiationFeatureGateListAndWatchChunk]
+	return ok
+}
+
+// endSpan records the error (if any) in the span before ending it
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// entriesCountAttributes returns the numbers of pods and pools in calculation entries as span attributes
+func entriesCountAttributes(calculationEntriesMap map[string]*cpuadvisor.CalculationEntries) []attribute.KeyValue {
+	podCount, poolCount := 0, 0
+	for _, entries := range calculationEntriesMap {
+		if _, ok := entries.Entries[commonstate.FakedContainerName]; ok {
+			poolCount++
+		} else {
+			podCount++
+		}
+	}
+	return []attribute.KeyValue{attribute.Int("pod_count", podCount), attribute.Int("pool_count", poolCount)}
+}
+
+func (cs *cpuServer) updateAdvisor(ctx context.Context, featureGates map[string]*advisorsvc.FeatureGate) (*cpuInternalResult, error) {
+	// update feature gates in meta cache
+	err := cs.metaCache.SetSupportedWantedFeatureGates(featureGates)
+	if err != nil {
+		_ = cs.emitter.StoreInt64(cs.genMetricsName(metricServerAdvisorUpdateFailed), int64(cs.period.Seconds()), metrics.MetricTypeNameCount)
+		return nil, fmt.Errorf("set feature gates failed: %w", err)
+	}
+
+	// trigger advisor update and get latest advice
+	_, updateSpan := cs.tracer.Start(ctx, "advisor-update")
+	updateStartTime := cs.clock.Now()
+	advisorRespRaw, err := cs.updateAndGetAdviceWithTimeout(ctx)
+	cs.emitStageDuration("advisor_update", cs.clock.Since(updateStartTime))
+	endSpan(updateSpan, err)
+	if err != nil {
+		_ = cs.emitter.StoreInt64(cs.genMetricsName(metricServerAdvisorUpdateFailed), int64(cs.period.Seconds()), metrics.MetricTypeNameCount)
+		return nil, fmt.Errorf("get advice failed: %w", err)
+	}
+	advisorResp, ok := advisorRespRaw.(*types.InternalCPUCalculationResult)
+	if !ok {
+		_ = cs.emitter.StoreInt64(cs.genMetricsName(metricServerAdvisorUpdateFailed), int64(cs.period.Seconds()), metrics.MetricTypeNameCount)
+		return nil, fmt.Errorf("get advice failed: invalid type: %T", advisorRespRaw)
+	}
+
+	klog.Infof("[qosaware-server-cpu] get advisor update: %+v", general.ToString(advisorResp))
+	cs.recordAdviceInputSnapshot(advisorResp)
+
+	advisorResp = cs.disableReclaimOverlapOnNodeConditions(ctx, advisorResp)
+	_, assembleSpan := cs.tracer.Start(ctx, "assemble")
+	assembleStartTime := cs.clock.Now()
+	result := cs.assembleResponse(advisorResp)
+	result.AdvisorResult = advisorResp
+	cs.emitStageDuration("assemble", cs.clock.Since(assembleStartTime))
+	assembleSpan.SetAttributes(entriesCountAttributes(result.Entries)...)
+	assembleSpan.End()
+	if err := cs.checkReserveReclaimOverlap(result.Entries); err != nil && cs.refusePushOnReserveReclaimOverlap {
+		_ = cs.emitter.StoreInt64(cs.genMetricsName(metricServerAdvisorUpdateFailed), int64(cs.period.Seconds()), metrics.MetricTypeNameCount)
+		return nil, err
+	}
+	if poolMissing := result.PoolMissingContainers; cs.maxPoolMissingContainers > 0 && poolMissing > cs.maxPoolMissingContainers {
+		_ = cs.emitter.StoreInt64(cs.genMetricsName(metricServerAdvisorUpdateFailed), int64(cs.period.Seconds()), metrics.MetricTypeNameCount)
+		return nil, fmt.Errorf("%d containers refer to empty or missing owner pools, exceeding %d", poolMissing, cs.maxPoolMissingContainers)
+	}
+	if cs.strictAssembly && len(result.Warnings) > 0 {
+		_ = cs.emitter.StoreInt64(cs.genMetricsName(metricCPUServerStrictAssemblyAborted), int64(len(result.Warnings)), metrics.MetricTypeNameCount)
+		return nil, fmt.Errorf("strict assembly found %d inconsistencies: %s", len(result.Warnings), strings.Join(result.Warnings, "; "))
+	}
+	return result, nil
+}
+
+// disableReclaimOverlapOnNodeConditions returns the advisor result with overlap between reclaim pool and others
+// turned off if the node has any of reclaimDisablingNodeConditions, and overlap is turned on again once they clear;
+// the original advisor result is never modified since it may be referred to by the advisor.
+func (cs *cpuServer) disableReclaimOverlapOnNodeConditions(ctx context.Context, advisorResp *types.InternalCPUCalculationResult) *types.InternalCPUCalculationResult {
+	if cs.reclaimDisablingNodeConditions.Len() == 0 {
+		return advisorResp
+	}
+
+	node, err := cs.metaServer.GetNode(ctx)
+	if err != nil {
+		klog.Errorf("[qosaware-server-cpu] get node failed, keep reclaim overlap as advised: %v", err)
+		return advisorResp
+	}
+
+	conditions := make([]string, 0)
+	for _, condition := range node.Status.Conditions {
+		if condition.Status == v1.ConditionTrue && cs.reclaimDisablingNodeConditions.Has(string(condition.Type)) {
+			conditions = append(conditions, string(condition.Type))
+		}
+	}
+	if len(conditions) == 0 {
+		_ = cs.emitter.StoreInt64(cs.genMetricsName(metricCPUServerReclaimOverlapDisabled), 0, metrics.MetricTypeNameRaw)
+		return advisorResp
+	}
+
+	klog.Warningf("[qosaware-server-cpu] node has conditions %v, turn off reclaim overlap", conditions)
+	_ = cs.emitter.StoreInt64(cs.genMetricsName(metricCPUServerReclaimOverlapDisabled), 1, metrics.MetricTypeNameRaw)
+
+	disabled := *advisorResp
+	disabled.AllowSharedCoresOverlapReclaimedCores = false
+	disabled.PoolOverlapInfo = lo.OmitByKeys(advisorResp.PoolOverlapInfo, []string{commonstate.PoolNameReclaim})
+	disabled.PoolOverlapPodContainerInfo = lo.OmitByKeys(advisorResp.PoolOverlapPodContainerInfo, []string{commonstate.PoolNameReclaim})
+	return &disabled
+}
+
+// checkReserveReclaimOverlap validates that reserve pool stays exclusive, i.e. neither assembled reclaim blocks
+// overlap with reserve pool, nor reclaim cpus in checkpoint intersect with reserve cpus; any overlap is a serious
+// error, so it is always reported by a critical metric, and returned to refuse pushing if configured.
+func (cs *cpuServer) checkReserveReclaimOverlap(calculationEntriesMap map[string]*cpuadvisor.CalculationEntries) error {
+	var errs []error
+	if reclaimEntries, ok := calculationEntriesMap[commonstate.PoolNameReclaim]; ok {
+		if reclaimInfo, ok := reclaimEntries.Entries[commonstate.FakedContainerName]; ok {
+			for numaID, numaCalculationResult := range reclaimInfo.CalculationResultsByNumas {
+				for _, block := range numaCalculationResult.Blocks {
+					for _, target := range block.OverlapTargets {
+						if target.OverlapType == cpuadvisor.OverlapType_OverlapWithPool && target.OverlapTargetPoolName == commonstate.PoolNameReserve {
+							errs = append(errs, fmt.Errorf("reclaim block %s overlaps with reserve pool on numa %d", block.BlockId, numaID))
+						}
+					}
+				}
+			}
+		}
+	}
+
+	reservePoolInfo, reserveOK := cs.metaCache.GetPoolInfo(commonstate.PoolNameReserve)
+	reclaimPoolInfo, reclaimOK := cs.metaCache.GetPoolInfo(commonstate.PoolNameReclaim)
+	if reserveOK && reclaimOK {
+		if overlapped := reservePoolInfo.TopologyAwareAssignments.MergeCPUSet().Intersection(
+			reclaimPoolInfo.TopologyAwareAssignments.MergeCPUSet()); !overlapped.IsEmpty() {
+			errs = append(errs, fmt.Errorf("reclaim cpus overlap with reserve cpus %s in checkpoint", overlapped.String()))
+		}
+	}
+
+	if len(errs) == 0 {
+		_ = cs.emitter.StoreInt64(cs.genMetricsName(metricCPUServerReserveReclaimOverlapped), 0, metrics.MetricTypeNameRaw)
+		return nil
+	}
+
+	err := errors.NewAggregate(errs)
+	klog.Errorf("[qosaware-server-cpu] reserve pool is not exclusive: %v", err)
+	_ = cs.emitter.StoreInt64(cs.genMetricsName(metricCPUServerReserveReclaimOverlapped), 1, metrics.MetricTypeNameRaw)
+	return err
+}
+
+type cpuInternalResult struct {
+	Entries                               map[string]*cpuadvisor.CalculationEntries
+	AllowSharedCoresOverlapReclaimedCores bool
+	ExtraEntries                          []*advisorsvc.CalculationInfo
+	// PlacementReasons records why each normal container is placed in its owner pool,
+	// keyed by pod uid and container name; it is only used for debugging and not sent to qrm plugins.
+	PlacementReasons map[string]map[string]PlacementReason
+	// Warnings are inconsistencies found in assembly, whose entries are skipped
+	Warnings []string
+	// PoolMissingContainers is the number of containers skipped for referring to empty or missing owner pools
+	PoolMissingContainers int
+	// ReclaimOverlapInfo is the size of overlap between reclaim pool and each shared pool in cores,
+	// keyed by numa id and shared pool name; it is only used for debugging and not sent to qrm plugins.
+	ReclaimOverlapInfo map[int]map[string]int
+	// AdvisorResult is the advisor result the entries are assembled from; it is only used for advice traces
+	// and not sent to qrm plugins.
+	AdvisorResult *types.InternalCPUCalculationResult
+}
+
+// getBlockProvenance returns provenance of pool blocks, which is taken from the pool entry of the same numa;
+// blocks of pools without provenance (e.g. reserve and reclaim) are omitted
+func getBlockProvenance(advisorResp *types.InternalCPUCalculationResult,
+	calculationEntriesMap map[string]*cpuadvisor.CalculationEntries,
+) cpuadvisor.CPUBlockProvenance {
+	blockProvenance := make(cpuadvisor.CPUBlockProvenance)
+	for poolName, entries := range calculationEntriesMap {
+		poolInfo, ok := entries.Entries[commonstate.FakedContainerName]
+		if !ok {
+			continue
+		}
+		for numaID, numaCalculationResult := range poolInfo.CalculationResultsByNumas {
+			provenance := advisorResp.GetPoolEntryProvenance(poolName, int(numaID))
+			if provenance == "" {
+				continue
+			}
+			for _, block := range numaCalculationResult.Blocks {
+				blockProvenance[block.BlockId] = provenance
+			}
+		}
+	}
+	return blockProvenance
+}
+
+// assembleBlockProvenance assembles provenance of pool blocks, and it is skipped if no block has provenance
+func (cs *cpuServer) assembleBlockProvenance(blockProvenance cpuadvisor.CPUBlockProvenance) *advisorsvc.CalculationInfo {
+	if len(blockProvenance) == 0 {
+		return nil
+	}
+
+	data, err := json.Marshal(blockProvenance)
+	if err != nil {
+		klog.Errorf("[qosaware-server-cpu] marshal block provenance failed: %v", err)
+		return nil
+	}
+
+	return &advisorsvc.CalculationInfo{
+		CgroupPath: "",
+		CalculationResult: &advisorsvc.CalculationResult{
+			Values: map[string]string{
+				string(cpuadvisor.ControlKnobKeyCPUBlockProvenance): string(data),
+			},
+		},
+	}
+}
+
+// assembleBlockCPUList assembles explicit cpu lists of blocks if it is negotiated with cpu plugin; the cpu list
+// of a block is derived from TopologyAwareAssignments of its owner pool (or container), and it is only carried
+// if the owner has a single block in the numa with the same size, otherwise the plugin falls back to the block size.
+func (cs *cpuServer) assembleBlockCPUList(calculationEntriesMap map[string]*cpuadvisor.CalculationEntries) *advisorsvc.CalculationInfo {
+	enabled, err := metacache.IsExplicitCPUListEnabled(cs.metaCache)
+	if err != nil {
+		klog.Errorf("[qosaware-server-cpu] check explicit cpu list enabled failed: %v", err)
+		return nil
+	} else if !enabled {
+		return nil
+	}
+
+	blockCPUList := make(cpuadvisor.CPUBlockCPUList)
+	for entryName, entries := range calculationEntriesMap {
+		for containerName, calculationInfo := range entries.Entries {
+			var assignments types.TopologyAwareAssignment
+			if containerName == commonstate.FakedContainerName {
+				poolInfo, ok := cs.metaCache.GetPoolInfo(entryName)
+				if !ok {
+					continue
+				}
+				assignments = poolInfo.TopologyAwareAssignments
+			} else {
+				containerInfo, ok := cs.metaCache.GetContainerInfo(entryName, containerName)
+				if !ok {
+					continue
+				}
+				assignments = containerInfo.TopologyAwareAssignments
+			}
+
+			for numaID, numaCalculationResult := range calculationInfo.CalculationResultsByNumas {
+				if len(numaCalculationResult.Blocks) != 1 {
+					continue
+				}
+
+				var cpuset machine.CPUSet
+				if numaID == commonstate.FakedNUMAID {
+					cpuset = machine.NewCPUSet().UnionAll(lo.Values(assignments))
+				} else {
+					cpuset = assignments[int(numaID)]
+				}
+
+				block := numaCalculationResult.Blocks[0]
+				if _, ok := blockCPUList[block.BlockId]; ok || uint64(cpuset.Size()) != block.Result {
+					continue
+				}
+				blockCPUList[block.BlockId] = cpuset.String()
+			}
+		}
+	}
+
+	data, err := json.Marshal(blockCPUList)
+	if err != nil {
+		klog.Errorf("[qosaware-server-cpu] marshal block cpu list failed: %v", err)
+		return nil
+	}
+
+	return &advisorsvc.CalculationInfo{
+		CgroupPath: "",
+		CalculationResult: &advisorsvc.CalculationResult{
+			Values: map[string]string{
+				string(cpuadvisor.ControlKnobKeyCPUBlockCPUList): string(data),
+			},
+		},
+	}
+}
+
+// PlacementReason describes which branch applies when choosing the owner pool of a container
+type PlacementReason string
+
+const (
+	// PlacementReasonOwnerPool means the container is placed in its current owner pool
+	PlacementReasonOwnerPool PlacementReason = "owner-pool"
+	// PlacementReasonIsolationLockIn means the container is isolated, and placed in its isolation region
+	PlacementReasonIsolationLockIn PlacementReason = "isolation-lock-in"
+	// PlacementReasonIsolationLockOut means the container is de-isolated, and placed back in its original owner pool
+	PlacementReasonIsolationLockOut PlacementReason = "isolation-lock-out"
+	// PlacementReasonOrphanFallback means the owner pool of the container is gone, and it is placed in the fallback pool
+	PlacementReasonOrphanFallback PlacementReason = "orphan-fallback"
+	// PlacementReasonIsolationDamped means the isolation state of the container changed recently, and it is
+	// kept in the previously advised pool until the new state lasts for the min transition gap
+	PlacementReasonIsolationDamped PlacementReason = "isolation-damped"
+)
+
+// isolationTransition records the latest isolation state of a container and the owner pool reflected in advice
+type isolationTransition struct {
+	isolated bool
+	// since is the first time the current isolation state is observed
+	since         time.Time
+	ownerPoolName string
+	reason        PlacementReason
+}
+
+// PoolGCProtectionReason describes why a cached pool absent from checkpoint is protected from gc
+type PoolGCProtectionReason string
+
+const (
+	// PoolGCProtectionReasonContainerReference means the pool is still the original owner pool of a living container
+	PoolGCProtectionReasonContainerReference PoolGCProtectionReason = "container-reference"
+)
+
+// EmptyDedicatedAssignmentsPolicy is the policy to handle dedicated numa binding containers without topology aware assignments
+type EmptyDedicatedAssignmentsPolicy string
+
+const (
+	// EmptyDedicatedAssignmentsPolicySkip skips assembling such containers
+	EmptyDedicatedAssignmentsPolicySkip EmptyDedicatedAssignmentsPolicy = "skip"
+	// EmptyDedicatedAssignmentsPolicyFallbackPool assembles such containers without blocks, placed in their owner pool
+	EmptyDedicatedAssignmentsPolicyFallbackPool EmptyDedicatedAssignmentsPolicy = "fallback-pool"
+)
+
+// EmptyReclaimBlocksPolicy is the policy to represent reclaim pool on numa nodes without reclaim capacity
+type EmptyReclaimBlocksPolicy string
+
+const (
+	// EmptyReclaimBlocksPolicyKeep keeps zero-size reclaim blocks along with numa results without blocks
+	EmptyReclaimBlocksPolicyKeep EmptyReclaimBlocksPolicy = "keep"
+	// EmptyReclaimBlocksPolicyOmit drops zero-size reclaim blocks, and numa results left without blocks are dropped as well
+	EmptyReclaimBlocksPolicyOmit EmptyReclaimBlocksPolicy = "omit"
+	// EmptyReclaimBlocksPolicyEmptyMarker drops zero-size reclaim blocks, and numa results without blocks
+	// are kept as an explicit marker that reclaim pool has no cpus on the numa
+	EmptyReclaimBlocksPolicyEmptyMarker EmptyReclaimBlocksPolicy = "empty-marker"
+)
+
+// resolveOwnerPool returns the owner pool name passed to qrm plugins for a normal container, along with the reason
+func resolveOwnerPool(ci *types.ContainerInfo) (string, PlacementReason) {
+	// if isolation is locking in, pass isolation-region name (equals isolation owner-pool) instead of owner pool
+	if ci.Isolated {
+		if ci.RegionNames.Len() == 1 && ci.OwnerPoolName != ci.RegionNames.List()[0] {
+			return ci.RegionNames.List()[0], PlacementReasonIsolationLockIn
+		}
+	}
+	// if isolation is locking out, pass original owner pool instead of owner pool
+	if !ci.Isolated && ci.OwnerPoolName != ci.OriginOwnerPoolName {
+		return ci.OriginOwnerPoolName, PlacementReasonIsolationLockOut
+	}
+	return ci.OwnerPoolName, PlacementReasonOwnerPool
+}
+
+// resolveDampedOwnerPool resolves the owner pool of a normal container like resolveOwnerPool, but keeps the
+// previously advised pool if the isolation state of the container changed within isolationTransitionMinGap,
+// so that flapping isolation does not cause pool thrash.
+func (cs *cpuServer) resolveDampedOwnerPool(ci *types.ContainerInfo) (string, PlacementReason) {
+	ownerPoolName, reason := resolveOwnerPool(ci)
+	if cs.isolationTransitionMinGap <= 0 {
+		return ownerPoolName, reason
+	}
+
+	cs.isolationTransitionsMutex.Lock()
+	defer cs.isolationTransitionsMutex.Unlock()
+
+	now := cs.clock.Now()
+	meta := ContainerMeta{PodUID: ci.PodUID, ContainerName: ci.ContainerName}
+	transition, ok := cs.isolationTransitions[meta]
+	if !ok {
+		cs.isolationTransitions[meta] = &isolationTransition{
+			isolated:      ci.Isolated,
+			since:         now,
+			ownerPoolName: ownerPoolName,
+			reason:        reason,
+		}
+		return ownerPoolName, reason
+	}
+
+	if transition.isolated != ci.Isolated {
+		transition.isolated = ci.Isolated
+		transition.since = now
+	}
+	if ownerPoolName == transition.ownerPoolName || now.Sub(transition.since) >= cs.isolationTransitionMinGap {
+		transition.ownerPoolName, transition.reason = ownerPoolName, reason
+		return ownerPoolName, reason
+	}
+
+	klog.Infof("[qosaware-server-cpu] container %s/%s isolated=%v since %v, keep it in pool %s instead of %s",
+		ci.PodUID, ci.ContainerName, ci.Isolated, transition.since, transition.ownerPoolName, ownerPoolName)
+	_ = cs.emitter.StoreInt64(cs.genMetricsName(metricCPUServerIsolationTransitionDamped), 1, metrics.MetricTypeNameCount,
+		metrics.MetricTag{Key: "reason", Val: string(reason)})
+	transition.reason = PlacementReasonIsolationDamped
+	return transition.ownerPoolName, transition.reason
+}
+
+// advisedOwnerPool returns the owner pool of a normal container reflected in the latest assembly
+func (cs *cpuServer) advisedOwnerPool(ci *types.ContainerInfo) (string, PlacementReason) {
+	cs.isolationTransitionsMutex.Lock()
+	defer cs.isolationTransitionsMutex.Unlock()
+
+	if transition, ok := cs.isolationTransitions[ContainerMeta{PodUID: ci.PodUID, ContainerName: ci.ContainerName}]; ok {
+		return transition.ownerPoolName, transition.reason
+	}
+	return resolveOwnerPool(ci)
+}
+
+// pruneIsolationTransitions drops isolation transitions of containers not assembled any more
+func (cs *cpuServer) pruneIsolationTransitions(assembled map[ContainerMeta]struct{}) {
+	cs.isolationTransitionsMutex.Lock()
+	defer cs.isolationTransitionsMutex.Unlock()
+
+	for meta := range cs.isolationTransitions {
+		if _, ok := assembled[meta]; !ok {
+			delete(cs.isolationTransitions, meta)
+		}
+	}
+}
+
+func (cs *cpuServer) assembleResponse(advisorResp *types.InternalCPUCalculationResult) *cpuInternalResult {
+	startTime := time.Now()
+	defer func() {
+		general.InfoS("finished", "duration", time.Since(startTime))
+	}()
+	advisorResp = cs.carryForwardAbsentPools(advisorResp)
+	advisorResp = cs.applyContainerCPUFloors(advisorResp)
+	advisorResp = cs.applyReclaimPoolFloor(advisorResp)
+	calculationEntriesMap := make(map[string]*cpuadvisor.CalculationEntries)
+	blockID2Blocks := NewBlockSet()
+	skippedContainers := cs.getStaleContainers()
+	for meta := range cs.getPodFetchFailedContainers() {
+		skippedContainers.Insert(meta)
+	}
+	for meta := range cs.getUnsettledContainers() {
+		skippedContainers.Insert(meta)
+	}
+	for meta := range cs.getUnmanagedContainers() {
+		skippedContainers.Insert(meta)
+	}
+	blockStat := &blockAssemblyStat{}
+	warnings := &assemblyWarnings{}
+
+	// first assemble NUMABinding pod entries
+	if cs.podEntryAssemblyWorkers > 1 {
+		podContainers := make(map[string][]*types.ContainerInfo)
+		cs.metaCache.RangeContainer(func(podUID string, containerName string, ci *types.ContainerInfo) bool {
+			if !skippedContainers.Has(ContainerMeta{PodUID: podUID, ContainerName: containerName}) && ci.IsDedicatedNumaBinding() {
+				podContainers[podUID] = append(podContainers[podUID], ci)
+			}
+			return true
+		})
+		cs.assembleDedicatedNUMABindingPodEntriesInParallel(advisorResp, calculationEntriesMap, blockID2Blocks, blockStat, warnings, podContainers)
+	} else {
+		cs.metaCache.RangeContainer(func(podUID string, containerName string, ci *types.ContainerInfo) bool {
+			if skippedContainers.Has(ContainerMeta{PodUID: podUID, ContainerName: containerName}) {
+				return true
+			}
+			if err := cs.assembleDedicatedNUMABindingPodEntries(advisorResp, calculationEntriesMap, blockID2Blocks, blockStat, warnings, podUID, ci); err != nil {
+				klog.Errorf("[qosaware-server-cpu] assembleDedicatedNUMABindingPodEntries for pod %s/%s uid %s err: %v", ci.PodNamespace, ci.PodName, ci.PodUID, err)
+				warnings.add(fmt.Sprintf("assemble dedicated numa binding container %s/%s failed: %v", ci.PodUID, ci.ContainerName, err))
+			}
+			return true
+		})
+	}
+	_ = cs.emitter.StoreInt64(cs.genMetricsName(metricCPUServerBlocksReused), int64(blockStat.reused), metrics.MetricTypeNameRaw)
+	_ = cs.emitter.StoreInt64(cs.genMetricsName(metricCPUServerBlocksCreated), int64(blockStat.created), metrics.MetricTypeNameRaw)
+
+	// second, assemble pool entries
+	cs.assemblePoolEntries(advisorResp, calculationEntriesMap, blockID2Blocks, warnings)
+	cs.capPoolBlocksPerNUMA(calculationEntriesMap, blockID2Blocks)
+	cs.mergePoolNUMABlocks(calculationEntriesMap, blockID2Blocks)
+
+	// last, assemble normal pod entries
+	placementReasons := make(map[string]map[string]PlacementReason)
+	assembledContainers := make(map[ContainerMeta]struct{})
+	poolMissingContainers := map[string]int{}
+	f := func(podUID string, containerName string, ci *types.ContainerInfo) bool {
+		if skippedContainers.Has(ContainerMeta{PodUID: podUID, ContainerName: containerName}) {
+			return true
+		}
+		assembledContainers[ContainerMeta{PodUID: podUID, ContainerName: containerName}] = struct{}{}
+		if err := cs.assembleNormalPodEntries(calculationEntriesMap, podUID, ci); err != nil {
+			klog.Errorf("[qosaware-server-cpu] assembleNormalPodEntries for pod %s/%s uid %s err: %v", ci.PodNamespace, ci.PodName, ci.PodUID, err)
+			warnings.add(fmt.Sprintf("assemble container %s/%s failed: %v", ci.PodUID, ci.ContainerName, err))
+			if stdErrors.Is(err, ErrEmptyOwnerPool) {
+				poolMissingContainers["empty-owner-pool"]++
+			} else if stdErrors.Is(err, ErrPoolNotFound) {
+				poolMissingContainers["pool-not-found"]++
+			}
+		}
+
+		// record placement reason for containers assembled as normal pod entries
+		if entries, ok := calculationEntriesMap[podUID]; ok && !ci.IsDedicatedNumaBinding() {
+			if calculationInfo, ok := entries.Entries[containerName]; ok {
+				if _, ok := placementReasons[podUID]; !ok {
+					placementReasons[podUID] = make(map[string]PlacementReason)
+				}
+				ownerPoolName, reason := cs.advisedOwnerPool(ci)
+				if calculationInfo.OwnerPoolName != ownerPoolName {
+					reason = PlacementReasonOrphanFallback
+				}
+				placementReasons[podUID][containerName] = reason
+			}
+		}
+		return true
+	}
+	cs.metaCache.RangeContainer(f)
+	cs.pruneIsolationTransitions(assembledContainers)
+	for _, reason := range []string{"empty-owner-pool", "pool-not-found"} {
+		_ = cs.emitter.StoreInt64(cs.genMetricsName(metricCPUServerPoolMissingContainers), int64(poolMissingContainers[reason]),
+			metrics.MetricTypeNameRaw, metrics.MetricTag{Key: "reason", Val: reason})
+	}
+	cs.removeDuplicateBlocks(calculationEntriesMap)
+
+	extraEntries := cs.assembleCgroupConfig(advisorResp)
+	extraNumaHeadRoom := cs.assembleHeadroom(advisorResp)
+	if extraNumaHeadRoom != nil {
+		extraEntries = append(extraEntries, extraNumaHeadRoom)
+	}
+	if blockCPUList := cs.assembleBlockCPUList(calculationEntriesMap); blockCPUList != nil {
+		extraEntries = append(extraEntries, blockCPUList)
+	}
+	if cpuManagerPolicy := cs.assembleCPUManagerPolicy(); cpuManagerPolicy != nil {
+		extraEntries = append(extraEntries, cpuManagerPolicy)
+	}
+	blockProvenance := getBlockProvenance(advisorResp, calculationEntriesMap)
+	if provenance := cs.assembleBlockProvenance(blockProvenance); provenance != nil {
+		extraEntries = append(extraEntries, provenance)
+	}
+	extraEntries = cs.filterDeniedControlKnobs(extraEntries)
+	cs.emitAggregateMetrics(advisorResp)
+	cs.emitPoolStabilityScores(advisorResp)
+	cs.emitBlockSetStat(blockID2Blocks)
+	cs.emitPoolNUMABlockCounts(calculationEntriesMap)
+	// Send result
+	resp := &cpuInternalResult{
+		Entries:                               calculationEntriesMap,
+		ExtraEntries:                          extraEntries,
+		AllowSharedCoresOverlapReclaimedCores: advisorResp.AllowSharedCoresOverlapReclaimedCores,
+		PlacementReasons:                      placementReasons,
+		Warnings:                              warnings.messages,
+		PoolMissingContainers:                 poolMissingContainers["empty-owner-pool"] + poolMissingContainers["pool-not-found"],
+		ReclaimOverlapInfo:                    advisorResp.PoolOverlapInfo[commonstate.PoolNameReclaim],
+	}
+
+	// blocks and entries are never modified once assembled, and response hooks run on a deep copy of them,
+	// so keep the reference for debugging
+	cs.latestBlockSetMutex.Lock()
+	cs.latestBlockSet = blockID2Blocks
+	cs.latestCalculationEntries = calculationEntriesMap
+	cs.latestBlockProvenance = blockProvenance
+	cs.latestBlockSetMutex.Unlock()
+
+	cs.emitAdviceLatency(calculationEntriesMap, time.Since(startTime))
+	return resp
+}
+
+// carryForwardAbsentPools returns the advisor result complemented with pools cached in meta cache but absent
+// from it, at their cached sizes per numa, until they have been absent for absentPoolCarryForwardWindow;
+// the original advisor result is never modified since it may be referred to by the advisor.
+func (cs *cpuServer) carryForwardAbsentPools(advisorResp *types.InternalCPUCalculationResult) *types.InternalCPUCalculationResult {
+	if cs.absentPoolCarryForwardWindow <= 0 {
+		return advisorResp
+	}
+
+	cs.poolAbsentSinceMutex.Lock()
+	defer cs.poolAbsentSinceMutex.Unlock()
+
+	now := cs.clock.Now()
+	absentSince := make(map[string]time.Time)
+	carriedPoolEntries := make(map[string]map[int]types.CPUResource)
+	cs.metaCache.RangePoolInfo(func(poolName string, poolInfo *types.PoolInfo) bool {
+		if _, ok := advisorResp.PoolEntries[poolName]; ok || len(poolInfo.TopologyAwareAssignments) == 0 {
+			return true
+		}
+
+		since, ok := cs.poolAbsentSince[poolName]
+		if !ok {
+			since = now
+		}
+		absentSince[poolName] = since
+		if now.Sub(since) > cs.absentPoolCarryForwardWindow {
+			return true
+		}
+
+		entries := make(map[int]types.CPUResource, len(poolInfo.TopologyAwareAssignments))
+		for numaID, cpuset := range poolInfo.TopologyAwareAssignments {
+			entries[numaID] = types.CPUResource{Size: cpuset.Size()}
+		}
+		carriedPoolEntries[poolName] = entries
+		klog.Warningf("[qosaware-server-cpu] pool %s is absent from advisor result since %v, carry forward its cached size",
+			poolName, since)
+		_ = cs.emitter.StoreInt64(cs.genMetricsName(metricCPUServerAbsentPoolCarriedForward), 1, metrics.MetricTypeNameCount,
+			metrics.MetricTag{Key: "pool", Val: poolName})
+		return true
+	})
+	// only keep records for pools still absent
+	cs.poolAbsentSince = absentSince
+
+	if len(carriedPoolEntries) == 0 {
+		return advisorResp
+	}
+
+	carried := *advisorResp
+	carried.PoolEntries = make(map[string]map[int]types.CPUResource, len(advisorResp.PoolEntries)+len(carriedPoolEntries))
+	for poolName, entries := range advisorResp.PoolEntries {
+		carried.PoolEntries[poolName] = entries
+	}
+	for poolName, entries := range carriedPoolEntries {
+		carried.PoolEntries[poolName] = entries
+	}
+	return &carried
+}
+
+// applyContainerCPUFloors returns the advisor result with pools (or dedicated numa binding pods) clamped up to
+// the cpu floors of containers placed in them, so that no container is squeezed to zero cpus under reclaim
+// pressure; the deficit is added to the numa with the largest size, and overlapped cpus are counted for reclaim
+// pool. The original advisor result is never modified since it may be referred to by the advisor.
+func (cs *cpuServer) applyContainerCPUFloors(advisorResp *types.InternalCPUCalculationResult) *types.InternalCPUCalculationResult {
+	if len(cs.containerMinCPUFloors) == 0 {
+		return advisorResp
+	}
+
+	clampedPoolEntries := make(map[string]map[int]types.CPUResource)
+	for poolName, floor := range cs.getPoolCPUFloors() {
+		entries, ok := advisorResp.PoolEntries[poolName]
+		if !ok || len(entries) == 0 {
+			continue
+		}
+
+		unit := cs.poolSizeUnits[poolName]
+		floorSize, err := ConvertCPUValue(float64(floor), CPUUnitCores, unit)
+		if err != nil {
+			klog.Errorf("[qosaware-server-cpu] convert cpu floor of pool %s failed: %v", poolName, err)
+			continue
+		}
+
+		total, largestNUMAID, found := 0.0, 0, false
+		for numaID, cpuResource := range entries {
+			total += float64(cpuResource.Size)
+			largest := entries[largestNUMAID]
+			if !found || cpuResource.Size > largest.Size || (cpuResource.Size == largest.Size && numaID < largestNUMAID) {
+				largestNUMAID, found = numaID, true
+			}
+		}
+		if poolName == commonstate.PoolNameReclaim {
+			overlapped := 0
+			for _, overlapInfo := range advisorResp.PoolOverlapInfo[commonstate.PoolNameReclaim] {
+				for _, size := range overlapInfo {
+					overlapped += size
+				}
+			}
+			// overlapped sizes are always in cores
+			overlappedSize, err := ConvertCPUValue(float64(overlapped), CPUUnitCores, unit)
+			if err != nil {
+				klog.Errorf("[qosaware-server-cpu] convert overlapped size of pool %s failed: %v", poolName, err)
+				continue
+			}
+			total += overlappedSize
+		}
+
+		deficit := int(math.Ceil(floorSize - total))
+		if deficit <= 0 {
+			continue
+		}
+
+		clamped := make(map[int]types.CPUResource, len(entries))
+		for numaID, cpuResource := range entries {
+			clamped[numaID] = cpuResource
+		}
+		cpuResource := clamped[largestNUMAID]
+		cpuResource.Size += deficit
+		clamped[largestNUMAID] = cpuResource
+		clampedPoolEntries[poolName] = clamped
+
+		klog.Warningf("[qosaware-server-cpu] pool %s is sized %v below the cpu floor %d of its containers, clamp it up by %d on numa %d",
+			poolName, total, floor, deficit, largestNUMAID)
+		_ = cs.emitter.StoreInt64(cs.genMetricsName(metricCPUServerContainerCPUFloorApplied), int64(deficit), metrics.MetricTypeNameRaw,
+			metrics.MetricTag{Key: "pool", Val: poolName})
+	}
+
+	if len(clampedPoolEntries) == 0 {
+		return advisorResp
+	}
+
+	clamped := *advisorResp
+	clamped.PoolEntries = make(map[string]map[int]types.CPUResource, len(advisorResp.PoolEntries))
+	for poolName, entries := range advisorResp.PoolEntries {
+		clamped.PoolEntries[poolName] = entries
+	}
+	for poolName, entries := range clampedPoolEntries {
+		clamped.PoolEntries[poolName] = entries
+	}
+	return &clamped
+}
+
+// getPoolCPUFloors returns the cpu floor in cores of each pool, i.e. the largest floor among containers placed in
+// it; floors are keyed by pool name, or pod uid for dedicated numa binding pods
+func (cs *cpuServer) getPoolCPUFloors() map[string]int {
+	poolFloors := make(map[string]int)
+	if len(cs.containerMinCPUFloors) == 0 {
+		return poolFloors
+	}
+
+	cs.metaCache.RangeContainer(func(podUID string, containerName string, ci *types.ContainerInfo) bool {
+		floor := cs.containerMinCPUFloors[ci.QoSLevel]
+		if floor <= 0 {
+			return true
+		}
+
+		poolName := podUID
+		if !ci.IsDedicatedNumaBinding() {
+			poolName, _ = resolveOwnerPool(ci)
+		}
+		if floor > poolFloors[poolName] {
+			poolFloors[poolName] = floor
+		}
+		return true
+	})
+	return poolFloors
+}
+
+// applyReclaimPoolFloor returns the advisor result with reclaim pool on each numa raised up to the configured floor,
+// so that reclaimed workloads are kept minimally alive during shared pool spikes; the deficit is borrowed from shared
+// pools on the same numa with lower overlap priority first, and overlapped cpus are counted for reclaim pool. A shared
+// pool never lends the cpus needed by the cpu floor of its containers, nor those already overlapped with reclaim pool
+// on the numa. The computed size is kept if shared pools can't afford the deficit, since the numa is fully committed then. The
+// original advisor result is never modified since it may be referred to by the advisor.
+func (cs *cpuServer) applyReclaimPoolFloor(advisorResp *types.InternalCPUCalculationResult) *types.InternalCPUCalculationResult {
+	if cs.reclaimPoolMinCoresPerNUMA <= 0 && cs.reclaimPoolMinRatioPerNUMA <= 0 {
+		return advisorResp
+	}
+	reclaimEntries, ok := advisorResp.PoolEntries[commonstate.PoolNameReclaim]
+	if !ok || len(reclaimEntries) == 0 {
+		return advisorResp
+	}
+
+	// shared pools are the candidates to borrow from, and dedicated pods keyed by pod uid are excluded
+	sharedPoolNames := make([]string, 0, len(advisorResp.PoolEntries))
+	for poolName := range advisorResp.PoolEntries {
+		if commonstate.GetPoolType(poolName) != commonstate.PoolNameShare {
+			continue
+		}
+		if _, isPod := cs.metaCache.GetContainerEntries(poolName); isPod {
+			continue
+		}
+		sharedPoolNames = append(sharedPoolNames, poolName)
+	}
+	sharedPoolNames = cs.sortByOverlapPriority(sharedPoolNames)
+
+	// spare cores of each shared pool above the cpu floor of its containers, counted across all numas
+	poolFloors := cs.getPoolCPUFloors()
+	spareCores := make(map[string]float64, len(sharedPoolNames))
+	for _, poolName := range sharedPoolNames {
+		total := 0
+		for _, cpuResource := range advisorResp.PoolEntries[poolName] {
+			total += cpuResource.Size
+		}
+		totalCores, err := ConvertCPUValue(float64(total), cs.poolSizeUnits[poolName], CPUUnitCores)
+		if err != nil {
+			klog.Errorf("[qosaware-server-cpu] convert size of pool %s failed: %v", poolName, err)
+			continue
+		}
+		spareCores[poolName] = totalCores - float64(poolFloors[poolName])
+	}
+
+	adjustedPoolEntries := make(map[string]map[int]types.CPUResource)
+	getEntries := func(poolName string) map[int]types.CPUResource {
+		if entries, ok := adjustedPoolEntries[poolName]; ok {
+			return entries
+		}
+		entries := make(map[int]types.CPUResource, len(advisorResp.PoolEntries[poolName]))
+		for numaID, cpuResource := range advisorResp.PoolEntries[poolName] {
+			entries[numaID] = cpuResource
+		}
+		adjustedPoolEntries[poolName] = entries
+		return entries
+	}
+
+	reclaimUnit := cs.poolSizeUnits[commonstate.PoolNameReclaim]
+	for _, numaID := range sortedNUMAIDs(reclaimEntries) {
+		// the floor is enforced per numa, so reclaim pool without a specific numa is left as is
+		if numaID == commonstate.FakedNUMAID {
+			continue
+		}
+
+		numaCPUs := cs.metaServer.CPUDetails.CPUsInNUMANodes(numaID).Size()
+		floor := cs.reclaimPoolMinCoresPerNUMA
+		if ratioFloor := int(math.Ceil(cs.reclaimPoolMinRatioPerNUMA * float64(numaCPUs))); ratioFloor > floor {
+			floor = ratioFloor
+		}
+		if floor <= 0 {
+			continue
+		}
+
+		reclaimCores, err := ConvertCPUValue(float64(reclaimEntries[numaID].Size), reclaimUnit, CPUUnitCores)
+		if err != nil {
+			klog.Errorf("[qosaware-server-cpu] convert size of pool %s failed: %v", commonstate.PoolNameReclaim, err)
+			continue
+		}
+		// overlapped sizes are always in cores
+		for _, size := range advisorResp.GetPoolOverlapInfo(commonstate.PoolNameReclaim, numaID) {
+			reclaimCores += float64(size)
+		}
+		deficit := int(math.Ceil(float64(floor) - reclaimCores))
+		if deficit <= 0 {
+			continue
+		}
+
+		// plan borrowed cores of each shared pool first, and borrow nothing if the deficit can't be covered
+		borrowed := make(map[string]int)
+		remaining := deficit
+		for _, poolName := range sharedPoolNames {
+			if remaining <= 0 {
+				break
+			}
+			cpuResource, ok := advisorResp.PoolEntries[poolName][numaID]
+			if !ok {
+				continue
+			}
+			poolCores, err := ConvertCPUValue(float64(cpuResource.Size), cs.poolSizeUnits[poolName], CPUUnitCores)
+			if err != nil {
+				klog.Errorf("[qosaware-server-cpu] convert size of pool %s failed: %v", poolName, err)
+				continue
+			}
+			// overlapped sizes are always in cores
+			overlapped := advisorResp.GetPoolOverlapInfo(commonstate.PoolNameReclaim, numaID)[poolName]
+			available := math.Min(poolCores-float64(overlapped), spareCores[poolName])
+			if n := general.Min(int(math.Floor(available)), remaining); n > 0 {
+				borrowed[poolName] = n
+				remaining -= n
+			}
+		}
+		if remaining > 0 {
+			klog.Warningf("[qosaware-server-cpu] reclaim pool is sized %v below the floor %d on numa %d, "+
+				"but shared pools can only afford %d of the deficit %d, keep the computed size", reclaimCores, floor, numaID, deficit-remaining, deficit)
+			_ = cs.emitter.StoreInt64(cs.genMetricsName(metricCPUServerReclaimFloorUnsatisfied), int64(remaining), metrics.MetricTypeNameRaw,
+				metrics.MetricTag{Key: "numa", Val: strconv.Itoa(numaID)})
+			continue
+		}
+
+		for _, poolName := range sharedPoolNames {
+			n, ok := borrowed[poolName]
+			if !ok {
+				continue
+			}
+			unit := cs.poolSizeUnits[poolName]
+			borrowedSize, err := ConvertCPUValue(float64(n), CPUUnitCores, unit)
+			if err != nil {
+				klog.Errorf("[qosaware-server-cpu] convert borrowed size of pool %s failed: %v", poolName, err)
+				continue
+			}
+			reclaimSize, err := ConvertCPUValue(float64(n), CPUUnitCores, reclaimUnit)
+			if err != nil {
+				klog.Errorf("[qosaware-server-cpu] convert borrowed size of pool %s failed: %v", commonstate.PoolNameReclaim, err)
+				continue
+			}
+
+			spareCores[poolName] -= float64(n)
+			entries := getEntries(poolName)
+			cpuResource := entries[numaID]
+			cpuResource.Size -= int(borrowedSize)
+			entries[numaID] = cpuResource
+			entries = getEntries(commonstate.PoolNameReclaim)
+			cpuResource = entries[numaID]
+			cpuResource.Size += int(reclaimSize)
+			entries[numaID] = cpuResource
+
+			klog.Infof("[qosaware-server-cpu] reclaim pool is below the floor %d on numa %d, borrow %d cores from pool %s",
+				floor, numaID, n, poolName)
+			_ = cs.emitter.StoreInt64(cs.genMetricsName(metricCPUServerReclaimFloorBorrowed), int64(n), metrics.MetricTypeNameRaw,
+				metrics.MetricTag{Key: "pool", Val: poolName}, metrics.MetricTag{Key: "numa", Val: strconv.Itoa(numaID)})
+		}
+	}
+
+	if len(adjustedPoolEntries) == 0 {
+		return advisorResp
+	}
+
+	adjusted := *advisorResp
+	adjusted.PoolEntries = make(map[string]map[int]types.CPUResource, len(advisorResp.PoolEntries))
+	for poolName, entries := range advisorResp.PoolEntries {
+		adjusted.PoolEntries[poolName] = entries
+	}
+	for poolName, entries := range adjustedPoolEntries {
+		adjusted.PoolEntries[poolName] = entries
+	}
+	return &adjusted
+}
+
+// podCountBucket returns the bucket of the given pod count, e.g. 0-50, 50-200 and 200+
+func podCountBucket(count int) string {
+	lower := 0
+	for _, upper := range podCountBucketBounds {
+		if count < upper {
+			return fmt.Sprintf("%d-%d", lower, upper)
+		}
+		lower = upper
+	}
+	return fmt.Sprintf("%d+", lower)
+}
+
+// emitBlockSetStat emits the size of the overlap graph of assembled blocks, tagged by the numa count,
+// to detect pathological growth of blocks caused by reclaim overlap on nodes with many numa nodes
+func (cs *cpuServer) emitBlockSetStat(bs blockSet) {
+	stat := bs.stat()
+	numaCountTag := metrics.MetricTag{Key: "numa_count", Val: strconv.Itoa(cs.metaServer.NumNUMANodes)}
+	_ = cs.emitter.StoreInt64(cs.genMetricsName(metricCPUServerBlockSetBlocks), int64(stat.blocks), metrics.MetricTypeNameRaw, numaCountTag)
+	_ = cs.emitter.StoreInt64(cs.genMetricsName(metricCPUServerBlockSetOverlapJoins), int64(stat.overlapJoins), metrics.MetricTypeNameCount, numaCountTag)
+	_ = cs.emitter.StoreInt64(cs.genMetricsName(metricCPUServerBlockSetMaxOverlapFanOut), int64(stat.maxOverlapFanOut), metrics.MetricTypeNameRaw, numaCountTag)
+}
+
+// getPoolNUMABlockCounts returns the number of blocks each pool contributes on each numa, keyed by numa id and pool name
+func getPoolNUMABlockCounts(calculationEntriesMap map[string]*cpuadvisor.CalculationEntries) map[int64]map[string]int {
+	counts := make(map[int64]map[string]int)
+	for poolName, entries := range calculationEntriesMap {
+		poolInfo, ok := entries.Entries[commonstate.FakedContainerName]
+		if !ok {
+			continue
+		}
+
+		for numaID, numaCalculationResult := range poolInfo.CalculationResultsByNumas {
+			if counts[numaID] == nil {
+				counts[numaID] = make(map[string]int)
+			}
+			counts[numaID][poolName] = len(numaCalculationResult.Blocks)
+		}
+	}
+	return counts
+}
+
+// emitPoolNUMABlockCounts emits the number of blocks each pool contributes on each numa after assembly,
+// since many blocks of a pool on the same numa indicate fragmentation that complicates cpuset selection of the plugin
+func (cs *cpuServer) emitPoolNUMABlockCounts(calculationEntriesMap map[string]*cpuadvisor.CalculationEntries) {
+	for numaID, poolCounts := range getPoolNUMABlockCounts(calculationEntriesMap) {
+		for poolName, count := range poolCounts {
+			_ = cs.emitter.StoreInt64(cs.genMetricsName(metricCPUServerPoolNUMABlocks), int64(count), metrics.MetricTypeNameRaw,
+				metrics.MetricTag{Key: "numa", Val: strconv.FormatInt(numaID, 10)}, metrics.MetricTag{Key: "pool", Val: poolName})
+		}
+	}
+}
+
+// emitStageDuration emits the cost of a stage in the push cycle in milliseconds, so that the latency of a slow
+// cycle can be attributed to advisor update, assembly or sending; it is emitted for failed stages as well
+func (cs *cpuServer) emitStageDuration(stage string, cost time.Duration) {
+	_ = cs.emitter.StoreInt64(cs.genMetricsName(metricCPUServerStageDuration), cost.Milliseconds(), metrics.MetricTypeNameRaw,
+		metrics.MetricTag{Key: "server", Val: cpuServerName},
+		metrics.MetricTag{Key: "stage", Val: stage})
+}
+
+// emitAdviceLatency emits the cost of assembling advice, tagged by the bucket of assembled container count,
+// to reveal how assembly cost scales with workload density
+func (cs *cpuServer) emitAdviceLatency(calculationEntriesMap map[string]*cpuadvisor.CalculationEntries, cost time.Duration) {
+	containerCount := 0
+	for _, entries := range calculationEntriesMap {
+		if _, ok := entries.Entries[commonstate.FakedContainerName]; ok {
+			continue
+		}
+		containerCount += len(entries.Entries)
+	}
+
+	_ = cs.emitter.StoreInt64(cs.genMetricsName(metricCPUServerAdviceLatency), cost.Milliseconds(), metrics.MetricTypeNameRaw,
+		metrics.MetricTag{Key: "pod_count_bucket", Val: podCountBucket(containerCount)})
+}
+
+// recordContainerUpdateTime records the time when container info is updated by the qrm plugin
+func (cs *cpuServer) recordContainerUpdateTime(podUID, containerName string) {
+	if cs.containerInfoMaxAge <= 0 {
+		return
+	}
+
+	cs.containerUpdateTimeMutex.Lock()
+	defer cs.containerUpdateTimeMutex.Unlock()
+	cs.containerUpdateTime[ContainerMeta{PodUID: podUID, ContainerName: containerName}] = time.Now()
+}
+
+// getStaleContainers returns containers whose info has not been updated within containerInfoMaxAge,
+// and it also cleans up update time records of containers which no longer exist in meta cache
+func (cs *cpuServer) getStaleContainers() containerMetaSet {
+	staleContainers := make(containerMetaSet)
+	if cs.containerInfoMaxAge <= 0 {
+		return staleContainers
+	}
+
+	cs.containerUpdateTimeMutex.Lock()
+	defer cs.containerUpdateTimeMutex.Unlock()
+
+	now := time.Now()
+	livingContainers := make(containerMetaSet)
+	cs.metaCache.RangeContainer(func(podUID string, containerName string, ci *types.ContainerInfo) bool {
+		meta := ContainerMeta{PodUID: podUID, ContainerName: containerName}
+		livingContainers.Insert(meta)
+
+		updateTime, ok := cs.containerUpdateTime[meta]
+		if !ok || now.Sub(updateTime) > cs.containerInfoMaxAge {
+			klog.Warningf("[qosaware-server-cpu] container %s/%s info is stale (last update time: %v), skip assembling it",
+				podUID, containerName, updateTime)
+			staleContainers.Insert(meta)
+		}
+		return true
+	})
+
+	for meta := range cs.containerUpdateTime {
+		if !livingContainers.Has(meta) {
+			delete(cs.containerUpdateTime, meta)
+		}
+	}
+
+	_ = cs.emitter.StoreInt64(cs.genMetricsName(metricCPUServerStaleContainerCount), int64(len(staleContainers)), metrics.MetricTypeNameRaw)
+	return staleContainers
+}
+
+// getUnsettledContainers returns containers first seen within containerSettleDelay, which are not assembled
+// so that the qrm plugin keeps them in pool defaults until they settle; it also records first seen time of
+// new containers and cleans up records of containers which no longer exist in meta cache
+func (cs *cpuServer) getUnsettledContainers() containerMetaSet {
+	unsettledContainers := make(containerMetaSet)
+	if cs.containerSettleDelay <= 0 {
+		return unsettledContainers
+	}
+
+	cs.containerFirstSeenTimeMutex.Lock()
+	defer cs.containerFirstSeenTimeMutex.Unlock()
+
+	now := cs.clock.Now()
+	livingContainers := make(containerMetaSet)
+	cs.metaCache.RangeContainer(func(podUID string, containerName string, ci *types.ContainerInfo) bool {
+		meta := ContainerMeta{PodUID: podUID, ContainerName: containerName}
+		livingContainers.Insert(meta)
+
+		firstSeenTime, ok := cs.containerFirstSeenTime[meta]
+		if !ok {
+			firstSeenTime = now
+			cs.containerFirstSeenTime[meta] = now
+		}
+		if now.Sub(firstSeenTime) < cs.containerSettleDelay {
+			klog.Infof("[qosaware-server-cpu] container %s/%s is not settled (first seen time: %v), skip assembling it",
+				podUID, containerName, firstSeenTime)
+			unsettledContainers.Insert(meta)
+		}
+		return true
+	})
+
+	for meta := range cs.containerFirstSeenTime {
+		if !livingContainers.Has(meta) {
+			delete(cs.containerFirstSeenTime, meta)
+		}
+	}
+
+	_ = cs.emitter.StoreInt64(cs.genMetricsName(metricCPUServerUnsettledContainerCount), int64(len(unsettledContainers)), metrics.MetricTypeNameRaw)
+	return unsettledContainers
+}
+
+// getUnmanagedContainers returns containers whose qos levels are not managed, which are left out of assembly
+// so that the qrm plugin stops managing them; each of them is logged once until its qos level is managed again
+// or it no longer exists in meta cache
+func (cs *cpuServer) getUnmanagedContainers() containerMetaSet {
+	unmanagedContainers := make(containerMetaSet)
+	if cs.managedQoSLevels.Len() == 0 {
+		return unmanagedContainers
+	}
+
+	cs.unmanagedContainersMutex.Lock()
+	defer cs.unmanagedContainersMutex.Unlock()
+
+	cs.metaCache.RangeContainer(func(podUID string, containerName string, ci *types.ContainerInfo) bool {
+		if cs.managedQoSLevels.Has(ci.QoSLevel) {
+			return true
+		}
+
+		meta := ContainerMeta{PodUID: podUID, ContainerName: containerName}
+		if !cs.unmanagedContainers.Has(meta) {
+			klog.Infof("[qosaware-server-cpu] qos level %s of container %s/%s is not managed, skip assembling it",
+				ci.QoSLevel, podUID, containerName)
+		}
+		unmanagedContainers.Insert(meta)
+		return true
+	})
+	cs.unmanagedContainers = unmanagedContainers
+
+	_ = cs.emitter.StoreInt64(cs.genMetricsName(metricCPUServerUnmanagedContainerCount), int64(len(unmanagedContainers)), metrics.MetricTypeNameRaw)
+	return unmanagedContainers
+}
+
+// getPodFetchFailedContainers returns containers whose pod failed to be fetched in the latest sync
+func (cs *cpuServer) getPodFetchFailedContainers() containerMetaSet {
+	podFetchFailedContainers := make(containerMetaSet)
+	if !cs.skipPodFetchFailedContainers {
+		return podFetchFailedContainers
+	}
+
+	cs.podFetchFailedMutex.RLock()
+	defer cs.podFetchFailedMutex.RUnlock()
+
+	cs.metaCache.RangeContainer(func(podUID string, containerName string, _ *types.ContainerInfo) bool {
+		if cs.podFetchFailed.Has(podUID) {
+			klog.Warningf("[qosaware-server-cpu] pod %s failed to be fetched in the latest sync, skip assembling container %s",
+				podUID, containerName)
+			podFetchFailedContainers.Insert(ContainerMeta{PodUID: podUID, ContainerName: containerName})
+		}
+		return true
+	})
+
+	_ = cs.emitter.StoreInt64(cs.genMetricsName(metricCPUServerPodFetchFailedContainers), int64(len(podFetchFailedContainers)), metrics.MetricTypeNameRaw)
+	return podFetchFailedContainers
+}
+
+// emitAggregateMetrics emits metrics aggregated over the whole assembled state, which are expensive to compute;
+// they are emitted at most once per aggregateMetricsInterval rather than in every push.
+func (cs *cpuServer) emitAggregateMetrics(advisorResp *types.InternalCPUCalculationResult) {
+	cs.aggregateMetricsMutex.Lock()
+	now := cs.clock.Now()
+	if !cs.lastAggregateMetricsTime.IsZero() && now.Sub(cs.lastAggregateMetricsTime) < cs.aggregateMetricsInterval {
+		cs.aggregateMetricsMutex.Unlock()
+		return
+	}
+	cs.lastAggregateMetricsTime = now
+	cs.aggregateMetricsMutex.Unlock()
+
+	cs.emitOverlapMetrics(advisorResp)
+	cs.checkPoolHeadroomConsistency(advisorResp)
+	cs.checkNUMAHeadroomAgainstDedicated()
+	cs.emitPoolNUMADistributionDrift(advisorResp)
+}
+
+// emitOverlapMetrics emits whether shared cores overlapping reclaimed cores is active,
+// and the number of numa nodes where reclaim pool overlaps with shared pools
+func (cs *cpuServer) emitOverlapMetrics(advisorResp *types.InternalCPUCalculationResult) {
+	overlapActive := int64(0)
+	if advisorResp.AllowSharedCoresOverlapReclaimedCores {
+		overlapActive = 1
+	}
+
+	overlapNUMACount := int64(0)
+	for _, overlapInfo := range advisorResp.PoolOverlapInfo[commonstate.PoolNameReclaim] {
+		if len(overlapInfo) > 0 {
+			overlapNUMACount++
+		}
+	}
+
+	_ = cs.emitter.StoreInt64(cs.genMetricsName(metricCPUServerOverlapActive), overlapActive, metrics.MetricTypeNameRaw)
+	_ = cs.emitter.StoreInt64(cs.genMetricsName(metricCPUServerOverlapActiveNUMACount), overlapNUMACount, metrics.MetricTypeNameRaw)
+}
+
+// checkPoolHeadroomConsistency emits the sum of pool sizes and headroom per numa, and flags the numa if the sum
+// diverges from its cpu count beyond the threshold; sizes of pools not bound to any numa are distributed among
+// numa nodes in proportion to their cpu counts.
+func (cs *cpuServer) checkPoolHeadroomConsistency(advisorResp *types.InternalCPUCalculationResult) {
+	if cs.poolHeadroomDivergenceThreshold <= 0 {
+		return
+	}
+
+	numaAllocatable, err := cs.headroomResourceManager.GetNumaAllocatable()
+	if err != nil {
+		klog.Errorf("[qosaware-server-cpu] get numa allocatable failed: %v", err)
+		return
+	}
+
+	totalCPUs := cs.metaServer.CPUDetails.CPUs().Size()
+	if totalCPUs == 0 {
+		return
+	}
+
+	for numaID := 0; numaID < cs.metaServer.NumNUMANodes; numaID++ {
+		numaCPUs := cs.metaServer.CPUDetails.CPUsInNUMANodes(numaID).Size()
+		if numaCPUs == 0 {
+			continue
+		}
+
+		total := 0.0
+		for _, entries := range advisorResp.PoolEntries {
+			if cpuResource, ok := entries[numaID]; ok {
+				total += float64(cpuResource.Size)
+			}
+			if cpuResource, ok := entries[commonstate.FakedNUMAID]; ok {
+				total += float64(cpuResource.Size) * float64(numaCPUs) / float64(totalCPUs)
+			}
+		}
+		if headroom, ok := numaAllocatable[numaID]; ok {
+			total += float64(headroom.Value()) / 1000.0
+		}
+
+		diverged := int64(0)
+		if math.Abs(total-float64(numaCPUs))/float64(numaCPUs) > cs.poolHeadroomDivergenceThreshold {
+			klog.Warningf("[qosaware-server-cpu] sum of pool sizes and headroom %.2f diverges from cpu count %d on numa %d",
+				total, numaCPUs, numaID)
+			diverged = 1
+		}
+
+		numaTag := metrics.MetricTag{Key: "numa", Val: strconv.Itoa(numaID)}
+		_ = cs.emitter.StoreInt64(cs.genMetricsName(metricCPUServerPoolHeadroomTotal), int64(total*1000), metrics.MetricTypeNameRaw, numaTag)
+		_ = cs.emitter.StoreInt64(cs.genMetricsName(metricCPUServerPoolHeadroomDiverged), diverged, metrics.MetricTypeNameRaw, numaTag)
+	}
+}
+
+// checkNUMAHeadroomAgainstDedicated flags the numa if its headroom plus cpus bound by dedicated containers
+// exceeds its cpu count, since such cpus can never be reclaimed
+func (cs *cpuServer) checkNUMAHeadroomAgainstDedicated() {
+	if !cs.validateNUMAHeadroomAgainstDedicated {
+		return
+	}
+
+	numaAllocatable, err := cs.headroomResourceManager.GetNumaAllocatable()
+	if err != nil {
+		klog.Errorf("[qosaware-server-cpu] get numa allocatable failed: %v", err)
+		return
+	}
+
+	// containers of the same pod may share cpus, so bound cpus are merged rather than summed
+	boundCPUs := make(map[int]machine.CPUSet)
+	cs.metaCache.RangeContainer(func(podUID string, containerName string, ci *types.ContainerInfo) bool {
+		if ci.QoSLevel != consts.PodAnnotationQoSLevelDedicatedCores {
+			return true
+		}
+		for numaID, cpuset := range ci.TopologyAwareAssignments {
+			boundCPUs[numaID] = boundCPUs[numaID].Union(cpuset)
+		}
+		return true
+	})
+
+	for numaID := 0; numaID < cs.metaServer.NumNUMANodes; numaID++ {
+		numaCPUs := cs.metaServer.CPUDetails.CPUsInNUMANodes(numaID).Size()
+		if numaCPUs == 0 {
+			continue
+		}
+
+		// values of numa allocatable are in milli cores
+		total := float64(boundCPUs[numaID].Size())
+		if headroom, ok := numaAllocatable[numaID]; ok {
+			total += float64(headroom.Value()) / 1000.0
+		}
+
+		overcommitted := int64(0)
+		if total > float64(numaCPUs) {
+			klog.Warningf("[qosaware-server-cpu] headroom plus %d cpus bound by dedicated containers %.2f exceeds cpu count %d on numa %d",
+				boundCPUs[numaID].Size(), total, numaCPUs, numaID)
+			overcommitted = 1
+		}
+		_ = cs.emitter.StoreInt64(cs.genMetricsName(metricCPUServerNUMAHeadroomOvercommitted), overcommitted, metrics.MetricTypeNameRaw,
+			metrics.MetricTag{Key: "numa", Val: strconv.Itoa(numaID)})
+	}
+}
+
+// emitPoolNUMADistributionDrift emits the number of cpus that differ between the numa distribution of each pool
+// desired by advisor and the one currently enacted from checkpoint; pools without numa distribution desired
+// (i.e. assigned by FakedNUMAID) or not synced yet are skipped
+func (cs *cpuServer) emitPoolNUMADistributionDrift(advisorResp *types.InternalCPUCalculationResult) {
+	for poolName, entries := range advisorResp.PoolEntries {
+		if _, ok := entries[commonstate.FakedNUMAID]; ok {
+			continue
+		}
+		poolInfo, ok := cs.metaCache.GetPoolInfo(poolName)
+		if !ok {
+			continue
+		}
+
+		numaIDs := sets.NewInt()
+		for numaID := range entries {
+			numaIDs.Insert(numaID)
+		}
+		for numaID := range poolInfo.TopologyAwareAssignments {
+			numaIDs.Insert(numaID)
+		}
 
-	if !cs.shouldTriggerAdvisorUpdate() {
-		return nil
+		drift := 0
+		for _, numaID := range numaIDs.UnsortedList() {
+			current := poolInfo.TopologyAwareAssignments[numaID].Size()
+			if diff := entries[numaID].Size - current; diff > 0 {
+				drift += diff
+			} else {
+				drift -= diff
+			}
+		}
+		if drift > 0 {
+			klog.V(4).Infof("[qosaware-server-cpu] numa distribution of pool %s drifts by %d cpus, desired: %+v, current: %v",
+				poolName, drift, entries, poolInfo.TopologyAwareAssignments)
+		}
+		_ = cs.emitter.StoreInt64(cs.genMetricsName(metricCPUServerPoolNUMADistributionDrift), int64(drift), metrics.MetricTypeNameRaw,
+			metrics.MetricTag{Key: "pool", Val: poolName})
 	}
+}
 
-	// old asynchronous communication interface does not support feature gate negotiation. If necessary, upgrade to the synchronization interface.
-	emptyMap := map[string]*advisorsvc.FeatureGate{}
-	result, err := cs.updateAdvisor(emptyMap)
-	if err != nil {
-		return err
-	}
-	lwResp := &cpuadvisor.ListAndWatchResponse{
-		Entries:                               result.Entries,
-		AllowSharedCoresOverlapReclaimedCores: result.AllowSharedCoresOverlapReclaimedCores,
-		ExtraEntries:                          result.ExtraEntries,
-	}
-	if err := server.Send(lwResp); err != nil {
-		_ = cs.emitter.StoreInt64(cs.genMetricsName(metricServerLWSendResponseFailed), int64(cs.period.Seconds()), metrics.MetricTypeNameCount)
-		return fmt.Errorf("send listWatch response failed: %w", err)
+// emitPoolStabilityScores records pool sizes by numa of this cycle, and emits the stability score of each pool
+// in percentage over the latest poolStabilityWindow cycles; a low score flags a thrashing pool.
+func (cs *cpuServer) emitPoolStabilityScores(advisorResp *types.InternalCPUCalculationResult) {
+	if cs.poolStabilityWindow <= 0 {
+		return
 	}
 
-	if klog.V(6).Enabled() {
-		klog.Infof("[qosaware-server-cpu] sent listWatch resp: %v", general.ToString(lwResp))
+	poolSizes := make(map[string]map[int]int, len(advisorResp.PoolEntries))
+	for poolName, entries := range advisorResp.PoolEntries {
+		poolSizes[poolName] = make(map[int]int, len(entries))
+		for numaID, cpu := range entries {
+			poolSizes[poolName][numaID] = cpu.Size
+		}
 	}
 
-	_ = cs.emitter.StoreInt64(cs.genMetricsName(metricServerLWSendResponseSucceeded), int64(cs.period.Seconds()), metrics.MetricTypeNameCount)
-	return nil
-}
+	cs.poolSizeHistoryMutex.Lock()
+	defer cs.poolSizeHistoryMutex.Unlock()
 
-func (cs *cpuServer) updateAdvisor(featureGates map[string]*advisorsvc.FeatureGate) (*cpuInternalResult, error) {
-	// update feature gates in meta cache
-	err := cs.metaCache.SetSupportedWantedFeatureGates(featureGates)
-	if err != nil {
-		_ = cs.emitter.StoreInt64(cs.genMetricsName(metricServerAdvisorUpdateFailed), int64(cs.period.Seconds()), metrics.MetricTypeNameCount)
-		return nil, fmt.Errorf("set feature gates failed: %w", err)
+	cs.poolSizeHistory = append(cs.poolSizeHistory, poolSizes)
+	if len(cs.poolSizeHistory) > cs.poolStabilityWindow {
+		cs.poolSizeHistory = cs.poolSizeHistory[len(cs.poolSizeHistory)-cs.poolStabilityWindow:]
 	}
 
-	// trigger advisor update and get latest advice
-	advisorRespRaw, err := cs.resourceAdvisor.UpdateAndGetAdvice()
-	if err != nil {
-		_ = cs.emitter.StoreInt64(cs.genMetricsName(metricServerAdvisorUpdateFailed), int64(cs.period.Seconds()), metrics.MetricTypeNameCount)
-		return nil, fmt.Errorf("get advice failed: %w", err)
+	for poolName := range poolSizes {
+		score, ok := poolStabilityScore(cs.poolSizeHistory, poolName)
+		if !ok {
+			continue
+		}
+		_ = cs.emitter.StoreInt64(cs.genMetricsName(metricCPUServerPoolStabilityScore), int64(math.Round(score*100)), metrics.MetricTypeNameRaw,
+			metrics.MetricTag{Key: "pool", Val: poolName})
 	}
-	advisorResp, ok := advisorRespRaw.(*types.InternalCPUCalculationResult)
-	if !ok {
-		_ = cs.emitter.StoreInt64(cs.genMetricsName(metricServerAdvisorUpdateFailed), int64(cs.period.Seconds()), metrics.MetricTypeNameCount)
-		return nil, fmt.Errorf("get advice failed: invalid type: %T", advisorRespRaw)
+}
+
+// poolStabilityScore returns one minus the average change ratio of the pool between consecutive cycles in history,
+// where the change ratio is the number of cpus changed across numa nodes relative to the larger pool size, capped
+// at one; a pool absent in a cycle is regarded as zero-sized, and false is returned if there is no change to measure.
+func poolStabilityScore(history []map[string]map[int]int, poolName string) (float64, bool) {
+	if len(history) < 2 {
+		return 0, false
 	}
 
-	klog.Infof("[qosaware-server-cpu] get advisor update: %+v", general.ToString(advisorResp))
+	changeRatioSum := 0.0
+	for i := 1; i < len(history); i++ {
+		prev, cur := history[i-1][poolName], history[i][poolName]
 
-	return cs.assembleResponse(advisorResp), nil
-}
+		changed, prevTotal, curTotal := 0, 0, 0
+		for numaID, size := range cur {
+			curTotal += size
+			diff := size - prev[numaID]
+			if diff < 0 {
+				diff = -diff
+			}
+			changed += diff
+		}
+		for numaID, size := range prev {
+			prevTotal += size
+			if _, ok := cur[numaID]; !ok {
+				changed += size
+			}
+		}
 
-type cpuInternalResult struct {
-	Entries                               map[string]*cpuadvisor.CalculationEntries
-	AllowSharedCoresOverlapReclaimedCores bool
-	ExtraEntries                          []*advisorsvc.CalculationInfo
+		if total := general.Max(prevTotal, curTotal); total > 0 {
+			changeRatioSum += math.Min(1, float64(changed)/float64(total))
+		}
+	}
+	return 1 - changeRatioSum/float64(len(history)-1), true
 }
 
-func (cs *cpuServer) assembleResponse(advisorResp *types.InternalCPUCalculationResult) *cpuInternalResult {
-	startTime := time.Now()
-	defer func() {
-		general.InfoS("finished", "duration", time.Since(startTime))
-	}()
-	calculationEntriesMap := make(map[string]*cpuadvisor.CalculationEntries)
-	blockID2Blocks := NewBlockSet()
-
-	// first assemble NUMABinding pod entries
-	f := func(podUID string, containerName string, ci *types.ContainerInfo) bool {
-		if err := cs.assembleDedicatedNUMABindingPodEntries(advisorResp, calculationEntriesMap, blockID2Blocks, podUID, ci); err != nil {
-			klog.Errorf("[qosaware-server-cpu] assembleDedicatedNUMABindingPodEntries for pod %s/%s uid %s err: %v", ci.PodNamespace, ci.PodName, ci.PodUID, err)
-		}
-		return true
+// filterDeniedControlKnobs removes denied control knob keys from extra entries,
+// and entries left with no values are dropped as well
+func (cs *cpuServer) filterDeniedControlKnobs(extraEntries []*advisorsvc.CalculationInfo) []*advisorsvc.CalculationInfo {
+	if cs.deniedControlKnobKeys.Len() == 0 {
+		return extraEntries
 	}
-	cs.metaCache.RangeContainer(f)
 
-	// second, assemble pool entries
-	cs.assemblePoolEntries(advisorResp, calculationEntriesMap, blockID2Blocks)
+	filtered := make([]*advisorsvc.CalculationInfo, 0, len(extraEntries))
+	for _, entry := range extraEntries {
+		if entry.GetCalculationResult() == nil {
+			filtered = append(filtered, entry)
+			continue
+		}
 
-	// last, assemble normal pod entries
-	f = func(podUID string, containerName string, ci *types.ContainerInfo) bool {
-		if err := cs.assembleNormalPodEntries(calculationEntriesMap, podUID, ci); err != nil {
-			klog.Errorf("[qosaware-server-cpu] assembleNormalPodEntries for pod %s/%s uid %s err: %v", ci.PodNamespace, ci.PodName, ci.PodUID, err)
+		for key := range entry.CalculationResult.Values {
+			if !cs.deniedControlKnobKeys.Has(key) {
+				continue
+			}
+			delete(entry.CalculationResult.Values, key)
+			klog.Infof("[qosaware-server-cpu] suppress control knob %s for cgroup path %q", key, entry.CgroupPath)
+			_ = cs.emitter.StoreInt64(cs.genMetricsName(metricCPUServerControlKnobSuppressed), 1, metrics.MetricTypeNameCount,
+				metrics.MetricTag{Key: "key", Val: key})
 		}
-		return true
-	}
-	cs.metaCache.RangeContainer(f)
 
-	extraEntries := cs.assembleCgroupConfig(advisorResp)
-	extraNumaHeadRoom := cs.assembleHeadroom()
-	if extraNumaHeadRoom != nil {
-		extraEntries = append(extraEntries, extraNumaHeadRoom)
-	}
-	// Send result
-	resp := &cpuInternalResult{
-		Entries:                               calculationEntriesMap,
-		ExtraEntries:                          extraEntries,
-		AllowSharedCoresOverlapReclaimedCores: advisorResp.AllowSharedCoresOverlapReclaimedCores,
+		if len(entry.CalculationResult.Values) > 0 {
+			filtered = append(filtered, entry)
+		}
 	}
-
-	return resp
+	return filtered
 }
 
 // assemble cgroup config
@@ -389,35 +3468,198 @@ func (cs *cpuServer) assembleCgroupConfig(advisorResp *types.InternalCPUCalculat
 }
 
 // assemble per-numa headroom
-func (cs *cpuServer) assembleHeadroom() *advisorsvc.CalculationInfo {
+func (cs *cpuServer) assembleHeadroom(advisorResp *types.InternalCPUCalculationResult) *advisorsvc.CalculationInfo {
 	numaAllocatable, err := cs.headroomResourceManager.GetNumaAllocatable()
 	if err != nil {
 		klog.Errorf("get numa allocatable failed: %v", err)
 		return nil
 	}
+	numaAllocatable = cs.discountOverlappedNUMAHeadroom(cs.reserveNUMAHeadroom(cs.clampNUMAHeadroom(numaAllocatable)), advisorResp)
+	numaTimestamps := cs.getNUMAHeadroomTimestamps()
+	assembleTime := time.Now()
 
-	numaHeadroom := make(cpuadvisor.CPUNUMAHeadroom)
+	// numa keys are formatted as configured, and json object keys are strings anyway
+	numaHeadroom := make(map[string]float64)
+	numaHeadroomQuantity := make(map[string]string)
+	numaHeadroomTimestamp := make(map[string]int64)
+	// node headroom is summed up from the same snapshot as per-numa headroom to avoid skew,
+	// and it is zero if there is no numa allocatable
+	var nodeAllocatable resource.Quantity
 	for numaID, res := range numaAllocatable {
-		numaHeadroom[numaID] = float64(res.Value()) / 1000.0
+		nodeAllocatable.Add(res)
+		numaKey, err := cpuadvisor.FormatNUMAKey(cs.headroomNUMAKeyFormat, numaID)
+		if err != nil {
+			klog.Errorf("format numa key failed: %v", err)
+			return nil
+		}
+		// values of numa allocatable are in milli cores
+		numaHeadroom[numaKey], err = ConvertCPUValue(float64(res.Value()), CPUUnitMilliCores, cs.headroomUnit)
+		if err != nil {
+			klog.Errorf("convert headroom failed: %v", err)
+			return nil
+		}
+		numaHeadroomQuantity[numaKey] = res.String()
+
+		// fall back to assembly time if the time of computing headroom is unknown
+		timestamp, ok := numaTimestamps[numaID]
+		if !ok {
+			timestamp = assembleTime
+		}
+		numaHeadroomTimestamp[numaKey] = timestamp.UnixMilli()
 	}
 	data, err := json.Marshal(numaHeadroom)
 	if err != nil {
 		klog.Errorf("marshal headroom failed: %v", err)
 		return nil
 	}
+	timestampData, err := json.Marshal(numaHeadroomTimestamp)
+	if err != nil {
+		klog.Errorf("marshal headroom timestamp failed: %v", err)
+		return nil
+	}
+	nodeHeadroom, err := ConvertCPUValue(float64(nodeAllocatable.Value()), CPUUnitMilliCores, cs.headroomUnit)
+	if err != nil {
+		klog.Errorf("convert node headroom failed: %v", err)
+		return nil
+	}
 
 	calculationResult := &advisorsvc.CalculationResult{
 		Values: map[string]string{
-			string(cpuadvisor.ControlKnobKeyCPUNUMAHeadroom): string(data),
+			string(cpuadvisor.ControlKnobKeyCPUNUMAHeadroom):          string(data),
+			string(cpuadvisor.ControlKnobKeyCPUNUMAHeadroomTimestamp): string(timestampData),
+			string(cpuadvisor.ControlKnobKeyCPUNodeHeadroom):          strconv.FormatFloat(nodeHeadroom, 'f', -1, 64),
 		},
 	}
 
+	// the float cores is kept for legacy consumers, and the raw quantity is
+	// reported additionally for consumers who need the precise value
+	if cs.reportNUMAHeadroomQuantity {
+		quantityData, err := json.Marshal(numaHeadroomQuantity)
+		if err != nil {
+			klog.Errorf("marshal headroom quantity failed: %v", err)
+			return nil
+		}
+		calculationResult.Values[string(cpuadvisor.ControlKnobKeyCPUNUMAHeadroomQuantity)] = string(quantityData)
+	}
+
 	return &advisorsvc.CalculationInfo{
 		CgroupPath:        "",
 		CalculationResult: calculationResult,
 	}
 }
 
+// getNUMAHeadroomTimestamps returns the time when headroom of each numa is computed if the headroom
+// resource manager supports it, otherwise nil is returned
+func (cs *cpuServer) getNUMAHeadroomTimestamps() map[int]time.Time {
+	getter, ok := cs.headroomResourceManager.(manager.NumaResourceTimestampGetter)
+	if !ok {
+		return nil
+	}
+
+	timestamps, err := getter.GetNumaAllocatableTimestamp()
+	if err != nil {
+		klog.Warningf("[qosaware-server-cpu] get numa allocatable timestamp failed: %v", err)
+		return nil
+	}
+	return timestamps
+}
+
+// clampNUMAHeadroom caps total headroom to maxHeadroomRatio of node cpus to avoid over-aggressive reclaim
+// caused by a buggy estimator; headroom of each numa is scaled down proportionally if the cap is exceeded.
+// notice that values of numa allocatable are in milli cores.
+func (cs *cpuServer) clampNUMAHeadroom(numaAllocatable map[int]resource.Quantity) map[int]resource.Quantity {
+	if cs.maxHeadroomRatio <= 0 {
+		return numaAllocatable
+	}
+
+	var total int64
+	for _, res := range numaAllocatable {
+		total += res.Value()
+	}
+	capacity := int64(cs.maxHeadroomRatio * float64(cs.metaServer.NumCPUs) * 1000)
+	if total <= capacity {
+		return numaAllocatable
+	}
+
+	klog.Warningf("[qosaware-server-cpu] total headroom %.2f exceeds cap %.2f (%.2f of %d cpus), clamp it",
+		float64(total)/1000.0, float64(capacity)/1000.0, cs.maxHeadroomRatio, cs.metaServer.NumCPUs)
+	_ = cs.emitter.StoreInt64(cs.genMetricsName(metricCPUServerHeadroomClamped), total-capacity, metrics.MetricTypeNameRaw)
+
+	clamped := make(map[int]resource.Quantity, len(numaAllocatable))
+	for numaID, res := range numaAllocatable {
+		clamped[numaID] = *resource.NewQuantity(res.Value()*capacity/total, resource.DecimalSI)
+	}
+	return clamped
+}
+
+// reserveNUMAHeadroom holds back a safety margin of each numa from headroom so that reclaimed workloads never
+// consume the very last cores, and the headroom of each numa is clamped at zero; node headroom is summed up from
+// the reserved per-numa headroom, so node-level reservations already excluded from headroom are not double counted
+func (cs *cpuServer) reserveNUMAHeadroom(numaAllocatable map[int]resource.Quantity) map[int]resource.Quantity {
+	if cs.numaHeadroomReservedRatio <= 0 && cs.numaHeadroomReservedMilliCores <= 0 {
+		return numaAllocatable
+	}
+
+	var before, after int64
+	reserved := make(map[int]resource.Quantity, len(numaAllocatable))
+	for numaID, res := range numaAllocatable {
+		// values of numa allocatable are in milli cores
+		value := res.Value()
+		margin := int64(cs.numaHeadroomReservedRatio * float64(value))
+		if cs.numaHeadroomReservedMilliCores > margin {
+			margin = cs.numaHeadroomReservedMilliCores
+		}
+		left := value - margin
+		if left < 0 {
+			left = 0
+		}
+		reserved[numaID] = *resource.NewQuantity(left, resource.DecimalSI)
+		before += value
+		after += left
+	}
+
+	_ = cs.emitter.StoreInt64(cs.genMetricsName(metricCPUServerNUMAHeadroomPreReserve), before, metrics.MetricTypeNameRaw)
+	_ = cs.emitter.StoreInt64(cs.genMetricsName(metricCPUServerNUMAHeadroomPostReserve), after, metrics.MetricTypeNameRaw)
+	return reserved
+}
+
+// discountOverlappedNUMAHeadroom discounts cores of shared pools overlapped by reclaim pool from headroom of each
+// numa, since they are counted as both shared and reclaimed; the headroom of each numa is clamped at zero, and
+// headroom is unchanged if overlap is not allowed, with both raw and adjusted headroom emitted for comparison
+func (cs *cpuServer) discountOverlappedNUMAHeadroom(numaAllocatable map[int]resource.Quantity,
+	advisorResp *types.InternalCPUCalculationResult,
+) map[int]resource.Quantity {
+	if !cs.discountOverlappedHeadroom || advisorResp == nil {
+		return numaAllocatable
+	}
+
+	// overlapped sizes are in cores, and derived from the same overlap info as assembled reclaim blocks
+	overlappedMilliCores := make(map[int]int64)
+	if advisorResp.AllowSharedCoresOverlapReclaimedCores {
+		for numaID, overlapInfo := range advisorResp.PoolOverlapInfo[commonstate.PoolNameReclaim] {
+			for _, size := range overlapInfo {
+				overlappedMilliCores[numaID] += int64(size) * 1000
+			}
+		}
+	}
+
+	adjusted := make(map[int]resource.Quantity, len(numaAllocatable))
+	for numaID, res := range numaAllocatable {
+		// values of numa allocatable are in milli cores
+		value := res.Value()
+		left := value - overlappedMilliCores[numaID]
+		if left < 0 {
+			left = 0
+		}
+		adjusted[numaID] = *resource.NewQuantity(left, resource.DecimalSI)
+
+		numaTag := metrics.MetricTag{Key: "numa", Val: strconv.Itoa(numaID)}
+		_ = cs.emitter.StoreInt64(cs.genMetricsName(metricCPUServerNUMAHeadroomRaw), value, metrics.MetricTypeNameRaw, numaTag)
+		_ = cs.emitter.StoreInt64(cs.genMetricsName(metricCPUServerNUMAHeadroomAdjusted), left, metrics.MetricTypeNameRaw, numaTag)
+	}
+	return adjusted
+}
+
 func (cs *cpuServer) updateMetaCacheInput(ctx context.Context, req *cpuadvisor.GetAdviceRequest) error {
 	startTime := time.Now()
 	// lock meta cache to prevent race with cpu server
@@ -441,6 +3683,7 @@ func (cs *cpuServer) updateMetaCacheInput(ctx context.Context, req *cpuadvisor.G
 			poolInfo.AllocationInfo.OwnerPoolName,
 			poolInfo.AllocationInfo.TopologyAwareAssignments,
 			poolInfo.AllocationInfo.OriginalTopologyAwareAssignments,
+			nil,
 		); err != nil {
 			errs = append(errs, fmt.Errorf("update pool info failed: %w", err))
 		}
@@ -448,20 +3691,23 @@ func (cs *cpuServer) updateMetaCacheInput(ctx context.Context, req *cpuadvisor.G
 
 	general.InfoS("updated pool entries", "duration", time.Since(startTime))
 
-	// update container entries after pool entries
+	// update container entries after pool entries, all of which share the same qos conf snapshot
+	qosLevels := newQoSLevelResolver(cs.snapshotQoSConf())
+	containerCount := 0
 	for entryName, entry := range req.Entries {
 		if _, ok := entry.Entries[commonstate.FakedContainerName]; ok {
 			continue
 		}
+		containerCount += len(entry.Entries)
 		podUID := entryName
-		pod, err := cs.metaServer.GetPod(ctx, podUID)
+		pod, err := cs.getPodWithTimeout(ctx, podUID)
 		if err != nil {
 			errs = append(errs, fmt.Errorf("get pod info for %s failed: %w", podUID, err))
 			continue
 		}
 
 		for containerName, info := range entry.Entries {
-			if err := cs.createOrUpdateContainerInfo(podUID, containerName, pod, info); err != nil {
+			if err := cs.createOrUpdateContainerInfo(qosLevels, podUID, containerName, pod, info); err != nil {
 				errs = append(errs, fmt.Errorf("update container info for %s/%s failed: %w", podUID, containerName, err))
 				_ = cs.emitter.StoreInt64(
 					cs.genMetricsName(metricServerCheckpointUpdateContainerFailed), 1, metrics.MetricTypeNameCount,
@@ -473,6 +3719,13 @@ func (cs *cpuServer) updateMetaCacheInput(ctx context.Context, req *cpuadvisor.G
 	}
 
 	general.InfoS("updated container entries", "duration", time.Since(startTime))
+	cs.emitQoSLevelResolutionCost("updateMetaCacheInput", qosLevels)
+	cs.validatePoolMembership()
+
+	suspect := cs.isCheckpointSuspect(containerCount)
+	if cs.isGCDisabled() || suspect {
+		return errors.NewAggregate(errs)
+	}
 
 	// clean up containers that no longer exist
 	if err := cs.metaCache.RangeAndDeleteContainer(func(containerInfo *types.ContainerInfo) bool {
@@ -492,12 +3745,14 @@ func (cs *cpuServer) updateMetaCacheInput(ctx context.Context, req *cpuadvisor.G
 	general.InfoS("cleaned up container entries", "duration", time.Since(startTime))
 
 	// add all containers' original owner pools to livingPoolNameSet
+	checkpointPoolNameSet := sets.NewString(livingPoolNameSet.UnsortedList()...)
 	cs.metaCache.RangeContainer(func(podUID string, containerName string, containerInfo *types.ContainerInfo) bool {
 		livingPoolNameSet.Insert(containerInfo.OriginOwnerPoolName)
 		return true
 	},
 	)
 
+	cs.reportGCProtectedPools(checkpointPoolNameSet, livingPoolNameSet)
 	if err := cs.metaCache.GCPoolEntries(livingPoolNameSet); err != nil {
 		errs = append(errs, fmt.Errorf("gc pool entries failed: %w", err))
 	}
@@ -506,9 +3761,45 @@ func (cs *cpuServer) updateMetaCacheInput(ctx context.Context, req *cpuadvisor.G
 	return errors.NewAggregate(errs)
 }
 
+// getPodWithTimeout gets the pod from meta server within getPodTimeout, so that a slow lookup of one pod
+// never stalls the whole sync; the lookup is left behind on timeout since meta server may not respect ctx
+func (cs *cpuServer) getPodWithTimeout(ctx context.Context, podUID string) (*v1.Pod, error) {
+	if cs.getPodTimeout <= 0 {
+		return cs.metaServer.GetPod(ctx, podUID)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, cs.getPodTimeout)
+	defer cancel()
+
+	type getPodResult struct {
+		pod *v1.Pod
+		err error
+	}
+	resultCh := make(chan getPodResult, 1)
+	go func() {
+		pod, err := cs.metaServer.GetPod(ctx, podUID)
+		resultCh <- getPodResult{pod: pod, err: err}
+	}()
+
+	select {
+	case result := <-resultCh:
+		return result.pod, result.err
+	case <-ctx.Done():
+		_ = cs.emitter.StoreInt64(cs.genMetricsName(metricCPUServerGetPodTimeout), 1, metrics.MetricTypeNameCount,
+			metrics.MetricTag{Key: "podUID", Val: podUID})
+		return nil, fmt.Errorf("get pod %s timed out after %v: %w", podUID, cs.getPodTimeout, ctx.Err())
+	}
+}
+
 // Deprecated: to be removed after all qrm plugins are migrated to the new synchronous model
 func (cs *cpuServer) syncCheckpoint(ctx context.Context, resp *cpuadvisor.GetCheckpointResponse, safeTime int64) {
+	cs.syncCheckpointEntries(ctx, resp, safeTime, true)
+}
+
+// syncCheckpointEntries syncs the checkpoint into meta cache, and entries absent from it are gc-ed only if allowGC
+func (cs *cpuServer) syncCheckpointEntries(ctx context.Context, resp *cpuadvisor.GetCheckpointResponse, safeTime int64, allowGC bool) {
 	livingPoolNameSet := sets.NewString()
+	updateStats := &checkpointUpdateStats{}
 
 	// parse pool entries first, which are needed for parsing container entries
 	for entryName, entry := range resp.Entries {
@@ -516,83 +3807,401 @@ func (cs *cpuServer) syncCheckpoint(ctx context.Context, resp *cpuadvisor.GetChe
 			poolName := entryName
 			livingPoolNameSet.Insert(poolName)
 			if err := cs.createOrUpdatePoolInfo(
-				poolName, poolInfo.OwnerPoolName, poolInfo.TopologyAwareAssignments, poolInfo.OriginalTopologyAwareAssignments,
+				poolName, poolInfo.OwnerPoolName, poolInfo.TopologyAwareAssignments, poolInfo.OriginalTopologyAwareAssignments, updateStats,
 			); err != nil {
 				klog.Errorf("[qosaware-server-cpu] update pool info with error: %v", err)
 			}
 		}
 	}
 
-	// parse container entries after pool entries
-	for entryName, entry := range resp.Entries {
-		if _, ok := entry.Entries[commonstate.FakedContainerName]; !ok {
-			podUID := entryName
-			pod, err := cs.metaServer.GetPod(ctx, podUID)
-			if err != nil {
-				klog.Errorf("[qosaware-server-cpu] get pod info with error: %v", err)
-				continue
-			}
+	// parse container entries after pool entries, all of which share the same qos conf snapshot
+	qosLevels := newQoSLevelResolver(cs.snapshotQoSConf())
+	retryBudget := cs.updateContainerRetryBudget
+	podFetchFailed := sets.NewString()
+	containerCount := 0
+	for entryName, entry := range resp.Entries {
+		if _, ok := entry.Entries[commonstate.FakedContainerName]; !ok {
+			containerCount += len(entry.Entries)
+			podUID := entryName
+			pod, err := cs.getPodWithTimeout(ctx, podUID)
+			if err != nil {
+				podFetchFailed.Insert(podUID)
+				// pods deleted after the plugin wrote its checkpoint are expected during churn until the plugin cleans them up
+				reason := "error"
+				if stdErrors.Is(err, metaserverpod.ErrPodNotFound) {
+					reason = "pod_gone"
+					klog.V(4).Infof("[qosaware-server-cpu] pod %s is gone, skip its containers: %v", podUID, err)
+				} else {
+					klog.Errorf("[qosaware-server-cpu] get pod info with error: %v", err)
+				}
+				_ = cs.emitter.StoreInt64(cs.genMetricsName(metricCPUServerGetPodFailed), 1, metrics.MetricTypeNameCount,
+					metrics.MetricTag{Key: "reason", Val: reason})
+				continue
+			}
+
+			for containerName, info := range entry.Entries {
+				if err := cs.updateContainerInfoWithRetry(qosLevels, podUID, containerName, pod, info, &retryBudget, updateStats); err != nil {
+					klog.Errorf("[qosaware-server-cpu] update container info with error: %v", err)
+					_ = cs.emitter.StoreInt64(cs.genMetricsName(metricServerCheckpointUpdateContainerFailed), 1, metrics.MetricTypeNameCount,
+						metrics.MetricTag{Key: "podUID", Val: podUID},
+						metrics.MetricTag{Key: "containerName", Val: containerName})
+				}
+			}
+		}
+	}
+
+	cs.podFetchFailedMutex.Lock()
+	cs.podFetchFailed = podFetchFailed
+	cs.podFetchFailedMutex.Unlock()
+	cs.emitQoSLevelResolutionCost("syncCheckpoint", qosLevels)
+	cs.emitCheckpointUpdateStats(updateStats)
+	cs.validatePoolMembership()
+
+	suspect := cs.isCheckpointSuspect(containerCount)
+	if cs.isGCDisabled() || suspect || !allowGC {
+		return
+	}
+
+	if cs.gcAfterAdvisorUpdate {
+		cs.pendingGC = func() {
+			cs.gcCheckpoint(resp, livingPoolNameSet, safeTime)
+		}
+		return
+	}
+	cs.gcCheckpoint(resp, livingPoolNameSet, safeTime)
+}
+
+// checkpointUpdateStats counts updates of pools and containers in meta cache within a single sync,
+// and an update is skipped if the allocation is identical to the cached one
+type checkpointUpdateStats struct {
+	skipped int
+	applied int
+}
+
+func (s *checkpointUpdateStats) record(applied bool) {
+	if s == nil {
+		return
+	}
+	if applied {
+		s.applied++
+	} else {
+		s.skipped++
+	}
+}
+
+func (cs *cpuServer) emitCheckpointUpdateStats(stats *checkpointUpdateStats) {
+	_ = cs.emitter.StoreInt64(cs.genMetricsName(metricCPUServerCheckpointUpdates), int64(stats.skipped), metrics.MetricTypeNameRaw,
+		metrics.MetricTag{Key: "result", Val: "skipped"})
+	_ = cs.emitter.StoreInt64(cs.genMetricsName(metricCPUServerCheckpointUpdates), int64(stats.applied), metrics.MetricTypeNameRaw,
+		metrics.MetricTag{Key: "result", Val: "applied"})
+}
+
+// equalAssignments returns whether two assignments consist of the same cpus on the same numas,
+// regardless of how the cpusets are constructed
+func equalAssignments(a, b types.TopologyAwareAssignment) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for numaID, cpus := range a {
+		other, ok := b[numaID]
+		if !ok || cpus.Size() != other.Size() || !cpus.IsSubsetOf(other) {
+			return false
+		}
+	}
+	return true
+}
+
+// runPendingGC runs the deferred gc of the latest synced checkpoint if advisor is updated successfully,
+// otherwise the gc is skipped, and cached containers and pools are kept until the next successful update
+func (cs *cpuServer) runPendingGC(advisorUpdated bool) {
+	pendingGC := cs.pendingGC
+	cs.pendingGC = nil
+	if pendingGC == nil {
+		return
+	}
+
+	if !advisorUpdated {
+		klog.Warningf("[qosaware-server-cpu] advisor update failed, skip gc of containers and pools")
+		_ = cs.emitter.StoreInt64(cs.genMetricsName(metricCPUServerGCSkippedOnUpdateFailure), 1, metrics.MetricTypeNameCount)
+		return
+	}
+	pendingGC()
+}
+
+// gcCheckpoint deletes cached containers absent from checkpoint and pools no longer referred to
+func (cs *cpuServer) gcCheckpoint(resp *cpuadvisor.GetCheckpointResponse, livingPoolNameSet sets.String, safeTime int64) {
+	// clean up the containers not existed in resp.Entries
+	gcContainers := cs.getContainersToGC(resp)
+	_ = cs.metaCache.RangeAndDeleteContainer(func(containerInfo *types.ContainerInfo) bool {
+		return gcContainers.Has(ContainerMeta{PodUID: containerInfo.PodUID, ContainerName: containerInfo.ContainerName})
+	}, safeTime)
+
+	// complement living containers' original owner pools for pool gc
+	// todo: deprecate original owner pool and generate owner pool by realtime container status
+	checkpointPoolNameSet := sets.NewString(livingPoolNameSet.UnsortedList()...)
+	cs.metaCache.RangeContainer(func(podUID string, containerName string, containerInfo *types.ContainerInfo) bool {
+		livingPoolNameSet.Insert(containerInfo.OriginOwnerPoolName)
+		return true
+	})
+
+	// gc pool entries
+	cs.reportGCProtectedPools(checkpointPoolNameSet, livingPoolNameSet)
+	_ = cs.metaCache.GCPoolEntries(livingPoolNameSet)
+}
+
+// reportGCProtectedPools reports cached pools absent from checkpoint but protected from gc in this cycle,
+// which gives visibility into why such pools persist
+func (cs *cpuServer) reportGCProtectedPools(checkpointPoolNameSet, livingPoolNameSet sets.String) {
+	protected := 0
+	cs.metaCache.RangePoolInfo(func(poolName string, _ *types.PoolInfo) bool {
+		if checkpointPoolNameSet.Has(poolName) || !livingPoolNameSet.Has(poolName) {
+			return true
+		}
+
+		protected++
+		klog.Infof("[qosaware-server-cpu] pool %s is absent from checkpoint, but protected from gc, reason: %s",
+			poolName, PoolGCProtectionReasonContainerReference)
+		_ = cs.emitter.StoreInt64(cs.genMetricsName(metricCPUServerPoolGCProtected), 1, metrics.MetricTypeNameCount,
+			metrics.MetricTag{Key: "pool", Val: poolName},
+			metrics.MetricTag{Key: "reason", Val: string(PoolGCProtectionReasonContainerReference)})
+		return true
+	})
+	_ = cs.emitter.StoreInt64(cs.genMetricsName(metricCPUServerPoolGCProtectedCount), int64(protected), metrics.MetricTypeNameRaw)
+}
+
+// validatePoolMembership correlates qos level of each container with the type of its owner pool after sync,
+// since pool entries and container entries are parsed independently, and inconsistencies between qrm plugin
+// and advisor should be caught early.
+func (cs *cpuServer) validatePoolMembership() {
+	violations := 0
+	cs.metaCache.RangeContainer(func(podUID string, containerName string, ci *types.ContainerInfo) bool {
+		if ci.OwnerPoolName == commonstate.EmptyOwnerPoolName {
+			return true
+		}
+
+		compatibleQoSLevels, ok := poolTypeCompatibleQoSLevels[commonstate.GetPoolType(ci.OwnerPoolName)]
+		if ok && !compatibleQoSLevels.Has(ci.QoSLevel) {
+			klog.Warningf("[qosaware-server-cpu] container %s/%s with qos level %s claims membership of incompatible pool %s",
+				podUID, containerName, ci.QoSLevel, ci.OwnerPoolName)
+			violations++
+		}
+		return true
+	})
+
+	_ = cs.emitter.StoreInt64(cs.genMetricsName(metricCPUServerPoolMembershipViolations), int64(violations), metrics.MetricTypeNameRaw)
+}
+
+// isCheckpointSuspect returns whether the number of containers in a checkpoint drops by more than
+// suspectCheckpointDropRatio versus the previous one, in which case the checkpoint may be incomplete
+// (e.g. due to a transient plugin bug) and gc is skipped to avoid deleting live containers; the count
+// is always recorded, so gc resumes with the next checkpoint unless it drops again.
+func (cs *cpuServer) isCheckpointSuspect(containerCount int) bool {
+	cs.lastCheckpointContainerCountMutex.Lock()
+	lastCount := cs.lastCheckpointContainerCount
+	cs.lastCheckpointContainerCount = containerCount
+	cs.lastCheckpointContainerCountMutex.Unlock()
+
+	if cs.suspectCheckpointDropRatio <= 0 || lastCount <= 0 {
+		return false
+	}
+
+	dropRatio := float64(lastCount-containerCount) / float64(lastCount)
+	if dropRatio <= cs.suspectCheckpointDropRatio {
+		return false
+	}
+
+	klog.Warningf("[qosaware-server-cpu] containers in checkpoint drop from %d to %d (ratio %.2f > %.2f), "+
+		"regard it as suspect and skip gc", lastCount, containerCount, dropRatio, cs.suspectCheckpointDropRatio)
+	_ = cs.emitter.StoreInt64(cs.genMetricsName(metricCPUServerSuspectCheckpoint), 1, metrics.MetricTypeNameCount)
+	return true
+}
 
-			for containerName, info := range entry.Entries {
-				if err := cs.updateContainerInfo(podUID, containerName, pod, info); err != nil {
-					klog.Errorf("[qosaware-server-cpu] update container info with error: %v", err)
-					_ = cs.emitter.StoreInt64(cs.genMetricsName(metricServerCheckpointUpdateContainerFailed), 1, metrics.MetricTypeNameCount,
-						metrics.MetricTag{Key: "podUID", Val: podUID},
-						metrics.MetricTag{Key: "containerName", Val: containerName})
-				}
+// isGCDisabled returns whether gc of containers and pools is disabled; since cached entries keep
+// accumulating meanwhile, it is reported loudly whenever gc is skipped
+func (cs *cpuServer) isGCDisabled() bool {
+	if !cs.disableGC {
+		return false
+	}
+
+	klog.Warningf("[qosaware-server-cpu] gc of containers and pools is disabled, meta cache keeps growing " +
+		"and leaks memory; it is intended for short debugging sessions only")
+	_ = cs.emitter.StoreInt64(cs.genMetricsName(metricCPUServerGCDisabled), 1, metrics.MetricTypeNameRaw)
+	return true
+}
+
+// TODO: are poolName and ownerPoolName the same?
+// getContainersToGC returns the cached containers absent from checkpoint that should be deleted in this sync;
+// if the number exceeds containerGCCapPerCycle, the longest-absent ones are chosen and the others are deferred.
+func (cs *cpuServer) getContainersToGC(resp *cpuadvisor.GetCheckpointResponse) containerMetaSet {
+	cs.containerAbsentSinceMutex.Lock()
+	defer cs.containerAbsentSinceMutex.Unlock()
+
+	now := time.Now()
+	absentContainers := make([]ContainerMeta, 0)
+	absentSince := make(map[ContainerMeta]time.Time)
+	cs.metaCache.RangeContainer(func(podUID string, containerName string, _ *types.ContainerInfo) bool {
+		if info, ok := resp.Entries[podUID]; ok {
+			if _, ok = info.Entries[containerName]; ok {
+				return true
 			}
 		}
-	}
 
-	// clean up the containers not existed in resp.Entries
-	_ = cs.metaCache.RangeAndDeleteContainer(func(containerInfo *types.ContainerInfo) bool {
-		info, ok := resp.Entries[containerInfo.PodUID]
+		meta := ContainerMeta{PodUID: podUID, ContainerName: containerName}
+		since, ok := cs.containerAbsentSince[meta]
 		if !ok {
-			return true
-		}
-		if _, ok = info.Entries[containerInfo.ContainerName]; !ok {
-			return true
+			since = now
 		}
-		return false
-	}, safeTime)
-
-	// complement living containers' original owner pools for pool gc
-	// todo: deprecate original owner pool and generate owner pool by realtime container status
-	cs.metaCache.RangeContainer(func(podUID string, containerName string, containerInfo *types.ContainerInfo) bool {
-		livingPoolNameSet.Insert(containerInfo.OriginOwnerPoolName)
+		absentSince[meta] = since
+		absentContainers = append(absentContainers, meta)
 		return true
 	})
+	// only keep records for containers still absent
+	cs.containerAbsentSince = absentSince
 
-	// gc pool entries
-	_ = cs.metaCache.GCPoolEntries(livingPoolNameSet)
+	deferred := 0
+	if cs.containerGCCapPerCycle > 0 && len(absentContainers) > cs.containerGCCapPerCycle {
+		sort.SliceStable(absentContainers, func(i, j int) bool {
+			return absentSince[absentContainers[i]].Before(absentSince[absentContainers[j]])
+		})
+
+		deferred = len(absentContainers) - cs.containerGCCapPerCycle
+		klog.Warningf("[qosaware-server-cpu] %d containers are absent from checkpoint, defer deleting %d of them",
+			len(absentContainers), deferred)
+		absentContainers = absentContainers[:cs.containerGCCapPerCycle]
+	}
+	_ = cs.emitter.StoreInt64(cs.genMetricsName(metricCPUServerContainerGCDeferred), int64(deferred), metrics.MetricTypeNameRaw)
+
+	gcContainers := containerMetaSet{}
+	for _, meta := range absentContainers {
+		gcContainers.Insert(meta)
+	}
+	return gcContainers
 }
 
-// TODO: are poolName and ownerPoolName the same?
 func (cs *cpuServer) createOrUpdatePoolInfo(
 	poolName string,
 	ownerPoolName string,
 	topologyAwareAssignments map[uint64]string,
 	originalTopologyAwareAssignments map[uint64]string,
+	stats *checkpointUpdateStats,
 ) error {
+	assignments := machine.TransformCPUAssignmentFormat(topologyAwareAssignments)
+	originalAssignments := machine.TransformCPUAssignmentFormat(originalTopologyAwareAssignments)
+
 	pi, ok := cs.metaCache.GetPoolInfo(poolName)
 	if !ok {
 		pi = &types.PoolInfo{
 			PoolName: ownerPoolName,
 		}
+	} else if equalAssignments(pi.TopologyAwareAssignments, assignments) &&
+		equalAssignments(pi.OriginalTopologyAwareAssignments, originalAssignments) {
+		stats.record(false)
+		return nil
+	}
+	pi.TopologyAwareAssignments = assignments
+	pi.OriginalTopologyAwareAssignments = originalAssignments
+
+	if err := cs.metaCache.SetPoolInfo(poolName, pi); err != nil {
+		return err
+	}
+	stats.record(true)
+	return nil
+}
+
+// snapshotQoSConf returns a copy of current qos configuration, so that all containers
+// in a sync are handled with a consistent config version; the configuration is updated
+// in place under its own lock, and updates take effect from the next sync
+func (cs *cpuServer) snapshotQoSConf() *generic.QoSConfiguration {
+	return cs.qosConf.Clone()
+}
+
+// qosLevelResolver resolves qos levels of pods with a qos conf snapshot, and caches them by pod uid
+// so that containers of the same pod are resolved only once; it must be scoped to a single sync,
+// so that annotation changes between syncs are still picked up
+type qosLevelResolver struct {
+	qosConf   *generic.QoSConfiguration
+	qosLevels map[string]string
+	// cost is the total time spent in resolving qos levels, excluding cache hits
+	cost time.Duration
+}
+
+func newQoSLevelResolver(qosConf *generic.QoSConfiguration) *qosLevelResolver {
+	return &qosLevelResolver{
+		qosConf:   qosConf,
+		qosLevels: make(map[string]string),
+	}
+}
+
+// getQoSLevelForPod returns the cached qos level of the pod if any; errors are not cached
+func (r *qosLevelResolver) getQoSLevelForPod(pod *v1.Pod) (string, error) {
+	var podUID string
+	if pod != nil {
+		podUID = string(pod.UID)
+		if qosLevel, ok := r.qosLevels[podUID]; ok {
+			return qosLevel, nil
+		}
+	}
+
+	start := time.Now()
+	qosLevel, err := r.qosConf.GetQoSLevelForPod(pod)
+	r.cost += time.Since(start)
+	if err != nil {
+		return "", err
+	}
+
+	if pod != nil {
+		r.qosLevels[podUID] = qosLevel
+	}
+	return qosLevel, nil
+}
+
+// emitQoSLevelResolutionCost emits the time spent in qos level resolution of a sync
+func (cs *cpuServer) emitQoSLevelResolutionCost(api string, resolver *qosLevelResolver) {
+	_ = cs.emitter.StoreInt64(cs.genMetricsName(metricCPUServerQoSLevelResolutionCost), resolver.cost.Microseconds(),
+		metrics.MetricTypeNameRaw, metrics.MetricTag{Key: "api", Val: api})
+}
+
+// getForcedRampUp returns the ramp-up state forced by pod annotation, and false if it is not forced
+func getForcedRampUp(pod *v1.Pod) (bool, bool) {
+	if pod == nil {
+		return false, false
+	}
+
+	switch pod.Annotations[coreconsts.PodAnnotationForceRampUpKey] {
+	case coreconsts.PodAnnotationForceRampUpTrue:
+		return true, true
+	case coreconsts.PodAnnotationForceRampUpFalse:
+		return false, true
+	default:
+		return false, false
+	}
+}
+
+// validateQoSLevelChange rejects changing the qos level of a container to or from immutable qos levels,
+// since e.g. a container flipping from dedicated_cores to shared_cores mid-life indicates a serious bug
+func (cs *cpuServer) validateQoSLevelChange(ci *types.ContainerInfo, qosLevel string) error {
+	if ci.QoSLevel == "" || ci.QoSLevel == qosLevel {
+		return nil
+	}
+	if !cs.immutableQoSLevels.Has(ci.QoSLevel) && !cs.immutableQoSLevels.Has(qosLevel) {
+		return nil
 	}
-	pi.TopologyAwareAssignments = machine.TransformCPUAssignmentFormat(topologyAwareAssignments)
-	pi.OriginalTopologyAwareAssignments = machine.TransformCPUAssignmentFormat(originalTopologyAwareAssignments)
 
-	return cs.metaCache.SetPoolInfo(poolName, pi)
+	_ = cs.emitter.StoreInt64(cs.genMetricsName(metricCPUServerQoSLevelChangeRejected), 1, metrics.MetricTypeNameCount,
+		metrics.MetricTag{Key: "old", Val: ci.QoSLevel},
+		metrics.MetricTag{Key: "new", Val: qosLevel})
+	return fmt.Errorf("%w: container %s of pod %s from %s to %s",
+		errIllegalQoSLevelChange, ci.ContainerName, ci.PodUID, ci.QoSLevel, qosLevel)
 }
 
 // The new update method for container info to replace setContainerInfoBasedOnAllocationInfo
 func (cs *cpuServer) setContainerInfoBasedOnContainerAllocationInfo(
+	qosLevels *qosLevelResolver,
 	pod *v1.Pod,
 	ci *types.ContainerInfo,
 	info *cpuadvisor.ContainerAllocationInfo,
 ) error {
-	if err := cs.setContainerInfoBasedOnAllocationInfo(pod, ci, info.AllocationInfo); err != nil {
+	if err := cs.setContainerInfoBasedOnAllocationInfo(qosLevels, pod, ci, info.AllocationInfo); err != nil {
 		return err
 	}
 
@@ -621,20 +4230,33 @@ func (cs *cpuServer) setContainerInfoBasedOnContainerAllocationInfo(
 
 // Deprecated: to be removed after all qrm plugins are migrated to the new synchronous model
 func (cs *cpuServer) setContainerInfoBasedOnAllocationInfo(
+	qosLevels *qosLevelResolver,
 	pod *v1.Pod,
 	ci *types.ContainerInfo,
 	info *cpuadvisor.AllocationInfo,
 ) error {
+	// get qos level name according to the qos conf, and nothing is applied if the change is illegal
+	qosLevel, err := qosLevels.getQoSLevelForPod(pod)
+	if err != nil {
+		return fmt.Errorf("get qos level failed: %w", err)
+	}
+	if err := cs.validateQoSLevelChange(ci, qosLevel); err != nil {
+		return err
+	}
+
 	ci.RampUp = info.RampUp
+	if forcedRampUp, ok := getForcedRampUp(pod); ok {
+		if forcedRampUp != ci.RampUp {
+			klog.Infof("[qosaware-server-cpu] ramp up of %v/%v is forced to %v by annotation", ci.PodUID, ci.ContainerName, forcedRampUp)
+		}
+		ci.RampUp = forcedRampUp
+		_ = cs.emitter.StoreInt64(cs.genMetricsName(metricCPUServerRampUpOverridden), 1, metrics.MetricTypeNameCount,
+			metrics.MetricTag{Key: "rampUp", Val: strconv.FormatBool(forcedRampUp)})
+	}
 	ci.TopologyAwareAssignments = machine.TransformCPUAssignmentFormat(info.TopologyAwareAssignments)
 	ci.OriginalTopologyAwareAssignments = machine.TransformCPUAssignmentFormat(info.OriginalTopologyAwareAssignments)
 	ci.OwnerPoolName = info.OwnerPoolName
 
-	// get qos level name according to the qos conf
-	qosLevel, err := cs.qosConf.GetQoSLevelForPod(pod)
-	if err != nil {
-		return fmt.Errorf("get qos level failed: %w", err)
-	}
 	if ci.QoSLevel != qosLevel {
 		general.Infof("qos level of %v/%v has change from %s to %s", ci.PodUID, ci.ContainerName, ci.QoSLevel, qosLevel)
 		ci.QoSLevel = qosLevel
@@ -657,6 +4279,7 @@ func (cs *cpuServer) setContainerInfoBasedOnAllocationInfo(
 }
 
 func (cs *cpuServer) createOrUpdateContainerInfo(
+	qosLevels *qosLevelResolver,
 	podUID string,
 	containerName string,
 	pod *v1.Pod,
@@ -682,48 +4305,136 @@ func (cs *cpuServer) createOrUpdateContainerInfo(
 			ci.CPURequest = float64(info.Metadata.RequestQuantity)
 		}
 
-		if err := cs.setContainerInfoBasedOnContainerAllocationInfo(pod, ci, info); err != nil {
+		if err := cs.setContainerInfoBasedOnContainerAllocationInfo(qosLevels, pod, ci, info); err != nil {
 			return fmt.Errorf("set container info for new container %v/%v failed: %w", podUID, containerName, err)
 		}
 		// use AddContainer instead of SetContainer to set the creation time in meta cache (is this necessary?)
 		if err := cs.metaCache.AddContainer(podUID, containerName, ci); err != nil {
 			return fmt.Errorf("add container %v/%v failed: %w", podUID, containerName, err)
 		}
+		cs.recordContainerUpdateTime(podUID, containerName)
 		return nil
 	}
 
-	if err := cs.setContainerInfoBasedOnContainerAllocationInfo(pod, ci, info); err != nil {
+	if err := cs.setContainerInfoBasedOnContainerAllocationInfo(qosLevels, pod, ci, info); err != nil {
 		return fmt.Errorf("set container info for existing container %v/%v failed: %w", podUID, containerName, err)
 	}
 	if err := cs.metaCache.SetContainerInfo(podUID, containerName, ci); err != nil {
 		return fmt.Errorf("update container info %v/%v failed: %w", podUID, containerName, err)
 	}
+	cs.recordContainerUpdateTime(podUID, containerName)
 	return nil
 }
 
 func (cs *cpuServer) updateContainerInfo(
+	qosLevels *qosLevelResolver,
 	podUID string,
 	containerName string,
 	pod *v1.Pod,
 	info *cpuadvisor.AllocationInfo,
+	stats *checkpointUpdateStats,
 ) error {
 	ci, ok := cs.metaCache.GetContainerInfo(podUID, containerName)
 	if !ok {
-		return fmt.Errorf("container %v/%v not exist", podUID, containerName)
+		return fmt.Errorf("%w: %v/%v", errContainerNotExist, podUID, containerName)
 	}
 
-	if err := cs.setContainerInfoBasedOnAllocationInfo(pod, ci, info); err != nil {
+	cached := newContainerAllocationState(ci)
+	if err := cs.setContainerInfoBasedOnAllocationInfo(qosLevels, pod, ci, info); err != nil {
 		return fmt.Errorf("update container info %v/%v failed: %w", podUID, containerName, err)
 	}
 
+	// the container is still regarded as updated by the qrm plugin even if nothing changes
+	cs.recordContainerUpdateTime(podUID, containerName)
+	if cached.equals(newContainerAllocationState(ci)) {
+		stats.record(false)
+		return nil
+	}
+
 	// Need to set back because of deep copy
-	return cs.metaCache.SetContainerInfo(podUID, containerName, ci)
+	if err := cs.metaCache.SetContainerInfo(podUID, containerName, ci); err != nil {
+		return err
+	}
+	stats.record(true)
+	return nil
+}
+
+// containerAllocationState is the part of container info updated from the allocation in checkpoint;
+// assignments are replaced rather than modified in place by updates, so they are safe to be referred to
+type containerAllocationState struct {
+	ownerPoolName       string
+	originOwnerPoolName string
+	qosLevel            string
+	rampUp              bool
+	assignments         types.TopologyAwareAssignment
+	originalAssignments types.TopologyAwareAssignment
+}
+
+func newContainerAllocationState(ci *types.ContainerInfo) containerAllocationState {
+	return containerAllocationState{
+		ownerPoolName:       ci.OwnerPoolName,
+		originOwnerPoolName: ci.OriginOwnerPoolName,
+		qosLevel:            ci.QoSLevel,
+		rampUp:              ci.RampUp,
+		assignments:         ci.TopologyAwareAssignments,
+		originalAssignments: ci.OriginalTopologyAwareAssignments,
+	}
+}
+
+func (s containerAllocationState) equals(other containerAllocationState) bool {
+	return s.ownerPoolName == other.ownerPoolName && s.originOwnerPoolName == other.originOwnerPoolName &&
+		s.qosLevel == other.qosLevel && s.rampUp == other.rampUp &&
+		equalAssignments(s.assignments, other.assignments) && equalAssignments(s.originalAssignments, other.originalAssignments)
+}
+
+// updateContainerInfoWithRetry retries updateContainerInfo for transient errors,
+// and each retry consumes the retry budget shared within a single sync
+func (cs *cpuServer) updateContainerInfoWithRetry(
+	qosLevels *qosLevelResolver,
+	podUID string,
+	containerName string,
+	pod *v1.Pod,
+	info *cpuadvisor.AllocationInfo,
+	retryBudget *int,
+	stats *checkpointUpdateStats,
+) error {
+	for {
+		err := cs.updateContainerInfo(qosLevels, podUID, containerName, pod, info, stats)
+		if err == nil || stdErrors.Is(err, errContainerNotExist) || stdErrors.Is(err, errIllegalQoSLevelChange) || *retryBudget <= 0 {
+			return err
+		}
+
+		*retryBudget--
+		klog.Warningf("[qosaware-server-cpu] retry to update container info %v/%v (remaining budget: %d): %v",
+			podUID, containerName, *retryBudget, err)
+	}
+}
+
+// newBlock constructs a Block with an id from blockIDGenerator, and the id is suffixed if it is taken by any live
+// block in the block set, since a new block with such an id would be silently joined with the live one
+func (cs *cpuServer) newBlock(bs blockSet, key BlockIDKey) *cpuadvisor.Block {
+	generatedID := cs.blockIDGenerator(key)
+	blockID := generatedID
+	for i := 2; len(bs.get(blockID)) > 0; i++ {
+		blockID = fmt.Sprintf("%s-%d", generatedID, i)
+	}
+	if blockID != generatedID {
+		klog.Warningf("[qosaware-server-cpu] block id %s collides with a live block, use %s instead", generatedID, blockID)
+		_ = cs.emitter.StoreInt64(cs.genMetricsName(metricCPUServerBlockIDCollided), 1, metrics.MetricTypeNameCount)
+	}
+	return NewBlock(key.Size, blockID)
 }
 
 // assemblePoolEntries fills up calculationEntriesMap and blockSet based on cpu.InternalCPUCalculationResult
 // - for each [pool, numa] set, there exists a new Block (and corresponding internalBlock)
-func (cs *cpuServer) assemblePoolEntries(advisorResp *types.InternalCPUCalculationResult, calculationEntriesMap map[string]*cpuadvisor.CalculationEntries, bs blockSet) {
-	for poolName, entries := range advisorResp.PoolEntries {
+// - pools and numa nodes are walked in order, so that blocks are constructed deterministically
+func (cs *cpuServer) assemblePoolEntries(advisorResp *types.InternalCPUCalculationResult, calculationEntriesMap map[string]*cpuadvisor.CalculationEntries, bs blockSet,
+	warnings *assemblyWarnings,
+) {
+	poolNames := lo.Keys(advisorResp.PoolEntries)
+	sort.Strings(poolNames)
+	for _, poolName := range poolNames {
+		entries := advisorResp.PoolEntries[poolName]
 		// join reclaim pool lastly
 		if poolName == commonstate.PoolNameReclaim {
 			continue
@@ -736,8 +4447,15 @@ func (cs *cpuServer) assemblePoolEntries(advisorResp *types.InternalCPUCalculati
 		}
 
 		poolEntry := NewPoolCalculationEntries(poolName)
-		for numaID, cpu := range entries {
-			block := NewBlock(uint64(cpu.Size), "")
+		for _, numaID := range sortedNUMAIDs(entries) {
+			cpu := entries[numaID]
+			size, err := cpuSizeToBlockResult(cpu.Size, cs.poolSizeUnits[poolName])
+			if err != nil {
+				klog.Errorf("[qosaware-server-cpu] convert size of pool %s failed: %v", poolName, err)
+				warnings.add(fmt.Sprintf("convert size of pool %s failed: %v", poolName, err))
+				continue
+			}
+			block := cs.newBlock(bs, BlockIDKey{Owner: poolName, NUMAID: int64(numaID), Size: size})
 			numaCalculationResult := &cpuadvisor.NumaCalculationResult{Blocks: []*cpuadvisor.Block{block}}
 
 			innerBlock := NewInnerBlock(block, int64(numaID), poolName, nil, numaCalculationResult)
@@ -749,8 +4467,10 @@ func (cs *cpuServer) assemblePoolEntries(advisorResp *types.InternalCPUCalculati
 	}
 
 	if reclaimEntries, ok := advisorResp.PoolEntries[commonstate.PoolNameReclaim]; ok {
+		ineligiblePools, ineligibleContainers := cs.getOverlapIneligibleTargets()
 		poolEntry := NewPoolCalculationEntries(commonstate.PoolNameReclaim)
-		for numaID, reclaimCPU := range reclaimEntries {
+		for _, numaID := range sortedNUMAIDs(reclaimEntries) {
+			reclaimCPU := reclaimEntries[numaID]
 			reclaimNUMACalculationResult, ok := poolEntry.Entries[commonstate.FakedContainerName].CalculationResultsByNumas[int64(numaID)]
 			if !ok {
 				reclaimNUMACalculationResult = &cpuadvisor.NumaCalculationResult{Blocks: []*cpuadvisor.Block{}}
@@ -758,8 +4478,11 @@ func (cs *cpuServer) assemblePoolEntries(advisorResp *types.InternalCPUCalculati
 			}
 
 			// first init reclaim pool if reclaim size is greater than 0
-			if reclaimCPU.Size > 0 {
-				block := NewBlock(uint64(reclaimCPU.Size), "")
+			if size, err := cpuSizeToBlockResult(reclaimCPU.Size, cs.poolSizeUnits[commonstate.PoolNameReclaim]); err != nil {
+				klog.Errorf("[qosaware-server-cpu] convert size of pool %s failed: %v", commonstate.PoolNameReclaim, err)
+				warnings.add(fmt.Sprintf("convert size of pool %s failed: %v", commonstate.PoolNameReclaim, err))
+			} else if size = cs.clampReclaimPoolShrink(numaID, size); size > 0 {
+				block := cs.newBlock(bs, BlockIDKey{Owner: commonstate.PoolNameReclaim, NUMAID: int64(numaID), Size: size})
 				innerBlock := NewInnerBlock(block, int64(numaID), commonstate.PoolNameReclaim, nil, reclaimNUMACalculationResult)
 				innerBlock.join(block.BlockId, bs)
 				reclaimNUMACalculationResult.Blocks = appendBlock(reclaimNUMACalculationResult.Blocks, block)
@@ -769,7 +4492,14 @@ func (cs *cpuServer) assemblePoolEntries(advisorResp *types.InternalCPUCalculati
 			overlapPodContainerSize := advisorResp.GetPoolOverlapPodContainerInfo(commonstate.PoolNameReclaim, numaID)
 			for podUID, containerSize := range overlapPodContainerSize {
 				for containerName, size := range containerSize {
-					block := NewBlock(uint64(size), "")
+					if ineligibleContainers.Has(ContainerMeta{PodUID: podUID, ContainerName: containerName}) {
+						continue
+					}
+					if size == 0 && cs.emptyReclaimBlocksPolicy != EmptyReclaimBlocksPolicyKeep {
+						continue
+					}
+
+					block := cs.newBlock(bs, BlockIDKey{Owner: commonstate.PoolNameReclaim, NUMAID: int64(numaID), Size: uint64(size)})
 					dedicatedCalculationResults, ok := getNumaCalculationResult(calculationEntriesMap, podUID, containerName, int64(numaID))
 					if ok && len(dedicatedCalculationResults.Blocks) == 1 {
 						innerBlock := NewInnerBlock(block, int64(numaID), commonstate.PoolNameReclaim, &ContainerMeta{
@@ -782,17 +4512,47 @@ func (cs *cpuServer) assemblePoolEntries(advisorResp *types.InternalCPUCalculati
 				}
 			}
 
-			// finally handle reclaim pool with overlap shared pool if overlap shared pool is existed
+			// finally handle reclaim pool with overlap shared pool if overlap shared pool is existed,
+			// and lower-priority shared pools are overlapped first
 			overlapSize := advisorResp.GetPoolOverlapInfo(commonstate.PoolNameReclaim, numaID)
-			for sharedPoolName, reclaimedSize := range overlapSize {
+			// the cumulative overlap is checked against cpus of the numa, which is skipped if unknown
+			numaCPUs := cs.metaServer.CPUDetails.CPUsInNUMANodes(numaID).Size()
+			cumulativeOverlap := 0
+			for _, sharedPoolName := range cs.sortByOverlapPriority(lo.Keys(overlapSize)) {
+				if ineligiblePools.Has(sharedPoolName) {
+					continue
+				}
+				reclaimedSize := overlapSize[sharedPoolName]
+				if reclaimedSize == 0 && cs.emptyReclaimBlocksPolicy != EmptyReclaimBlocksPolicyKeep {
+					continue
+				}
+
 				sharedPoolCalculationResults, ok := getNumaCalculationResult(calculationEntriesMap, sharedPoolName, commonstate.FakedContainerName, int64(numaID))
 				if ok && len(sharedPoolCalculationResults.Blocks) == 1 {
-					block := NewBlock(uint64(reclaimedSize), "")
+					// an overlap larger than the shared pool is clamped to the pool size
+					if sharedPoolSize := int(sharedPoolCalculationResults.Blocks[0].Result); reclaimedSize > sharedPoolSize {
+						cs.reportInvalidReclaimOverlap(warnings, numaID, sharedPoolName, "exceeds-pool",
+							fmt.Sprintf("overlap %d exceeds pool size %d, clamped", reclaimedSize, sharedPoolSize))
+						reclaimedSize = sharedPoolSize
+					}
+					// an overlap making the cumulative one exceed cpus of the numa is rejected
+					if numaCPUs > 0 && cumulativeOverlap+reclaimedSize > numaCPUs {
+						cs.reportInvalidReclaimOverlap(warnings, numaID, sharedPoolName, "exceeds-numa",
+							fmt.Sprintf("cumulative overlap %d exceeds numa cpus %d, rejected", cumulativeOverlap+reclaimedSize, numaCPUs))
+						continue
+					}
+					cumulativeOverlap += reclaimedSize
+
+					block := cs.newBlock(bs, BlockIDKey{Owner: commonstate.PoolNameReclaim, NUMAID: int64(numaID), Size: uint64(reclaimedSize)})
 					innerBlock := NewInnerBlock(block, int64(numaID), commonstate.PoolNameReclaim, nil, reclaimNUMACalculationResult)
 					innerBlock.join(sharedPoolCalculationResults.Blocks[0].BlockId, bs)
 					reclaimNUMACalculationResult.Blocks = appendBlock(reclaimNUMACalculationResult.Blocks, block)
 				}
 			}
+
+			if len(reclaimNUMACalculationResult.Blocks) == 0 && cs.emptyReclaimBlocksPolicy == EmptyReclaimBlocksPolicyOmit {
+				delete(poolEntry.Entries[commonstate.FakedContainerName].CalculationResultsByNumas, int64(numaID))
+			}
 		}
 		calculationEntriesMap[commonstate.PoolNameReclaim] = poolEntry
 	}
@@ -807,40 +4567,233 @@ func (cs *cpuServer) assemblePoolEntries(advisorResp *types.InternalCPUCalculati
 	}
 }
 
+func sortedNUMAIDs(entries map[int]types.CPUResource) []int {
+	numaIDs := lo.Keys(entries)
+	sort.Ints(numaIDs)
+	return numaIDs
+}
+
+// reportInvalidReclaimOverlap logs and reports an invalid overlap between reclaim pool and a shared pool from advisor
+func (cs *cpuServer) reportInvalidReclaimOverlap(warnings *assemblyWarnings, numaID int, sharedPoolName, reason, message string) {
+	klog.Errorf("[qosaware-server-cpu] invalid reclaim overlap with pool %s on numa %d: %s", sharedPoolName, numaID, message)
+	warnings.add(fmt.Sprintf("invalid reclaim overlap with pool %s on numa %d: %s", sharedPoolName, numaID, message))
+	_ = cs.emitter.StoreInt64(cs.genMetricsName(metricCPUServerReclaimOverlapInvalid), 1, metrics.MetricTypeNameCount,
+		metrics.MetricTag{Key: "numa", Val: strconv.Itoa(numaID)},
+		metrics.MetricTag{Key: "pool", Val: sharedPoolName},
+		metrics.MetricTag{Key: "reason", Val: reason})
+}
+
+// clampReclaimPoolShrink limits how much reclaim pool shrinks on the numa compared with the latest assembled size,
+// so that batch jobs running in reclaim pool are able to wind down gracefully
+func (cs *cpuServer) clampReclaimPoolShrink(numaID int, size uint64) uint64 {
+	cs.reclaimPoolSizesMutex.Lock()
+	defer cs.reclaimPoolSizesMutex.Unlock()
+
+	lastSize, ok := cs.reclaimPoolSizes[numaID]
+	if ok && cs.reclaimPoolMaxShrinkPerCycle > 0 && lastSize > size+uint64(cs.reclaimPoolMaxShrinkPerCycle) {
+		clampedSize := lastSize - uint64(cs.reclaimPoolMaxShrinkPerCycle)
+		klog.Infof("[qosaware-server-cpu] reclaim pool on numa %d shrinks from %d to %d, clamped to %d",
+			numaID, lastSize, size, clampedSize)
+		_ = cs.emitter.StoreInt64(cs.genMetricsName(metricCPUServerReclaimPoolShrinkClamped), int64(clampedSize-size), metrics.MetricTypeNameRaw,
+			metrics.MetricTag{Key: "numa", Val: strconv.Itoa(numaID)})
+		size = clampedSize
+	}
+	cs.reclaimPoolSizes[numaID] = size
+	return size
+}
+
+// removeDuplicateBlocks normalizes assembled entries by keeping only the first block of each block id within
+// a numa result, since duplicate blocks confuse the plugin; results shared by entries are normalized only once.
+func (cs *cpuServer) removeDuplicateBlocks(calculationEntriesMap map[string]*cpuadvisor.CalculationEntries) {
+	visited := make(map[*cpuadvisor.NumaCalculationResult]struct{})
+	removed := 0
+	for entryName, entries := range calculationEntriesMap {
+		for containerName, calculationInfo := range entries.Entries {
+			for numaID, numaCalculationResult := range calculationInfo.CalculationResultsByNumas {
+				if numaCalculationResult == nil {
+					continue
+				}
+				if _, ok := visited[numaCalculationResult]; ok {
+					continue
+				}
+				visited[numaCalculationResult] = struct{}{}
+
+				blocks := make([]*cpuadvisor.Block, 0, len(numaCalculationResult.Blocks))
+				for _, block := range numaCalculationResult.Blocks {
+					blocks = appendBlock(blocks, block)
+				}
+				if duplicates := len(numaCalculationResult.Blocks) - len(blocks); duplicates > 0 {
+					klog.Warningf("[qosaware-server-cpu] %d duplicate blocks of %s/%s on numa %d are removed",
+						duplicates, entryName, containerName, numaID)
+					numaCalculationResult.Blocks = blocks
+					removed += duplicates
+				}
+			}
+		}
+	}
+
+	if removed > 0 {
+		_ = cs.emitter.StoreInt64(cs.genMetricsName(metricCPUServerDuplicateBlocksRemoved), int64(removed), metrics.MetricTypeNameRaw)
+	}
+}
+
+// sortByOverlapPriority sorts shared pools by overlap priority in ascending order, and by name for equal priorities
+func (cs *cpuServer) sortByOverlapPriority(poolNames []string) []string {
+	sort.SliceStable(poolNames, func(i, j int) bool {
+		pi, pj := cs.poolOverlapPriorities[poolNames[i]], cs.poolOverlapPriorities[poolNames[j]]
+		if pi != pj {
+			return pi < pj
+		}
+		return poolNames[i] < poolNames[j]
+	})
+	return poolNames
+}
+
+// capPoolBlocksPerNUMA merges blocks of a pool on one numa if the number of them exceeds maxBlocksPerNUMAPerPool;
+// only blocks without overlap targets are merged, since the others share cpus with their targets, and the pool
+// is reported if it still exceeds the cap after merging.
+func (cs *cpuServer) capPoolBlocksPerNUMA(calculationEntriesMap map[string]*cpuadvisor.CalculationEntries, bs blockSet) {
+	if cs.maxBlocksPerNUMAPerPool <= 0 {
+		return
+	}
+
+	for poolName, entries := range calculationEntriesMap {
+		poolInfo, ok := entries.Entries[commonstate.FakedContainerName]
+		if !ok {
+			continue
+		}
+
+		for numaID, numaCalculationResult := range poolInfo.CalculationResultsByNumas {
+			if len(numaCalculationResult.Blocks) <= cs.maxBlocksPerNUMAPerPool {
+				continue
+			}
+
+			var mergedBlock *cpuadvisor.Block
+			blocks := make([]*cpuadvisor.Block, 0, len(numaCalculationResult.Blocks))
+			for _, block := range numaCalculationResult.Blocks {
+				if len(block.OverlapTargets) > 0 {
+					blocks = append(blocks, block)
+					continue
+				}
+				if mergedBlock == nil {
+					mergedBlock = block
+					blocks = append(blocks, block)
+					continue
+				}
+
+				mergedBlock.Result += block.Result
+				delete(bs, block.BlockId)
+				_ = cs.emitter.StoreInt64(cs.genMetricsName(metricCPUServerPoolBlocksMerged), 1, metrics.MetricTypeNameCount,
+					metrics.MetricTag{Key: "pool", Val: poolName})
+			}
+			numaCalculationResult.Blocks = blocks
+
+			if len(blocks) > cs.maxBlocksPerNUMAPerPool {
+				klog.Warningf("[qosaware-server-cpu] pool %s has %d blocks on numa %d after merging, exceeding cap %d",
+					poolName, len(blocks), numaID, cs.maxBlocksPerNUMAPerPool)
+				_ = cs.emitter.StoreInt64(cs.genMetricsName(metricCPUServerPoolBlocksExceeded), int64(len(blocks)), metrics.MetricTypeNameRaw,
+					metrics.MetricTag{Key: "pool", Val: poolName}, metrics.MetricTag{Key: "numa", Val: strconv.FormatInt(numaID, 10)})
+			}
+		}
+	}
+}
+
+// mergePoolNUMABlocks merges blocks of a pool spanning multiple numa nodes identically, i.e. with exactly one
+// block of the same size on each numa, into a single block assigned by FakedNUMAID, and the total size is kept;
+// pools with any overlapping block are left as is, since overlap targets share cpus on a specific numa.
+func (cs *cpuServer) mergePoolNUMABlocks(calculationEntriesMap map[string]*cpuadvisor.CalculationEntries, bs blockSet) {
+	if !cs.mergeIdenticalPoolNUMABlocks {
+		return
+	}
+
+	for poolName, entries := range calculationEntriesMap {
+		poolInfo, ok := entries.Entries[commonstate.FakedContainerName]
+		if !ok || len(poolInfo.CalculationResultsByNumas) < 2 {
+			continue
+		}
+
+		identical := true
+		sizes := sets.NewInt64()
+		var total uint64
+		for numaID, numaCalculationResult := range poolInfo.CalculationResultsByNumas {
+			if numaID == commonstate.FakedNUMAID || len(numaCalculationResult.Blocks) != 1 ||
+				len(numaCalculationResult.Blocks[0].OverlapTargets) > 0 {
+				identical = false
+				break
+			}
+			sizes.Insert(int64(numaCalculationResult.Blocks[0].Result))
+			total += numaCalculationResult.Blocks[0].Result
+		}
+		if !identical || sizes.Len() != 1 || total == 0 {
+			continue
+		}
+
+		for _, numaCalculationResult := range poolInfo.CalculationResultsByNumas {
+			delete(bs, numaCalculationResult.Blocks[0].BlockId)
+		}
+		block := cs.newBlock(bs, BlockIDKey{Owner: poolName, NUMAID: commonstate.FakedNUMAID, Size: total})
+		numaCalculationResult := &cpuadvisor.NumaCalculationResult{Blocks: []*cpuadvisor.Block{block}}
+		_ = bs.add(NewInnerBlock(block, commonstate.FakedNUMAID, poolName, nil, numaCalculationResult))
+		poolInfo.CalculationResultsByNumas = map[int64]*cpuadvisor.NumaCalculationResult{
+			commonstate.FakedNUMAID: numaCalculationResult,
+		}
+		_ = cs.emitter.StoreInt64(cs.genMetricsName(metricCPUServerPoolNUMABlocksMerged), 1, metrics.MetricTypeNameCount,
+			metrics.MetricTag{Key: "pool", Val: poolName})
+	}
+}
+
+// getOverlapIneligibleTargets returns the pools and containers that reclaim pool should not overlap with,
+// i.e. the owner pools of overlap-ineligible containers along with the containers themselves.
+func (cs *cpuServer) getOverlapIneligibleTargets() (sets.String, containerMetaSet) {
+	ineligiblePools := sets.NewString()
+	ineligibleContainers := containerMetaSet{}
+	cs.metaCache.RangeContainer(func(podUID string, containerName string, ci *types.ContainerInfo) bool {
+		if ci.IsReclaimOverlapIneligible() {
+			ineligibleContainers.Insert(ContainerMeta{PodUID: podUID, ContainerName: containerName})
+			if ci.OwnerPoolName != "" {
+				ineligiblePools.Insert(ci.OwnerPoolName)
+			}
+		}
+		return true
+	})
+
+	_ = cs.emitter.StoreInt64(cs.genMetricsName(metricCPUServerOverlapExcludedContainers), int64(len(ineligibleContainers)), metrics.MetricTypeNameRaw)
+	return ineligiblePools, ineligibleContainers
+}
+
 // assemblePoolEntries fills up calculationEntriesMap and blockSet based on types.ContainerInfo
 //
 // todo this logic should be refined to make sure we will assemble entries from	internalCalculationInfo rather than walking through containerInfo
 func (cs *cpuServer) assembleNormalPodEntries(calculationEntriesMap map[string]*cpuadvisor.CalculationEntries,
 	podUID string, ci *types.ContainerInfo,
 ) error {
-	calculationInfo := &cpuadvisor.CalculationInfo{
-		OwnerPoolName:             ci.OwnerPoolName,
-		CalculationResultsByNumas: nil,
-	}
-
 	if ci.IsDedicatedNumaBinding() {
 		return nil
 	}
 
-	// if isolation is locking in, pass isolation-region name (equals isolation owner-pool) instead of owner pool
-	if ci.Isolated {
-		if ci.RegionNames.Len() == 1 && ci.OwnerPoolName != ci.RegionNames.List()[0] {
-			calculationInfo.OwnerPoolName = ci.RegionNames.List()[0]
-		}
-	}
-	// if isolation is locking out, pass original owner pool instead of owner pool
-	if !ci.Isolated && ci.OwnerPoolName != ci.OriginOwnerPoolName {
-		calculationInfo.OwnerPoolName = ci.OriginOwnerPoolName
+	ownerPoolName, reason := cs.resolveDampedOwnerPool(ci)
+	klog.V(4).Infof("[qosaware-server-cpu] container %s/%s is placed in pool %s, reason: %s",
+		ci.PodUID, ci.ContainerName, ownerPoolName, reason)
+	calculationInfo := &cpuadvisor.CalculationInfo{
+		OwnerPoolName:             ownerPoolName,
+		CalculationResultsByNumas: nil,
 	}
 
 	if ci.QoSLevel == consts.PodAnnotationQoSLevelSharedCores || ci.QoSLevel == consts.PodAnnotationQoSLevelReclaimedCores {
 		if calculationInfo.OwnerPoolName == "" {
-			klog.Warningf("container %s/%s pool name is empty", ci.PodUID, ci.ContainerName)
-			return nil
+			return fmt.Errorf("container %s/%s: %w", ci.PodUID, ci.ContainerName, ErrEmptyOwnerPool)
 		}
 		if _, ok := calculationEntriesMap[calculationInfo.OwnerPoolName]; !ok {
-			klog.Warningf("container %s/%s refer a non-existed pool: %s", ci.PodUID, ci.ContainerName, ci.OwnerPoolName)
-			return nil
+			// the owner pool may be gc-ed between sync and assembly, so place the container in fallback pool if any
+			if _, ok := calculationEntriesMap[cs.orphanContainerFallbackPool]; cs.orphanContainerFallbackPool == "" || !ok {
+				return fmt.Errorf("container %s/%s refers to pool %s: %w", ci.PodUID, ci.ContainerName, calculationInfo.OwnerPoolName, ErrPoolNotFound)
+			}
+
+			klog.Warningf("container %s/%s refer a non-existed pool: %s, fall back to pool %s",
+				ci.PodUID, ci.ContainerName, calculationInfo.OwnerPoolName, cs.orphanContainerFallbackPool)
+			_ = cs.emitter.StoreInt64(cs.genMetricsName(metricCPUServerOrphanContainerFallback), 1, metrics.MetricTypeNameCount,
+				metrics.MetricTag{Key: "pool", Val: calculationInfo.OwnerPoolName})
+			calculationInfo.OwnerPoolName = cs.orphanContainerFallbackPool
 		}
 	}
 
@@ -856,10 +4809,103 @@ func (cs *cpuServer) assembleNormalPodEntries(calculationEntriesMap map[string]*
 	return nil
 }
 
+// assembleDedicatedNUMABindingPodEntriesInParallel assembles entries of dedicated numa binding pods like
+// assembleDedicatedNUMABindingPodEntries, with pods spread over podEntryAssemblyWorkers workers; containers of
+// a pod are always assembled by the same worker, since sidecars reuse blocks of other containers in the pod.
+//
+// Block joins are not thread-safe, since joining a block mutates overlap targets of all inner blocks sharing
+// its id. So each worker assembles a pod into its own calculation entries and blockSet without any lock, and
+// then merges them into the shared ones with mutex held, along with its stat and warnings. This is correct
+// since blocks of dedicated numa binding pods are owned by the pod and never joined across pods; block ids
+// colliding with those of pods merged earlier are regenerated on merge, as newBlock does for live blocks.
+func (cs *cpuServer) assembleDedicatedNUMABindingPodEntriesInParallel(
+	advisorResp *types.InternalCPUCalculationResult,
+	calculationEntriesMap map[string]*cpuadvisor.CalculationEntries,
+	bs blockSet, stat *blockAssemblyStat, warnings *assemblyWarnings, podContainers map[string][]*types.ContainerInfo,
+) {
+	podUIDs := lo.Keys(podContainers)
+	sort.Strings(podUIDs)
+
+	// mutex protects calculationEntriesMap, bs, stat and warnings
+	var mutex sync.Mutex
+	workqueue.ParallelizeUntil(context.Background(), cs.podEntryAssemblyWorkers, len(podUIDs), func(i int) {
+		podUID := podUIDs[i]
+		podCalculationEntriesMap := make(map[string]*cpuadvisor.CalculationEntries)
+		podBlockSet := NewBlockSet()
+		podStat := &blockAssemblyStat{}
+		podWarnings := &assemblyWarnings{}
+		for _, ci := range podContainers[podUID] {
+			if err := cs.assembleDedicatedNUMABindingPodEntries(advisorResp, podCalculationEntriesMap, podBlockSet, podStat, podWarnings, podUID, ci); err != nil {
+				klog.Errorf("[qosaware-server-cpu] assembleDedicatedNUMABindingPodEntries for pod %s/%s uid %s err: %v", ci.PodNamespace, ci.PodName, ci.PodUID, err)
+				podWarnings.add(fmt.Sprintf("assemble dedicated numa binding container %s/%s failed: %v", ci.PodUID, ci.ContainerName, err))
+			}
+		}
+
+		mutex.Lock()
+		defer mutex.Unlock()
+		cs.mergePodBlockSet(bs, podBlockSet)
+		if calculationEntries, ok := podCalculationEntriesMap[podUID]; ok {
+			calculationEntriesMap[podUID] = calculationEntries
+		}
+		stat.reused += podStat.reused
+		stat.created += podStat.created
+		for _, message := range podWarnings.messages {
+			warnings.add(message)
+		}
+	})
+}
+
+// mergePodBlockSet merges blocks of a pod into the shared blockSet, and blocks whose ids collide with live blocks
+// of other pods are given new ids; it must be called with the shared blockSet protected.
+func (cs *cpuServer) mergePodBlockSet(bs blockSet, podBlockSet blockSet) {
+	for blockID, internalBlocks := range podBlockSet {
+		mergedID := blockID
+		for i := 2; len(bs.get(mergedID)) > 0 || (mergedID != blockID && len(podBlockSet.get(mergedID)) > 0); i++ {
+			mergedID = fmt.Sprintf("%s-%d", blockID, i)
+		}
+		if mergedID != blockID {
+			klog.Warningf("[qosaware-server-cpu] block id %s collides with a live block, use %s instead", blockID, mergedID)
+			_ = cs.emitter.StoreInt64(cs.genMetricsName(metricCPUServerBlockIDCollided), 1, metrics.MetricTypeNameCount)
+			// blocks in calculation results are referred to by inner blocks, so they are renamed as well
+			for _, ib := range internalBlocks {
+				ib.Block.BlockId = mergedID
+			}
+		}
+		bs[mergedID] = internalBlocks
+	}
+}
+
+// assemblyWarnings collects inconsistencies found in a single assembly, whose entries are skipped;
+// they are tolerated by default, and abort pushing advice in strict assembly mode.
+// All methods are no-ops for a nil receiver except logging, so that callers may omit it.
+type assemblyWarnings struct {
+	messages []string
+}
+
+// add records an inconsistency which has already been logged by the caller
+func (w *assemblyWarnings) add(message string) {
+	if w == nil {
+		return
+	}
+	w.messages = append(w.messages, message)
+}
+
+// warnf logs an inconsistency as warning and records it
+func (w *assemblyWarnings) warnf(format string, args ...interface{}) {
+	klog.Warningf(format, args...)
+	w.add(fmt.Sprintf(format, args...))
+}
+
+// blockAssemblyStat counts dedicated blocks reused by sidecars and newly created by the first container of pods
+type blockAssemblyStat struct {
+	reused  int
+	created int
+}
+
 func (cs *cpuServer) assembleDedicatedNUMABindingPodEntries(
 	advisorResp *types.InternalCPUCalculationResult,
 	calculationEntriesMap map[string]*cpuadvisor.CalculationEntries,
-	bs blockSet, podUID string, ci *types.ContainerInfo,
+	bs blockSet, stat *blockAssemblyStat, warnings *assemblyWarnings, podUID string, ci *types.ContainerInfo,
 ) error {
 	if !ci.IsDedicatedNumaBinding() {
 		return nil
@@ -870,6 +4916,28 @@ func (cs *cpuServer) assembleDedicatedNUMABindingPodEntries(
 		CalculationResultsByNumas: nil,
 	}
 
+	// dedicated numa binding containers without assignments are inconsistent, since they would yield no blocks
+	if len(ci.TopologyAwareAssignments) == 0 {
+		_ = cs.emitter.StoreInt64(cs.genMetricsName(metricCPUServerEmptyDedicatedAssignments), 1, metrics.MetricTypeNameCount,
+			metrics.MetricTag{Key: "policy", Val: string(cs.emptyDedicatedAssignmentsPolicy)})
+		if cs.emptyDedicatedAssignmentsPolicy != EmptyDedicatedAssignmentsPolicyFallbackPool {
+			warnings.warnf("[qosaware-server-cpu] dedicated numa binding container %s/%s has no assignments, skip it",
+				ci.PodUID, ci.ContainerName)
+			return nil
+		}
+
+		// leave CalculationResultsByNumas empty, so that qrm plugin places the container by its owner pool
+		klog.Warningf("[qosaware-server-cpu] dedicated numa binding container %s/%s has no assignments, fall back to pool %s",
+			ci.PodUID, ci.ContainerName, ci.OwnerPoolName)
+		if _, ok := calculationEntriesMap[podUID]; !ok {
+			calculationEntriesMap[podUID] = &cpuadvisor.CalculationEntries{
+				Entries: make(map[string]*cpuadvisor.CalculationInfo),
+			}
+		}
+		calculationEntriesMap[podUID].Entries[ci.ContainerName] = calculationInfo
+		return nil
+	}
+
 	calculationResultsByNumas := make(map[int64]*cpuadvisor.NumaCalculationResult)
 
 	for numaID, cpuset := range ci.TopologyAwareAssignments {
@@ -890,6 +4958,7 @@ func (cs *cpuServer) assembleDedicatedNUMABindingPodEntries(
 		// the same podUID appears twice iff there exists multiple containers in one pod;
 		// in this case, reuse the same blocks as the last container.
 		// i.e. sidecar container will always follow up with the main container.
+		reused := false
 		if podEntries, ok := calculationEntriesMap[podUID]; ok {
 			for _, containerEntry := range podEntries.Entries {
 				if result, ok := containerEntry.CalculationResultsByNumas[int64(numaID)]; ok {
@@ -901,19 +4970,32 @@ func (cs *cpuServer) assembleDedicatedNUMABindingPodEntries(
 						}, numaCalculationResult)
 						numaCalculationResult.Blocks = append(numaCalculationResult.Blocks, newBlock)
 						newInnerBlock.join(block.BlockId, bs)
+						stat.reused++
 					}
+					reused = true
 					break
 				}
 			}
-		} else {
-			// if this podUID appears firstly, we should generate a new Block
-			block := NewBlock(size, "")
+
+			// numas of sidecar should be a subset of those of the main container, otherwise it has no blocks
+			// to reuse on the divergent numa, and new blocks are generated for it instead
+			if !reused {
+				klog.Warningf("[qosaware-server-cpu] sidecar %s/%s is assigned numa %d which other containers of the pod are not, generate new blocks",
+					ci.PodUID, ci.ContainerName, numaID)
+				_ = cs.emitter.StoreInt64(cs.genMetricsName(metricCPUServerSidecarNUMAMismatch), 1, metrics.MetricTypeNameCount,
+					metrics.MetricTag{Key: "numa", Val: strconv.Itoa(numaID)})
+			}
+		}
+		if !reused {
+			// if this podUID appears firstly, or on this numa firstly, we should generate a new Block
+			block := cs.newBlock(bs, BlockIDKey{Owner: podUID, NUMAID: int64(numaID), Size: size})
 			innerBlock := NewInnerBlock(block, int64(numaID), "", &ContainerMeta{
 				PodUID:        ci.PodUID,
 				ContainerName: ci.ContainerName,
 			}, numaCalculationResult)
 			numaCalculationResult.Blocks = append(numaCalculationResult.Blocks, block)
 			innerBlock.join(block.BlockId, bs)
+			stat.created++
 		}
 
 		calculationResultsByNumas[int64(numaID)] = numaCalculationResult
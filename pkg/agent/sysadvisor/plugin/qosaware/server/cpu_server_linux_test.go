@@ -110,7 +110,11 @@ func TestCPUServerUpdate(t *testing.T) {
 				ExtraEntries: []*advisorsvc.CalculationInfo{
 					{
 						CalculationResult: &advisorsvc.CalculationResult{
-							Values: map[string]string{"cpu_numa_headroom": "{}"},
+							Values: map[string]string{
+								"cpu_numa_headroom":           "{}",
+								"cpu_numa_headroom_timestamp": "{}",
+								"cpu_node_headroom":           "0",
+							},
 						},
 					},
 					{
@@ -247,7 +251,11 @@ func TestCPUServerUpdate(t *testing.T) {
 				ExtraEntries: []*advisorsvc.CalculationInfo{
 					{
 						CalculationResult: &advisorsvc.CalculationResult{
-							Values: map[string]string{"cpu_numa_headroom": "{}"},
+							Values: map[string]string{
+								"cpu_numa_headroom":           "{}",
+								"cpu_numa_headroom_timestamp": "{}",
+								"cpu_node_headroom":           "0",
+							},
 						},
 					},
 					{
@@ -450,7 +458,11 @@ func TestCPUServerUpdate(t *testing.T) {
 				ExtraEntries: []*advisorsvc.CalculationInfo{
 					{
 						CalculationResult: &advisorsvc.CalculationResult{
-							Values: map[string]string{"cpu_numa_headroom": "{}"},
+							Values: map[string]string{
+								"cpu_numa_headroom":           "{}",
+								"cpu_numa_headroom_timestamp": "{}",
+								"cpu_node_headroom":           "0",
+							},
 						},
 					},
 					{
@@ -777,7 +789,11 @@ func TestCPUServerUpdate(t *testing.T) {
 				ExtraEntries: []*advisorsvc.CalculationInfo{
 					{
 						CalculationResult: &advisorsvc.CalculationResult{
-							Values: map[string]string{"cpu_numa_headroom": "{}"},
+							Values: map[string]string{
+								"cpu_numa_headroom":           "{}",
+								"cpu_numa_headroom_timestamp": "{}",
+								"cpu_node_headroom":           "0",
+							},
 						},
 					},
 					{
@@ -1102,7 +1118,11 @@ func TestCPUServerUpdate(t *testing.T) {
 				ExtraEntries: []*advisorsvc.CalculationInfo{
 					{
 						CalculationResult: &advisorsvc.CalculationResult{
-							Values: map[string]string{"cpu_numa_headroom": "{}"},
+							Values: map[string]string{
+								"cpu_numa_headroom":           "{}",
+								"cpu_numa_headroom_timestamp": "{}",
+								"cpu_node_headroom":           "0",
+							},
 						},
 					},
 					{
@@ -1248,7 +1268,11 @@ func TestCPUServerUpdate(t *testing.T) {
 				ExtraEntries: []*advisorsvc.CalculationInfo{
 					{
 						CalculationResult: &advisorsvc.CalculationResult{
-							Values: map[string]string{"cpu_numa_headroom": "{}"},
+							Values: map[string]string{
+								"cpu_numa_headroom":           "{}",
+								"cpu_numa_headroom_timestamp": "{}",
+								"cpu_node_headroom":           "0",
+							},
 						},
 					},
 					{
@@ -1393,7 +1417,11 @@ func TestCPUServerUpdate(t *testing.T) {
 				ExtraEntries: []*advisorsvc.CalculationInfo{
 					{
 						CalculationResult: &advisorsvc.CalculationResult{
-							Values: map[string]string{"cpu_numa_headroom": "{}"},
+							Values: map[string]string{
+								"cpu_numa_headroom":           "{}",
+								"cpu_numa_headroom_timestamp": "{}",
+								"cpu_node_headroom":           "0",
+							},
 						},
 					},
 					{
@@ -1454,7 +1482,8 @@ func TestCPUServerUpdate(t *testing.T) {
 		checkpoint.Entries[commonstate.PoolNameReserve] = &cpuadvisor.AllocationEntries{
 			Entries: map[string]*cpuadvisor.AllocationInfo{
 				commonstate.FakedContainerName: {
-					OwnerPoolName: commonstate.PoolNameReserve,
+					OwnerPoolName:            commonstate.PoolNameReserve,
+					TopologyAwareAssignments: map[uint64]string{0: "0"},
 				},
 			},
 		}
@@ -1485,7 +1514,7 @@ func TestCPUServerUpdate(t *testing.T) {
 		// populate MetaCache
 		for _, info := range tt.infos {
 			assert.NoError(t, cs.addContainer(info.request))
-			assert.NoError(t, cs.updateContainerInfo(info.request.PodUid, info.request.ContainerName, info.podInfo, info.allocationInfo))
+			assert.NoError(t, cs.updateContainerInfo(newQoSLevelResolver(cs.qosConf), info.request.PodUid, info.request.ContainerName, info.podInfo, info.allocationInfo, nil))
 
 			nodeInfo, _ := cs.metaCache.GetContainerInfo(info.request.PodUid, info.request.ContainerName)
 			nodeInfo.Isolated = info.isolated
@@ -1528,7 +1557,8 @@ func TestCPUServerUpdate(t *testing.T) {
 			Entries: map[string]*cpuadvisor.ContainerAllocationInfo{
 				commonstate.FakedContainerName: {
 					AllocationInfo: &cpuadvisor.AllocationInfo{
-						OwnerPoolName: commonstate.PoolNameReserve,
+						OwnerPoolName:            commonstate.PoolNameReserve,
+						TopologyAwareAssignments: map[uint64]string{0: "0"},
 					},
 				},
 			},
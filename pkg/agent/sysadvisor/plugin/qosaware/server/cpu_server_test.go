@@ -19,22 +19,40 @@ package server
 import (
 	"context"
 	"encoding/json"
+	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
 	"reflect"
 	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/metadata"
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	k8stypes "k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/rand"
 	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/klog/v2"
+	testingclock "k8s.io/utils/clock/testing"
 
 	"github.com/kubewharf/katalyst-api/pkg/consts"
 	"github.com/kubewharf/katalyst-core/cmd/katalyst-agent/app/options"
@@ -46,17 +64,28 @@ import (
 	"github.com/kubewharf/katalyst-core/pkg/agent/sysadvisor/metacache"
 	"github.com/kubewharf/katalyst-core/pkg/agent/sysadvisor/plugin/qosaware/reporter"
 	"github.com/kubewharf/katalyst-core/pkg/agent/sysadvisor/types"
+	"github.com/kubewharf/katalyst-core/pkg/agent/utilcomponent/featuregatenegotiation"
+	"github.com/kubewharf/katalyst-core/pkg/agent/utilcomponent/featuregatenegotiation/finders"
+	"github.com/kubewharf/katalyst-core/pkg/agent/utilcomponent/featuregatenegotiation/finders/feature_cpu"
 	"github.com/kubewharf/katalyst-core/pkg/config"
+	"github.com/kubewharf/katalyst-core/pkg/config/agent/global"
+	metaconfig "github.com/kubewharf/katalyst-core/pkg/config/agent/metaserver"
+	coreconsts "github.com/kubewharf/katalyst-core/pkg/consts"
 	"github.com/kubewharf/katalyst-core/pkg/metaserver"
 	"github.com/kubewharf/katalyst-core/pkg/metaserver/agent"
+	"github.com/kubewharf/katalyst-core/pkg/metaserver/agent/kubeletconfig"
 	"github.com/kubewharf/katalyst-core/pkg/metaserver/agent/metric"
+	"github.com/kubewharf/katalyst-core/pkg/metaserver/agent/node"
 	"github.com/kubewharf/katalyst-core/pkg/metaserver/agent/pod"
 	"github.com/kubewharf/katalyst-core/pkg/metrics"
 	metricspool "github.com/kubewharf/katalyst-core/pkg/metrics/metrics-pool"
+	"github.com/kubewharf/katalyst-core/pkg/util/general"
 	"github.com/kubewharf/katalyst-core/pkg/util/machine"
+	utilmetric "github.com/kubewharf/katalyst-core/pkg/util/metric"
+	"github.com/kubewharf/katalyst-core/pkg/util/native"
 )
 
-func generateTestConfiguration(t *testing.T) *config.Configuration {
+func generateTestConfiguration(t testing.TB) *config.Configuration {
 	conf, err := options.NewOptions().Config()
 	require.NoError(t, err)
 	require.NotNil(t, conf)
@@ -75,7 +104,7 @@ func generateTestConfiguration(t *testing.T) *config.Configuration {
 	return conf
 }
 
-func newTestCPUServer(t *testing.T, advisor subResourceAdvisor, podList []*v1.Pod) *cpuServer {
+func newTestCPUServer(t testing.TB, advisor subResourceAdvisor, podList []*v1.Pod) *cpuServer {
 	conf := generateTestConfiguration(t)
 	metricsFetcher := metric.NewFakeMetricsFetcher(metrics.DummyMetrics{})
 	metaCache, err := metacache.NewMetaCacheImp(conf, metricspool.DummyMetricsEmitterPool{}, metricsFetcher)
@@ -121,6 +150,31 @@ func TestCPUServerStartAndStop(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestCPUServerDebugHandlers(t *testing.T) {
+	cs := newTestCPUServer(t, nil, []*v1.Pod{})
+	// some handlers respond 404 by themselves without data, so registration is told by the body of http.NotFound
+	registered := func(name string) bool {
+		recorder := httptest.NewRecorder()
+		general.ServeDebugHandlers(recorder, httptest.NewRequest(http.MethodGet, general.DebugHandlerPathPrefix+name, nil))
+		return recorder.Body.String() != "404 page not found\n"
+	}
+
+	require.NotEmpty(t, cs.debugHandlers)
+	for name := range cs.debugHandlers {
+		require.False(t, registered(name), "handler %s is registered before start", name)
+	}
+
+	require.NoError(t, cs.Start())
+	for name := range cs.debugHandlers {
+		require.True(t, registered(name), "handler %s is not registered after start", name)
+	}
+
+	require.NoError(t, cs.Stop())
+	for name := range cs.debugHandlers {
+		require.False(t, registered(name), "handler %s is still registered after stop", name)
+	}
+}
+
 func TestCPUServerAddContainer(t *testing.T) {
 	t.Parallel()
 
@@ -285,12 +339,81 @@ func TestCPUServerRemovePod(t *testing.T) {
 type mockQRMCPUPluginServer struct {
 	checkpoint *cpuadvisor.GetCheckpointResponse
 	err        error
+	called     int32
 }
 
 func (m *mockQRMCPUPluginServer) GetCheckpoint(ctx context.Context, request *cpuadvisor.GetCheckpointRequest) (*cpuadvisor.GetCheckpointResponse, error) {
+	atomic.AddInt32(&m.called, 1)
 	return m.checkpoint, m.err
 }
 
+// fakeMetricEmitter records the latest value of each emitted int64 metric, with and without tags
+type fakeMetricEmitter struct {
+	metrics.DummyMetrics
+	mutex        sync.Mutex
+	values       map[string]int64
+	taggedValues map[string]int64
+}
+
+func newFakeMetricEmitter() *fakeMetricEmitter {
+	return &fakeMetricEmitter{values: make(map[string]int64), taggedValues: make(map[string]int64)}
+}
+
+func (f *fakeMetricEmitter) StoreInt64(key string, val int64, _ metrics.MetricTypeName, tags ...metrics.MetricTag) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.values[key] = val
+	f.taggedValues[fmt.Sprintf("%s%v", key, tags)] = val
+	return nil
+}
+
+func (f *fakeMetricEmitter) get(key string) (int64, bool) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	val, ok := f.values[key]
+	return val, ok
+}
+
+func (f *fakeMetricEmitter) getTagged(key string, tags ...metrics.MetricTag) (int64, bool) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	val, ok := f.taggedValues[fmt.Sprintf("%s%v", key, tags)]
+	return val, ok
+}
+
+type mockHeadroomResourceManager struct {
+	reporter.DummyHeadroomResourceManager
+	numaAllocatable map[int]resource.Quantity
+}
+
+func (m *mockHeadroomResourceManager) GetNumaAllocatable() (map[int]resource.Quantity, error) {
+	return m.numaAllocatable, nil
+}
+
+type mockTimestampedHeadroomResourceManager struct {
+	mockHeadroomResourceManager
+	numaTimestamps map[int]time.Time
+}
+
+func (m *mockTimestampedHeadroomResourceManager) GetNumaAllocatableTimestamp() (map[int]time.Time, error) {
+	return m.numaTimestamps, nil
+}
+
+type mockCPUPluginClient struct {
+	delay      time.Duration
+	checkpoint *cpuadvisor.GetCheckpointResponse
+	err        error
+}
+
+func (m *mockCPUPluginClient) GetCheckpoint(ctx context.Context, _ *cpuadvisor.GetCheckpointRequest, _ ...grpc.CallOption) (*cpuadvisor.GetCheckpointResponse, error) {
+	select {
+	case <-time.After(m.delay):
+		return m.checkpoint, m.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
 type mockCPUResourceAdvisor struct {
 	onUpdate  func()
 	provision *types.InternalCPUCalculationResult
@@ -307,6 +430,7 @@ func (m *mockCPUResourceAdvisor) UpdateAndGetAdvice() (interface{}, error) {
 type mockCPUServerService_ListAndWatchServer struct {
 	grpc.ServerStream
 	ResultsChan chan *cpuadvisor.ListAndWatchResponse
+	ctx         context.Context
 }
 
 func (_m *mockCPUServerService_ListAndWatchServer) Send(res *cpuadvisor.ListAndWatchResponse) error {
@@ -315,6 +439,9 @@ func (_m *mockCPUServerService_ListAndWatchServer) Send(res *cpuadvisor.ListAndW
 }
 
 func (_m *mockCPUServerService_ListAndWatchServer) Context() context.Context {
+	if _m.ctx != nil {
+		return _m.ctx
+	}
 	return context.TODO()
 }
 
@@ -360,17 +487,17 @@ func TestAssemblePodEntries(t *testing.T) {
 
 	cs := cpuServer{}
 	calcResult := map[string]*cpuadvisor.CalculationEntries{}
-	require.NoError(t, cs.assembleNormalPodEntries(calcResult, "11", &types.ContainerInfo{
+	require.ErrorIs(t, cs.assembleNormalPodEntries(calcResult, "11", &types.ContainerInfo{
 		OwnerPoolName: "",
 		QoSLevel:      consts.PodAnnotationQoSLevelSharedCores,
-	}), "failed to assemble container with empty pool name")
+	}), ErrEmptyOwnerPool, "container with empty pool name is not reported")
 	require.Equal(t, 0, len(calcResult), "empty pool container is added into calc results")
 
 	calcResult = map[string]*cpuadvisor.CalculationEntries{}
-	require.NoError(t, cs.assembleNormalPodEntries(calcResult, "11", &types.ContainerInfo{
+	require.ErrorIs(t, cs.assembleNormalPodEntries(calcResult, "11", &types.ContainerInfo{
 		OwnerPoolName: "",
 		QoSLevel:      consts.PodAnnotationQoSLevelReclaimedCores,
-	}), "failed to assemble container with empty pool name")
+	}), ErrEmptyOwnerPool, "container with empty pool name is not reported")
 	require.Equal(t, 0, len(calcResult), "empty pool container is added into calc results")
 
 	calcResult = map[string]*cpuadvisor.CalculationEntries{}
@@ -388,19 +515,19 @@ func TestAssemblePodEntries(t *testing.T) {
 	require.Equal(t, 1, len(calcResult), "dedicated pool container is ignored")
 
 	calcResult = map[string]*cpuadvisor.CalculationEntries{}
-	require.NoError(t, cs.assembleNormalPodEntries(calcResult, "11", &types.ContainerInfo{
+	require.ErrorIs(t, cs.assembleNormalPodEntries(calcResult, "11", &types.ContainerInfo{
 		OwnerPoolName:       "non-exist",
 		OriginOwnerPoolName: "non-exist",
 		QoSLevel:            consts.PodAnnotationQoSLevelSharedCores,
-	}), "failed to assemble container with non-exist pool name")
+	}), ErrPoolNotFound, "container with non-exist pool name is not reported")
 	require.Equal(t, 0, len(calcResult), "non-exist share pool container is added into calc results")
 
 	calcResult = map[string]*cpuadvisor.CalculationEntries{}
-	require.NoError(t, cs.assembleNormalPodEntries(calcResult, "11", &types.ContainerInfo{
+	require.ErrorIs(t, cs.assembleNormalPodEntries(calcResult, "11", &types.ContainerInfo{
 		OwnerPoolName:       "non-exist",
 		OriginOwnerPoolName: "non-exist",
 		QoSLevel:            consts.PodAnnotationQoSLevelReclaimedCores,
-	}), "failed to assemble container with non-exist pool name")
+	}), ErrPoolNotFound, "container with non-exist pool name is not reported")
 	require.Equal(t, 0, len(calcResult), "non-exist reclaiemd cores pool container is added into calc results")
 
 	calcResult = map[string]*cpuadvisor.CalculationEntries{}
@@ -871,3 +998,4995 @@ func TestCPUServerUpdateMetaCacheInput(t *testing.T) {
 		require.Equal(t, expectedPoolInfo, actualPoolInfo)
 	}
 }
+
+func TestCPUServerGetLWHealthDetail(t *testing.T) {
+	// the health check registry is global, so this test should not run in parallel with ListAndWatch tests
+
+	cs := newTestCPUServer(t, nil, []*v1.Pod{})
+
+	detail := cs.GetLWHealthDetail()
+	require.False(t, detail.Ready)
+	require.True(t, detail.LastSuccessTime.IsZero())
+	require.True(t, detail.LastErrorTime.IsZero())
+
+	general.RegisterTemporaryHeartbeatCheck(cpuServerLWHealthCheckName, healthCheckTolerationDuration, general.HealthzCheckStateNotReady, 0)
+	defer general.UnregisterTemporaryHeartbeatCheck(cpuServerLWHealthCheckName)
+
+	cs.updateLWHealthState(fmt.Errorf("get checkpoint failed"))
+	detail = cs.GetLWHealthDetail()
+	require.False(t, detail.Ready)
+	require.Equal(t, "get checkpoint failed", detail.Message)
+	require.Equal(t, "get checkpoint failed", detail.LastError)
+	require.False(t, detail.LastErrorTime.IsZero())
+	require.True(t, detail.LastSuccessTime.IsZero())
+
+	cs.updateLWHealthState(nil)
+	detail = cs.GetLWHealthDetail()
+	require.True(t, detail.Ready)
+	require.Equal(t, "get checkpoint failed", detail.LastError)
+	require.False(t, detail.LastSuccessTime.Before(detail.LastErrorTime))
+}
+
+func TestCPUServerFilterDeniedControlKnobs(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		deniedKeys []string
+		wantKeys   []string
+	}{
+		{
+			name:       "no denied keys",
+			deniedKeys: nil,
+			wantKeys: []string{
+				string(cpuadvisor.ControlKnobKeyCgroupConfig), string(cpuadvisor.ControlKnobKeyCPUNUMAHeadroom),
+				string(cpuadvisor.ControlKnobKeyCPUNUMAHeadroomTimestamp), string(cpuadvisor.ControlKnobKeyCPUNodeHeadroom),
+			},
+		},
+		{
+			name: "deny headroom",
+			deniedKeys: []string{
+				string(cpuadvisor.ControlKnobKeyCPUNUMAHeadroom), string(cpuadvisor.ControlKnobKeyCPUNUMAHeadroomTimestamp),
+				string(cpuadvisor.ControlKnobKeyCPUNodeHeadroom),
+			},
+			wantKeys: []string{string(cpuadvisor.ControlKnobKeyCgroupConfig)},
+		},
+		{
+			name: "deny all",
+			deniedKeys: []string{
+				string(cpuadvisor.ControlKnobKeyCPUNUMAHeadroom), string(cpuadvisor.ControlKnobKeyCPUNUMAHeadroomTimestamp),
+				string(cpuadvisor.ControlKnobKeyCPUNodeHeadroom), string(cpuadvisor.ControlKnobKeyCgroupConfig),
+			},
+			wantKeys: []string{},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			cs := newTestCPUServer(t, nil, []*v1.Pod{})
+			cs.deniedControlKnobKeys = sets.NewString(tt.deniedKeys...)
+
+			resp := cs.assembleResponse(&types.InternalCPUCalculationResult{
+				PoolEntries: map[string]map[int]types.CPUResource{
+					commonstate.PoolNameReclaim: {-1: {Size: 4, Quota: -1}},
+				},
+			})
+
+			gotKeys := []string{}
+			for _, entry := range resp.ExtraEntries {
+				require.NotEmpty(t, entry.CalculationResult.Values)
+				for key := range entry.CalculationResult.Values {
+					gotKeys = append(gotKeys, key)
+				}
+			}
+			assert.ElementsMatch(t, tt.wantKeys, gotKeys)
+		})
+	}
+}
+
+func TestCPUServerPushCycleDeadline(t *testing.T) {
+	// the health check registry is global, so this test should not run in parallel with ListAndWatch tests
+
+	cs := newTestCPUServer(t, nil, []*v1.Pod{})
+	cs.pushCycleDeadline = 10 * time.Millisecond
+	// the empty checkpoint is not retried, so that only the delay of the plugin counts against the deadline
+	cs.getCheckpointMaxAttempts = 1
+
+	general.RegisterTemporaryHeartbeatCheck(cpuServerLWHealthCheckName, healthCheckTolerationDuration, general.HealthzCheckStateNotReady, 0)
+	defer general.UnregisterTemporaryHeartbeatCheck(cpuServerLWHealthCheckName)
+
+	client := &mockCPUPluginClient{
+		checkpoint: &cpuadvisor.GetCheckpointResponse{Entries: map[string]*cpuadvisor.AllocationEntries{}},
+	}
+	s := &mockCPUServerService_ListAndWatchServer{ResultsChan: make(chan *cpuadvisor.ListAndWatchResponse)}
+
+	cs.runPushCycle([]cpuadvisor.CPUPluginClient{client}, s)
+	require.True(t, cs.GetLWHealthDetail().Ready)
+
+	// the cycle succeeds but exceeds the deadline
+	client.delay = 50 * time.Millisecond
+	cs.runPushCycle([]cpuadvisor.CPUPluginClient{client}, s)
+	detail := cs.GetLWHealthDetail()
+	require.False(t, detail.Ready)
+	require.Contains(t, detail.LastError, "exceeding deadline")
+}
+
+func TestCPUServerAssembleHeadroomClamped(t *testing.T) {
+	t.Parallel()
+
+	cs := newTestCPUServer(t, nil, []*v1.Pod{})
+	emitter := newFakeMetricEmitter()
+	cs.emitter = emitter
+	cs.metaServer.NumCPUs = 16
+	cs.maxHeadroomRatio = 0.5
+	cs.headroomResourceManager = &mockHeadroomResourceManager{
+		numaAllocatable: map[int]resource.Quantity{
+			0: resource.MustParse("12k"),
+			1: resource.MustParse("4k"),
+		},
+	}
+
+	// raw headroom of 16 cores exceeds the cap of 8 cores, and each numa is scaled down proportionally
+	info := cs.assembleHeadroom(nil)
+	require.NotNil(t, info)
+	numaHeadroom := cpuadvisor.CPUNUMAHeadroom{}
+	require.NoError(t, json.Unmarshal([]byte(info.CalculationResult.Values[string(cpuadvisor.ControlKnobKeyCPUNUMAHeadroom)]), &numaHeadroom))
+	require.Equal(t, cpuadvisor.CPUNUMAHeadroom{0: 6, 1: 2}, numaHeadroom)
+	clamped, ok := emitter.get(cs.genMetricsName(metricCPUServerHeadroomClamped))
+	require.True(t, ok)
+	require.Equal(t, int64(8000), clamped)
+
+	// headroom within the cap is kept as is
+	cs.maxHeadroomRatio = 1
+	info = cs.assembleHeadroom(nil)
+	require.NotNil(t, info)
+	numaHeadroom = cpuadvisor.CPUNUMAHeadroom{}
+	require.NoError(t, json.Unmarshal([]byte(info.CalculationResult.Values[string(cpuadvisor.ControlKnobKeyCPUNUMAHeadroom)]), &numaHeadroom))
+	require.Equal(t, cpuadvisor.CPUNUMAHeadroom{0: 12, 1: 4}, numaHeadroom)
+}
+
+func TestCPUServerAssembleHeadroomQuantity(t *testing.T) {
+	t.Parallel()
+
+	cs := newTestCPUServer(t, nil, []*v1.Pod{})
+	cs.headroomResourceManager = &mockHeadroomResourceManager{
+		numaAllocatable: map[int]resource.Quantity{
+			0: resource.MustParse("1500"),
+			1: resource.MustParse("3k"),
+		},
+	}
+
+	info := cs.assembleHeadroom(nil)
+	require.NotNil(t, info)
+	_, ok := info.CalculationResult.Values[string(cpuadvisor.ControlKnobKeyCPUNUMAHeadroomQuantity)]
+	require.False(t, ok, "quantity should not be reported by default")
+
+	cs.reportNUMAHeadroomQuantity = true
+	info = cs.assembleHeadroom(nil)
+	require.NotNil(t, info)
+
+	numaHeadroom := cpuadvisor.CPUNUMAHeadroom{}
+	require.NoError(t, json.Unmarshal([]byte(info.CalculationResult.Values[string(cpuadvisor.ControlKnobKeyCPUNUMAHeadroom)]), &numaHeadroom))
+	numaHeadroomQuantity := cpuadvisor.CPUNUMAHeadroomQuantity{}
+	require.NoError(t, json.Unmarshal([]byte(info.CalculationResult.Values[string(cpuadvisor.ControlKnobKeyCPUNUMAHeadroomQuantity)]), &numaHeadroomQuantity))
+
+	require.Equal(t, len(numaHeadroom), len(numaHeadroomQuantity))
+	for numaID, cores := range numaHeadroom {
+		q, err := resource.ParseQuantity(numaHeadroomQuantity[numaID])
+		require.NoError(t, err)
+		require.Equal(t, cores, float64(q.Value())/1000.0)
+	}
+	require.Equal(t, 3.0, numaHeadroom[1])
+}
+
+type flakyMetaCache struct {
+	metacache.MetaCache
+	setContainerFailures int
+}
+
+func (f *flakyMetaCache) SetContainerInfo(podUID string, containerName string, containerInfo *types.ContainerInfo) error {
+	if f.setContainerFailures > 0 {
+		f.setContainerFailures--
+		return fmt.Errorf("transient error")
+	}
+	return f.MetaCache.SetContainerInfo(podUID, containerName, containerInfo)
+}
+
+func TestCPUServerUpdateContainerInfoWithRetry(t *testing.T) {
+	t.Parallel()
+
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			UID: "pod1",
+			Annotations: map[string]string{
+				consts.PodAnnotationQoSLevelKey: consts.PodAnnotationQoSLevelSharedCores,
+			},
+		},
+	}
+	info := &cpuadvisor.AllocationInfo{OwnerPoolName: commonstate.PoolNameShare}
+
+	cs := newTestCPUServer(t, nil, []*v1.Pod{pod})
+	require.NoError(t, cs.metaCache.AddContainer("pod1", "c1", &types.ContainerInfo{
+		PodUID:        "pod1",
+		ContainerName: "c1",
+		QoSLevel:      consts.PodAnnotationQoSLevelSharedCores,
+	}))
+	mc := &flakyMetaCache{MetaCache: cs.metaCache}
+	cs.metaCache = mc
+
+	// no budget left, the transient error is returned
+	budget := 0
+	mc.setContainerFailures = 1
+	require.Error(t, cs.updateContainerInfoWithRetry(newQoSLevelResolver(cs.qosConf), "pod1", "c1", pod, info, &budget, nil))
+
+	// transient error succeeds on retry
+	budget = 2
+	mc.setContainerFailures = 1
+	require.NoError(t, cs.updateContainerInfoWithRetry(newQoSLevelResolver(cs.qosConf), "pod1", "c1", pod, info, &budget, nil))
+	require.Equal(t, 1, budget)
+	ci, ok := cs.metaCache.GetContainerInfo("pod1", "c1")
+	require.True(t, ok)
+	require.Equal(t, commonstate.PoolNameShare, ci.OwnerPoolName)
+
+	// permanent error is not retried
+	err := cs.updateContainerInfoWithRetry(newQoSLevelResolver(cs.qosConf), "pod1", "non-exist", pod, info, &budget, nil)
+	require.ErrorIs(t, err, errContainerNotExist)
+	require.Equal(t, 1, budget)
+}
+
+func TestCPUServerQoSConfSnapshot(t *testing.T) {
+	t.Parallel()
+
+	const legacyQoSKey = "legacy/qos-level"
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			UID:         "pod1",
+			Annotations: map[string]string{legacyQoSKey: "dedicated"},
+		},
+	}
+	info := &cpuadvisor.AllocationInfo{OwnerPoolName: commonstate.PoolNameShare}
+
+	cs := newTestCPUServer(t, nil, []*v1.Pod{pod})
+	require.NoError(t, cs.metaCache.AddContainer("pod1", "c1", &types.ContainerInfo{
+		PodUID:        "pod1",
+		ContainerName: "c1",
+		QoSLevel:      consts.PodAnnotationQoSLevelSharedCores,
+	}))
+
+	// config changes after the snapshot is taken, the cycle still uses the snapshot
+	qosConf := cs.snapshotQoSConf()
+	cs.qosConf.SetExpandQoSLevelSelector(consts.PodAnnotationQoSLevelDedicatedCores, map[string]string{legacyQoSKey: "dedicated"})
+	require.NoError(t, cs.updateContainerInfo(newQoSLevelResolver(qosConf), "pod1", "c1", pod, info, nil))
+	ci, ok := cs.metaCache.GetContainerInfo("pod1", "c1")
+	require.True(t, ok)
+	require.Equal(t, consts.PodAnnotationQoSLevelSharedCores, ci.QoSLevel)
+
+	// the next sync picks up the changed config
+	cs.syncCheckpoint(context.TODO(), &cpuadvisor.GetCheckpointResponse{
+		Entries: map[string]*cpuadvisor.AllocationEntries{
+			"pod1": {Entries: map[string]*cpuadvisor.AllocationInfo{"c1": info}},
+		},
+	}, 0)
+	ci, ok = cs.metaCache.GetContainerInfo("pod1", "c1")
+	require.True(t, ok)
+	require.Equal(t, consts.PodAnnotationQoSLevelDedicatedCores, ci.QoSLevel)
+}
+
+func TestCPUServerEmitOverlapMetrics(t *testing.T) {
+	t.Parallel()
+
+	cs := newTestCPUServer(t, nil, []*v1.Pod{})
+	emitter := newFakeMetricEmitter()
+	cs.emitter = emitter
+
+	for _, allowOverlap := range []bool{true, false} {
+		advisorResp := &types.InternalCPUCalculationResult{
+			PoolEntries: map[string]map[int]types.CPUResource{
+				commonstate.PoolNameShare:   {0: {Size: 4}, 1: {Size: 4}},
+				commonstate.PoolNameReclaim: {0: {Size: 2}, 1: {Size: 2}},
+			},
+			PoolOverlapInfo:                       map[string]map[int]map[string]int{},
+			AllowSharedCoresOverlapReclaimedCores: allowOverlap,
+		}
+		if allowOverlap {
+			advisorResp.SetPoolOverlapInfo(commonstate.PoolNameReclaim, 0, commonstate.PoolNameShare, 2)
+		}
+		cs.assembleResponse(advisorResp)
+
+		active, ok := emitter.get(cs.genMetricsName(metricCPUServerOverlapActive))
+		require.True(t, ok)
+		numaCount, ok := emitter.get(cs.genMetricsName(metricCPUServerOverlapActiveNUMACount))
+		require.True(t, ok)
+		if allowOverlap {
+			require.Equal(t, int64(1), active)
+			require.Equal(t, int64(1), numaCount)
+		} else {
+			require.Equal(t, int64(0), active)
+			require.Equal(t, int64(0), numaCount)
+		}
+	}
+}
+
+func TestCPUServerReconnectOnPluginSocketLost(t *testing.T) {
+	t.Parallel()
+
+	cs := newTestCPUServer(t, nil, []*v1.Pod{})
+	cs.period = 50 * time.Millisecond
+	cs.reconnectOnPluginSocketLost = true
+
+	startPluginServer := func() (*mockQRMCPUPluginServer, *grpc.Server) {
+		qrmServer := &mockQRMCPUPluginServer{
+			checkpoint: &cpuadvisor.GetCheckpointResponse{Entries: map[string]*cpuadvisor.AllocationEntries{}},
+		}
+		server := grpc.NewServer()
+		cpuadvisor.RegisterCPUPluginServer(server, qrmServer)
+		sock, err := net.Listen("unix", cs.pluginSocketPath)
+		require.NoError(t, err)
+		go func() {
+			_ = server.Serve(sock)
+		}()
+		return qrmServer, server
+	}
+
+	oldPluginServer, oldServer := startPluginServer()
+	defer oldServer.Stop()
+
+	s := &mockCPUServerService_ListAndWatchServer{ResultsChan: make(chan *cpuadvisor.ListAndWatchResponse)}
+	stop := make(chan struct{})
+	go func() {
+		assert.NoError(t, cs.ListAndWatch(&advisorsvc.Empty{}, s))
+		close(stop)
+	}()
+
+	require.Eventually(t, func() bool {
+		return atomic.LoadInt32(&oldPluginServer.called) > 0
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// remove the socket mid-stream while the old plugin server is still serving,
+	// and start a new plugin server at the same path
+	require.NoError(t, os.Remove(cs.pluginSocketPath))
+	newPluginServer, newServer := startPluginServer()
+	defer newServer.Stop()
+
+	require.Eventually(t, func() bool {
+		return atomic.LoadInt32(&newPluginServer.called) > 0
+	}, 5*time.Second, 10*time.Millisecond)
+
+	close(cs.stopCh)
+	<-stop
+}
+
+func TestCPUServerExcludeStaleContainers(t *testing.T) {
+	t.Parallel()
+
+	cs := newTestCPUServer(t, nil, []*v1.Pod{})
+	cs.containerInfoMaxAge = time.Minute
+
+	for _, podUID := range []string{"fresh-pod", "stale-pod", "untracked-pod"} {
+		require.NoError(t, cs.metaCache.AddContainer(podUID, "c1", &types.ContainerInfo{
+			PodUID:              podUID,
+			ContainerName:       "c1",
+			QoSLevel:            consts.PodAnnotationQoSLevelSharedCores,
+			OwnerPoolName:       commonstate.PoolNameShare,
+			OriginOwnerPoolName: commonstate.PoolNameShare,
+		}))
+	}
+	cs.recordContainerUpdateTime("fresh-pod", "c1")
+	cs.containerUpdateTime[ContainerMeta{PodUID: "stale-pod", ContainerName: "c1"}] = time.Now().Add(-2 * time.Minute)
+	cs.containerUpdateTime[ContainerMeta{PodUID: "removed-pod", ContainerName: "c1"}] = time.Now()
+
+	resp := cs.assembleResponse(&types.InternalCPUCalculationResult{
+		PoolEntries: map[string]map[int]types.CPUResource{
+			commonstate.PoolNameShare: {-1: {Size: 4}},
+		},
+	})
+
+	require.Contains(t, resp.Entries, "fresh-pod")
+	require.NotContains(t, resp.Entries, "stale-pod")
+	require.NotContains(t, resp.Entries, "untracked-pod")
+	require.NotContains(t, cs.containerUpdateTime, ContainerMeta{PodUID: "removed-pod", ContainerName: "c1"})
+
+	// all cached containers are assembled if max age is not set
+	cs.containerInfoMaxAge = 0
+	resp = cs.assembleResponse(&types.InternalCPUCalculationResult{
+		PoolEntries: map[string]map[int]types.CPUResource{
+			commonstate.PoolNameShare: {-1: {Size: 4}},
+		},
+	})
+	require.Contains(t, resp.Entries, "stale-pod")
+	require.Contains(t, resp.Entries, "untracked-pod")
+}
+
+func TestCPUServerMultiPluginFanOut(t *testing.T) {
+	t.Parallel()
+
+	cs := newTestCPUServer(t, nil, []*v1.Pod{})
+	emitter := newFakeMetricEmitter()
+	cs.emitter = emitter
+
+	newCheckpoint := func(podUID, poolName string) *cpuadvisor.GetCheckpointResponse {
+		return &cpuadvisor.GetCheckpointResponse{
+			Entries: map[string]*cpuadvisor.AllocationEntries{
+				podUID: {
+					Entries: map[string]*cpuadvisor.AllocationInfo{
+						"c1": {OwnerPoolName: poolName},
+					},
+				},
+			},
+		}
+	}
+
+	// the primary checkpoint takes precedence on conflicts
+	merged := cs.mergeCheckpoints([]*cpuadvisor.GetCheckpointResponse{
+		newCheckpoint("pod1", commonstate.PoolNameShare),
+		newCheckpoint("pod1", commonstate.PoolNameReclaim),
+		newCheckpoint("pod2", commonstate.PoolNameShare),
+	})
+	require.Len(t, merged.Entries, 2)
+	require.Equal(t, commonstate.PoolNameShare, merged.Entries["pod1"].Entries["c1"].OwnerPoolName)
+	require.Equal(t, commonstate.PoolNameShare, merged.Entries["pod2"].Entries["c1"].OwnerPoolName)
+	conflicted, ok := emitter.get(cs.genMetricsName(metricCPUServerCheckpointConflicted))
+	require.True(t, ok)
+	require.Equal(t, int64(1), conflicted)
+
+	// sync fails if any plugin fails to return its checkpoint
+	err := cs.getAndSyncCheckpoint(context.TODO(), []cpuadvisor.CPUPluginClient{
+		&mockCPUPluginClient{checkpoint: newCheckpoint("pod1", commonstate.PoolNameShare)},
+		&mockCPUPluginClient{err: fmt.Errorf("mock error")},
+	})
+	require.Error(t, err)
+
+	// a stream can only join while the loop is running
+	joined := &mockCPUServerService_ListAndWatchServer{ResultsChan: make(chan *cpuadvisor.ListAndWatchResponse, 1)}
+	require.Error(t, cs.joinListAndWatchLoop(joined))
+
+	loopDone := make(chan struct{})
+	cs.lwStreamsMutex.Lock()
+	cs.lwLoopDone = loopDone
+	cs.lwStreamsMutex.Unlock()
+
+	joinErr := make(chan error)
+	go func() {
+		joinErr <- cs.joinListAndWatchLoop(joined)
+	}()
+
+	primary := &mockCPUServerService_ListAndWatchServer{ResultsChan: make(chan *cpuadvisor.ListAndWatchResponse, 1)}
+	require.Eventually(t, func() bool {
+		return len(cs.getLWStreams(primary)) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+
+	close(loopDone)
+	require.Error(t, <-joinErr)
+	require.Len(t, cs.getLWStreams(primary), 1)
+}
+
+func TestCPUServerJoinListAndWatchLoopOnStart(t *testing.T) {
+	t.Parallel()
+
+	cs := newTestCPUServer(t, nil, []*v1.Pod{})
+	dir := t.TempDir()
+	cs.pluginSocketPaths = []string{path.Join(dir, "missing-a.sock"), path.Join(dir, "missing-b.sock")}
+	cs.pluginDialBackoffInitialInterval = 10 * time.Millisecond
+	cs.pluginDialBackoffMaxElapsedTime = time.Minute
+
+	// a running loop is always joinable, i.e. lwLoopDone is never missing while the loop flag is set
+	checkDone := make(chan struct{})
+	violated := make(chan struct{}, 1)
+	go func() {
+		for {
+			select {
+			case <-checkDone:
+				return
+			default:
+			}
+			cs.lwStreamsMutex.Lock()
+			if cs.hasListAndWatchLoop.Load().(bool) && cs.lwLoopDone == nil {
+				select {
+				case violated <- struct{}{}:
+				default:
+				}
+			}
+			cs.lwStreamsMutex.Unlock()
+		}
+	}()
+	defer close(checkDone)
+
+	// the loop keeps running while it is dialing the missing plugin sockets
+	primaryCtx, cancelPrimary := context.WithCancel(context.Background())
+	primary := &mockCPUServerService_ListAndWatchServer{ResultsChan: make(chan *cpuadvisor.ListAndWatchResponse), ctx: primaryCtx}
+	primaryErr := make(chan error)
+	go func() {
+		primaryErr <- cs.ListAndWatch(&advisorsvc.Empty{}, primary)
+	}()
+	require.Eventually(t, func() bool {
+		return cs.hasListAndWatchLoop.Load().(bool)
+	}, 5*time.Second, time.Millisecond)
+
+	joined := &mockCPUServerService_ListAndWatchServer{ResultsChan: make(chan *cpuadvisor.ListAndWatchResponse)}
+	joinErr := make(chan error)
+	go func() {
+		joinErr <- cs.ListAndWatch(&advisorsvc.Empty{}, joined)
+	}()
+	require.Eventually(t, func() bool {
+		return len(cs.getLWStreams(primary)) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+
+	cancelPrimary()
+	require.ErrorIs(t, <-primaryErr, errPluginSocketMissing)
+	require.ErrorContains(t, <-joinErr, "the running ListAndWatch loop exited")
+
+	cs.lwStreamsMutex.Lock()
+	require.False(t, cs.hasListAndWatchLoop.Load().(bool))
+	require.Nil(t, cs.lwLoopDone)
+	require.Empty(t, cs.lwStreams)
+	cs.lwStreamsMutex.Unlock()
+	require.Empty(t, violated)
+}
+
+func TestCPUServerSkipPushOnStaleSync(t *testing.T) {
+	t.Parallel()
+
+	cs := newTestCPUServer(t, nil, []*v1.Pod{})
+	emitter := newFakeMetricEmitter()
+	cs.emitter = emitter
+	cs.syncFreshnessWindow = time.Minute
+	require.NoError(t, cs.metaCache.SetPoolInfo(commonstate.PoolNameReserve, &types.PoolInfo{
+		PoolName:                 commonstate.PoolNameReserve,
+		TopologyAwareAssignments: map[int]machine.CPUSet{0: machine.NewCPUSet(0)},
+	}))
+
+	// the latest successful sync is out of the freshness window
+	cs.lastSyncSuccessTime = time.Now().Add(-2 * time.Minute)
+	require.Error(t, cs.checkAdviceGates())
+	skipped, ok := emitter.get(cs.genMetricsName(metricCPUServerSkipPushStaleSync))
+	require.True(t, ok)
+	require.Equal(t, int64(1), skipped)
+
+	// a successful sync makes pushing available again
+	require.NoError(t, cs.getAndSyncCheckpoint(context.TODO(), []cpuadvisor.CPUPluginClient{
+		&mockCPUPluginClient{checkpoint: &cpuadvisor.GetCheckpointResponse{
+			Entries: map[string]*cpuadvisor.AllocationEntries{
+				commonstate.PoolNameReserve: {
+					Entries: map[string]*cpuadvisor.AllocationInfo{
+						commonstate.FakedContainerName: {OwnerPoolName: commonstate.PoolNameReserve, TopologyAwareAssignments: map[uint64]string{0: "0"}},
+					},
+				},
+			},
+		}},
+	}))
+	require.NoError(t, cs.checkAdviceGates())
+}
+
+func TestCPUServerOverlapIneligibleContainer(t *testing.T) {
+	t.Parallel()
+
+	cs := newTestCPUServer(t, nil, []*v1.Pod{})
+	emitter := newFakeMetricEmitter()
+	cs.emitter = emitter
+
+	require.NoError(t, cs.metaCache.AddContainer("pod1", "c1", &types.ContainerInfo{
+		PodUID:              "pod1",
+		ContainerName:       "c1",
+		QoSLevel:            consts.PodAnnotationQoSLevelSharedCores,
+		OwnerPoolName:       "share-latency",
+		OriginOwnerPoolName: "share-latency",
+		Annotations: map[string]string{
+			coreconsts.PodAnnotationReclaimOverlapIneligibleKey: coreconsts.PodAnnotationReclaimOverlapIneligibleTrue,
+		},
+	}))
+
+	advisorResp := &types.InternalCPUCalculationResult{
+		PoolEntries: map[string]map[int]types.CPUResource{
+			commonstate.PoolNameShare:   {0: {Size: 4}},
+			"share-latency":             {0: {Size: 4}},
+			commonstate.PoolNameReclaim: {0: {Size: 2}},
+		},
+		PoolOverlapInfo:                       map[string]map[int]map[string]int{},
+		AllowSharedCoresOverlapReclaimedCores: true,
+	}
+	advisorResp.SetPoolOverlapInfo(commonstate.PoolNameReclaim, 0, commonstate.PoolNameShare, 2)
+	advisorResp.SetPoolOverlapInfo(commonstate.PoolNameReclaim, 0, "share-latency", 2)
+	resp := cs.assembleResponse(advisorResp)
+
+	blockIDs := func(poolName string) sets.String {
+		ids := sets.NewString()
+		for _, block := range resp.Entries[poolName].Entries[commonstate.FakedContainerName].CalculationResultsByNumas[0].Blocks {
+			ids.Insert(block.BlockId)
+		}
+		return ids
+	}
+	// shared blocks are split on overlapping, so all blocks of each pool are referred to
+	reclaimBlockIDs := blockIDs(commonstate.PoolNameReclaim)
+	require.True(t, reclaimBlockIDs.HasAny(blockIDs(commonstate.PoolNameShare).UnsortedList()...))
+	require.False(t, reclaimBlockIDs.HasAny(blockIDs("share-latency").UnsortedList()...))
+
+	excluded, ok := emitter.get(cs.genMetricsName(metricCPUServerOverlapExcludedContainers))
+	require.True(t, ok)
+	require.Equal(t, int64(1), excluded)
+}
+
+func TestCPUServerBlockReuseMetrics(t *testing.T) {
+	t.Parallel()
+
+	cs := newTestCPUServer(t, nil, []*v1.Pod{})
+	emitter := newFakeMetricEmitter()
+	cs.emitter = emitter
+
+	for _, containerName := range []string{"main", "sidecar"} {
+		require.NoError(t, cs.metaCache.AddContainer("pod1", containerName, &types.ContainerInfo{
+			PodUID:        "pod1",
+			ContainerName: containerName,
+			QoSLevel:      consts.PodAnnotationQoSLevelDedicatedCores,
+			Annotations: map[string]string{
+				consts.PodAnnotationMemoryEnhancementNumaBinding: consts.PodAnnotationMemoryEnhancementNumaBindingEnable,
+			},
+			OwnerPoolName: commonstate.PoolNameDedicated,
+			TopologyAwareAssignments: map[int]machine.CPUSet{
+				0: machine.MustParse("0-3"),
+				1: machine.MustParse("16-19"),
+			},
+		}))
+	}
+
+	cs.assembleResponse(&types.InternalCPUCalculationResult{
+		PoolEntries: map[string]map[int]types.CPUResource{},
+	})
+
+	// blocks are created by whichever container comes first, and reused by the other one
+	reused, ok := emitter.get(cs.genMetricsName(metricCPUServerBlocksReused))
+	require.True(t, ok)
+	require.Equal(t, int64(2), reused)
+	created, ok := emitter.get(cs.genMetricsName(metricCPUServerBlocksCreated))
+	require.True(t, ok)
+	require.Equal(t, int64(2), created)
+}
+
+func TestCPUServerSidecarNUMAMismatch(t *testing.T) {
+	t.Parallel()
+
+	cs := newTestCPUServer(t, nil, []*v1.Pod{})
+	emitter := newFakeMetricEmitter()
+	cs.emitter = emitter
+
+	newContainerInfo := func(containerName string, assignments map[int]machine.CPUSet) *types.ContainerInfo {
+		return &types.ContainerInfo{
+			PodUID:        "pod1",
+			ContainerName: containerName,
+			QoSLevel:      consts.PodAnnotationQoSLevelDedicatedCores,
+			Annotations: map[string]string{
+				consts.PodAnnotationMemoryEnhancementNumaBinding: consts.PodAnnotationMemoryEnhancementNumaBindingEnable,
+			},
+			OwnerPoolName:            commonstate.PoolNameDedicated,
+			TopologyAwareAssignments: assignments,
+		}
+	}
+	advisorResp := &types.InternalCPUCalculationResult{PoolEntries: map[string]map[int]types.CPUResource{}}
+	calculationEntriesMap := make(map[string]*cpuadvisor.CalculationEntries)
+	bs := NewBlockSet()
+	stat := &blockAssemblyStat{}
+
+	// the sidecar is pinned to numa 1 besides numa 0 of its main container
+	require.NoError(t, cs.assembleDedicatedNUMABindingPodEntries(advisorResp, calculationEntriesMap, bs, stat, nil, "pod1",
+		newContainerInfo("main", map[int]machine.CPUSet{0: machine.MustParse("0-3")})))
+	require.NoError(t, cs.assembleDedicatedNUMABindingPodEntries(advisorResp, calculationEntriesMap, bs, stat, nil, "pod1",
+		newContainerInfo("sidecar", map[int]machine.CPUSet{0: machine.MustParse("0-3"), 1: machine.MustParse("16-17")})))
+
+	// blocks of the shared numa are reused, and new blocks are generated for the divergent numa
+	mainResults := calculationEntriesMap["pod1"].Entries["main"].CalculationResultsByNumas
+	sidecarResults := calculationEntriesMap["pod1"].Entries["sidecar"].CalculationResultsByNumas
+	require.Len(t, sidecarResults[0].Blocks, 1)
+	require.Equal(t, mainResults[0].Blocks[0].BlockId, sidecarResults[0].Blocks[0].BlockId)
+	require.Len(t, sidecarResults[1].Blocks, 1)
+	require.Equal(t, uint64(2), sidecarResults[1].Blocks[0].Result)
+	require.Equal(t, 1, stat.reused)
+	require.Equal(t, 2, stat.created)
+
+	mismatch, ok := emitter.getTagged(cs.genMetricsName(metricCPUServerSidecarNUMAMismatch), metrics.MetricTag{Key: "numa", Val: "1"})
+	require.True(t, ok)
+	require.Equal(t, int64(1), mismatch)
+	_, ok = emitter.getTagged(cs.genMetricsName(metricCPUServerSidecarNUMAMismatch), metrics.MetricTag{Key: "numa", Val: "0"})
+	require.False(t, ok)
+}
+
+// newTestNUMABindingNode returns a cpu server on a simulated node of 2 numas with 64 cpus each, on which there are
+// the given number of dedicated numa binding pods, each of a main container and a sidecar, and the advisor result
+func newTestNUMABindingNode(t testing.TB, podCount, workers int) (*cpuServer, *types.InternalCPUCalculationResult) {
+	cs := newTestCPUServer(t, nil, []*v1.Pod{})
+	cpuTopology, err := machine.GenerateDummyCPUTopology(128, 2, 2)
+	require.NoError(t, err)
+	cs.metaServer.KatalystMachineInfo = &machine.KatalystMachineInfo{CPUTopology: cpuTopology}
+	cs.blockIDGenerator = NewDeterministicBlockIDGenerator()
+	cs.podEntryAssemblyWorkers = workers
+
+	advisorResp := &types.InternalCPUCalculationResult{
+		PoolEntries: map[string]map[int]types.CPUResource{
+			commonstate.PoolNameReserve: {0: {Size: 2}, 1: {Size: 2}},
+			commonstate.PoolNameShare:   {0: {Size: 8}, 1: {Size: 8}},
+			commonstate.PoolNameReclaim: {0: {Size: 4}, 1: {Size: 4}},
+		},
+		PoolOverlapInfo:             map[string]map[int]map[string]int{},
+		PoolOverlapPodContainerInfo: map[string]map[int]map[string]map[string]int{},
+	}
+	for i := 0; i < podCount; i++ {
+		podUID := fmt.Sprintf("pod%d", i)
+		numaID := i % 2
+		assignments := map[int]machine.CPUSet{numaID: machine.NewCPUSet(numaID*64 + i/2%64)}
+		for _, containerName := range []string{"main", "sidecar"} {
+			require.NoError(t, cs.metaCache.AddContainer(podUID, containerName, &types.ContainerInfo{
+				PodUID:        podUID,
+				ContainerName: containerName,
+				QoSLevel:      consts.PodAnnotationQoSLevelDedicatedCores,
+				Annotations: map[string]string{
+					consts.PodAnnotationMemoryEnhancementNumaBinding: consts.PodAnnotationMemoryEnhancementNumaBindingEnable,
+				},
+				OwnerPoolName:            commonstate.PoolNameDedicated,
+				TopologyAwareAssignments: assignments,
+			}))
+		}
+		if i%4 == 0 {
+			advisorResp.SetPoolOverlapPodContainerInfo(commonstate.PoolNameReclaim, numaID, podUID, "main", 1)
+		}
+	}
+	return cs, advisorResp
+}
+
+func TestCPUServerAssembleDedicatedNUMABindingPodEntriesInParallel(t *testing.T) {
+	t.Parallel()
+
+	// entries assembled in parallel are identical with those assembled serially, regardless of the order
+	// of blocks and overlap targets, which follows map iteration even if assembled serially
+	serialServer, advisorResp := newTestNUMABindingNode(t, 40, 1)
+	want, err := DeepCopyResponse(&cpuadvisor.ListAndWatchResponse{Entries: serialServer.assembleResponse(advisorResp).Entries})
+	require.NoError(t, err)
+	parallelServer, advisorResp := newTestNUMABindingNode(t, 40, 8)
+	emitter := newFakeMetricEmitter()
+	parallelServer.emitter = emitter
+	got, err := DeepCopyResponse(&cpuadvisor.ListAndWatchResponse{Entries: parallelServer.assembleResponse(advisorResp).Entries})
+	require.NoError(t, err)
+	require.Equal(t, want, got)
+	for name, want := range map[string]int64{metricCPUServerBlocksCreated: 40, metricCPUServerBlocksReused: 40} {
+		value, ok := emitter.get(parallelServer.genMetricsName(name))
+		require.True(t, ok)
+		require.Equal(t, want, value, name)
+	}
+
+	// blocks colliding with those of pods merged earlier are given new ids along with their references
+	bs := NewBlockSet()
+	live := NewBlock(2, "block")
+	NewInnerBlock(live, 0, "", &ContainerMeta{PodUID: "pod1", ContainerName: "main"}, nil).join(live.BlockId, bs)
+	podBlockSet := NewBlockSet()
+	main, sidecar := NewBlock(4, "block"), NewBlock(4, "block")
+	NewInnerBlock(main, 0, "", &ContainerMeta{PodUID: "pod2", ContainerName: "main"}, nil).join(main.BlockId, podBlockSet)
+	NewInnerBlock(sidecar, 0, "", &ContainerMeta{PodUID: "pod2", ContainerName: "sidecar"}, nil).join(sidecar.BlockId, podBlockSet)
+	parallelServer.mergePodBlockSet(bs, podBlockSet)
+	require.Equal(t, "block-2", main.BlockId)
+	require.Equal(t, "block-2", sidecar.BlockId)
+	require.Len(t, bs.get("block"), 1)
+	require.Len(t, bs.get("block-2"), 2)
+}
+
+// BenchmarkCPUServerAssembleResponse benchmarks assembly on a simulated node of 200 dedicated numa binding pods
+func BenchmarkCPUServerAssembleResponse(b *testing.B) {
+	klog.SetOutput(io.Discard)
+	klog.LogToStderr(false)
+	defer klog.LogToStderr(true)
+
+	for _, workers := range []int{1, 4, 16} {
+		b.Run(fmt.Sprintf("workers-%d", workers), func(b *testing.B) {
+			cs, advisorResp := newTestNUMABindingNode(b, 200, workers)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				cs.assembleResponse(advisorResp)
+			}
+		})
+	}
+}
+
+func TestCPUServerAssembleHeadroomNUMAKeyFormat(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		format   cpuadvisor.NUMAKeyFormat
+		wantKeys []string
+	}{
+		{
+			name:     "plain",
+			format:   cpuadvisor.NUMAKeyFormatPlain,
+			wantKeys: []string{"1", "10"},
+		},
+		{
+			name:     "zero padded",
+			format:   cpuadvisor.NUMAKeyFormatZeroPadded,
+			wantKeys: []string{"01", "10"},
+		},
+		{
+			name:     "prefixed",
+			format:   cpuadvisor.NUMAKeyFormatPrefixed,
+			wantKeys: []string{"numa1", "numa10"},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			cs := newTestCPUServer(t, nil, []*v1.Pod{})
+			cs.headroomNUMAKeyFormat = tt.format
+			cs.reportNUMAHeadroomQuantity = true
+			cs.headroomResourceManager = &mockHeadroomResourceManager{
+				numaAllocatable: map[int]resource.Quantity{
+					1:  resource.MustParse("1"),
+					10: resource.MustParse("2"),
+				},
+			}
+
+			info := cs.assembleHeadroom(nil)
+			require.NotNil(t, info)
+			for _, key := range []cpuadvisor.CPUControlKnobName{
+				cpuadvisor.ControlKnobKeyCPUNUMAHeadroom,
+				cpuadvisor.ControlKnobKeyCPUNUMAHeadroomQuantity,
+			} {
+				payload := map[string]interface{}{}
+				require.NoError(t, json.Unmarshal([]byte(info.CalculationResult.Values[string(key)]), &payload))
+				gotKeys := make([]string, 0, len(payload))
+				for numaKey := range payload {
+					gotKeys = append(gotKeys, numaKey)
+				}
+				assert.ElementsMatch(t, tt.wantKeys, gotKeys)
+			}
+		})
+	}
+
+	_, err := cpuadvisor.FormatNUMAKey("unknown", 0)
+	require.Error(t, err)
+}
+
+func TestCPUServerMinReadySuccessCycles(t *testing.T) {
+	// the health check registry is global, so this test should not run in parallel with ListAndWatch tests
+
+	cs := newTestCPUServer(t, nil, []*v1.Pod{})
+	cs.minReadySuccessCycles = 3
+
+	general.RegisterTemporaryHeartbeatCheck(cpuServerLWHealthCheckName, healthCheckTolerationDuration, general.HealthzCheckStateNotReady, 0)
+	defer general.UnregisterTemporaryHeartbeatCheck(cpuServerLWHealthCheckName)
+
+	cs.updateLWHealthState(nil)
+	cs.updateLWHealthState(nil)
+	require.False(t, cs.GetLWHealthDetail().Ready)
+
+	// a failure within the warmup resets the counting
+	cs.updateLWHealthState(fmt.Errorf("get checkpoint failed"))
+	cs.updateLWHealthState(nil)
+	cs.updateLWHealthState(nil)
+	detail := cs.GetLWHealthDetail()
+	require.False(t, detail.Ready)
+	require.Equal(t, 2, detail.ConsecutiveSuccesses)
+
+	cs.updateLWHealthState(nil)
+	detail = cs.GetLWHealthDetail()
+	require.True(t, detail.Ready)
+	require.Equal(t, 3, detail.ConsecutiveSuccesses)
+}
+
+func TestCPUServerServeCPUAssignments(t *testing.T) {
+	t.Parallel()
+
+	cs := newTestCPUServer(t, nil, []*v1.Pod{})
+	ci := &types.ContainerInfo{
+		PodUID:        "pod1",
+		PodNamespace:  "default",
+		PodName:       "pod1",
+		ContainerName: "c1",
+		QoSLevel:      consts.PodAnnotationQoSLevelSharedCores,
+		OwnerPoolName: commonstate.PoolNameShare,
+		TopologyAwareAssignments: map[int]machine.CPUSet{
+			0: machine.MustParse("0-3,8"),
+			1: machine.MustParse("16-19"),
+		},
+	}
+	require.NoError(t, cs.metaCache.AddContainer(ci.PodUID, ci.ContainerName, ci))
+
+	recorder := httptest.NewRecorder()
+	cs.serveCPUAssignments(recorder, httptest.NewRequest(http.MethodGet, general.DebugHandlerPathPrefix+cpuServerAssignmentsDebugHandlerName, nil))
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	assignments := map[string]map[string]ContainerCPUAssignment{}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &assignments))
+	assignment := assignments[ci.PodUID][ci.ContainerName]
+	require.Equal(t, "0-3,8,16-19", assignment.CPUSet)
+	require.Len(t, assignment.CPUSetByNUMA, len(ci.TopologyAwareAssignments))
+	for numaID, cpuset := range ci.TopologyAwareAssignments {
+		parsed, err := machine.Parse(assignment.CPUSetByNUMA[numaID])
+		require.NoError(t, err)
+		require.True(t, cpuset.Equals(parsed))
+	}
+}
+
+func TestCPUServerAdvicePushWindow(t *testing.T) {
+	t.Parallel()
+
+	cs := newTestCPUServer(t, nil, []*v1.Pod{})
+	emitter := newFakeMetricEmitter()
+	cs.emitter = emitter
+	require.NoError(t, cs.metaCache.SetPoolInfo(commonstate.PoolNameReserve, &types.PoolInfo{
+		PoolName:                 commonstate.PoolNameReserve,
+		TopologyAwareAssignments: map[int]machine.CPUSet{0: machine.NewCPUSet(0)},
+	}))
+
+	// the window crosses midnight
+	pushWindow, err := parseDailyTimeWindow("22:00-02:00")
+	require.NoError(t, err)
+	cs.pushWindow = pushWindow
+
+	tests := []struct {
+		name       string
+		now        time.Time
+		wantPushed bool
+	}{
+		{
+			name:       "in window before midnight",
+			now:        time.Date(2024, 1, 1, 23, 30, 0, 0, time.Local),
+			wantPushed: true,
+		},
+		{
+			name:       "in window after midnight",
+			now:        time.Date(2024, 1, 2, 1, 59, 0, 0, time.Local),
+			wantPushed: true,
+		},
+		{
+			name:       "out of window",
+			now:        time.Date(2024, 1, 2, 12, 0, 0, 0, time.Local),
+			wantPushed: false,
+		},
+		{
+			name:       "window end is exclusive",
+			now:        time.Date(2024, 1, 2, 2, 0, 0, 0, time.Local),
+			wantPushed: false,
+		},
+	}
+	for _, tt := range tests {
+		cs.clock = testingclock.NewFakeClock(tt.now)
+		require.Equal(t, tt.wantPushed, cs.checkAdviceGates() == nil, tt.name)
+	}
+
+	skipped, ok := emitter.get(cs.genMetricsName(metricCPUServerSkipPushOutOfWindow))
+	require.True(t, ok)
+	require.Equal(t, int64(1), skipped)
+
+	_, err = parseDailyTimeWindow("22:00")
+	require.Error(t, err)
+
+	// GetAdvice out of window fails without updating advisor, so that the plugin keeps its current allocation
+	var updated int32
+	advisor := &mockCPUResourceAdvisor{
+		onUpdate: func() {
+			atomic.AddInt32(&updated, 1)
+		},
+		provision: &types.InternalCPUCalculationResult{
+			PoolEntries: map[string]map[int]types.CPUResource{
+				commonstate.PoolNameReserve: {0: {Size: 1}},
+			},
+		},
+	}
+	cs = newTestCPUServer(t, advisor, []*v1.Pod{})
+	cs.emitter = newFakeMetricEmitter()
+	cs.pushWindow = pushWindow
+	request := &cpuadvisor.GetAdviceRequest{
+		Entries: map[string]*cpuadvisor.ContainerAllocationInfoEntries{
+			commonstate.PoolNameReserve: {
+				Entries: map[string]*cpuadvisor.ContainerAllocationInfo{
+					commonstate.FakedContainerName: {AllocationInfo: &cpuadvisor.AllocationInfo{
+						OwnerPoolName: commonstate.PoolNameReserve, TopologyAwareAssignments: map[uint64]string{0: "0"},
+					}},
+				},
+			},
+		},
+	}
+	cs.clock = testingclock.NewFakeClock(time.Date(2024, 1, 2, 12, 0, 0, 0, time.Local))
+	resp, err := cs.GetAdvice(context.TODO(), request)
+	require.Error(t, err)
+	require.Nil(t, resp)
+	require.Equal(t, int32(0), atomic.LoadInt32(&updated))
+
+	cs.clock = testingclock.NewFakeClock(time.Date(2024, 1, 1, 23, 30, 0, 0, time.Local))
+	resp, err = cs.GetAdvice(context.TODO(), request)
+	require.NoError(t, err)
+	require.NotNil(t, resp)
+	require.Equal(t, int32(1), atomic.LoadInt32(&updated))
+}
+
+func TestCPUServerPlacementReasons(t *testing.T) {
+	t.Parallel()
+
+	cs := newTestCPUServer(t, nil, []*v1.Pod{})
+	isolationPoolName := commonstate.PoolNamePrefixIsolation + "0"
+
+	containers := []*types.ContainerInfo{
+		{
+			PodUID:              "isolated-pod",
+			ContainerName:       "c1",
+			QoSLevel:            consts.PodAnnotationQoSLevelSharedCores,
+			OwnerPoolName:       commonstate.PoolNameShare,
+			OriginOwnerPoolName: commonstate.PoolNameShare,
+			Isolated:            true,
+			RegionNames:         sets.NewString(isolationPoolName),
+		},
+		{
+			PodUID:              "deisolated-pod",
+			ContainerName:       "c1",
+			QoSLevel:            consts.PodAnnotationQoSLevelSharedCores,
+			OwnerPoolName:       isolationPoolName,
+			OriginOwnerPoolName: commonstate.PoolNameShare,
+		},
+		{
+			PodUID:              "normal-pod",
+			ContainerName:       "c1",
+			QoSLevel:            consts.PodAnnotationQoSLevelSharedCores,
+			OwnerPoolName:       commonstate.PoolNameShare,
+			OriginOwnerPoolName: commonstate.PoolNameShare,
+		},
+	}
+	for _, ci := range containers {
+		require.NoError(t, cs.metaCache.AddContainer(ci.PodUID, ci.ContainerName, ci))
+	}
+
+	resp := cs.assembleResponse(&types.InternalCPUCalculationResult{
+		PoolEntries: map[string]map[int]types.CPUResource{
+			commonstate.PoolNameShare: {-1: {Size: 4}},
+			isolationPoolName:         {-1: {Size: 2}},
+		},
+	})
+
+	expected := map[string]struct {
+		ownerPoolName string
+		reason        PlacementReason
+	}{
+		"isolated-pod":   {isolationPoolName, PlacementReasonIsolationLockIn},
+		"deisolated-pod": {commonstate.PoolNameShare, PlacementReasonIsolationLockOut},
+		"normal-pod":     {commonstate.PoolNameShare, PlacementReasonOwnerPool},
+	}
+	for podUID, want := range expected {
+		require.Equal(t, want.ownerPoolName, resp.Entries[podUID].Entries["c1"].OwnerPoolName, podUID)
+		require.Equal(t, want.reason, resp.PlacementReasons[podUID]["c1"], podUID)
+	}
+}
+
+func TestCPUServerContainerGCCapPerCycle(t *testing.T) {
+	t.Parallel()
+
+	cs := newTestCPUServer(t, nil, []*v1.Pod{})
+	emitter := newFakeMetricEmitter()
+	cs.emitter = emitter
+	cs.containerGCCapPerCycle = 2
+
+	podUIDs := []string{"pod1", "pod2", "pod3", "pod4", "pod5"}
+	for _, podUID := range podUIDs {
+		require.NoError(t, cs.metaCache.AddContainer(podUID, "c1", &types.ContainerInfo{
+			PodUID:              podUID,
+			ContainerName:       "c1",
+			QoSLevel:            consts.PodAnnotationQoSLevelSharedCores,
+			OwnerPoolName:       commonstate.PoolNameShare,
+			OriginOwnerPoolName: commonstate.PoolNameShare,
+		}))
+	}
+	// pod4 and pod5 have been absent for a while
+	cs.containerAbsentSince[ContainerMeta{PodUID: "pod4", ContainerName: "c1"}] = time.Now().Add(-time.Minute)
+	cs.containerAbsentSince[ContainerMeta{PodUID: "pod5", ContainerName: "c1"}] = time.Now().Add(-2 * time.Minute)
+
+	cachedPodUIDs := func() []string {
+		var result []string
+		cs.metaCache.RangeContainer(func(podUID string, _ string, _ *types.ContainerInfo) bool {
+			result = append(result, podUID)
+			return true
+		})
+		return result
+	}
+
+	// all containers disappear at once
+	emptyCheckpoint := &cpuadvisor.GetCheckpointResponse{Entries: map[string]*cpuadvisor.AllocationEntries{}}
+	cs.syncCheckpoint(context.TODO(), emptyCheckpoint, 0)
+	assert.ElementsMatch(t, []string{"pod1", "pod2", "pod3"}, cachedPodUIDs())
+	deferred, ok := emitter.get(cs.genMetricsName(metricCPUServerContainerGCDeferred))
+	require.True(t, ok)
+	require.Equal(t, int64(3), deferred)
+
+	cs.syncCheckpoint(context.TODO(), emptyCheckpoint, 0)
+	require.Len(t, cachedPodUIDs(), 1)
+	deferred, _ = emitter.get(cs.genMetricsName(metricCPUServerContainerGCDeferred))
+	require.Equal(t, int64(1), deferred)
+
+	cs.syncCheckpoint(context.TODO(), emptyCheckpoint, 0)
+	require.Empty(t, cachedPodUIDs())
+}
+
+func TestCPUServerDisableGC(t *testing.T) {
+	t.Parallel()
+
+	cs := newTestCPUServer(t, nil, []*v1.Pod{})
+	emitter := newFakeMetricEmitter()
+	cs.emitter = emitter
+	cs.disableGC = true
+
+	require.NoError(t, cs.metaCache.AddContainer("pod1", "c1", &types.ContainerInfo{
+		PodUID:              "pod1",
+		ContainerName:       "c1",
+		QoSLevel:            consts.PodAnnotationQoSLevelSharedCores,
+		OwnerPoolName:       commonstate.PoolNameShare,
+		OriginOwnerPoolName: commonstate.PoolNameShare,
+	}))
+	require.NoError(t, cs.metaCache.SetPoolInfo("batch", &types.PoolInfo{PoolName: "batch"}))
+
+	// neither containers nor pools are deleted when gc is disabled
+	emptyCheckpoint := &cpuadvisor.GetCheckpointResponse{Entries: map[string]*cpuadvisor.AllocationEntries{}}
+	cs.syncCheckpoint(context.TODO(), emptyCheckpoint, 0)
+	_, ok := cs.metaCache.GetContainerInfo("pod1", "c1")
+	require.True(t, ok)
+	_, ok = cs.metaCache.GetPoolInfo("batch")
+	require.True(t, ok)
+	disabled, ok := emitter.get(cs.genMetricsName(metricCPUServerGCDisabled))
+	require.True(t, ok)
+	require.Equal(t, int64(1), disabled)
+
+	require.NoError(t, cs.updateMetaCacheInput(context.TODO(), &cpuadvisor.GetAdviceRequest{
+		Entries: map[string]*cpuadvisor.ContainerAllocationInfoEntries{},
+	}))
+	_, ok = cs.metaCache.GetContainerInfo("pod1", "c1")
+	require.True(t, ok)
+	_, ok = cs.metaCache.GetPoolInfo("batch")
+	require.True(t, ok)
+
+	// everything absent is cleaned up once gc is enabled again
+	cs.disableGC = false
+	cs.syncCheckpoint(context.TODO(), emptyCheckpoint, 0)
+	_, ok = cs.metaCache.GetContainerInfo("pod1", "c1")
+	require.False(t, ok)
+	_, ok = cs.metaCache.GetPoolInfo("batch")
+	require.False(t, ok)
+}
+
+func TestCPUServerAssembleBlockCPUList(t *testing.T) {
+	t.Parallel()
+
+	cs := newTestCPUServer(t, nil, []*v1.Pod{})
+	require.NoError(t, cs.metaCache.SetPoolInfo(commonstate.PoolNameShare, &types.PoolInfo{
+		PoolName: commonstate.PoolNameShare,
+		TopologyAwareAssignments: map[int]machine.CPUSet{
+			0: machine.MustParse("0-3"),
+			1: machine.MustParse("16-19"),
+		},
+	}))
+	require.NoError(t, cs.metaCache.SetPoolInfo("batch", &types.PoolInfo{
+		PoolName: "batch",
+		TopologyAwareAssignments: map[int]machine.CPUSet{
+			0: machine.MustParse("4-5"),
+		},
+	}))
+
+	advisorResp := &types.InternalCPUCalculationResult{
+		PoolEntries: map[string]map[int]types.CPUResource{
+			commonstate.PoolNameShare: {commonstate.FakedNUMAID: {Size: 8}},
+			// batch pool is resized, so its current cpus can not be carried
+			"batch": {commonstate.FakedNUMAID: {Size: 4}},
+		},
+	}
+	getBlockCPUList := func(resp *cpuInternalResult) (cpuadvisor.CPUBlockCPUList, bool) {
+		for _, entry := range resp.ExtraEntries {
+			if value, ok := entry.CalculationResult.Values[string(cpuadvisor.ControlKnobKeyCPUBlockCPUList)]; ok {
+				blockCPUList := cpuadvisor.CPUBlockCPUList{}
+				require.NoError(t, json.Unmarshal([]byte(value), &blockCPUList))
+				return blockCPUList, true
+			}
+		}
+		return nil, false
+	}
+
+	// size-based blocks only by default
+	_, ok := getBlockCPUList(cs.assembleResponse(advisorResp))
+	require.False(t, ok)
+
+	require.NoError(t, cs.metaCache.SetSupportedWantedFeatureGates(map[string]*advisorsvc.FeatureGate{
+		feature_cpu.NegotiationFeatureGateExplicitCPUList: {
+			Name: feature_cpu.NegotiationFeatureGateExplicitCPUList,
+			Type: finders.FeatureGateTypeCPU,
+		},
+	}))
+	resp := cs.assembleResponse(advisorResp)
+	blockCPUList, ok := getBlockCPUList(resp)
+	require.True(t, ok)
+
+	shareBlockID := resp.Entries[commonstate.PoolNameShare].Entries[commonstate.FakedContainerName].CalculationResultsByNumas[commonstate.FakedNUMAID].Blocks[0].BlockId
+	batchBlockID := resp.Entries["batch"].Entries[commonstate.FakedContainerName].CalculationResultsByNumas[commonstate.FakedNUMAID].Blocks[0].BlockId
+	require.Equal(t, "0-3,16-19", blockCPUList[shareBlockID])
+	require.NotContains(t, blockCPUList, batchBlockID)
+}
+
+func TestCPUServerPoolHeadroomConsistency(t *testing.T) {
+	t.Parallel()
+
+	cs := newTestCPUServer(t, nil, []*v1.Pod{})
+	emitter := newFakeMetricEmitter()
+	cs.emitter = emitter
+	cs.poolHeadroomDivergenceThreshold = 0.1
+
+	cpuTopology, err := machine.GenerateDummyCPUTopology(16, 2, 2)
+	require.NoError(t, err)
+	cs.metaServer.KatalystMachineInfo = &machine.KatalystMachineInfo{CPUTopology: cpuTopology}
+	// headroom is reported in milli cores
+	cs.headroomResourceManager = &mockHeadroomResourceManager{
+		numaAllocatable: map[int]resource.Quantity{
+			0: resource.MustParse("2k"),
+			1: resource.MustParse("6k"),
+		},
+	}
+
+	// numa 0: 2 (share) + 4 (reserve) + 2 (headroom) = 8, which is consistent
+	// numa 1: 2 (share) + 2 (dedicated) + 6 (headroom) = 10, which diverges by 25%
+	cs.assembleResponse(&types.InternalCPUCalculationResult{
+		PoolEntries: map[string]map[int]types.CPUResource{
+			commonstate.PoolNameShare:   {commonstate.FakedNUMAID: {Size: 4}},
+			commonstate.PoolNameReserve: {0: {Size: 4}},
+			"dedicated-pod":             {1: {Size: 2}},
+		},
+	})
+
+	for numaID, want := range map[int]struct {
+		total    int64
+		diverged int64
+	}{
+		0: {total: 8000, diverged: 0},
+		1: {total: 10000, diverged: 1},
+	} {
+		numaTag := metrics.MetricTag{Key: "numa", Val: strconv.Itoa(numaID)}
+		total, ok := emitter.getTagged(cs.genMetricsName(metricCPUServerPoolHeadroomTotal), numaTag)
+		require.True(t, ok)
+		require.Equal(t, want.total, total)
+		diverged, ok := emitter.getTagged(cs.genMetricsName(metricCPUServerPoolHeadroomDiverged), numaTag)
+		require.True(t, ok)
+		require.Equal(t, want.diverged, diverged)
+	}
+}
+
+func TestCPUServerSkipPodFetchFailedContainers(t *testing.T) {
+	t.Parallel()
+
+	// the pod is not in meta server, so fetching it fails during sync
+	cs := newTestCPUServer(t, nil, []*v1.Pod{})
+	emitter := newFakeMetricEmitter()
+	cs.emitter = emitter
+	cs.skipPodFetchFailedContainers = true
+
+	require.NoError(t, cs.metaCache.AddContainer("pod1", "c1", &types.ContainerInfo{
+		PodUID:              "pod1",
+		ContainerName:       "c1",
+		QoSLevel:            consts.PodAnnotationQoSLevelSharedCores,
+		OwnerPoolName:       commonstate.PoolNameShare,
+		OriginOwnerPoolName: commonstate.PoolNameShare,
+	}))
+	cs.syncCheckpoint(context.TODO(), &cpuadvisor.GetCheckpointResponse{
+		Entries: map[string]*cpuadvisor.AllocationEntries{
+			"pod1": {
+				Entries: map[string]*cpuadvisor.AllocationInfo{
+					"c1": {OwnerPoolName: commonstate.PoolNameShare},
+				},
+			},
+		},
+	}, 0)
+
+	advisorResp := &types.InternalCPUCalculationResult{
+		PoolEntries: map[string]map[int]types.CPUResource{
+			commonstate.PoolNameShare: {commonstate.FakedNUMAID: {Size: 4}},
+		},
+	}
+	resp := cs.assembleResponse(advisorResp)
+	require.NotContains(t, resp.Entries, "pod1")
+	skipped, ok := emitter.get(cs.genMetricsName(metricCPUServerPodFetchFailedContainers))
+	require.True(t, ok)
+	require.Equal(t, int64(1), skipped)
+
+	// the container is assembled with cached info if skipping is disabled
+	cs.skipPodFetchFailedContainers = false
+	resp = cs.assembleResponse(advisorResp)
+	require.Contains(t, resp.Entries, "pod1")
+}
+
+// slowPodFetcher delays getting the given pods
+type slowPodFetcher struct {
+	*pod.PodFetcherStub
+	delays map[string]time.Duration
+}
+
+func (f *slowPodFetcher) GetPod(ctx context.Context, podUID string) (*v1.Pod, error) {
+	time.Sleep(f.delays[podUID])
+	return f.PodFetcherStub.GetPod(ctx, podUID)
+}
+
+func TestCPUServerGetPodTimeout(t *testing.T) {
+	t.Parallel()
+
+	cs := newTestCPUServer(t, nil, []*v1.Pod{})
+	emitter := newFakeMetricEmitter()
+	cs.emitter = emitter
+	cs.getPodTimeout = 100 * time.Millisecond
+	cs.metaServer.PodFetcher = &slowPodFetcher{
+		PodFetcherStub: &pod.PodFetcherStub{PodList: []*v1.Pod{
+			{ObjectMeta: metav1.ObjectMeta{Name: "slow-pod", UID: "slow-pod"}},
+			{ObjectMeta: metav1.ObjectMeta{Name: "fast-pod", UID: "fast-pod"}},
+		}},
+		delays: map[string]time.Duration{"slow-pod": 2 * time.Second},
+	}
+
+	require.NoError(t, cs.metaCache.AddContainer("slow-pod", "c1", &types.ContainerInfo{
+		PodUID:              "slow-pod",
+		ContainerName:       "c1",
+		QoSLevel:            consts.PodAnnotationQoSLevelSharedCores,
+		OwnerPoolName:       commonstate.PoolNameShare,
+		OriginOwnerPoolName: commonstate.PoolNameShare,
+	}))
+
+	start := time.Now()
+	cs.syncCheckpoint(context.TODO(), &cpuadvisor.GetCheckpointResponse{
+		Entries: map[string]*cpuadvisor.AllocationEntries{
+			"slow-pod": {Entries: map[string]*cpuadvisor.AllocationInfo{"c1": {OwnerPoolName: commonstate.PoolNameShare}}},
+			"fast-pod": {Entries: map[string]*cpuadvisor.AllocationInfo{"c1": {OwnerPoolName: commonstate.PoolNameShare}}},
+		},
+	}, 0)
+
+	// the slow lookup is skipped without stalling the sync, and the pod is handled as failed to be fetched
+	require.Less(t, time.Since(start), time.Second)
+	require.Equal(t, []string{"slow-pod"}, cs.podFetchFailed.List())
+	_, ok := cs.metaCache.GetContainerInfo("slow-pod", "c1")
+	require.True(t, ok)
+	timeout, ok := emitter.getTagged(cs.genMetricsName(metricCPUServerGetPodTimeout), metrics.MetricTag{Key: "podUID", Val: "slow-pod"})
+	require.True(t, ok)
+	require.Equal(t, int64(1), timeout)
+	_, ok = emitter.getTagged(cs.genMetricsName(metricCPUServerGetPodTimeout), metrics.MetricTag{Key: "podUID", Val: "fast-pod"})
+	require.False(t, ok)
+}
+
+func TestCPUServerEmitAdviceLatency(t *testing.T) {
+	t.Parallel()
+
+	for count, bucket := range map[int]string{0: "0-50", 49: "0-50", 50: "50-200", 199: "50-200", 200: "200+", 1000: "200+"} {
+		require.Equal(t, bucket, podCountBucket(count), "count %d", count)
+	}
+
+	cs := newTestCPUServer(t, nil, []*v1.Pod{})
+	emitter := newFakeMetricEmitter()
+	cs.emitter = emitter
+
+	// pool entries are not counted
+	calculationEntriesMap := map[string]*cpuadvisor.CalculationEntries{
+		commonstate.PoolNameShare: {
+			Entries: map[string]*cpuadvisor.CalculationInfo{commonstate.FakedContainerName: {}},
+		},
+	}
+	for i := 0; i < 60; i++ {
+		calculationEntriesMap[fmt.Sprintf("pod%d", i)] = &cpuadvisor.CalculationEntries{
+			Entries: map[string]*cpuadvisor.CalculationInfo{"c1": {}},
+		}
+	}
+	cs.emitAdviceLatency(calculationEntriesMap, 20*time.Millisecond)
+
+	latency, ok := emitter.getTagged(cs.genMetricsName(metricCPUServerAdviceLatency),
+		metrics.MetricTag{Key: "pod_count_bucket", Val: "50-200"})
+	require.True(t, ok)
+	require.Equal(t, int64(20), latency)
+}
+
+func TestCPUServerPoolNUMADistributionDrift(t *testing.T) {
+	t.Parallel()
+
+	cs := newTestCPUServer(t, nil, []*v1.Pod{})
+	emitter := newFakeMetricEmitter()
+	cs.emitter = emitter
+
+	require.NoError(t, cs.metaCache.SetPoolInfo(commonstate.PoolNameShare, &types.PoolInfo{
+		PoolName: commonstate.PoolNameShare,
+		TopologyAwareAssignments: map[int]machine.CPUSet{
+			0: machine.MustParse("0-3"),
+			1: machine.MustParse("8-11"),
+		},
+	}))
+	require.NoError(t, cs.metaCache.SetPoolInfo(commonstate.PoolNameReclaim, &types.PoolInfo{
+		PoolName: commonstate.PoolNameReclaim,
+		TopologyAwareAssignments: map[int]machine.CPUSet{
+			0: machine.MustParse("4-5"),
+		},
+	}))
+
+	cs.emitPoolNUMADistributionDrift(&types.InternalCPUCalculationResult{
+		PoolEntries: map[string]map[int]types.CPUResource{
+			// same total size, but two cpus are moved from numa 1 to numa 0
+			commonstate.PoolNameShare: {0: {Size: 6}, 1: {Size: 2}},
+			// distribution is the same as enacted
+			commonstate.PoolNameReclaim: {0: {Size: 2}},
+			// pools without numa distribution are skipped
+			"batch": {commonstate.FakedNUMAID: {Size: 4}},
+		},
+	})
+
+	drift, ok := emitter.getTagged(cs.genMetricsName(metricCPUServerPoolNUMADistributionDrift),
+		metrics.MetricTag{Key: "pool", Val: commonstate.PoolNameShare})
+	require.True(t, ok)
+	require.Equal(t, int64(4), drift)
+	drift, ok = emitter.getTagged(cs.genMetricsName(metricCPUServerPoolNUMADistributionDrift),
+		metrics.MetricTag{Key: "pool", Val: commonstate.PoolNameReclaim})
+	require.True(t, ok)
+	require.Equal(t, int64(0), drift)
+	_, ok = emitter.getTagged(cs.genMetricsName(metricCPUServerPoolNUMADistributionDrift),
+		metrics.MetricTag{Key: "pool", Val: "batch"})
+	require.False(t, ok)
+}
+
+func TestCPUServerCapPoolBlocksPerNUMA(t *testing.T) {
+	t.Parallel()
+
+	cs := newTestCPUServer(t, nil, []*v1.Pod{})
+	emitter := newFakeMetricEmitter()
+	cs.emitter = emitter
+	cs.maxBlocksPerNUMAPerPool = 2
+
+	overlapBlock := func(size uint64, poolName string) *cpuadvisor.Block {
+		block := NewBlock(size, "")
+		block.OverlapTargets = []*cpuadvisor.OverlapTarget{{
+			OverlapTargetPoolName: poolName,
+			OverlapType:           cpuadvisor.OverlapType_OverlapWithPool,
+		}}
+		return block
+	}
+
+	bs := NewBlockSet()
+	privateBlocks := []*cpuadvisor.Block{NewBlock(2, ""), NewBlock(3, "")}
+	for _, block := range privateBlocks {
+		require.NoError(t, bs.add(NewInnerBlock(block, 0, commonstate.PoolNameReclaim, nil, nil)))
+	}
+
+	poolEntry := NewPoolCalculationEntries(commonstate.PoolNameReclaim)
+	poolEntry.Entries[commonstate.FakedContainerName].CalculationResultsByNumas[0] = &cpuadvisor.NumaCalculationResult{
+		Blocks: []*cpuadvisor.Block{privateBlocks[0], overlapBlock(4, commonstate.PoolNameShare), privateBlocks[1]},
+	}
+	// blocks overlapping with others can't be merged
+	poolEntry.Entries[commonstate.FakedContainerName].CalculationResultsByNumas[1] = &cpuadvisor.NumaCalculationResult{
+		Blocks: []*cpuadvisor.Block{overlapBlock(1, "share-a"), overlapBlock(2, "share-b"), overlapBlock(3, "share-c")},
+	}
+	calculationEntriesMap := map[string]*cpuadvisor.CalculationEntries{commonstate.PoolNameReclaim: poolEntry}
+
+	cs.capPoolBlocksPerNUMA(calculationEntriesMap, bs)
+
+	blocks := poolEntry.Entries[commonstate.FakedContainerName].CalculationResultsByNumas[0].Blocks
+	require.Len(t, blocks, 2)
+	require.Equal(t, privateBlocks[0].BlockId, blocks[0].BlockId)
+	require.Equal(t, uint64(5), blocks[0].Result)
+	require.Equal(t, uint64(4), blocks[1].Result)
+	require.Nil(t, bs.get(privateBlocks[1].BlockId))
+	merged, ok := emitter.getTagged(cs.genMetricsName(metricCPUServerPoolBlocksMerged),
+		metrics.MetricTag{Key: "pool", Val: commonstate.PoolNameReclaim})
+	require.True(t, ok)
+	require.Equal(t, int64(1), merged)
+
+	require.Len(t, poolEntry.Entries[commonstate.FakedContainerName].CalculationResultsByNumas[1].Blocks, 3)
+	exceeded, ok := emitter.getTagged(cs.genMetricsName(metricCPUServerPoolBlocksExceeded),
+		metrics.MetricTag{Key: "pool", Val: commonstate.PoolNameReclaim}, metrics.MetricTag{Key: "numa", Val: "1"})
+	require.True(t, ok)
+	require.Equal(t, int64(3), exceeded)
+	_, ok = emitter.getTagged(cs.genMetricsName(metricCPUServerPoolBlocksExceeded),
+		metrics.MetricTag{Key: "pool", Val: commonstate.PoolNameReclaim}, metrics.MetricTag{Key: "numa", Val: "0"})
+	require.False(t, ok)
+}
+
+func TestCPUServerReserveReclaimOverlap(t *testing.T) {
+	t.Parallel()
+
+	advisor := &mockCPUResourceAdvisor{
+		provision: &types.InternalCPUCalculationResult{
+			PoolEntries: map[string]map[int]types.CPUResource{
+				commonstate.PoolNameReserve: {0: {Size: 2}},
+				commonstate.PoolNameReclaim: {0: {Size: 4}},
+			},
+		},
+	}
+	cs := newTestCPUServer(t, advisor, []*v1.Pod{})
+	emitter := newFakeMetricEmitter()
+	cs.emitter = emitter
+
+	require.NoError(t, cs.metaCache.SetPoolInfo(commonstate.PoolNameReserve, &types.PoolInfo{
+		PoolName:                 commonstate.PoolNameReserve,
+		TopologyAwareAssignments: map[int]machine.CPUSet{0: machine.MustParse("0-1")},
+	}))
+	require.NoError(t, cs.metaCache.SetPoolInfo(commonstate.PoolNameReclaim, &types.PoolInfo{
+		PoolName:                 commonstate.PoolNameReclaim,
+		TopologyAwareAssignments: map[int]machine.CPUSet{0: machine.MustParse("2-5")},
+	}))
+
+	// reserve pool stays exclusive
+	_, err := cs.updateAdvisor(context.TODO(), map[string]*advisorsvc.FeatureGate{})
+	require.NoError(t, err)
+	overlapped, ok := emitter.get(cs.genMetricsName(metricCPUServerReserveReclaimOverlapped))
+	require.True(t, ok)
+	require.Equal(t, int64(0), overlapped)
+
+	// reclaim cpus in checkpoint overlap with reserve cpus, and advice is still pushed by default
+	require.NoError(t, cs.metaCache.SetPoolInfo(commonstate.PoolNameReclaim, &types.PoolInfo{
+		PoolName:                 commonstate.PoolNameReclaim,
+		TopologyAwareAssignments: map[int]machine.CPUSet{0: machine.MustParse("1-4")},
+	}))
+	_, err = cs.updateAdvisor(context.TODO(), map[string]*advisorsvc.FeatureGate{})
+	require.NoError(t, err)
+	overlapped, _ = emitter.get(cs.genMetricsName(metricCPUServerReserveReclaimOverlapped))
+	require.Equal(t, int64(1), overlapped)
+
+	cs.refusePushOnReserveReclaimOverlap = true
+	_, err = cs.updateAdvisor(context.TODO(), map[string]*advisorsvc.FeatureGate{})
+	require.Error(t, err)
+
+	// assembled reclaim blocks overlap with reserve pool
+	require.NoError(t, cs.metaCache.SetPoolInfo(commonstate.PoolNameReclaim, &types.PoolInfo{
+		PoolName:                 commonstate.PoolNameReclaim,
+		TopologyAwareAssignments: map[int]machine.CPUSet{0: machine.MustParse("2-5")},
+	}))
+	reclaimBlock := NewBlock(2, "")
+	reclaimBlock.OverlapTargets = []*cpuadvisor.OverlapTarget{{
+		OverlapTargetPoolName: commonstate.PoolNameReserve,
+		OverlapType:           cpuadvisor.OverlapType_OverlapWithPool,
+	}}
+	reclaimEntry := NewPoolCalculationEntries(commonstate.PoolNameReclaim)
+	reclaimEntry.Entries[commonstate.FakedContainerName].CalculationResultsByNumas[0] = &cpuadvisor.NumaCalculationResult{
+		Blocks: []*cpuadvisor.Block{reclaimBlock},
+	}
+	err = cs.checkReserveReclaimOverlap(map[string]*cpuadvisor.CalculationEntries{commonstate.PoolNameReclaim: reclaimEntry})
+	require.ErrorContains(t, err, reclaimBlock.BlockId)
+	overlapped, _ = emitter.get(cs.genMetricsName(metricCPUServerReserveReclaimOverlapped))
+	require.Equal(t, int64(1), overlapped)
+}
+
+func TestCPUServerForceRampUp(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name           string
+		annotation     string
+		checkpointRamp bool
+		wantRampUp     bool
+		wantOverridden bool
+	}{
+		{name: "forced on", annotation: coreconsts.PodAnnotationForceRampUpTrue, checkpointRamp: false, wantRampUp: true, wantOverridden: true},
+		{name: "forced off", annotation: coreconsts.PodAnnotationForceRampUpFalse, checkpointRamp: true, wantRampUp: false, wantOverridden: true},
+		{name: "not forced", annotation: "", checkpointRamp: true, wantRampUp: true},
+		{name: "invalid value", annotation: "yes", checkpointRamp: false, wantRampUp: false},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{UID: "pod1", Annotations: map[string]string{}}}
+			if tt.annotation != "" {
+				pod.Annotations[coreconsts.PodAnnotationForceRampUpKey] = tt.annotation
+			}
+
+			cs := newTestCPUServer(t, nil, []*v1.Pod{pod})
+			emitter := newFakeMetricEmitter()
+			cs.emitter = emitter
+			require.NoError(t, cs.metaCache.AddContainer("pod1", "c1", &types.ContainerInfo{
+				PodUID:        "pod1",
+				ContainerName: "c1",
+				QoSLevel:      consts.PodAnnotationQoSLevelSharedCores,
+			}))
+
+			info := &cpuadvisor.AllocationInfo{OwnerPoolName: commonstate.PoolNameShare, RampUp: tt.checkpointRamp}
+			require.NoError(t, cs.updateContainerInfo(newQoSLevelResolver(cs.qosConf), "pod1", "c1", pod, info, nil))
+			ci, ok := cs.metaCache.GetContainerInfo("pod1", "c1")
+			require.True(t, ok)
+			require.Equal(t, tt.wantRampUp, ci.RampUp)
+
+			_, overridden := emitter.getTagged(cs.genMetricsName(metricCPUServerRampUpOverridden),
+				metrics.MetricTag{Key: "rampUp", Val: strconv.FormatBool(tt.wantRampUp)})
+			require.Equal(t, tt.wantOverridden, overridden)
+		})
+	}
+}
+
+func TestCPUServerAggregateMetricsInterval(t *testing.T) {
+	t.Parallel()
+
+	cs := newTestCPUServer(t, nil, []*v1.Pod{})
+	fakeClock := testingclock.NewFakeClock(time.Now())
+	cs.clock = fakeClock
+	cs.aggregateMetricsInterval = time.Minute
+
+	advisorResp := &types.InternalCPUCalculationResult{
+		PoolEntries: map[string]map[int]types.CPUResource{
+			commonstate.PoolNameShare: {commonstate.FakedNUMAID: {Size: 4}},
+		},
+	}
+	emitted := func() bool {
+		emitter := newFakeMetricEmitter()
+		cs.emitter = emitter
+		cs.assembleResponse(advisorResp)
+		_, ok := emitter.get(cs.genMetricsName(metricCPUServerOverlapActive))
+		return ok
+	}
+
+	// aggregate metrics are emitted in the first push, and then at most once per interval
+	require.True(t, emitted())
+	fakeClock.Step(30 * time.Second)
+	require.False(t, emitted())
+	fakeClock.Step(30 * time.Second)
+	require.True(t, emitted())
+	require.False(t, emitted())
+
+	// they are emitted in every push if no interval is configured
+	cs.aggregateMetricsInterval = 0
+	require.True(t, emitted())
+	require.True(t, emitted())
+}
+
+func TestCPUServerValidatePoolMembership(t *testing.T) {
+	t.Parallel()
+
+	newPod := func(podUID, qosLevel string) *v1.Pod {
+		return &v1.Pod{ObjectMeta: metav1.ObjectMeta{
+			UID:         k8stypes.UID(podUID),
+			Annotations: map[string]string{consts.PodAnnotationQoSLevelKey: qosLevel},
+		}}
+	}
+	pods := []*v1.Pod{
+		newPod("shared-pod", consts.PodAnnotationQoSLevelSharedCores),
+		newPod("reclaimed-pod", consts.PodAnnotationQoSLevelReclaimedCores),
+	}
+	cs := newTestCPUServer(t, nil, pods)
+	emitter := newFakeMetricEmitter()
+	cs.emitter = emitter
+
+	for _, pod := range pods {
+		require.NoError(t, cs.metaCache.AddContainer(string(pod.UID), "c1", &types.ContainerInfo{
+			PodUID:        string(pod.UID),
+			ContainerName: "c1",
+			QoSLevel:      pod.Annotations[consts.PodAnnotationQoSLevelKey],
+		}))
+	}
+
+	checkpoint := func(reclaimedPodPool string) *cpuadvisor.GetCheckpointResponse {
+		return &cpuadvisor.GetCheckpointResponse{
+			Entries: map[string]*cpuadvisor.AllocationEntries{
+				commonstate.PoolNameShare: {Entries: map[string]*cpuadvisor.AllocationInfo{
+					commonstate.FakedContainerName: {OwnerPoolName: commonstate.PoolNameShare},
+				}},
+				commonstate.PoolNameReclaim: {Entries: map[string]*cpuadvisor.AllocationInfo{
+					commonstate.FakedContainerName: {OwnerPoolName: commonstate.PoolNameReclaim},
+				}},
+				"shared-pod":    {Entries: map[string]*cpuadvisor.AllocationInfo{"c1": {OwnerPoolName: commonstate.PoolNameShare}}},
+				"reclaimed-pod": {Entries: map[string]*cpuadvisor.AllocationInfo{"c1": {OwnerPoolName: reclaimedPodPool}}},
+			},
+		}
+	}
+
+	cs.syncCheckpoint(context.TODO(), checkpoint(commonstate.PoolNameReclaim), 0)
+	violations, ok := emitter.get(cs.genMetricsName(metricCPUServerPoolMembershipViolations))
+	require.True(t, ok)
+	require.Equal(t, int64(0), violations)
+
+	// reclaimed_cores container claims membership of share pool
+	cs.syncCheckpoint(context.TODO(), checkpoint(commonstate.PoolNameShare), 0)
+	violations, _ = emitter.get(cs.genMetricsName(metricCPUServerPoolMembershipViolations))
+	require.Equal(t, int64(1), violations)
+}
+
+func TestCPUServerPushCycleTracing(t *testing.T) {
+	t.Parallel()
+
+	advisor := &mockCPUResourceAdvisor{
+		provision: &types.InternalCPUCalculationResult{
+			PoolEntries: map[string]map[int]types.CPUResource{
+				commonstate.PoolNameReserve: {0: {Size: 2}},
+				commonstate.PoolNameShare:   {0: {Size: 4}},
+			},
+		},
+	}
+	cs := newTestCPUServer(t, advisor, []*v1.Pod{})
+	exporter := tracetest.NewInMemoryExporter()
+	cs.tracer = sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)).Tracer("test")
+	require.NoError(t, cs.metaCache.SetPoolInfo(commonstate.PoolNameReserve, &types.PoolInfo{
+		PoolName:                 commonstate.PoolNameReserve,
+		TopologyAwareAssignments: map[int]machine.CPUSet{0: machine.NewCPUSet(0)},
+	}))
+
+	server := &mockCPUServerService_ListAndWatchServer{ResultsChan: make(chan *cpuadvisor.ListAndWatchResponse, 1)}
+	require.NoError(t, cs.getAndPushAdvice([]cpuadvisor.CPUPluginClient{
+		&mockCPUPluginClient{checkpoint: &cpuadvisor.GetCheckpointResponse{
+			Entries: map[string]*cpuadvisor.AllocationEntries{
+				commonstate.PoolNameReserve: {
+					Entries: map[string]*cpuadvisor.AllocationInfo{
+						commonstate.FakedContainerName: {OwnerPoolName: commonstate.PoolNameReserve, TopologyAwareAssignments: map[uint64]string{0: "0"}},
+					},
+				},
+			},
+		}},
+	}, server))
+	require.Len(t, server.ResultsChan, 1)
+
+	spans := make(map[string]*sdktrace.SpanSnapshot)
+	for _, span := range exporter.GetSpans() {
+		spans[span.Name] = span
+	}
+	require.Len(t, spans, 5)
+
+	// sync, advisor-update, assemble and send are children of the push cycle
+	root, ok := spans["push-cycle"]
+	require.True(t, ok)
+	require.False(t, root.Parent.IsValid())
+	for _, name := range []string{"sync", "advisor-update", "assemble", "send"} {
+		child, ok := spans[name]
+		require.True(t, ok, name)
+		require.Equal(t, root.SpanContext.TraceID(), child.SpanContext.TraceID(), name)
+		require.Equal(t, root.SpanContext.SpanID(), child.Parent.SpanID(), name)
+	}
+
+	attrs := make(map[string]int64)
+	for _, attr := range root.Attributes {
+		attrs[string(attr.Key)] = attr.Value.AsInt64()
+	}
+	require.Equal(t, map[string]int64{"pod_count": 0, "pool_count": 2}, attrs)
+}
+
+func TestCPUServerEmptyDedicatedAssignments(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		policy      EmptyDedicatedAssignmentsPolicy
+		wantEntries bool
+	}{
+		{
+			name:        "skip",
+			policy:      EmptyDedicatedAssignmentsPolicySkip,
+			wantEntries: false,
+		},
+		{
+			name:        "fallback to owner pool",
+			policy:      EmptyDedicatedAssignmentsPolicyFallbackPool,
+			wantEntries: true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			cs := newTestCPUServer(t, nil, []*v1.Pod{})
+			emitter := newFakeMetricEmitter()
+			cs.emitter = emitter
+			cs.emptyDedicatedAssignmentsPolicy = tt.policy
+
+			// the container is dedicated numa binding, but has no assignments
+			require.NoError(t, cs.metaCache.AddContainer("pod1", "c1", &types.ContainerInfo{
+				PodUID:        "pod1",
+				ContainerName: "c1",
+				QoSLevel:      consts.PodAnnotationQoSLevelDedicatedCores,
+				Annotations: map[string]string{
+					consts.PodAnnotationMemoryEnhancementNumaBinding: consts.PodAnnotationMemoryEnhancementNumaBindingEnable,
+				},
+				OwnerPoolName: commonstate.PoolNameDedicated,
+			}))
+
+			result := cs.assembleResponse(&types.InternalCPUCalculationResult{
+				PoolEntries: map[string]map[int]types.CPUResource{},
+			})
+
+			empty, ok := emitter.getTagged(cs.genMetricsName(metricCPUServerEmptyDedicatedAssignments),
+				metrics.MetricTag{Key: "policy", Val: string(tt.policy)})
+			require.True(t, ok)
+			require.Equal(t, int64(1), empty)
+
+			entries, ok := result.Entries["pod1"]
+			require.Equal(t, tt.wantEntries, ok)
+			if tt.wantEntries {
+				require.Equal(t, commonstate.PoolNameDedicated, entries.Entries["c1"].OwnerPoolName)
+				require.Empty(t, entries.Entries["c1"].CalculationResultsByNumas)
+			}
+		})
+	}
+}
+
+func TestCPUServerServeBlocksDOT(t *testing.T) {
+	t.Parallel()
+
+	cs := newTestCPUServer(t, nil, []*v1.Pod{})
+
+	// share pool and pod1/c1 overlap with each other in block b1
+	bs := NewBlockSet()
+	shareBlock := NewBlock(4, "b1")
+	NewInnerBlock(shareBlock, 0, commonstate.PoolNameShare, nil, &cpuadvisor.NumaCalculationResult{}).join("b1", bs)
+	containerBlock := NewBlock(4, "b1")
+	NewInnerBlock(containerBlock, 0, "", &ContainerMeta{PodUID: "pod1", ContainerName: "c1"},
+		&cpuadvisor.NumaCalculationResult{}).join("b1", bs)
+
+	// reclaim pool in block b2 overlaps with reserve pool, which owns no block of the same id
+	reclaimBlock := NewBlock(2, "b2")
+	reclaimBlock.OverlapTargets = []*cpuadvisor.OverlapTarget{{
+		OverlapTargetPoolName: commonstate.PoolNameReserve,
+		OverlapType:           cpuadvisor.OverlapType_OverlapWithPool,
+	}}
+	require.NoError(t, bs.add(NewInnerBlock(reclaimBlock, 1, commonstate.PoolNameReclaim, nil, &cpuadvisor.NumaCalculationResult{})))
+
+	cs.latestBlockSetMutex.Lock()
+	cs.latestBlockSet = bs
+	cs.latestBlockSetMutex.Unlock()
+
+	recorder := httptest.NewRecorder()
+	cs.serveBlocksDOT(recorder, httptest.NewRequest(http.MethodGet, general.DebugHandlerPathPrefix+cpuServerBlocksDebugHandlerName, nil))
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	dot := recorder.Body.String()
+	require.True(t, strings.HasPrefix(dot, "graph blocks {\n"))
+	require.Contains(t, dot, `"b1/pool:share" [label="pool:share\nnuma 0, size 4\nblock b1"];`)
+	require.Contains(t, dot, `"b1/container:pod1/c1" [label="container:pod1/c1\nnuma 0, size 4\nblock b1"];`)
+	require.Contains(t, dot, `"b2/pool:reclaim" [label="pool:reclaim\nnuma 1, size 2\nblock b2"];`)
+	require.Contains(t, dot, `"pool:reserve" [shape=box, style=dashed];`)
+	require.Contains(t, dot, `"b1/container:pod1/c1" -- "b1/pool:share";`)
+	require.Contains(t, dot, `"b2/pool:reclaim" -- "pool:reserve";`)
+	// mutual overlaps are rendered only once
+	require.Equal(t, 2, strings.Count(dot, " -- "))
+}
+
+func TestCPUServerServeBlockAssignments(t *testing.T) {
+	t.Parallel()
+
+	cs := newTestCPUServer(t, nil, []*v1.Pod{})
+	advisorResp := &types.InternalCPUCalculationResult{
+		PoolEntries: map[string]map[int]types.CPUResource{
+			commonstate.PoolNameReserve: {0: {Size: 2}},
+			commonstate.PoolNameShare:   {0: {Size: 4}},
+			commonstate.PoolNameReclaim: {0: {Size: 2}},
+		},
+		PoolOverlapInfo:                       map[string]map[int]map[string]int{},
+		AllowSharedCoresOverlapReclaimedCores: true,
+	}
+	advisorResp.SetPoolOverlapInfo(commonstate.PoolNameReclaim, 0, commonstate.PoolNameShare, 2)
+	result := cs.assembleResponse(advisorResp)
+
+	recorder := httptest.NewRecorder()
+	cs.serveBlockAssignments(recorder, httptest.NewRequest(http.MethodGet, general.DebugHandlerPathPrefix+cpuServerBlockAssignmentsDebugHandlerName, nil))
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	assignments := &BlockAssignments{}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), assignments))
+
+	// the latest assembled entries are served as they are, including the reserve pool
+	require.Contains(t, assignments.Entries, commonstate.PoolNameReserve)
+	require.Equal(t, len(result.Entries), len(assignments.Entries))
+	// the overlapped share block is split from the original one, and shares the id with the reclaim block
+	var overlapBlockID string
+	for _, block := range result.Entries[commonstate.PoolNameReclaim].Entries[commonstate.FakedContainerName].CalculationResultsByNumas[0].Blocks {
+		if len(block.OverlapTargets) > 0 {
+			overlapBlockID = block.BlockId
+		}
+	}
+
+	owners := make(map[string][]string)
+	for _, block := range assignments.Blocks {
+		for _, reference := range block.References {
+			owners[block.BlockID] = append(owners[block.BlockID], reference.Owner)
+		}
+	}
+	require.Equal(t, []string{"pool:reclaim", "pool:share"}, owners[overlapBlockID])
+	require.Len(t, assignments.Blocks, 4)
+	require.Equal(t, map[int64][]string{0: {"pool:share"}}, assignments.ReclaimOverlaps)
+}
+
+func TestCPUServerMergePoolNUMABlocks(t *testing.T) {
+	t.Parallel()
+
+	advisorResp := func() *types.InternalCPUCalculationResult {
+		return &types.InternalCPUCalculationResult{
+			PoolEntries: map[string]map[int]types.CPUResource{
+				commonstate.PoolNameReserve: {0: {Size: 2}, 1: {Size: 2}},
+				commonstate.PoolNameShare:   {0: {Size: 4}, 1: {Size: 4}},
+				"share-a":                   {0: {Size: 2}, 1: {Size: 3}},
+			},
+		}
+	}
+	poolSizes := func(entries map[string]*cpuadvisor.CalculationEntries) map[string]uint64 {
+		sizes := make(map[string]uint64)
+		for poolName, poolEntries := range entries {
+			for _, numaCalculationResult := range poolEntries.Entries[commonstate.FakedContainerName].CalculationResultsByNumas {
+				for _, block := range numaCalculationResult.Blocks {
+					sizes[poolName] += block.Result
+				}
+			}
+		}
+		return sizes
+	}
+
+	// per-numa blocks are kept by default
+	cs := newTestCPUServer(t, nil, []*v1.Pod{})
+	expected := cs.assembleResponse(advisorResp())
+	require.Len(t, expected.Entries[commonstate.PoolNameShare].Entries[commonstate.FakedContainerName].CalculationResultsByNumas, 2)
+
+	cs = newTestCPUServer(t, nil, []*v1.Pod{})
+	emitter := newFakeMetricEmitter()
+	cs.emitter = emitter
+	cs.mergeIdenticalPoolNUMABlocks = true
+	result := cs.assembleResponse(advisorResp())
+	require.Equal(t, poolSizes(expected.Entries), poolSizes(result.Entries))
+
+	for _, poolName := range []string{commonstate.PoolNameReserve, commonstate.PoolNameShare} {
+		numaResults := result.Entries[poolName].Entries[commonstate.FakedContainerName].CalculationResultsByNumas
+		require.Len(t, numaResults, 1, poolName)
+		require.Len(t, numaResults[commonstate.FakedNUMAID].Blocks, 1, poolName)
+		require.NotNil(t, cs.latestBlockSet.get(numaResults[commonstate.FakedNUMAID].Blocks[0].BlockId), poolName)
+
+		merged, ok := emitter.getTagged(cs.genMetricsName(metricCPUServerPoolNUMABlocksMerged),
+			metrics.MetricTag{Key: "pool", Val: poolName})
+		require.True(t, ok, poolName)
+		require.Equal(t, int64(1), merged, poolName)
+	}
+
+	// pools sized differently across numa nodes are left as is
+	require.Len(t, result.Entries["share-a"].Entries[commonstate.FakedContainerName].CalculationResultsByNumas, 2)
+	_, ok := emitter.getTagged(cs.genMetricsName(metricCPUServerPoolNUMABlocksMerged), metrics.MetricTag{Key: "pool", Val: "share-a"})
+	require.False(t, ok)
+}
+
+func TestCPUServerAdviceInputSnapshots(t *testing.T) {
+	t.Parallel()
+
+	advisor := &mockCPUResourceAdvisor{
+		provision: &types.InternalCPUCalculationResult{
+			PoolEntries: map[string]map[int]types.CPUResource{
+				commonstate.PoolNameReserve: {0: {Size: 2}},
+				commonstate.PoolNameShare:   {0: {Size: 4}, 1: {Size: 6}},
+			},
+		},
+	}
+	cs := newTestCPUServer(t, advisor, []*v1.Pod{})
+	cs.adviceInputSnapshotLimit = 2
+
+	metricsFetcher := metric.NewFakeMetricsFetcher(metrics.DummyMetrics{}).(*metric.FakeMetricsFetcher)
+	metricsFetcher.SetNodeMetric(coreconsts.MetricCPUUsageSystem, utilmetric.MetricData{Value: 12.5})
+	metricsFetcher.SetNodeMetric(coreconsts.MetricLoad1MinSystem, utilmetric.MetricData{Value: 8})
+	cs.metaServer.MetricsFetcher = metricsFetcher
+	require.NoError(t, cs.metaCache.SetRegionInfo("share-region", &types.RegionInfo{
+		RegionName:           "share-region",
+		OwnerPoolName:        commonstate.PoolNameShare,
+		ProvisionPolicyInUse: types.CPUProvisionPolicyCanonical,
+		Headroom:             3,
+		RegionStatus: types.RegionStatus{
+			OvershootStatus: map[string]types.OvershootType{coreconsts.MetricCPUSchedwait: types.OvershootTrue},
+		},
+	}))
+
+	// snapshots are disabled if the limit is zero
+	cs.adviceInputSnapshotLimit = 0
+	_, err := cs.updateAdvisor(context.TODO(), map[string]*advisorsvc.FeatureGate{})
+	require.NoError(t, err)
+	require.Empty(t, cs.adviceInputSnapshots)
+
+	// only snapshots of the latest cycles are kept
+	cs.adviceInputSnapshotLimit = 2
+	for i := 0; i < 3; i++ {
+		_, err := cs.updateAdvisor(context.TODO(), map[string]*advisorsvc.FeatureGate{})
+		require.NoError(t, err)
+	}
+
+	recorder := httptest.NewRecorder()
+	cs.serveAdviceInputSnapshots(recorder, httptest.NewRequest(http.MethodGet, general.DebugHandlerPathPrefix+cpuServerAdviceInputsDebugHandlerName, nil))
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	snapshots := map[uint64]*AdviceInputSnapshot{}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &snapshots))
+	require.Len(t, snapshots, 2)
+	for _, sequence := range []uint64{2, 3} {
+		snapshot, ok := snapshots[sequence]
+		require.True(t, ok, sequence)
+		require.Equal(t, sequence, snapshot.Sequence)
+		require.Equal(t, map[string]float64{
+			coreconsts.MetricCPUUsageSystem: 12.5,
+			coreconsts.MetricLoad1MinSystem: 8,
+		}, snapshot.NodeMetrics)
+		require.Equal(t, map[string]map[int]int{
+			commonstate.PoolNameReserve: {0: 2},
+			commonstate.PoolNameShare:   {0: 4, 1: 6},
+		}, snapshot.PoolSizes)
+
+		region, ok := snapshot.Regions["share-region"]
+		require.True(t, ok, sequence)
+		require.Equal(t, commonstate.PoolNameShare, region.OwnerPoolName)
+		require.Equal(t, string(types.CPUProvisionPolicyCanonical), region.ProvisionPolicyInUse)
+		require.Equal(t, float64(3), region.Headroom)
+		require.Equal(t, map[string]string{coreconsts.MetricCPUSchedwait: string(types.OvershootTrue)}, region.OvershootStatus)
+	}
+}
+
+func TestCPUServerOrphanContainerFallback(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name          string
+		fallbackPool  string
+		wantOwnerPool string
+	}{
+		{
+			name:          "dropped without fallback pool",
+			fallbackPool:  "",
+			wantOwnerPool: "",
+		},
+		{
+			name:          "dropped if fallback pool is absent",
+			fallbackPool:  "share-absent",
+			wantOwnerPool: "",
+		},
+		{
+			name:          "placed in fallback pool",
+			fallbackPool:  commonstate.PoolNameShare,
+			wantOwnerPool: commonstate.PoolNameShare,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			cs := newTestCPUServer(t, nil, []*v1.Pod{})
+			emitter := newFakeMetricEmitter()
+			cs.emitter = emitter
+			cs.orphanContainerFallbackPool = tt.fallbackPool
+
+			// pool share-a is synced with the container, but gc-ed before assembly
+			require.NoError(t, cs.metaCache.AddContainer("pod1", "c1", &types.ContainerInfo{
+				PodUID:              "pod1",
+				ContainerName:       "c1",
+				QoSLevel:            consts.PodAnnotationQoSLevelSharedCores,
+				OwnerPoolName:       "share-a",
+				OriginOwnerPoolName: "share-a",
+			}))
+			resp := cs.assembleResponse(&types.InternalCPUCalculationResult{
+				PoolEntries: map[string]map[int]types.CPUResource{
+					commonstate.PoolNameShare: {-1: {Size: 4}},
+				},
+			})
+
+			fallback, ok := emitter.getTagged(cs.genMetricsName(metricCPUServerOrphanContainerFallback),
+				metrics.MetricTag{Key: "pool", Val: "share-a"})
+			if tt.wantOwnerPool == "" {
+				require.NotContains(t, resp.Entries, "pod1")
+				require.False(t, ok)
+				return
+			}
+
+			require.Equal(t, tt.wantOwnerPool, resp.Entries["pod1"].Entries["c1"].OwnerPoolName)
+			require.Equal(t, PlacementReasonOrphanFallback, resp.PlacementReasons["pod1"]["c1"])
+			require.True(t, ok)
+			require.Equal(t, int64(1), fallback)
+		})
+	}
+}
+
+func TestCPUServerAssembleNodeHeadroom(t *testing.T) {
+	t.Parallel()
+
+	cs := newTestCPUServer(t, nil, []*v1.Pod{})
+	getHeadroom := func() (cpuadvisor.CPUNUMAHeadroom, string) {
+		info := cs.assembleHeadroom(nil)
+		require.NotNil(t, info)
+		numaHeadroom := cpuadvisor.CPUNUMAHeadroom{}
+		require.NoError(t, json.Unmarshal([]byte(info.CalculationResult.Values[string(cpuadvisor.ControlKnobKeyCPUNUMAHeadroom)]), &numaHeadroom))
+		nodeHeadroom, ok := info.CalculationResult.Values[string(cpuadvisor.ControlKnobKeyCPUNodeHeadroom)]
+		require.True(t, ok)
+		return numaHeadroom, nodeHeadroom
+	}
+
+	// node headroom is the sum of per-numa headroom, which is kept for backward compatibility
+	cs.headroomResourceManager = &mockHeadroomResourceManager{numaAllocatable: map[int]resource.Quantity{
+		0: resource.MustParse("2500"),
+		1: resource.MustParse("4k"),
+	}}
+	numaHeadroom, nodeHeadroom := getHeadroom()
+	require.Equal(t, cpuadvisor.CPUNUMAHeadroom{0: 2.5, 1: 4}, numaHeadroom)
+	require.Equal(t, "6.5", nodeHeadroom)
+
+	// node headroom is reported as zero rather than omitted if there is no numa allocatable
+	cs.headroomResourceManager = &mockHeadroomResourceManager{numaAllocatable: map[int]resource.Quantity{}}
+	numaHeadroom, nodeHeadroom = getHeadroom()
+	require.Empty(t, numaHeadroom)
+	require.Equal(t, "0", nodeHeadroom)
+}
+
+func TestCPUServerAssembleHeadroomTimestamp(t *testing.T) {
+	t.Parallel()
+
+	cs := newTestCPUServer(t, nil, []*v1.Pod{})
+	numaAllocatable := map[int]resource.Quantity{
+		0: resource.MustParse("2k"),
+		1: resource.MustParse("4k"),
+	}
+	computedTime := time.Now().Add(-time.Minute)
+
+	getTimestamps := func() cpuadvisor.CPUNUMAHeadroomTimestamp {
+		info := cs.assembleHeadroom(nil)
+		require.NotNil(t, info)
+		timestamps := cpuadvisor.CPUNUMAHeadroomTimestamp{}
+		require.NoError(t, json.Unmarshal([]byte(info.CalculationResult.Values[string(cpuadvisor.ControlKnobKeyCPUNUMAHeadroomTimestamp)]), &timestamps))
+		return timestamps
+	}
+
+	// the time of computing headroom is reported if available, otherwise the assembly time is reported
+	cs.headroomResourceManager = &mockTimestampedHeadroomResourceManager{
+		mockHeadroomResourceManager: mockHeadroomResourceManager{numaAllocatable: numaAllocatable},
+		numaTimestamps:              map[int]time.Time{0: computedTime},
+	}
+	assembleTime := time.Now()
+	timestamps := getTimestamps()
+	require.Len(t, timestamps, 2)
+	require.Equal(t, computedTime.UnixMilli(), timestamps[0])
+	require.GreaterOrEqual(t, timestamps[1], assembleTime.UnixMilli())
+
+	// headroom resource managers without timestamps report the assembly time for all numa nodes
+	cs.headroomResourceManager = &mockHeadroomResourceManager{numaAllocatable: numaAllocatable}
+	assembleTime = time.Now()
+	timestamps = getTimestamps()
+	require.Len(t, timestamps, 2)
+	for numaID, timestamp := range timestamps {
+		require.GreaterOrEqual(t, timestamp, assembleTime.UnixMilli(), numaID)
+	}
+}
+
+func TestCPUServerGCAfterAdvisorUpdate(t *testing.T) {
+	t.Parallel()
+
+	advisor := &mockCPUResourceAdvisor{
+		provision: &types.InternalCPUCalculationResult{
+			PoolEntries: map[string]map[int]types.CPUResource{
+				commonstate.PoolNameReserve: {0: {Size: 2}},
+			},
+		},
+		err: fmt.Errorf("mock error"),
+	}
+	cs := newTestCPUServer(t, advisor, []*v1.Pod{})
+	emitter := newFakeMetricEmitter()
+	cs.emitter = emitter
+	cs.gcAfterAdvisorUpdate = true
+
+	// the container is absent from checkpoint, and should be gc-ed
+	require.NoError(t, cs.metaCache.AddContainer("pod1", "c1", &types.ContainerInfo{
+		PodUID:        "pod1",
+		ContainerName: "c1",
+		QoSLevel:      consts.PodAnnotationQoSLevelSharedCores,
+		OwnerPoolName: commonstate.PoolNameShare,
+	}))
+	clients := []cpuadvisor.CPUPluginClient{
+		&mockCPUPluginClient{checkpoint: &cpuadvisor.GetCheckpointResponse{
+			Entries: map[string]*cpuadvisor.AllocationEntries{
+				commonstate.PoolNameReserve: {
+					Entries: map[string]*cpuadvisor.AllocationInfo{
+						commonstate.FakedContainerName: {OwnerPoolName: commonstate.PoolNameReserve, TopologyAwareAssignments: map[uint64]string{0: "0"}},
+					},
+				},
+			},
+		}},
+	}
+	server := &mockCPUServerService_ListAndWatchServer{ResultsChan: make(chan *cpuadvisor.ListAndWatchResponse, 1)}
+
+	// gc is skipped if advisor update fails
+	require.Error(t, cs.getAndPushAdvice(clients, server))
+	_, ok := cs.metaCache.GetContainerInfo("pod1", "c1")
+	require.True(t, ok)
+	skipped, ok := emitter.get(cs.genMetricsName(metricCPUServerGCSkippedOnUpdateFailure))
+	require.True(t, ok)
+	require.Equal(t, int64(1), skipped)
+	require.Nil(t, cs.pendingGC)
+
+	// gc is done once advisor is updated successfully
+	advisor.err = nil
+	require.NoError(t, cs.getAndPushAdvice(clients, server))
+	_, ok = cs.metaCache.GetContainerInfo("pod1", "c1")
+	require.False(t, ok)
+	require.Nil(t, cs.pendingGC)
+}
+
+func TestConvertCPUValue(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		value float64
+		from  CPUUnit
+		to    CPUUnit
+		want  float64
+	}{
+		{name: "cores to millicores", value: 1.5, from: CPUUnitCores, to: CPUUnitMilliCores, want: 1500},
+		{name: "millicores to cores", value: 2500, from: CPUUnitMilliCores, to: CPUUnitCores, want: 2.5},
+		{name: "same unit", value: 3, from: CPUUnitCores, to: CPUUnitCores, want: 3},
+		{name: "empty unit is cores", value: 4, from: "", to: CPUUnitMilliCores, want: 4000},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := ConvertCPUValue(tt.value, tt.from, tt.to)
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+
+			// converting back yields the original value
+			back, err := ConvertCPUValue(got, tt.to, tt.from)
+			require.NoError(t, err)
+			require.Equal(t, tt.value, back)
+		})
+	}
+
+	_, err := ConvertCPUValue(1, "kilocores", CPUUnitCores)
+	require.Error(t, err)
+
+	// block results are in whole cores
+	size, err := cpuSizeToBlockResult(2500, CPUUnitMilliCores)
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), size)
+	size, err = cpuSizeToBlockResult(-1, CPUUnitCores)
+	require.NoError(t, err)
+	require.Equal(t, uint64(0), size)
+}
+
+func TestCPUServerCPUUnits(t *testing.T) {
+	t.Parallel()
+
+	cs := newTestCPUServer(t, nil, []*v1.Pod{})
+	cs.headroomResourceManager = &mockHeadroomResourceManager{
+		numaAllocatable: map[int]resource.Quantity{0: resource.MustParse("1500")},
+	}
+	cs.headroomUnit = CPUUnitMilliCores
+	cs.poolSizeUnits = map[string]CPUUnit{commonstate.PoolNameShare: CPUUnitMilliCores}
+
+	info := cs.assembleHeadroom(nil)
+	require.NotNil(t, info)
+	numaHeadroom := cpuadvisor.CPUNUMAHeadroom{}
+	require.NoError(t, json.Unmarshal([]byte(info.CalculationResult.Values[string(cpuadvisor.ControlKnobKeyCPUNUMAHeadroom)]), &numaHeadroom))
+	require.Equal(t, cpuadvisor.CPUNUMAHeadroom{0: 1500}, numaHeadroom)
+
+	// sizes of share pool are in millicores, while sizes of reserve pool are in cores by default
+	result := cs.assembleResponse(&types.InternalCPUCalculationResult{
+		PoolEntries: map[string]map[int]types.CPUResource{
+			commonstate.PoolNameShare:   {0: {Size: 3500}},
+			commonstate.PoolNameReserve: {0: {Size: 2}},
+		},
+	})
+	shareBlocks := result.Entries[commonstate.PoolNameShare].Entries[commonstate.FakedContainerName].CalculationResultsByNumas[0].Blocks
+	require.Len(t, shareBlocks, 1)
+	require.Equal(t, uint64(4), shareBlocks[0].Result)
+	reserveBlocks := result.Entries[commonstate.PoolNameReserve].Entries[commonstate.FakedContainerName].CalculationResultsByNumas[0].Blocks
+	require.Len(t, reserveBlocks, 1)
+	require.Equal(t, uint64(2), reserveBlocks[0].Result)
+}
+
+func TestCPUServerLWWatchdog(t *testing.T) {
+	t.Parallel()
+
+	advisor := &mockCPUResourceAdvisor{
+		provision: &types.InternalCPUCalculationResult{
+			PoolEntries: map[string]map[int]types.CPUResource{
+				commonstate.PoolNameReserve: {0: {Size: 2}},
+			},
+		},
+		err: fmt.Errorf("mock error"),
+	}
+	cs := newTestCPUServer(t, advisor, []*v1.Pod{})
+	emitter := newFakeMetricEmitter()
+	cs.emitter = emitter
+	fakeClock := testingclock.NewFakeClock(time.Now())
+	cs.clock = fakeClock
+	cs.lwWatchdogWindow = time.Minute
+	cs.lastPushSuccessTime = fakeClock.Now()
+
+	clients := []cpuadvisor.CPUPluginClient{
+		&mockCPUPluginClient{checkpoint: &cpuadvisor.GetCheckpointResponse{
+			Entries: map[string]*cpuadvisor.AllocationEntries{
+				commonstate.PoolNameReserve: {
+					Entries: map[string]*cpuadvisor.AllocationInfo{
+						commonstate.FakedContainerName: {OwnerPoolName: commonstate.PoolNameReserve, TopologyAwareAssignments: map[uint64]string{0: "0"}},
+					},
+				},
+			},
+		}},
+	}
+	server := &mockCPUServerService_ListAndWatchServer{ResultsChan: make(chan *cpuadvisor.ListAndWatchResponse, 10)}
+
+	// pushes stall while the loop keeps running, and the watchdog fires once the window is exceeded
+	for i := 0; i < 2; i++ {
+		cs.runPushCycle(clients, server)
+		require.NoError(t, cs.checkLWWatchdog())
+		fakeClock.Step(40 * time.Second)
+	}
+	require.Error(t, cs.checkLWWatchdog())
+	triggered, ok := emitter.get(cs.genMetricsName(metricCPUServerLWWatchdogTriggered))
+	require.True(t, ok)
+	require.Equal(t, int64(1), triggered)
+
+	// a successful push resets the watchdog
+	advisor.err = nil
+	cs.runPushCycle(clients, server)
+	require.NoError(t, cs.checkLWWatchdog())
+	fakeClock.Step(40 * time.Second)
+	require.NoError(t, cs.checkLWWatchdog())
+
+	// the watchdog is disabled if the window is zero
+	cs.lwWatchdogWindow = 0
+	fakeClock.Step(time.Hour)
+	require.NoError(t, cs.checkLWWatchdog())
+}
+
+func TestCPUServerCarryForwardAbsentPools(t *testing.T) {
+	t.Parallel()
+
+	cs := newTestCPUServer(t, nil, []*v1.Pod{})
+	emitter := newFakeMetricEmitter()
+	cs.emitter = emitter
+	fakeClock := testingclock.NewFakeClock(time.Now())
+	cs.clock = fakeClock
+	cs.absentPoolCarryForwardWindow = time.Minute
+
+	// pool share-a is cached from a prior sync, but absent from the advisor result
+	require.NoError(t, cs.metaCache.SetPoolInfo("share-a", &types.PoolInfo{
+		PoolName: "share-a",
+		TopologyAwareAssignments: map[int]machine.CPUSet{
+			0: machine.MustParse("0-3"),
+			1: machine.MustParse("8-9"),
+		},
+	}))
+	advisorResp := &types.InternalCPUCalculationResult{
+		PoolEntries: map[string]map[int]types.CPUResource{
+			commonstate.PoolNameShare: {0: {Size: 4}},
+		},
+	}
+	poolSizes := func(result *cpuInternalResult, poolName string) map[int64]uint64 {
+		entries, ok := result.Entries[poolName]
+		if !ok {
+			return nil
+		}
+		sizes := make(map[int64]uint64)
+		for numaID, numaCalculationResult := range entries.Entries[commonstate.FakedContainerName].CalculationResultsByNumas {
+			for _, block := range numaCalculationResult.Blocks {
+				sizes[numaID] += block.Result
+			}
+		}
+		return sizes
+	}
+
+	// the absent pool is carried forward at its cached size within the grace window
+	for i := 0; i < 2; i++ {
+		result := cs.assembleResponse(advisorResp)
+		require.Equal(t, map[int64]uint64{0: 4, 1: 2}, poolSizes(result, "share-a"))
+		require.Equal(t, map[int64]uint64{0: 4}, poolSizes(result, commonstate.PoolNameShare))
+		fakeClock.Step(40 * time.Second)
+	}
+	carried, ok := emitter.getTagged(cs.genMetricsName(metricCPUServerAbsentPoolCarriedForward), metrics.MetricTag{Key: "pool", Val: "share-a"})
+	require.True(t, ok)
+	require.Equal(t, int64(1), carried)
+	// the advisor result itself is kept as is
+	require.NotContains(t, advisorResp.PoolEntries, "share-a")
+
+	// the pool is dropped once the grace window is exceeded
+	result := cs.assembleResponse(advisorResp)
+	require.Nil(t, poolSizes(result, "share-a"))
+
+	// pools are dropped immediately if carrying forward is disabled
+	cs.absentPoolCarryForwardWindow = 0
+	result = cs.assembleResponse(advisorResp)
+	require.Nil(t, poolSizes(result, "share-a"))
+}
+
+func TestCPUServerIsolationTransitionDamping(t *testing.T) {
+	t.Parallel()
+
+	cs := newTestCPUServer(t, nil, []*v1.Pod{})
+	emitter := newFakeMetricEmitter()
+	cs.emitter = emitter
+	fakeClock := testingclock.NewFakeClock(time.Now())
+	cs.clock = fakeClock
+	cs.isolationTransitionMinGap = time.Minute
+
+	advisorResp := &types.InternalCPUCalculationResult{
+		PoolEntries: map[string]map[int]types.CPUResource{
+			commonstate.PoolNameShare: {-1: {Size: 4}},
+			"isolation-pod1":          {-1: {Size: 2}},
+		},
+	}
+	assemble := func(isolated bool) (string, PlacementReason) {
+		require.NoError(t, cs.metaCache.SetContainerInfo("pod1", "c1", &types.ContainerInfo{
+			PodUID:              "pod1",
+			ContainerName:       "c1",
+			QoSLevel:            consts.PodAnnotationQoSLevelSharedCores,
+			OwnerPoolName:       commonstate.PoolNameShare,
+			OriginOwnerPoolName: commonstate.PoolNameShare,
+			RegionNames:         sets.NewString("isolation-pod1"),
+			Isolated:            isolated,
+		}))
+		resp := cs.assembleResponse(advisorResp)
+		return resp.Entries["pod1"].Entries["c1"].OwnerPoolName, resp.PlacementReasons["pod1"]["c1"]
+	}
+
+	ownerPoolName, reason := assemble(false)
+	require.Equal(t, commonstate.PoolNameShare, ownerPoolName)
+	require.Equal(t, PlacementReasonOwnerPool, reason)
+
+	// isolation flaps within the min gap, and the container stays in share pool
+	for i := 0; i < 3; i++ {
+		fakeClock.Step(10 * time.Second)
+		ownerPoolName, reason = assemble(true)
+		require.Equal(t, commonstate.PoolNameShare, ownerPoolName)
+		require.Equal(t, PlacementReasonIsolationDamped, reason)
+
+		fakeClock.Step(10 * time.Second)
+		ownerPoolName, reason = assemble(false)
+		require.Equal(t, commonstate.PoolNameShare, ownerPoolName)
+		require.Equal(t, PlacementReasonOwnerPool, reason)
+	}
+	damped, ok := emitter.getTagged(cs.genMetricsName(metricCPUServerIsolationTransitionDamped),
+		metrics.MetricTag{Key: "reason", Val: string(PlacementReasonIsolationLockIn)})
+	require.True(t, ok)
+	require.Equal(t, int64(1), damped)
+
+	// isolation lasts for the min gap, and the container is switched to isolation pool
+	fakeClock.Step(10 * time.Second)
+	ownerPoolName, _ = assemble(true)
+	require.Equal(t, commonstate.PoolNameShare, ownerPoolName)
+	fakeClock.Step(time.Minute)
+	ownerPoolName, reason = assemble(true)
+	require.Equal(t, "isolation-pod1", ownerPoolName)
+	require.Equal(t, PlacementReasonIsolationLockIn, reason)
+
+	// transitions of containers not assembled any more are dropped
+	require.NoError(t, cs.metaCache.DeleteContainer("pod1", "c1"))
+	cs.assembleResponse(advisorResp)
+	require.Empty(t, cs.isolationTransitions)
+}
+
+func TestCPUServerReportGCProtectedPools(t *testing.T) {
+	t.Parallel()
+
+	cs := newTestCPUServer(t, nil, []*v1.Pod{})
+	emitter := newFakeMetricEmitter()
+	cs.emitter = emitter
+
+	for _, poolName := range []string{commonstate.PoolNameReserve, "share-a", "share-b"} {
+		require.NoError(t, cs.metaCache.SetPoolInfo(poolName, &types.PoolInfo{PoolName: poolName}))
+	}
+	// share-a is absent from checkpoint, but still the original owner pool of a living container
+	require.NoError(t, cs.metaCache.AddContainer("pod1", "c1", &types.ContainerInfo{
+		PodUID:              "pod1",
+		ContainerName:       "c1",
+		QoSLevel:            consts.PodAnnotationQoSLevelSharedCores,
+		OwnerPoolName:       commonstate.PoolNameShare,
+		OriginOwnerPoolName: "share-a",
+	}))
+	resp := &cpuadvisor.GetCheckpointResponse{
+		Entries: map[string]*cpuadvisor.AllocationEntries{
+			commonstate.PoolNameReserve: {
+				Entries: map[string]*cpuadvisor.AllocationInfo{
+					commonstate.FakedContainerName: {OwnerPoolName: commonstate.PoolNameReserve, TopologyAwareAssignments: map[uint64]string{0: "0"}},
+				},
+			},
+			"pod1": {
+				Entries: map[string]*cpuadvisor.AllocationInfo{
+					"c1": {OwnerPoolName: commonstate.PoolNameShare},
+				},
+			},
+		},
+	}
+	cs.gcCheckpoint(resp, sets.NewString(commonstate.PoolNameReserve), 0)
+
+	_, ok := cs.metaCache.GetPoolInfo("share-a")
+	require.True(t, ok)
+	_, ok = cs.metaCache.GetPoolInfo("share-b")
+	require.False(t, ok)
+
+	protected, ok := emitter.getTagged(cs.genMetricsName(metricCPUServerPoolGCProtected),
+		metrics.MetricTag{Key: "pool", Val: "share-a"},
+		metrics.MetricTag{Key: "reason", Val: string(PoolGCProtectionReasonContainerReference)})
+	require.True(t, ok)
+	require.Equal(t, int64(1), protected)
+	for _, poolName := range []string{commonstate.PoolNameReserve, "share-b"} {
+		_, ok = emitter.getTagged(cs.genMetricsName(metricCPUServerPoolGCProtected),
+			metrics.MetricTag{Key: "pool", Val: poolName},
+			metrics.MetricTag{Key: "reason", Val: string(PoolGCProtectionReasonContainerReference)})
+		require.False(t, ok)
+	}
+	count, ok := emitter.get(cs.genMetricsName(metricCPUServerPoolGCProtectedCount))
+	require.True(t, ok)
+	require.Equal(t, int64(1), count)
+}
+
+func TestCPUServerNUMAHeadroomAgainstDedicated(t *testing.T) {
+	t.Parallel()
+
+	cs := newTestCPUServer(t, nil, []*v1.Pod{})
+	emitter := newFakeMetricEmitter()
+	cs.emitter = emitter
+	cs.validateNUMAHeadroomAgainstDedicated = true
+
+	cpuTopology, err := machine.GenerateDummyCPUTopology(16, 2, 2)
+	require.NoError(t, err)
+	cs.metaServer.KatalystMachineInfo = &machine.KatalystMachineInfo{CPUTopology: cpuTopology}
+	// headroom is reported in milli cores
+	cs.headroomResourceManager = &mockHeadroomResourceManager{
+		numaAllocatable: map[int]resource.Quantity{
+			0: resource.MustParse("4k"),
+			1: resource.MustParse("6k"),
+		},
+	}
+
+	// the main container and sidecar share the same cpus on each numa
+	for _, containerName := range []string{"c1", "sidecar"} {
+		require.NoError(t, cs.metaCache.AddContainer("pod1", containerName, &types.ContainerInfo{
+			PodUID:        "pod1",
+			ContainerName: containerName,
+			QoSLevel:      consts.PodAnnotationQoSLevelDedicatedCores,
+			TopologyAwareAssignments: types.TopologyAwareAssignment{
+				0: machine.NewCPUSet(0, 1, 8, 9),
+				1: machine.NewCPUSet(4, 5, 12),
+			},
+		}))
+	}
+
+	// numa 0: 4 (dedicated) + 4 (headroom) = 8, which is consistent
+	// numa 1: 3 (dedicated) + 6 (headroom) = 9, which exceeds 8 cpus
+	cs.assembleResponse(&types.InternalCPUCalculationResult{
+		PoolEntries: map[string]map[int]types.CPUResource{
+			commonstate.PoolNameReserve: {0: {Size: 2}},
+		},
+	})
+
+	for numaID, want := range map[int]int64{0: 0, 1: 1} {
+		overcommitted, ok := emitter.getTagged(cs.genMetricsName(metricCPUServerNUMAHeadroomOvercommitted),
+			metrics.MetricTag{Key: "numa", Val: strconv.Itoa(numaID)})
+		require.True(t, ok)
+		require.Equal(t, want, overcommitted)
+	}
+}
+
+func TestCPUServerPoolOverlapPriorities(t *testing.T) {
+	t.Parallel()
+
+	cs := newTestCPUServer(t, nil, []*v1.Pod{})
+	cs.poolOverlapPriorities = map[string]int{"share-a": 10, "share-c": 5}
+
+	advisorResp := &types.InternalCPUCalculationResult{
+		PoolEntries: map[string]map[int]types.CPUResource{
+			"share-a":                   {0: {Size: 4}},
+			"share-b":                   {0: {Size: 4}},
+			"share-c":                   {0: {Size: 4}},
+			"share-d":                   {0: {Size: 4}},
+			commonstate.PoolNameReclaim: {0: {Size: 0}},
+		},
+		PoolOverlapInfo:                       map[string]map[int]map[string]int{},
+		AllowSharedCoresOverlapReclaimedCores: true,
+	}
+	for _, poolName := range []string{"share-a", "share-b", "share-c", "share-d"} {
+		advisorResp.SetPoolOverlapInfo(commonstate.PoolNameReclaim, 0, poolName, 2)
+	}
+	calculationEntriesMap := make(map[string]*cpuadvisor.CalculationEntries)
+	cs.assemblePoolEntries(advisorResp, calculationEntriesMap, NewBlockSet(), nil)
+
+	// shared blocks are split on overlapping, so all blocks of each pool are referred to
+	blockOwners := make(map[string]string)
+	for _, poolName := range []string{"share-a", "share-b", "share-c", "share-d"} {
+		for _, block := range calculationEntriesMap[poolName].Entries[commonstate.FakedContainerName].CalculationResultsByNumas[0].Blocks {
+			blockOwners[block.BlockId] = poolName
+		}
+	}
+	overlappedPools := make([]string, 0)
+	for _, block := range calculationEntriesMap[commonstate.PoolNameReclaim].Entries[commonstate.FakedContainerName].CalculationResultsByNumas[0].Blocks {
+		overlappedPools = append(overlappedPools, blockOwners[block.BlockId])
+	}
+	// pools not listed are of priority zero, and overlapped first in name order
+	require.Equal(t, []string{"share-b", "share-d", "share-c", "share-a"}, overlappedPools)
+}
+
+func TestCPUServerReportCPUManagerPolicy(t *testing.T) {
+	t.Parallel()
+
+	advisor := &mockCPUResourceAdvisor{
+		provision: &types.InternalCPUCalculationResult{
+			PoolEntries: map[string]map[int]types.CPUResource{
+				commonstate.PoolNameReserve: {0: {Size: 2}},
+			},
+		},
+	}
+	cs := newTestCPUServer(t, advisor, []*v1.Pod{})
+	cs.adviceInputSnapshotLimit = 1
+
+	getPolicy := func(resp *cpuInternalResult) (string, bool) {
+		for _, calculationInfo := range resp.ExtraEntries {
+			if policy, ok := calculationInfo.CalculationResult.Values[string(cpuadvisor.ControlKnobKeyCPUManagerPolicy)]; ok {
+				return policy, true
+			}
+		}
+		return "", false
+	}
+
+	// the policy is unknown without kubelet config
+	_, err := cs.updateAdvisor(context.TODO(), map[string]*advisorsvc.FeatureGate{})
+	require.NoError(t, err)
+	require.Empty(t, cs.adviceInputSnapshots[1].CPUManagerPolicy)
+
+	cs.metaServer.KubeletConfigFetcher = kubeletconfig.NewFakeKubeletConfigFetcher(native.KubeletConfiguration{
+		CPUManagerPolicy: "static",
+	})
+	_, err = cs.updateAdvisor(context.TODO(), map[string]*advisorsvc.FeatureGate{})
+	require.NoError(t, err)
+	require.Equal(t, "static", cs.adviceInputSnapshots[2].CPUManagerPolicy)
+
+	// the policy is reported in advice only if enabled
+	_, ok := getPolicy(cs.assembleResponse(advisor.provision))
+	require.False(t, ok)
+	cs.reportCPUManagerPolicy = true
+	policy, ok := getPolicy(cs.assembleResponse(advisor.provision))
+	require.True(t, ok)
+	require.Equal(t, "static", policy)
+}
+
+func TestCPUServerContainerCPUFloors(t *testing.T) {
+	t.Parallel()
+
+	cs := newTestCPUServer(t, nil, []*v1.Pod{})
+	emitter := newFakeMetricEmitter()
+	cs.emitter = emitter
+	cs.containerMinCPUFloors = map[string]int{
+		consts.PodAnnotationQoSLevelSharedCores:    1,
+		consts.PodAnnotationQoSLevelReclaimedCores: 2,
+	}
+
+	require.NoError(t, cs.metaCache.AddContainer("pod1", "c1", &types.ContainerInfo{
+		PodUID:              "pod1",
+		ContainerName:       "c1",
+		QoSLevel:            consts.PodAnnotationQoSLevelSharedCores,
+		OwnerPoolName:       commonstate.PoolNameShare,
+		OriginOwnerPoolName: commonstate.PoolNameShare,
+	}))
+	require.NoError(t, cs.metaCache.AddContainer("pod2", "c1", &types.ContainerInfo{
+		PodUID:              "pod2",
+		ContainerName:       "c1",
+		QoSLevel:            consts.PodAnnotationQoSLevelReclaimedCores,
+		OwnerPoolName:       commonstate.PoolNameReclaim,
+		OriginOwnerPoolName: commonstate.PoolNameReclaim,
+	}))
+
+	getPoolSizes := func(resp *cpuInternalResult, poolName string) map[int64]uint64 {
+		sizes := make(map[int64]uint64)
+		for numaID, result := range resp.Entries[poolName].Entries[commonstate.FakedContainerName].CalculationResultsByNumas {
+			for _, block := range result.Blocks {
+				sizes[numaID] += block.Result
+			}
+		}
+		return sizes
+	}
+
+	// both pools are squeezed below floors of their containers
+	advisorResp := &types.InternalCPUCalculationResult{
+		PoolEntries: map[string]map[int]types.CPUResource{
+			commonstate.PoolNameShare:   {commonstate.FakedNUMAID: {Size: 0}},
+			commonstate.PoolNameReclaim: {0: {Size: 0}, 1: {Size: 1}},
+		},
+		PoolOverlapInfo: map[string]map[int]map[string]int{},
+	}
+	resp := cs.assembleResponse(advisorResp)
+	require.Equal(t, map[int64]uint64{commonstate.FakedNUMAID: 1}, getPoolSizes(resp, commonstate.PoolNameShare))
+	require.Equal(t, map[int64]uint64{1: 2}, getPoolSizes(resp, commonstate.PoolNameReclaim))
+	for poolName, want := range map[string]int64{commonstate.PoolNameShare: 1, commonstate.PoolNameReclaim: 1} {
+		applied, ok := emitter.getTagged(cs.genMetricsName(metricCPUServerContainerCPUFloorApplied),
+			metrics.MetricTag{Key: "pool", Val: poolName})
+		require.True(t, ok)
+		require.Equal(t, want, applied)
+	}
+	// the advisor result is not modified
+	require.Equal(t, 0, advisorResp.PoolEntries[commonstate.PoolNameShare][commonstate.FakedNUMAID].Size)
+
+	// overlapped cpus are counted for reclaim pool
+	emitter = newFakeMetricEmitter()
+	cs.emitter = emitter
+	advisorResp = &types.InternalCPUCalculationResult{
+		PoolEntries: map[string]map[int]types.CPUResource{
+			commonstate.PoolNameShare:   {0: {Size: 4}},
+			commonstate.PoolNameReclaim: {0: {Size: 0}},
+		},
+		PoolOverlapInfo:                       map[string]map[int]map[string]int{},
+		AllowSharedCoresOverlapReclaimedCores: true,
+	}
+	advisorResp.SetPoolOverlapInfo(commonstate.PoolNameReclaim, 0, commonstate.PoolNameShare, 2)
+	cs.assembleResponse(advisorResp)
+	_, ok := emitter.getTagged(cs.genMetricsName(metricCPUServerContainerCPUFloorApplied),
+		metrics.MetricTag{Key: "pool", Val: commonstate.PoolNameReclaim})
+	require.False(t, ok)
+}
+
+func TestCPUServerReclaimPoolFloor(t *testing.T) {
+	t.Parallel()
+
+	cs := newTestCPUServer(t, nil, []*v1.Pod{})
+	cpuTopology, err := machine.GenerateDummyCPUTopology(16, 2, 2)
+	require.NoError(t, err)
+	cs.metaServer.KatalystMachineInfo = &machine.KatalystMachineInfo{CPUTopology: cpuTopology}
+	emitter := newFakeMetricEmitter()
+	cs.emitter = emitter
+	// the floor is 2 cores, i.e. a quarter of 8 cpus on each numa
+	cs.reclaimPoolMinCoresPerNUMA = 1
+	cs.reclaimPoolMinRatioPerNUMA = 0.25
+	cs.poolOverlapPriorities = map[string]int{"share-a": -1}
+
+	require.NoError(t, cs.metaCache.AddContainer("pod1", "c1", &types.ContainerInfo{
+		PodUID:              "pod1",
+		ContainerName:       "c1",
+		QoSLevel:            consts.PodAnnotationQoSLevelDedicatedCores,
+		OwnerPoolName:       commonstate.PoolNameDedicated,
+		OriginOwnerPoolName: commonstate.PoolNameDedicated,
+	}))
+
+	// the deficit on numa 0 is borrowed from lower-priority shared pools first, and dedicated pods are never borrowed from
+	advisorResp := &types.InternalCPUCalculationResult{
+		PoolEntries: map[string]map[int]types.CPUResource{
+			"pod1":                      {0: {Size: 4}},
+			commonstate.PoolNameShare:   {0: {Size: 6}},
+			"share-a":                   {0: {Size: 1}},
+			commonstate.PoolNameReclaim: {0: {Size: 0}, 1: {Size: 3}},
+		},
+		PoolOverlapInfo: map[string]map[int]map[string]int{},
+	}
+	adjusted := cs.applyReclaimPoolFloor(advisorResp)
+	require.Equal(t, map[int]types.CPUResource{0: {Size: 2}, 1: {Size: 3}}, adjusted.PoolEntries[commonstate.PoolNameReclaim])
+	require.Equal(t, map[int]types.CPUResource{0: {Size: 5}}, adjusted.PoolEntries[commonstate.PoolNameShare])
+	require.Equal(t, map[int]types.CPUResource{0: {Size: 0}}, adjusted.PoolEntries["share-a"])
+	require.Equal(t, map[int]types.CPUResource{0: {Size: 4}}, adjusted.PoolEntries["pod1"])
+	for poolName, want := range map[string]int64{commonstate.PoolNameShare: 1, "share-a": 1} {
+		borrowed, ok := emitter.getTagged(cs.genMetricsName(metricCPUServerReclaimFloorBorrowed),
+			metrics.MetricTag{Key: "pool", Val: poolName}, metrics.MetricTag{Key: "numa", Val: "0"})
+		require.True(t, ok)
+		require.Equal(t, want, borrowed)
+	}
+	// the advisor result is not modified
+	require.Equal(t, 0, advisorResp.PoolEntries[commonstate.PoolNameReclaim][0].Size)
+	require.Equal(t, 6, advisorResp.PoolEntries[commonstate.PoolNameShare][0].Size)
+
+	// the computed size is kept if the numa is fully committed
+	advisorResp = &types.InternalCPUCalculationResult{
+		PoolEntries: map[string]map[int]types.CPUResource{
+			commonstate.PoolNameShare:   {0: {Size: 1}},
+			commonstate.PoolNameReclaim: {0: {Size: 0}},
+		},
+		PoolOverlapInfo: map[string]map[int]map[string]int{},
+	}
+	require.Same(t, advisorResp, cs.applyReclaimPoolFloor(advisorResp))
+	unsatisfied, ok := emitter.getTagged(cs.genMetricsName(metricCPUServerReclaimFloorUnsatisfied),
+		metrics.MetricTag{Key: "numa", Val: "0"})
+	require.True(t, ok)
+	require.Equal(t, int64(1), unsatisfied)
+
+	// overlapped cpus are counted for reclaim pool
+	advisorResp = &types.InternalCPUCalculationResult{
+		PoolEntries: map[string]map[int]types.CPUResource{
+			commonstate.PoolNameShare:   {0: {Size: 4}},
+			commonstate.PoolNameReclaim: {0: {Size: 0}},
+		},
+		PoolOverlapInfo:                       map[string]map[int]map[string]int{},
+		AllowSharedCoresOverlapReclaimedCores: true,
+	}
+	advisorResp.SetPoolOverlapInfo(commonstate.PoolNameReclaim, 0, commonstate.PoolNameShare, 2)
+	require.Same(t, advisorResp, cs.applyReclaimPoolFloor(advisorResp))
+
+	// shared pools keep the cpu floor of their containers and the cpus already overlapped with reclaim pool
+	cs.reclaimPoolMinCoresPerNUMA = 4
+	cs.containerMinCPUFloors = map[string]int{consts.PodAnnotationQoSLevelSharedCores: 2}
+	require.NoError(t, cs.metaCache.AddContainer("pod2", "c1", &types.ContainerInfo{
+		PodUID:              "pod2",
+		ContainerName:       "c1",
+		QoSLevel:            consts.PodAnnotationQoSLevelSharedCores,
+		OwnerPoolName:       commonstate.PoolNameShare,
+		OriginOwnerPoolName: commonstate.PoolNameShare,
+	}))
+	newAdvisorResp := func(shareSize int) *types.InternalCPUCalculationResult {
+		resp := &types.InternalCPUCalculationResult{
+			PoolEntries: map[string]map[int]types.CPUResource{
+				commonstate.PoolNameShare:   {0: {Size: shareSize}},
+				"share-a":                   {0: {Size: 2}},
+				commonstate.PoolNameReclaim: {0: {Size: 0}},
+			},
+			PoolOverlapInfo:                       map[string]map[int]map[string]int{},
+			AllowSharedCoresOverlapReclaimedCores: true,
+		}
+		resp.SetPoolOverlapInfo(commonstate.PoolNameReclaim, 0, "share-a", 1)
+		return resp
+	}
+
+	// share-a lends 1 core beyond its overlap and share lends 1 core above its floor, which can't cover the deficit 3
+	advisorResp = newAdvisorResp(3)
+	require.Same(t, advisorResp, cs.applyReclaimPoolFloor(advisorResp))
+	unsatisfied, ok = emitter.getTagged(cs.genMetricsName(metricCPUServerReclaimFloorUnsatisfied),
+		metrics.MetricTag{Key: "numa", Val: "0"})
+	require.True(t, ok)
+	require.Equal(t, int64(1), unsatisfied)
+
+	// borrowing stops at the floor of share
+	advisorResp = newAdvisorResp(4)
+	adjusted = cs.applyReclaimPoolFloor(advisorResp)
+	require.Equal(t, map[int]types.CPUResource{0: {Size: 3}}, adjusted.PoolEntries[commonstate.PoolNameReclaim])
+	require.Equal(t, map[int]types.CPUResource{0: {Size: 2}}, adjusted.PoolEntries[commonstate.PoolNameShare])
+	require.Equal(t, map[int]types.CPUResource{0: {Size: 1}}, adjusted.PoolEntries["share-a"])
+}
+
+func TestCPUServerDrainListAndWatch(t *testing.T) {
+	t.Parallel()
+
+	checkpoint := &cpuadvisor.GetCheckpointResponse{
+		Entries: map[string]*cpuadvisor.AllocationEntries{
+			commonstate.PoolNameReserve: {
+				Entries: map[string]*cpuadvisor.AllocationInfo{
+					commonstate.FakedContainerName: {OwnerPoolName: commonstate.PoolNameReserve, TopologyAwareAssignments: map[uint64]string{0: "0"}},
+				},
+			},
+		},
+	}
+	tests := []struct {
+		name        string
+		delay       time.Duration
+		wantSuccess bool
+		wantPushed  int
+	}{
+		{
+			name:        "drain push succeeds",
+			wantSuccess: true,
+			wantPushed:  1,
+		},
+		{
+			name:        "drain push times out",
+			delay:       time.Second,
+			wantSuccess: false,
+			wantPushed:  0,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			advisor := &mockCPUResourceAdvisor{
+				provision: &types.InternalCPUCalculationResult{
+					PoolEntries: map[string]map[int]types.CPUResource{
+						commonstate.PoolNameReserve: {0: {Size: 2}},
+						commonstate.PoolNameShare:   {0: {Size: 4}},
+					},
+				},
+			}
+			cs := newTestCPUServer(t, advisor, []*v1.Pod{})
+			emitter := newFakeMetricEmitter()
+			cs.emitter = emitter
+			cs.drainTimeout = 100 * time.Millisecond
+			require.NoError(t, cs.metaCache.SetPoolInfo(commonstate.PoolNameReserve, &types.PoolInfo{
+				PoolName:                 commonstate.PoolNameReserve,
+				TopologyAwareAssignments: map[int]machine.CPUSet{0: machine.NewCPUSet(0)},
+			}))
+
+			server := &mockCPUServerService_ListAndWatchServer{ResultsChan: make(chan *cpuadvisor.ListAndWatchResponse, 1)}
+			start := time.Now()
+			cs.drainListAndWatch([]cpuadvisor.CPUPluginClient{
+				&mockCPUPluginClient{delay: tt.delay, checkpoint: checkpoint},
+			}, server)
+			// the drain never waits beyond drainTimeout
+			require.Less(t, time.Since(start), 500*time.Millisecond)
+			require.Len(t, server.ResultsChan, tt.wantPushed)
+
+			drained, ok := emitter.getTagged(cs.genMetricsName(metricCPUServerLWDrainPush),
+				metrics.MetricTag{Key: "success", Val: strconv.FormatBool(tt.wantSuccess)})
+			require.True(t, ok)
+			require.Equal(t, int64(1), drained)
+		})
+	}
+}
+
+func TestCPUServerReclaimPoolMaxShrinkPerCycle(t *testing.T) {
+	t.Parallel()
+
+	cs := newTestCPUServer(t, nil, []*v1.Pod{})
+	emitter := newFakeMetricEmitter()
+	cs.emitter = emitter
+	cs.reclaimPoolMaxShrinkPerCycle = 2
+
+	assembleReclaimSizes := func(numaSizes map[int]int) map[int64]uint64 {
+		advisorResp := &types.InternalCPUCalculationResult{
+			PoolEntries: map[string]map[int]types.CPUResource{
+				commonstate.PoolNameShare:   {0: {Size: 4}, 1: {Size: 4}},
+				commonstate.PoolNameReclaim: {},
+			},
+		}
+		for numaID, size := range numaSizes {
+			advisorResp.PoolEntries[commonstate.PoolNameReclaim][numaID] = types.CPUResource{Size: size}
+		}
+		calculationEntriesMap := make(map[string]*cpuadvisor.CalculationEntries)
+		cs.assemblePoolEntries(advisorResp, calculationEntriesMap, NewBlockSet(), nil)
+
+		sizes := make(map[int64]uint64)
+		for numaID, numaCalculationResult := range calculationEntriesMap[commonstate.PoolNameReclaim].Entries[commonstate.FakedContainerName].CalculationResultsByNumas {
+			for _, block := range numaCalculationResult.Blocks {
+				sizes[numaID] += block.Result
+			}
+		}
+		return sizes
+	}
+
+	// the first advice is not clamped
+	require.Equal(t, map[int64]uint64{0: 8, 1: 8}, assembleReclaimSizes(map[int]int{0: 8, 1: 8}))
+
+	// reclaim pool on numa 0 shrinks faster than the limit, and is clamped
+	require.Equal(t, map[int64]uint64{0: 6, 1: 7}, assembleReclaimSizes(map[int]int{0: 2, 1: 7}))
+	clamped, ok := emitter.getTagged(cs.genMetricsName(metricCPUServerReclaimPoolShrinkClamped), metrics.MetricTag{Key: "numa", Val: "0"})
+	require.True(t, ok)
+	require.Equal(t, int64(4), clamped)
+	_, ok = emitter.getTagged(cs.genMetricsName(metricCPUServerReclaimPoolShrinkClamped), metrics.MetricTag{Key: "numa", Val: "1"})
+	require.False(t, ok)
+
+	// it keeps shrinking at the limit until the advised size is reached
+	require.Equal(t, map[int64]uint64{0: 4, 1: 7}, assembleReclaimSizes(map[int]int{0: 2, 1: 7}))
+	require.Equal(t, map[int64]uint64{0: 2, 1: 7}, assembleReclaimSizes(map[int]int{0: 2, 1: 7}))
+
+	// growth is never limited
+	require.Equal(t, map[int64]uint64{0: 8, 1: 7}, assembleReclaimSizes(map[int]int{0: 8, 1: 7}))
+}
+
+func TestCPUServerConnectPluginWithBackoff(t *testing.T) {
+	t.Parallel()
+
+	socketPath := path.Join(t.TempDir(), "missing.sock")
+
+	// give up after max elapsed time if the socket keeps missing
+	cs := newTestCPUServer(t, nil, []*v1.Pod{})
+	emitter := newFakeMetricEmitter()
+	cs.emitter = emitter
+	cs.pluginDialBackoffInitialInterval = 10 * time.Millisecond
+	cs.pluginDialBackoffMaxElapsedTime = 200 * time.Millisecond
+
+	start := time.Now()
+	_, err := cs.connectPluginWithBackoff(context.TODO(), socketPath)
+	require.ErrorIs(t, err, errPluginSocketMissing)
+	require.GreaterOrEqual(t, time.Since(start), 200*time.Millisecond)
+	failed, ok := emitter.getTagged(cs.genMetricsName(metricCPUServerPluginDialFailed), metrics.MetricTag{Key: "reason", Val: "socket-missing"})
+	require.True(t, ok)
+	require.Equal(t, int64(1), failed)
+
+	// no retry if max elapsed time is zero
+	cs.pluginDialBackoffMaxElapsedTime = 0
+	start = time.Now()
+	_, err = cs.connectPluginWithBackoff(context.TODO(), socketPath)
+	require.ErrorIs(t, err, errPluginSocketMissing)
+	require.Less(t, time.Since(start), 100*time.Millisecond)
+
+	// backoff is interrupted once the stream is cancelled
+	cs.pluginDialBackoffMaxElapsedTime = time.Minute
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		cancel()
+	}()
+	start = time.Now()
+	_, err = cs.connectPluginWithBackoff(ctx, socketPath)
+	require.ErrorIs(t, err, errPluginSocketMissing)
+	require.ErrorContains(t, err, context.Canceled.Error())
+	require.Less(t, time.Since(start), 10*time.Second)
+
+	// ListAndWatch exits during backoff once its stream is cancelled
+	cs.pluginSocketPaths = []string{socketPath}
+	ctx, cancel = context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		cancel()
+	}()
+	start = time.Now()
+	err = cs.ListAndWatch(&advisorsvc.Empty{}, &mockCPUServerService_ListAndWatchServer{
+		ResultsChan: make(chan *cpuadvisor.ListAndWatchResponse), ctx: ctx,
+	})
+	require.ErrorIs(t, err, errPluginSocketMissing)
+	require.Less(t, time.Since(start), 10*time.Second)
+
+	// backoff is interrupted once cpu server stops
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		close(cs.stopCh)
+	}()
+	start = time.Now()
+	_, err = cs.connectPluginWithBackoff(context.TODO(), socketPath)
+	require.ErrorIs(t, err, errPluginSocketMissing)
+	require.Less(t, time.Since(start), 10*time.Second)
+}
+
+func TestCPUServerRemoveDuplicateBlocks(t *testing.T) {
+	t.Parallel()
+
+	cs := newTestCPUServer(t, nil, []*v1.Pod{})
+	emitter := newFakeMetricEmitter()
+	cs.emitter = emitter
+
+	b1, b2 := NewBlock(4, "b1"), NewBlock(2, "b2")
+	shareNUMAResult := &cpuadvisor.NumaCalculationResult{Blocks: []*cpuadvisor.Block{b1, b2, b1, NewBlock(4, "b1")}}
+	shareEntries := NewPoolCalculationEntries(commonstate.PoolNameShare)
+	shareEntries.Entries[commonstate.FakedContainerName].CalculationResultsByNumas[0] = shareNUMAResult
+	reserveEntries := NewPoolCalculationEntries(commonstate.PoolNameReserve)
+	reserveEntries.Entries[commonstate.FakedContainerName].CalculationResultsByNumas[1] = &cpuadvisor.NumaCalculationResult{
+		Blocks: []*cpuadvisor.Block{NewBlock(2, "b3")},
+	}
+	calculationEntriesMap := map[string]*cpuadvisor.CalculationEntries{
+		commonstate.PoolNameShare:   shareEntries,
+		commonstate.PoolNameReserve: reserveEntries,
+		// the numa result of share pool is shared by the container placed in it
+		"pod1": {Entries: map[string]*cpuadvisor.CalculationInfo{
+			"c1": {
+				OwnerPoolName:             commonstate.PoolNameShare,
+				CalculationResultsByNumas: map[int64]*cpuadvisor.NumaCalculationResult{0: shareNUMAResult},
+			},
+		}},
+	}
+
+	cs.removeDuplicateBlocks(calculationEntriesMap)
+	require.Equal(t, []*cpuadvisor.Block{b1, b2}, shareNUMAResult.Blocks)
+	require.Len(t, reserveEntries.Entries[commonstate.FakedContainerName].CalculationResultsByNumas[1].Blocks, 1)
+	removed, ok := emitter.get(cs.genMetricsName(metricCPUServerDuplicateBlocksRemoved))
+	require.True(t, ok)
+	require.Equal(t, int64(2), removed)
+}
+
+func TestCPUServerGetAdviceSerializedWithListAndWatch(t *testing.T) {
+	t.Parallel()
+
+	var inFlight, maxInFlight int32
+	advisor := &mockCPUResourceAdvisor{
+		onUpdate: func() {
+			n := atomic.AddInt32(&inFlight, 1)
+			defer atomic.AddInt32(&inFlight, -1)
+			for {
+				old := atomic.LoadInt32(&maxInFlight)
+				if n <= old || atomic.CompareAndSwapInt32(&maxInFlight, old, n) {
+					break
+				}
+			}
+			time.Sleep(10 * time.Millisecond)
+		},
+		provision: &types.InternalCPUCalculationResult{
+			PoolEntries: map[string]map[int]types.CPUResource{
+				commonstate.PoolNameReserve: {0: {Size: 2}},
+				commonstate.PoolNameShare:   {0: {Size: 4}},
+			},
+		},
+	}
+	cs := newTestCPUServer(t, advisor, []*v1.Pod{})
+
+	reserveAllocationInfo := &cpuadvisor.AllocationInfo{
+		OwnerPoolName:            commonstate.PoolNameReserve,
+		TopologyAwareAssignments: map[uint64]string{0: "0"},
+	}
+	clients := []cpuadvisor.CPUPluginClient{
+		&mockCPUPluginClient{checkpoint: &cpuadvisor.GetCheckpointResponse{
+			Entries: map[string]*cpuadvisor.AllocationEntries{
+				commonstate.PoolNameReserve: {
+					Entries: map[string]*cpuadvisor.AllocationInfo{commonstate.FakedContainerName: reserveAllocationInfo},
+				},
+			},
+		}},
+	}
+	request := &cpuadvisor.GetAdviceRequest{
+		Entries: map[string]*cpuadvisor.ContainerAllocationInfoEntries{
+			commonstate.PoolNameReserve: {
+				Entries: map[string]*cpuadvisor.ContainerAllocationInfo{
+					commonstate.FakedContainerName: {AllocationInfo: reserveAllocationInfo},
+				},
+			},
+		},
+	}
+	server := &mockCPUServerService_ListAndWatchServer{ResultsChan: make(chan *cpuadvisor.ListAndWatchResponse, 10)}
+
+	// advisor is never updated by GetAdvice and ListAndWatch loop at the same time
+	wg := sync.WaitGroup{}
+	for i := 0; i < 5; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			_, err := cs.GetAdvice(context.Background(), request)
+			assert.NoError(t, err)
+		}()
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, cs.getAndPushAdvice(clients, server))
+		}()
+	}
+	wg.Wait()
+	require.Equal(t, int32(1), atomic.LoadInt32(&maxInFlight))
+	require.Len(t, server.ResultsChan, 5)
+}
+
+func TestCPUServerPoolStabilityScores(t *testing.T) {
+	t.Parallel()
+
+	cs := newTestCPUServer(t, nil, []*v1.Pod{})
+	emitter := newFakeMetricEmitter()
+	cs.emitter = emitter
+	cs.poolStabilityWindow = 4
+
+	getScore := func(poolName string) (int64, bool) {
+		return emitter.getTagged(cs.genMetricsName(metricCPUServerPoolStabilityScore), metrics.MetricTag{Key: "pool", Val: poolName})
+	}
+
+	oscillatingSizes := []map[int]types.CPUResource{{0: {Size: 2}}, {0: {Size: 6}}}
+	movingSizes := []map[int]types.CPUResource{{0: {Size: 4}}, {1: {Size: 4}}}
+	for i := 0; i < 6; i++ {
+		cs.emitPoolStabilityScores(&types.InternalCPUCalculationResult{
+			PoolEntries: map[string]map[int]types.CPUResource{
+				commonstate.PoolNameShare: {0: {Size: 4}, 1: {Size: 4}},
+				"share-a":                 oscillatingSizes[i%2],
+				"share-b":                 movingSizes[i%2],
+			},
+		})
+
+		// no score is emitted until there is a change to measure
+		if i == 0 {
+			_, ok := getScore(commonstate.PoolNameShare)
+			require.False(t, ok)
+		}
+	}
+	require.Len(t, cs.poolSizeHistory, 4)
+
+	// the stable pool keeps a full score, while oscillating pools drop
+	score, ok := getScore(commonstate.PoolNameShare)
+	require.True(t, ok)
+	require.Equal(t, int64(100), score)
+	score, ok = getScore("share-a")
+	require.True(t, ok)
+	require.Equal(t, int64(33), score)
+	score, ok = getScore("share-b")
+	require.True(t, ok)
+	require.Equal(t, int64(0), score)
+}
+
+func TestCPUServerEmptyReclaimBlocksPolicy(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name           string
+		policy         EmptyReclaimBlocksPolicy
+		wantNUMA0      bool
+		wantNUMA0Sizes []uint64
+	}{
+		{
+			name:           "keep zero-size blocks",
+			policy:         EmptyReclaimBlocksPolicyKeep,
+			wantNUMA0:      true,
+			wantNUMA0Sizes: []uint64{0},
+		},
+		{
+			name:      "omit zero-size blocks and empty numa results",
+			policy:    EmptyReclaimBlocksPolicyOmit,
+			wantNUMA0: false,
+		},
+		{
+			name:           "empty marker",
+			policy:         EmptyReclaimBlocksPolicyEmptyMarker,
+			wantNUMA0:      true,
+			wantNUMA0Sizes: []uint64{},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			cs := newTestCPUServer(t, nil, []*v1.Pod{})
+			cs.emptyReclaimBlocksPolicy = tt.policy
+
+			// reclaim pool has no capacity on numa 0, where it overlaps with share pool by zero cpus
+			advisorResp := &types.InternalCPUCalculationResult{
+				PoolEntries: map[string]map[int]types.CPUResource{
+					commonstate.PoolNameShare:   {0: {Size: 4}, 1: {Size: 4}},
+					commonstate.PoolNameReclaim: {0: {Size: 0}, 1: {Size: 2}},
+				},
+				// zero-size overlap is ignored by SetPoolOverlapInfo, so it is set directly
+				PoolOverlapInfo: map[string]map[int]map[string]int{
+					commonstate.PoolNameReclaim: {0: {commonstate.PoolNameShare: 0}},
+				},
+				AllowSharedCoresOverlapReclaimedCores: true,
+			}
+			calculationEntriesMap := make(map[string]*cpuadvisor.CalculationEntries)
+			cs.assemblePoolEntries(advisorResp, calculationEntriesMap, NewBlockSet(), nil)
+
+			reclaimResults := calculationEntriesMap[commonstate.PoolNameReclaim].Entries[commonstate.FakedContainerName].CalculationResultsByNumas
+			require.Len(t, reclaimResults[1].Blocks, 1)
+			require.Equal(t, uint64(2), reclaimResults[1].Blocks[0].Result)
+
+			numa0Result, ok := reclaimResults[0]
+			require.Equal(t, tt.wantNUMA0, ok)
+			if ok {
+				sizes := make([]uint64, 0)
+				for _, block := range numa0Result.Blocks {
+					sizes = append(sizes, block.Result)
+				}
+				require.Equal(t, tt.wantNUMA0Sizes, sizes)
+			}
+		})
+	}
+}
+
+func TestCPUServerValidateReclaimOverlapSize(t *testing.T) {
+	t.Parallel()
+
+	cs := newTestCPUServer(t, nil, []*v1.Pod{})
+	emitter := newFakeMetricEmitter()
+	cs.emitter = emitter
+	// 8 cpus on each numa
+	cpuTopology, err := machine.GenerateDummyCPUTopology(16, 2, 2)
+	require.NoError(t, err)
+	cs.metaServer.KatalystMachineInfo = &machine.KatalystMachineInfo{CPUTopology: cpuTopology}
+
+	// reclaim overlaps with share by more than its size, and the overlap with share-a
+	// makes the cumulative overlap exceed cpus of numa 0
+	advisorResp := &types.InternalCPUCalculationResult{
+		PoolEntries: map[string]map[int]types.CPUResource{
+			commonstate.PoolNameShare:   {0: {Size: 4}},
+			"share-a":                   {0: {Size: 6}},
+			commonstate.PoolNameReclaim: {0: {Size: 0}},
+		},
+		PoolOverlapInfo:                       map[string]map[int]map[string]int{},
+		AllowSharedCoresOverlapReclaimedCores: true,
+	}
+	advisorResp.SetPoolOverlapInfo(commonstate.PoolNameReclaim, 0, commonstate.PoolNameShare, 6)
+	advisorResp.SetPoolOverlapInfo(commonstate.PoolNameReclaim, 0, "share-a", 5)
+	calculationEntriesMap := make(map[string]*cpuadvisor.CalculationEntries)
+	cs.assemblePoolEntries(advisorResp, calculationEntriesMap, NewBlockSet(), nil)
+
+	overlapSizes := make(map[string]uint64)
+	reclaimResults := calculationEntriesMap[commonstate.PoolNameReclaim].Entries[commonstate.FakedContainerName].CalculationResultsByNumas
+	for _, block := range reclaimResults[0].Blocks {
+		for _, target := range block.OverlapTargets {
+			if target.OverlapTargetPoolName != commonstate.PoolNameReclaim {
+				overlapSizes[target.OverlapTargetPoolName] = block.Result
+			}
+		}
+	}
+	require.Equal(t, map[string]uint64{commonstate.PoolNameShare: 4}, overlapSizes)
+
+	for poolName, reason := range map[string]string{commonstate.PoolNameShare: "exceeds-pool", "share-a": "exceeds-numa"} {
+		invalid, ok := emitter.getTagged(cs.genMetricsName(metricCPUServerReclaimOverlapInvalid),
+			metrics.MetricTag{Key: "numa", Val: "0"},
+			metrics.MetricTag{Key: "pool", Val: poolName},
+			metrics.MetricTag{Key: "reason", Val: reason})
+		require.True(t, ok, poolName)
+		require.Equal(t, int64(1), invalid)
+	}
+}
+
+func TestCPUServerSkipPushOnStartUp(t *testing.T) {
+	t.Parallel()
+
+	cs := newTestCPUServer(t, nil, []*v1.Pod{})
+	emitter := newFakeMetricEmitter()
+	cs.emitter = emitter
+	require.NoError(t, cs.metaCache.SetPoolInfo(commonstate.PoolNameReserve, &types.PoolInfo{
+		PoolName:                 commonstate.PoolNameReserve,
+		TopologyAwareAssignments: map[int]machine.CPUSet{0: machine.NewCPUSet(0)},
+	}))
+
+	// pushing advice is skipped within the startup period
+	cs.startTime = time.Now()
+	cs.startUpPeriod = time.Minute
+	require.Error(t, cs.checkAdviceGates())
+	skipped, ok := emitter.get(cs.genMetricsName(metricCPUServerSkipPushStartingUp))
+	require.True(t, ok)
+	require.Equal(t, int64(1), skipped)
+
+	// zero startup period disables skipping
+	cs.startUpPeriod = 0
+	require.NoError(t, cs.checkAdviceGates())
+}
+
+var updateGolden = flag.Bool("update", false, "update golden files in testdata")
+
+func TestCPUServerAssembleResponseGolden(t *testing.T) {
+	t.Parallel()
+
+	cs := newTestCPUServer(t, nil, []*v1.Pod{})
+	cs.blockIDGenerator = NewSequentialBlockIDGenerator("block-")
+
+	advisorResp := &types.InternalCPUCalculationResult{
+		PoolEntries: map[string]map[int]types.CPUResource{
+			commonstate.PoolNameReserve: {0: {Size: 2}, 1: {Size: 2}},
+			commonstate.PoolNameShare:   {0: {Size: 4}, 1: {Size: 6}},
+			"share-a":                   {0: {Size: 2}},
+			commonstate.PoolNameReclaim: {0: {Size: 3}, 1: {Size: 4}},
+		},
+		PoolOverlapInfo:                       map[string]map[int]map[string]int{},
+		AllowSharedCoresOverlapReclaimedCores: true,
+	}
+	advisorResp.SetPoolOverlapInfo(commonstate.PoolNameReclaim, 0, commonstate.PoolNameShare, 2)
+	advisorResp.SetPoolOverlapInfo(commonstate.PoolNameReclaim, 1, commonstate.PoolNameShare, 1)
+	got, err := json.MarshalIndent(cs.assembleResponse(advisorResp).Entries, "", "  ")
+	require.NoError(t, err)
+
+	goldenPath := path.Join("testdata", "assemble_response.golden.json")
+	if *updateGolden {
+		require.NoError(t, os.WriteFile(goldenPath, append(got, '\n'), 0o644))
+	}
+	want, err := os.ReadFile(goldenPath)
+	require.NoError(t, err)
+	require.JSONEq(t, string(want), string(got))
+}
+
+func TestCPUServerDisableReclaimOverlapOnNodeConditions(t *testing.T) {
+	t.Parallel()
+
+	cs := newTestCPUServer(t, nil, []*v1.Pod{})
+	emitter := newFakeMetricEmitter()
+	cs.emitter = emitter
+	cs.reclaimDisablingNodeConditions = sets.NewString(string(v1.NodeMemoryPressure))
+
+	nodeObj := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-node"},
+		Status: v1.NodeStatus{Conditions: []v1.NodeCondition{
+			{Type: v1.NodeMemoryPressure, Status: v1.ConditionFalse},
+			{Type: v1.NodeDiskPressure, Status: v1.ConditionTrue},
+		}},
+	}
+	nodeClient := fake.NewSimpleClientset(nodeObj).CoreV1().Nodes()
+	cs.metaServer.NodeFetcher = node.NewRemoteNodeFetcher(&global.BaseConfiguration{NodeName: "test-node"},
+		&metaconfig.NodeConfiguration{}, nodeClient)
+	setMemoryPressure := func(status v1.ConditionStatus) {
+		nodeObj.Status.Conditions[0].Status = status
+		_, err := nodeClient.UpdateStatus(context.TODO(), nodeObj, metav1.UpdateOptions{})
+		require.NoError(t, err)
+	}
+
+	advisorResp := &types.InternalCPUCalculationResult{
+		PoolEntries: map[string]map[int]types.CPUResource{
+			commonstate.PoolNameShare:   {0: {Size: 4}},
+			commonstate.PoolNameReclaim: {0: {Size: 2}},
+		},
+		PoolOverlapInfo:                       map[string]map[int]map[string]int{},
+		PoolOverlapPodContainerInfo:           map[string]map[int]map[string]map[string]int{},
+		AllowSharedCoresOverlapReclaimedCores: true,
+	}
+	advisorResp.SetPoolOverlapInfo(commonstate.PoolNameReclaim, 0, commonstate.PoolNameShare, 2)
+	advisorResp.SetPoolOverlapPodContainerInfo(commonstate.PoolNameReclaim, 0, "pod1", "c1", 1)
+
+	// conditions not configured don't turn off overlap
+	require.Same(t, advisorResp, cs.disableReclaimOverlapOnNodeConditions(context.TODO(), advisorResp))
+	disabled, ok := emitter.get(cs.genMetricsName(metricCPUServerReclaimOverlapDisabled))
+	require.True(t, ok)
+	require.Equal(t, int64(0), disabled)
+
+	// overlap is turned off under memory pressure, and the advisor result is left as is
+	setMemoryPressure(v1.ConditionTrue)
+	resp := cs.disableReclaimOverlapOnNodeConditions(context.TODO(), advisorResp)
+	require.False(t, resp.AllowSharedCoresOverlapReclaimedCores)
+	require.Nil(t, resp.GetPoolOverlapInfo(commonstate.PoolNameReclaim, 0))
+	require.Nil(t, resp.GetPoolOverlapPodContainerInfo(commonstate.PoolNameReclaim, 0))
+	require.Equal(t, advisorResp.PoolEntries, resp.PoolEntries)
+	require.True(t, advisorResp.AllowSharedCoresOverlapReclaimedCores)
+	require.Equal(t, map[string]int{commonstate.PoolNameShare: 2}, advisorResp.GetPoolOverlapInfo(commonstate.PoolNameReclaim, 0))
+	disabled, _ = emitter.get(cs.genMetricsName(metricCPUServerReclaimOverlapDisabled))
+	require.Equal(t, int64(1), disabled)
+
+	calculationEntriesMap := make(map[string]*cpuadvisor.CalculationEntries)
+	cs.assemblePoolEntries(resp, calculationEntriesMap, NewBlockSet(), nil)
+	for _, block := range calculationEntriesMap[commonstate.PoolNameReclaim].Entries[commonstate.FakedContainerName].CalculationResultsByNumas[0].Blocks {
+		require.Empty(t, block.OverlapTargets)
+	}
+
+	// overlap is turned on again once the condition clears
+	setMemoryPressure(v1.ConditionFalse)
+	require.Same(t, advisorResp, cs.disableReclaimOverlapOnNodeConditions(context.TODO(), advisorResp))
+	disabled, _ = emitter.get(cs.genMetricsName(metricCPUServerReclaimOverlapDisabled))
+	require.Equal(t, int64(0), disabled)
+}
+
+func TestCPUServerLWWatchdogCancelsStuckLoop(t *testing.T) {
+	t.Parallel()
+
+	// advisor update gets stuck until the test ends
+	unblock := make(chan struct{})
+	defer close(unblock)
+	advisor := &mockCPUResourceAdvisor{
+		onUpdate: func() { <-unblock },
+		provision: &types.InternalCPUCalculationResult{
+			PoolEntries: map[string]map[int]types.CPUResource{
+				commonstate.PoolNameReserve: {0: {Size: 2}},
+			},
+		},
+	}
+	cs := newTestCPUServer(t, advisor, []*v1.Pod{})
+	emitter := newFakeMetricEmitter()
+	cs.emitter = emitter
+	cs.period = 10 * time.Millisecond
+	cs.lwWatchdogWindow = 50 * time.Millisecond
+	cs.callTimeout = 0
+
+	clients := []cpuadvisor.CPUPluginClient{
+		&mockCPUPluginClient{checkpoint: &cpuadvisor.GetCheckpointResponse{
+			Entries: map[string]*cpuadvisor.AllocationEntries{
+				commonstate.PoolNameReserve: {
+					Entries: map[string]*cpuadvisor.AllocationInfo{
+						commonstate.FakedContainerName: {OwnerPoolName: commonstate.PoolNameReserve, TopologyAwareAssignments: map[uint64]string{0: "0"}},
+					},
+				},
+			},
+		}},
+	}
+	server := &mockCPUServerService_ListAndWatchServer{ResultsChan: make(chan *cpuadvisor.ListAndWatchResponse, 10)}
+
+	loopCtx, cancelLoop := context.WithCancel(context.Background())
+	defer cancelLoop()
+	watchdogCh := make(chan error, 1)
+	cs.setLastPushSuccessTime(cs.clock.Now())
+	go cs.watchLWLoop(loopCtx, cancelLoop, watchdogCh)
+
+	cycleDone := make(chan struct{})
+	go func() {
+		cs.runPushCycle(clients, &boundedListAndWatchServer{CPUAdvisor_ListAndWatchServer: server, ctx: loopCtx})
+		close(cycleDone)
+	}()
+
+	// the watchdog fires while the push cycle is stuck, and the cycle is abandoned by cancelling the loop context
+	select {
+	case err := <-watchdogCh:
+		require.Error(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("watchdog is not fired")
+	}
+	select {
+	case <-cycleDone:
+	case <-time.After(5 * time.Second):
+		t.Fatal("stuck push cycle is not abandoned")
+	}
+	require.Error(t, loopCtx.Err())
+	triggered, ok := emitter.get(cs.genMetricsName(metricCPUServerLWWatchdogTriggered))
+	require.True(t, ok)
+	require.Equal(t, int64(1), triggered)
+}
+
+func TestCPUServerCallTimeout(t *testing.T) {
+	t.Parallel()
+
+	unblock := make(chan struct{})
+	defer close(unblock)
+	cs := newTestCPUServer(t, &mockCPUResourceAdvisor{onUpdate: func() { <-unblock }}, []*v1.Pod{})
+	emitter := newFakeMetricEmitter()
+	cs.emitter = emitter
+	cs.callTimeout = 10 * time.Millisecond
+
+	err := cs.getAndSyncCheckpoint(context.TODO(), []cpuadvisor.CPUPluginClient{&mockCPUPluginClient{delay: time.Minute}})
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	_, err = cs.updateAndGetAdviceWithTimeout(context.TODO())
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	for _, call := range []string{"GetCheckpoint", "UpdateAndGetAdvice"} {
+		timedOut, ok := emitter.getTagged(cs.genMetricsName(metricCPUServerCallTimeout), metrics.MetricTag{Key: "call", Val: call})
+		require.True(t, ok, call)
+		require.Equal(t, int64(1), timedOut)
+	}
+	_, ok := emitter.getTagged(cs.genMetricsName(metricServerLWGetCheckpointFailed), metrics.MetricTag{Key: "reason", Val: "timeout"})
+	require.True(t, ok)
+
+	// other errors are distinguished from timeout
+	err = cs.getAndSyncCheckpoint(context.TODO(), []cpuadvisor.CPUPluginClient{&mockCPUPluginClient{err: fmt.Errorf("mock error")}})
+	require.Error(t, err)
+	require.NotErrorIs(t, err, context.DeadlineExceeded)
+	_, ok = emitter.getTagged(cs.genMetricsName(metricServerLWGetCheckpointFailed), metrics.MetricTag{Key: "reason", Val: "error"})
+	require.True(t, ok)
+}
+
+func TestCPUServerAdvisorUpdateSingleFlight(t *testing.T) {
+	t.Parallel()
+
+	var updated int32
+	unblock := make(chan struct{})
+	cs := newTestCPUServer(t, &mockCPUResourceAdvisor{onUpdate: func() {
+		atomic.AddInt32(&updated, 1)
+		<-unblock
+	}}, []*v1.Pod{})
+	emitter := newFakeMetricEmitter()
+	cs.emitter = emitter
+	cs.callTimeout = 10 * time.Millisecond
+
+	_, err := cs.updateAndGetAdviceWithTimeout(context.TODO())
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// no more update is started while the abandoned one is still running
+	for i := 0; i < 3; i++ {
+		_, err = cs.updateAndGetAdviceWithTimeout(context.TODO())
+		require.ErrorIs(t, err, errAdvisorUpdateInFlight)
+	}
+	require.Equal(t, int32(1), atomic.LoadInt32(&updated))
+	skipped, ok := emitter.get(cs.genMetricsName(metricCPUServerAdvisorUpdateInFlight))
+	require.True(t, ok)
+	require.Equal(t, int64(1), skipped)
+
+	// updates are started again once the abandoned one finishes
+	close(unblock)
+	require.Eventually(t, func() bool {
+		return atomic.LoadInt32(&cs.advisorUpdateInFlight) == 0
+	}, 5*time.Second, 10*time.Millisecond)
+	_, err = cs.updateAndGetAdviceWithTimeout(context.TODO())
+	require.NoError(t, err)
+	require.Equal(t, int32(2), atomic.LoadInt32(&updated))
+}
+
+// mockSequentialCPUPluginClient returns checkpoints in sequence, and the last one is repeated
+type mockSequentialCPUPluginClient struct {
+	checkpoints []*cpuadvisor.GetCheckpointResponse
+	calls       int
+}
+
+func (m *mockSequentialCPUPluginClient) GetCheckpoint(_ context.Context, _ *cpuadvisor.GetCheckpointRequest, _ ...grpc.CallOption) (*cpuadvisor.GetCheckpointResponse, error) {
+	checkpoint := m.checkpoints[general.Min(m.calls, len(m.checkpoints)-1)]
+	m.calls++
+	return checkpoint, nil
+}
+
+func TestCPUServerGetCheckpointRetryOnEmpty(t *testing.T) {
+	t.Parallel()
+
+	cs := newTestCPUServer(t, nil, []*v1.Pod{})
+	emitter := newFakeMetricEmitter()
+	cs.emitter = emitter
+	require.NoError(t, cs.metaCache.AddContainer("pod1", "c1", &types.ContainerInfo{
+		PodUID:              "pod1",
+		ContainerName:       "c1",
+		QoSLevel:            consts.PodAnnotationQoSLevelSharedCores,
+		OwnerPoolName:       commonstate.PoolNameShare,
+		OriginOwnerPoolName: commonstate.PoolNameShare,
+	}))
+	requireResponses := func(result string, want int64) {
+		got, ok := emitter.getTagged(cs.genMetricsName(metricCPUServerCheckpointResponses), metrics.MetricTag{Key: "result", Val: result})
+		require.True(t, ok, result)
+		require.Equal(t, want, got, result)
+	}
+	populated := &cpuadvisor.GetCheckpointResponse{
+		Entries: map[string]*cpuadvisor.AllocationEntries{
+			commonstate.PoolNameReserve: {
+				Entries: map[string]*cpuadvisor.AllocationInfo{
+					commonstate.FakedContainerName: {
+						OwnerPoolName:            commonstate.PoolNameReserve,
+						TopologyAwareAssignments: map[uint64]string{0: "0"},
+					},
+				},
+			},
+		},
+	}
+
+	// the checkpoint still empty after all attempts is synced without gc
+	client := &mockSequentialCPUPluginClient{checkpoints: []*cpuadvisor.GetCheckpointResponse{{}}}
+	require.NoError(t, cs.getAndSyncCheckpoint(context.TODO(), []cpuadvisor.CPUPluginClient{client}))
+	require.Equal(t, cs.getCheckpointMaxAttempts, client.calls)
+	requireResponses("empty-after-retry", 1)
+	_, ok := cs.metaCache.GetContainerInfo("pod1", "c1")
+	require.True(t, ok)
+
+	// nil and empty checkpoints are retried within the same cycle
+	client = &mockSequentialCPUPluginClient{checkpoints: []*cpuadvisor.GetCheckpointResponse{nil, {}, populated}}
+	require.NoError(t, cs.getAndSyncCheckpoint(context.TODO(), []cpuadvisor.CPUPluginClient{client}))
+	require.Equal(t, 3, client.calls)
+	requireResponses("populated", 1)
+	_, ok = cs.metaCache.GetPoolInfo(commonstate.PoolNameReserve)
+	require.True(t, ok)
+
+	// the cycle fails if the checkpoint is still nil after all attempts
+	client = &mockSequentialCPUPluginClient{checkpoints: []*cpuadvisor.GetCheckpointResponse{nil}}
+	require.Error(t, cs.getAndSyncCheckpoint(context.TODO(), []cpuadvisor.CPUPluginClient{client}))
+	require.Equal(t, cs.getCheckpointMaxAttempts, client.calls)
+	requireResponses("nil", 1)
+}
+
+func TestCPUServerCheckpointFreshness(t *testing.T) {
+	t.Parallel()
+
+	cs := newTestCPUServer(t, nil, []*v1.Pod{{ObjectMeta: metav1.ObjectMeta{UID: "pod1"}}})
+	emitter := newFakeMetricEmitter()
+	cs.emitter = emitter
+	cs.checkpointFrozenCycles = 2
+	// not ready states are reported without toleration
+	general.RegisterTemporaryHeartbeatCheck(cpuServerCheckpointFreshnessHealthCheckName, time.Minute, general.HealthzCheckStateNotReady, 0)
+	defer general.UnregisterTemporaryHeartbeatCheck(cpuServerCheckpointFreshnessHealthCheckName)
+
+	newCheckpoint := func(assignments string) *cpuadvisor.GetCheckpointResponse {
+		return &cpuadvisor.GetCheckpointResponse{
+			Entries: map[string]*cpuadvisor.AllocationEntries{
+				commonstate.PoolNameReserve: {
+					Entries: map[string]*cpuadvisor.AllocationInfo{
+						commonstate.FakedContainerName: {
+							OwnerPoolName:            commonstate.PoolNameReserve,
+							TopologyAwareAssignments: map[uint64]string{0: assignments},
+						},
+					},
+				},
+			},
+		}
+	}
+	client := &mockCPUPluginClient{checkpoint: newCheckpoint("0")}
+	requireFreshness := func(wantUnchanged int, wantReady bool) {
+		require.NoError(t, cs.getAndSyncCheckpoint(context.TODO(), []cpuadvisor.CPUPluginClient{client}))
+		unchanged, ok := emitter.getTagged(cs.genMetricsName(metricCPUServerCheckpointUnchangedCycles),
+			metrics.MetricTag{Key: "socket", Val: cs.advisorSocketPath})
+		require.True(t, ok)
+		require.Equal(t, int64(wantUnchanged), unchanged)
+		detail := cs.GetLWHealthDetail()
+		require.Equal(t, wantUnchanged, detail.CheckpointUnchangedCycles)
+		require.Equal(t, !wantReady, detail.CheckpointFrozen)
+		result, ok := general.GetRegisterReadinessCheckResult()[cpuServerCheckpointFreshnessHealthCheckName]
+		require.True(t, ok)
+		require.Equal(t, wantReady, result.Ready)
+	}
+
+	// an unchanged checkpoint is healthy as long as pods are unchanged as well
+	for i := 0; i <= 3; i++ {
+		requireFreshness(i, true)
+	}
+
+	// the plugin is regarded as frozen once pods change
+	cs.metaServer.PodFetcher.(*pod.PodFetcherStub).PodList = []*v1.Pod{
+		{ObjectMeta: metav1.ObjectMeta{UID: "pod1"}},
+		{ObjectMeta: metav1.ObjectMeta{UID: "pod2"}},
+	}
+	requireFreshness(4, false)
+
+	// and it recovers once the checkpoint changes
+	client.checkpoint = newCheckpoint("0-1")
+	requireFreshness(0, true)
+
+	// changes of assignments alone are ignored by the entries method
+	require.NotEqual(t, fingerprintCheckpoint(newCheckpoint("0"), CheckpointCompareMethodBytes),
+		fingerprintCheckpoint(newCheckpoint("0-1"), CheckpointCompareMethodBytes))
+	require.Equal(t, fingerprintCheckpoint(newCheckpoint("0"), CheckpointCompareMethodEntries),
+		fingerprintCheckpoint(newCheckpoint("0-1"), CheckpointCompareMethodEntries))
+}
+
+func TestFingerprintCheckpointCanonical(t *testing.T) {
+	t.Parallel()
+
+	newCheckpoint := func(sharedCPUs string) *cpuadvisor.GetCheckpointResponse {
+		checkpoint := &cpuadvisor.GetCheckpointResponse{Entries: map[string]*cpuadvisor.AllocationEntries{}}
+		for _, poolName := range []string{commonstate.PoolNameShare, commonstate.PoolNameReclaim, commonstate.PoolNameReserve} {
+			checkpoint.Entries[poolName] = &cpuadvisor.AllocationEntries{Entries: map[string]*cpuadvisor.AllocationInfo{
+				commonstate.FakedContainerName: {
+					OwnerPoolName:            poolName,
+					TopologyAwareAssignments: map[uint64]string{0: "0-1", 1: "8-9", 2: "16-17", 3: "24-25"},
+				},
+			}}
+		}
+		for _, podUID := range []string{"pod1", "pod2", "pod3"} {
+			checkpoint.Entries[podUID] = &cpuadvisor.AllocationEntries{Entries: map[string]*cpuadvisor.AllocationInfo{
+				"c1":      {OwnerPoolName: commonstate.PoolNameShare, TopologyAwareAssignments: map[uint64]string{0: sharedCPUs, 1: "8-9"}},
+				"c2":      {OwnerPoolName: commonstate.PoolNameShare, TopologyAwareAssignments: map[uint64]string{0: sharedCPUs, 1: "8-9"}},
+				"sidecar": {OwnerPoolName: commonstate.PoolNameShare, RampUp: true},
+			}}
+		}
+		return checkpoint
+	}
+
+	// identical checkpoints with many entries always have the same fingerprint, regardless of map order
+	for _, method := range []CheckpointCompareMethod{CheckpointCompareMethodBytes, CheckpointCompareMethodEntries} {
+		fingerprint := fingerprintCheckpoint(newCheckpoint("0-1"), method)
+		for i := 0; i < 20; i++ {
+			require.Equal(t, fingerprint, fingerprintCheckpoint(newCheckpoint("0-1"), method), method)
+		}
+	}
+	require.NotEqual(t, fingerprintCheckpoint(newCheckpoint("0-1"), CheckpointCompareMethodBytes),
+		fingerprintCheckpoint(newCheckpoint("0"), CheckpointCompareMethodBytes))
+}
+
+func TestCPUServerSendChunksWithTimeout(t *testing.T) {
+	t.Parallel()
+
+	cs := newTestCPUServer(t, nil, []*v1.Pod{})
+	emitter := newFakeMetricEmitter()
+	cs.emitter = emitter
+	cs.lwChunkMaxEntries = 2
+
+	resp := &cpuadvisor.ListAndWatchResponse{
+		Entries:                               map[string]*cpuadvisor.CalculationEntries{},
+		AllowSharedCoresOverlapReclaimedCores: true,
+		ExtraEntries: []*advisorsvc.CalculationInfo{{
+			CalculationResult: &advisorsvc.CalculationResult{
+				Values: map[string]string{string(cpuadvisor.ControlKnobKeyCPUManagerPolicy): "static"},
+			},
+		}},
+	}
+	for _, podUID := range []string{"pod1", "pod2", "pod3", "pod4", "pod5"} {
+		resp.Entries[podUID] = &cpuadvisor.CalculationEntries{
+			Entries: map[string]*cpuadvisor.CalculationInfo{"c1": {OwnerPoolName: commonstate.PoolNameShare}},
+		}
+	}
+
+	// the response is never split for plugins not negotiated to reassemble chunks
+	legacy := &mockCPUServerService_ListAndWatchServer{ResultsChan: make(chan *cpuadvisor.ListAndWatchResponse, 3)}
+	require.NoError(t, cs.sendToLWStreams(legacy, resp))
+	require.Same(t, resp, <-legacy.ResultsChan)
+
+	// the response is split into chunks once negotiated, which are reassembled into the original one
+	md, _ := metadata.FromOutgoingContext(featuregatenegotiation.AppendWantedFeatureGatesToOutgoingContext(context.Background(),
+		map[string]*advisorsvc.FeatureGate{feature_cpu.NegotiationFeatureGateListAndWatchChunk: {}}))
+	s := &mockCPUServerService_ListAndWatchServer{
+		ResultsChan: make(chan *cpuadvisor.ListAndWatchResponse, 3),
+		ctx:         metadata.NewIncomingContext(context.Background(), md),
+	}
+	require.NoError(t, cs.sendToLWStreams(s, resp))
+	require.Len(t, s.ResultsChan, 3)
+	assembler := &cpuadvisor.ListAndWatchResponseAssembler{}
+	for i := 0; i < 3; i++ {
+		chunk := <-s.ResultsChan
+		index, total, ok := chunk.GetChunkIndex()
+		require.True(t, ok)
+		require.Equal(t, []int{i + 1, 3}, []int{index, total})
+		assembled, ok := assembler.Add(chunk)
+		require.Equal(t, i == 2, ok, i)
+		if ok {
+			require.Equal(t, resp.String(), assembled.String())
+		}
+	}
+	entries, ok := emitter.get(cs.genMetricsName(metricCPUServerLWResponseEntries))
+	require.True(t, ok)
+	require.Equal(t, int64(5), entries)
+	chunks, ok := emitter.get(cs.genMetricsName(metricCPUServerLWResponseChunks))
+	require.True(t, ok)
+	require.Equal(t, int64(3), chunks)
+	size, ok := emitter.get(cs.genMetricsName(metricCPUServerLWResponseBytes))
+	require.True(t, ok)
+	require.Equal(t, int64(resp.Size()), size)
+
+	// the response under the threshold is sent as is
+	cs.lwChunkMaxEntries = 5
+	require.NoError(t, cs.sendToLWStreams(s, resp))
+	require.Same(t, resp, <-s.ResultsChan)
+
+	// a stream blocked in Send is given up once timed out, and the push cycle reports it for the loop to exit
+	cs.lwSendTimeout = 10 * time.Millisecond
+	blocked := &mockCPUServerService_ListAndWatchServer{ResultsChan: make(chan *cpuadvisor.ListAndWatchResponse)}
+	require.ErrorIs(t, cs.sendToLWStreams(blocked, resp), errLWSendTimedOut)
+	<-blocked.ResultsChan
+	timedOut, ok := emitter.get(cs.genMetricsName(metricCPUServerLWSendTimeout))
+	require.True(t, ok)
+	require.Equal(t, int64(1), timedOut)
+}
+
+func TestCPUServerBlockProvenance(t *testing.T) {
+	t.Parallel()
+
+	cs := newTestCPUServer(t, nil, []*v1.Pod{})
+	advisorResp := &types.InternalCPUCalculationResult{
+		PoolEntries: map[string]map[int]types.CPUResource{
+			commonstate.PoolNameReserve: {0: {Size: 2}},
+			commonstate.PoolNameShare:   {0: {Size: 4}, 1: {Size: 4}},
+			"isolation-a":               {0: {Size: 2}},
+		},
+	}
+	advisorResp.SetPoolEntryProvenance(commonstate.PoolNameShare, 0, "share-0/canonical")
+	advisorResp.SetPoolEntryProvenance(commonstate.PoolNameShare, 1, "share-1/rama")
+	advisorResp.SetPoolEntryProvenance("isolation-a", 0, "isolation-a/canonical")
+	result := cs.assembleResponse(advisorResp)
+
+	var provenanceValue string
+	for _, entry := range result.ExtraEntries {
+		if v, ok := entry.CalculationResult.Values[string(cpuadvisor.ControlKnobKeyCPUBlockProvenance)]; ok {
+			provenanceValue = v
+		}
+	}
+	blockProvenance := cpuadvisor.CPUBlockProvenance{}
+	require.NoError(t, json.Unmarshal([]byte(provenanceValue), &blockProvenance))
+
+	// each pool block carries the provenance of its numa, and pools without provenance are omitted
+	expected := cpuadvisor.CPUBlockProvenance{}
+	for poolName, numaProvenances := range map[string]map[int64]string{
+		commonstate.PoolNameShare: {0: "share-0/canonical", 1: "share-1/rama"},
+		"isolation-a":             {0: "isolation-a/canonical"},
+	} {
+		for numaID, provenance := range numaProvenances {
+			blocks := result.Entries[poolName].Entries[commonstate.FakedContainerName].CalculationResultsByNumas[numaID].Blocks
+			require.NotEmpty(t, blocks)
+			for _, block := range blocks {
+				expected[block.BlockId] = provenance
+			}
+		}
+	}
+	require.Equal(t, expected, blockProvenance)
+
+	// provenance is served by the block assignments debug endpoint as well
+	recorder := httptest.NewRecorder()
+	cs.serveBlockAssignments(recorder, httptest.NewRequest(http.MethodGet, general.DebugHandlerPathPrefix+cpuServerBlockAssignmentsDebugHandlerName, nil))
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assignments := &BlockAssignments{}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), assignments))
+	require.Equal(t, expected, assignments.Provenance)
+
+	// the extra entry is skipped if no pool entry has provenance
+	result = cs.assembleResponse(&types.InternalCPUCalculationResult{
+		PoolEntries: map[string]map[int]types.CPUResource{
+			commonstate.PoolNameShare: {0: {Size: 4}},
+		},
+	})
+	for _, entry := range result.ExtraEntries {
+		require.NotContains(t, entry.CalculationResult.Values, string(cpuadvisor.ControlKnobKeyCPUBlockProvenance))
+	}
+}
+
+func TestCPUServerHoldOutUnsettledContainers(t *testing.T) {
+	t.Parallel()
+
+	cs := newTestCPUServer(t, nil, []*v1.Pod{})
+	emitter := newFakeMetricEmitter()
+	cs.emitter = emitter
+	fakeClock := testingclock.NewFakeClock(time.Now())
+	cs.clock = fakeClock
+	cs.containerSettleDelay = time.Minute
+
+	addContainer := func(podUID string) {
+		require.NoError(t, cs.metaCache.AddContainer(podUID, "c1", &types.ContainerInfo{
+			PodUID:              podUID,
+			ContainerName:       "c1",
+			QoSLevel:            consts.PodAnnotationQoSLevelSharedCores,
+			OwnerPoolName:       commonstate.PoolNameShare,
+			OriginOwnerPoolName: commonstate.PoolNameShare,
+		}))
+	}
+	assemble := func() *cpuInternalResult {
+		return cs.assembleResponse(&types.InternalCPUCalculationResult{
+			PoolEntries: map[string]map[int]types.CPUResource{
+				commonstate.PoolNameShare: {-1: {Size: 4}},
+			},
+		})
+	}
+
+	// a fresh container is held out, while its pool is still assembled
+	addContainer("pod1")
+	resp := assemble()
+	require.NotContains(t, resp.Entries, "pod1")
+	require.Contains(t, resp.Entries, commonstate.PoolNameShare)
+	unsettled, ok := emitter.get(cs.genMetricsName(metricCPUServerUnsettledContainerCount))
+	require.True(t, ok)
+	require.Equal(t, int64(1), unsettled)
+
+	// the container is assembled once it settles, while a container seen later is still held out
+	fakeClock.Step(40 * time.Second)
+	addContainer("pod2")
+	require.NotContains(t, assemble().Entries, "pod1")
+	fakeClock.Step(20 * time.Second)
+	resp = assemble()
+	require.Contains(t, resp.Entries, "pod1")
+	require.NotContains(t, resp.Entries, "pod2")
+
+	// first seen time of removed containers is cleaned up
+	require.NoError(t, cs.metaCache.RemovePod("pod2"))
+	assemble()
+	require.NotContains(t, cs.containerFirstSeenTime, ContainerMeta{PodUID: "pod2", ContainerName: "c1"})
+
+	// all containers are assembled if settle delay is not set
+	cs.containerSettleDelay = 0
+	addContainer("pod3")
+	require.Contains(t, assemble().Entries, "pod3")
+}
+
+func TestCPUServerLeaveOutUnmanagedQoSLevels(t *testing.T) {
+	t.Parallel()
+
+	cs := newTestCPUServer(t, nil, []*v1.Pod{})
+	emitter := newFakeMetricEmitter()
+	cs.emitter = emitter
+	cs.managedQoSLevels = sets.NewString(consts.PodAnnotationQoSLevelSharedCores, consts.PodAnnotationQoSLevelDedicatedCores)
+
+	addContainer := func(podUID, qosLevel, poolName string) {
+		require.NoError(t, cs.metaCache.AddContainer(podUID, "c1", &types.ContainerInfo{
+			PodUID:              podUID,
+			ContainerName:       "c1",
+			QoSLevel:            qosLevel,
+			OwnerPoolName:       poolName,
+			OriginOwnerPoolName: poolName,
+		}))
+	}
+	assemble := func() *cpuInternalResult {
+		return cs.assembleResponse(&types.InternalCPUCalculationResult{
+			PoolEntries: map[string]map[int]types.CPUResource{
+				commonstate.PoolNameShare:   {-1: {Size: 4}},
+				commonstate.PoolNameReclaim: {-1: {Size: 2}},
+			},
+		})
+	}
+
+	// containers of unmanaged qos levels are left out, while their pools are still assembled
+	addContainer("pod1", consts.PodAnnotationQoSLevelSharedCores, commonstate.PoolNameShare)
+	addContainer("pod2", consts.PodAnnotationQoSLevelReclaimedCores, commonstate.PoolNameReclaim)
+	resp := assemble()
+	require.Contains(t, resp.Entries, "pod1")
+	require.NotContains(t, resp.Entries, "pod2")
+	require.Contains(t, resp.Entries, commonstate.PoolNameReclaim)
+	unmanaged, ok := emitter.get(cs.genMetricsName(metricCPUServerUnmanagedContainerCount))
+	require.True(t, ok)
+	require.Equal(t, int64(1), unmanaged)
+	require.True(t, cs.unmanagedContainers.Has(ContainerMeta{PodUID: "pod2", ContainerName: "c1"}))
+
+	// removed containers are cleaned up
+	require.NoError(t, cs.metaCache.RemovePod("pod2"))
+	assemble()
+	require.Empty(t, cs.unmanagedContainers)
+
+	// all containers are assembled if no qos level is configured
+	cs.managedQoSLevels = sets.NewString()
+	addContainer("pod3", consts.PodAnnotationQoSLevelReclaimedCores, commonstate.PoolNameReclaim)
+	require.Contains(t, assemble().Entries, "pod3")
+}
+
+func TestCPUServerSkipGCOnSuspectCheckpoint(t *testing.T) {
+	t.Parallel()
+
+	podUIDs := []string{"pod1", "pod2", "pod3", "pod4"}
+	pods := make([]*v1.Pod, 0, len(podUIDs))
+	for _, podUID := range podUIDs {
+		pods = append(pods, &v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: podUID, UID: k8stypes.UID(podUID)},
+			Spec:       v1.PodSpec{Containers: []v1.Container{{Name: "c1"}}},
+		})
+	}
+	cs := newTestCPUServer(t, nil, pods)
+	emitter := newFakeMetricEmitter()
+	cs.emitter = emitter
+	cs.suspectCheckpointDropRatio = 0.5
+	for _, podUID := range podUIDs {
+		require.NoError(t, cs.metaCache.AddContainer(podUID, "c1", &types.ContainerInfo{
+			PodUID:              podUID,
+			ContainerName:       "c1",
+			QoSLevel:            consts.PodAnnotationQoSLevelSharedCores,
+			OwnerPoolName:       commonstate.PoolNameShare,
+			OriginOwnerPoolName: commonstate.PoolNameShare,
+		}))
+	}
+
+	newCheckpoint := func(podUIDs ...string) *cpuadvisor.GetCheckpointResponse {
+		resp := &cpuadvisor.GetCheckpointResponse{Entries: map[string]*cpuadvisor.AllocationEntries{}}
+		for _, podUID := range podUIDs {
+			resp.Entries[podUID] = &cpuadvisor.AllocationEntries{
+				Entries: map[string]*cpuadvisor.AllocationInfo{
+					"c1": {OwnerPoolName: commonstate.PoolNameShare},
+				},
+			}
+		}
+		return resp
+	}
+	cachedPodUIDs := func() []string {
+		var result []string
+		cs.metaCache.RangeContainer(func(podUID string, _ string, _ *types.ContainerInfo) bool {
+			result = append(result, podUID)
+			return true
+		})
+		return result
+	}
+
+	cs.syncCheckpoint(context.TODO(), newCheckpoint(podUIDs...), 0)
+	assert.ElementsMatch(t, podUIDs, cachedPodUIDs())
+
+	// most containers disappear at once, so the checkpoint is regarded as suspect and nothing is deleted
+	cs.syncCheckpoint(context.TODO(), newCheckpoint("pod1"), 0)
+	assert.ElementsMatch(t, podUIDs, cachedPodUIDs())
+	suspect, ok := emitter.get(cs.genMetricsName(metricCPUServerSuspectCheckpoint))
+	require.True(t, ok)
+	require.Equal(t, int64(1), suspect)
+
+	// gc resumes with the next checkpoint
+	cs.syncCheckpoint(context.TODO(), newCheckpoint("pod1", "pod2", "pod3"), 0)
+	assert.ElementsMatch(t, []string{"pod1", "pod2", "pod3"}, cachedPodUIDs())
+
+	// a drop within the ratio is not suspect
+	cs.syncCheckpoint(context.TODO(), newCheckpoint("pod1", "pod2"), 0)
+	assert.ElementsMatch(t, []string{"pod1", "pod2"}, cachedPodUIDs())
+}
+
+func TestCPUServerEmitBlockSetStat(t *testing.T) {
+	t.Parallel()
+
+	cs := newTestCPUServer(t, nil, []*v1.Pod{})
+	emitter := newFakeMetricEmitter()
+	cs.emitter = emitter
+	numaCountTag := metrics.MetricTag{Key: "numa_count", Val: strconv.Itoa(cs.metaServer.NumNUMANodes)}
+	getStat := func(metricName string) int64 {
+		v, ok := emitter.getTagged(cs.genMetricsName(metricName), numaCountTag)
+		require.True(t, ok)
+		return v
+	}
+
+	// no block overlaps without reclaim pool
+	advisorResp := &types.InternalCPUCalculationResult{
+		PoolEntries: map[string]map[int]types.CPUResource{
+			commonstate.PoolNameReserve: {0: {Size: 2}},
+			commonstate.PoolNameShare:   {0: {Size: 4}, 1: {Size: 4}},
+		},
+	}
+	cs.assembleResponse(advisorResp)
+	require.Equal(t, int64(3), getStat(metricCPUServerBlockSetBlocks))
+	require.Equal(t, int64(0), getStat(metricCPUServerBlockSetOverlapJoins))
+	require.Equal(t, int64(0), getStat(metricCPUServerBlockSetMaxOverlapFanOut))
+
+	// reclaim pool overlapping with share pool joins the block split from the share pool
+	advisorResp.PoolEntries[commonstate.PoolNameReclaim] = map[int]types.CPUResource{0: {Size: 2}}
+	advisorResp.PoolOverlapInfo = map[string]map[int]map[string]int{}
+	advisorResp.AllowSharedCoresOverlapReclaimedCores = true
+	advisorResp.SetPoolOverlapInfo(commonstate.PoolNameReclaim, 0, commonstate.PoolNameShare, 2)
+	result := cs.assembleResponse(advisorResp)
+
+	blocks := 0
+	for _, entries := range result.Entries {
+		for _, numaCalculationResult := range entries.Entries[commonstate.FakedContainerName].CalculationResultsByNumas {
+			blocks += len(numaCalculationResult.Blocks)
+		}
+	}
+	require.Equal(t, int64(blocks), getStat(metricCPUServerBlockSetBlocks))
+	require.Equal(t, int64(1), getStat(metricCPUServerBlockSetOverlapJoins))
+	require.Equal(t, int64(2), getStat(metricCPUServerBlockSetMaxOverlapFanOut))
+}
+
+func TestCPUServerEmitPoolNUMABlockCounts(t *testing.T) {
+	t.Parallel()
+
+	cs := newTestCPUServer(t, nil, []*v1.Pod{})
+	emitter := newFakeMetricEmitter()
+	cs.emitter = emitter
+
+	advisorResp := &types.InternalCPUCalculationResult{
+		PoolEntries: map[string]map[int]types.CPUResource{
+			commonstate.PoolNameReserve: {0: {Size: 2}},
+			commonstate.PoolNameShare:   {0: {Size: 4}, 1: {Size: 4}},
+			commonstate.PoolNameReclaim: {0: {Size: 2}, 1: {Size: 2}},
+		},
+		PoolOverlapInfo:                       map[string]map[int]map[string]int{},
+		AllowSharedCoresOverlapReclaimedCores: true,
+	}
+	// the overlap splits the share block on numa 0
+	advisorResp.SetPoolOverlapInfo(commonstate.PoolNameReclaim, 0, commonstate.PoolNameShare, 2)
+	result := cs.assembleResponse(advisorResp)
+
+	// the breakdown matches the assembled blocks of each pool on each numa
+	expected := map[int64]map[string]int{}
+	for poolName, entries := range result.Entries {
+		for numaID, numaCalculationResult := range entries.Entries[commonstate.FakedContainerName].CalculationResultsByNumas {
+			if expected[numaID] == nil {
+				expected[numaID] = map[string]int{}
+			}
+			expected[numaID][poolName] = len(numaCalculationResult.Blocks)
+
+			count, ok := emitter.getTagged(cs.genMetricsName(metricCPUServerPoolNUMABlocks),
+				metrics.MetricTag{Key: "numa", Val: strconv.FormatInt(numaID, 10)}, metrics.MetricTag{Key: "pool", Val: poolName})
+			require.True(t, ok)
+			require.Equal(t, int64(len(numaCalculationResult.Blocks)), count)
+		}
+	}
+	require.Equal(t, expected, getPoolNUMABlockCounts(result.Entries))
+	require.Equal(t, 2, expected[0][commonstate.PoolNameShare])
+	require.Equal(t, 1, expected[1][commonstate.PoolNameShare])
+}
+
+func TestCPUServerStrictAssembly(t *testing.T) {
+	t.Parallel()
+
+	advisor := &mockCPUResourceAdvisor{
+		provision: &types.InternalCPUCalculationResult{
+			PoolEntries: map[string]map[int]types.CPUResource{
+				commonstate.PoolNameReserve: {0: {Size: 2}},
+				commonstate.PoolNameShare:   {0: {Size: 4}},
+			},
+		},
+	}
+	cs := newTestCPUServer(t, advisor, []*v1.Pod{})
+	emitter := newFakeMetricEmitter()
+	cs.emitter = emitter
+
+	// a consistent container is pushed in both modes
+	require.NoError(t, cs.metaCache.AddContainer("pod1", "c1", &types.ContainerInfo{
+		PodUID:              "pod1",
+		ContainerName:       "c1",
+		QoSLevel:            consts.PodAnnotationQoSLevelSharedCores,
+		OwnerPoolName:       commonstate.PoolNameShare,
+		OriginOwnerPoolName: commonstate.PoolNameShare,
+	}))
+	cs.strictAssembly = true
+	result, err := cs.updateAdvisor(context.TODO(), map[string]*advisorsvc.FeatureGate{})
+	require.NoError(t, err)
+	require.Empty(t, result.Warnings)
+
+	// containers referring to missing or empty owner pools are inconsistent
+	require.NoError(t, cs.metaCache.AddContainer("pod2", "c1", &types.ContainerInfo{
+		PodUID:              "pod2",
+		ContainerName:       "c1",
+		QoSLevel:            consts.PodAnnotationQoSLevelSharedCores,
+		OwnerPoolName:       "share-missing",
+		OriginOwnerPoolName: "share-missing",
+	}))
+	require.NoError(t, cs.metaCache.AddContainer("pod3", "c1", &types.ContainerInfo{
+		PodUID:        "pod3",
+		ContainerName: "c1",
+		QoSLevel:      consts.PodAnnotationQoSLevelSharedCores,
+	}))
+
+	// inconsistent entries are skipped in lenient mode
+	cs.strictAssembly = false
+	result, err = cs.updateAdvisor(context.TODO(), map[string]*advisorsvc.FeatureGate{})
+	require.NoError(t, err)
+	require.Len(t, result.Warnings, 2)
+	require.Contains(t, result.Entries, "pod1")
+	require.NotContains(t, result.Entries, "pod2")
+	require.NotContains(t, result.Entries, "pod3")
+	_, ok := emitter.get(cs.genMetricsName(metricCPUServerStrictAssemblyAborted))
+	require.False(t, ok)
+
+	// and the push is aborted in strict mode
+	cs.strictAssembly = true
+	result, err = cs.updateAdvisor(context.TODO(), map[string]*advisorsvc.FeatureGate{})
+	require.ErrorContains(t, err, "share-missing")
+	require.Nil(t, result)
+	aborted, ok := emitter.get(cs.genMetricsName(metricCPUServerStrictAssemblyAborted))
+	require.True(t, ok)
+	require.Equal(t, int64(2), aborted)
+}
+
+func TestCPUServerMaxPoolMissingContainers(t *testing.T) {
+	t.Parallel()
+
+	advisor := &mockCPUResourceAdvisor{
+		provision: &types.InternalCPUCalculationResult{
+			PoolEntries: map[string]map[int]types.CPUResource{
+				commonstate.PoolNameReserve: {0: {Size: 2}},
+				commonstate.PoolNameShare:   {0: {Size: 4}},
+			},
+		},
+	}
+	cs := newTestCPUServer(t, advisor, []*v1.Pod{})
+	emitter := newFakeMetricEmitter()
+	cs.emitter = emitter
+	cs.maxPoolMissingContainers = 1
+
+	// containers referring to missing and empty owner pools are counted per reason
+	require.NoError(t, cs.metaCache.AddContainer("pod1", "c1", &types.ContainerInfo{
+		PodUID:              "pod1",
+		ContainerName:       "c1",
+		QoSLevel:            consts.PodAnnotationQoSLevelSharedCores,
+		OwnerPoolName:       "share-missing",
+		OriginOwnerPoolName: "share-missing",
+	}))
+	result, err := cs.updateAdvisor(context.TODO(), map[string]*advisorsvc.FeatureGate{})
+	require.NoError(t, err)
+	require.Equal(t, 1, result.PoolMissingContainers)
+	notFound, ok := emitter.getTagged(cs.genMetricsName(metricCPUServerPoolMissingContainers),
+		metrics.MetricTag{Key: "reason", Val: "pool-not-found"})
+	require.True(t, ok)
+	require.Equal(t, int64(1), notFound)
+
+	// the cycle fails once the threshold is exceeded
+	require.NoError(t, cs.metaCache.AddContainer("pod2", "c1", &types.ContainerInfo{
+		PodUID:        "pod2",
+		ContainerName: "c1",
+		QoSLevel:      consts.PodAnnotationQoSLevelSharedCores,
+	}))
+	result, err = cs.updateAdvisor(context.TODO(), map[string]*advisorsvc.FeatureGate{})
+	require.ErrorContains(t, err, "2 containers refer to empty or missing owner pools")
+	require.Nil(t, result)
+	empty, ok := emitter.getTagged(cs.genMetricsName(metricCPUServerPoolMissingContainers),
+		metrics.MetricTag{Key: "reason", Val: "empty-owner-pool"})
+	require.True(t, ok)
+	require.Equal(t, int64(1), empty)
+
+	// no limit is applied if the threshold is zero
+	cs.maxPoolMissingContainers = 0
+	_, err = cs.updateAdvisor(context.TODO(), map[string]*advisorsvc.FeatureGate{})
+	require.NoError(t, err)
+}
+
+func TestCPUServerDryRun(t *testing.T) {
+	t.Parallel()
+
+	var updated int32
+	advisor := &mockCPUResourceAdvisor{
+		onUpdate: func() {
+			atomic.AddInt32(&updated, 1)
+		},
+		provision: &types.InternalCPUCalculationResult{
+			PoolEntries: map[string]map[int]types.CPUResource{
+				commonstate.PoolNameReserve: {0: {Size: 2}},
+				commonstate.PoolNameShare:   {0: {Size: 4}},
+			},
+		},
+	}
+	cs := newTestCPUServer(t, advisor, []*v1.Pod{})
+	emitter := newFakeMetricEmitter()
+	cs.emitter = emitter
+	cs.dryRun = true
+
+	shareAllocationInfo := &cpuadvisor.AllocationInfo{OwnerPoolName: commonstate.PoolNameShare}
+	clients := []cpuadvisor.CPUPluginClient{
+		&mockCPUPluginClient{checkpoint: &cpuadvisor.GetCheckpointResponse{
+			Entries: map[string]*cpuadvisor.AllocationEntries{
+				commonstate.PoolNameReserve: {
+					Entries: map[string]*cpuadvisor.AllocationInfo{
+						commonstate.FakedContainerName: {OwnerPoolName: commonstate.PoolNameReserve, TopologyAwareAssignments: map[uint64]string{0: "0"}},
+					},
+				},
+				commonstate.PoolNameShare: {
+					Entries: map[string]*cpuadvisor.AllocationInfo{commonstate.FakedContainerName: shareAllocationInfo},
+				},
+			},
+		}},
+	}
+
+	// checkpoint is synced and advice is computed, but nothing is sent
+	server := &mockCPUServerService_ListAndWatchServer{ResultsChan: make(chan *cpuadvisor.ListAndWatchResponse, 1)}
+	require.NoError(t, cs.getAndPushAdvice(clients, server))
+	require.Empty(t, server.ResultsChan)
+	_, ok := cs.metaCache.GetPoolInfo(commonstate.PoolNameShare)
+	require.True(t, ok)
+	require.Equal(t, int32(1), atomic.LoadInt32(&updated))
+	dryRun, ok := emitter.getTagged(cs.genMetricsName(metricCPUServerDryRunAdvice), metrics.MetricTag{Key: "api", Val: "ListAndWatch"})
+	require.True(t, ok)
+	require.Equal(t, int64(1), dryRun)
+
+	// gated GetAdvice computes advice as well, and fails so that the plugin keeps its current allocation
+	cs.gateGetAdvice = true
+	resp, err := cs.GetAdvice(context.TODO(), &cpuadvisor.GetAdviceRequest{
+		Entries: map[string]*cpuadvisor.ContainerAllocationInfoEntries{
+			commonstate.PoolNameReserve: {
+				Entries: map[string]*cpuadvisor.ContainerAllocationInfo{
+					commonstate.FakedContainerName: {AllocationInfo: &cpuadvisor.AllocationInfo{
+						OwnerPoolName: commonstate.PoolNameReserve, TopologyAwareAssignments: map[uint64]string{0: "0"},
+					}},
+				},
+			},
+			commonstate.PoolNameShare: {
+				Entries: map[string]*cpuadvisor.ContainerAllocationInfo{
+					commonstate.FakedContainerName: {AllocationInfo: shareAllocationInfo},
+				},
+			},
+		},
+	})
+	require.Error(t, err)
+	require.Nil(t, resp)
+	require.Equal(t, int32(2), atomic.LoadInt32(&updated))
+	dryRun, ok = emitter.getTagged(cs.genMetricsName(metricCPUServerDryRunAdvice), metrics.MetricTag{Key: "api", Val: "GetAdvice"})
+	require.True(t, ok)
+	require.Equal(t, int64(1), dryRun)
+
+	// advice is sent once dry-run is off
+	cs.dryRun = false
+	require.NoError(t, cs.getAndPushAdvice(clients, server))
+	require.Len(t, server.ResultsChan, 1)
+}
+
+func TestCPUServerGetAdviceGates(t *testing.T) {
+	t.Parallel()
+
+	request := &cpuadvisor.GetAdviceRequest{
+		Entries: map[string]*cpuadvisor.ContainerAllocationInfoEntries{
+			commonstate.PoolNameReserve: {
+				Entries: map[string]*cpuadvisor.ContainerAllocationInfo{
+					commonstate.FakedContainerName: {AllocationInfo: &cpuadvisor.AllocationInfo{
+						OwnerPoolName: commonstate.PoolNameReserve, TopologyAwareAssignments: map[uint64]string{0: "0"},
+					}},
+				},
+			},
+		},
+	}
+	tests := []struct {
+		name       string
+		setup      func(cs *cpuServer)
+		wantMetric string
+	}{
+		{
+			name: "starting up",
+			setup: func(cs *cpuServer) {
+				cs.startTime = time.Now()
+				cs.startUpPeriod = time.Hour
+			},
+			wantMetric: metricCPUServerSkipPushStartingUp,
+		},
+		{
+			name: "reserve pool uncovered",
+			setup: func(cs *cpuServer) {
+				cs.reservePoolMinNUMACoverage = 2
+			},
+			wantMetric: metricCPUServerSkipPushReserveUncovered,
+		},
+		{
+			// the request itself is a sync, so the freshness window is met without any checkpoint sync
+			name: "fresh sync from request",
+			setup: func(cs *cpuServer) {
+				cs.syncFreshnessWindow = time.Minute
+			},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var updated int32
+			advisor := &mockCPUResourceAdvisor{
+				onUpdate: func() {
+					atomic.AddInt32(&updated, 1)
+				},
+				provision: &types.InternalCPUCalculationResult{
+					PoolEntries: map[string]map[int]types.CPUResource{
+						commonstate.PoolNameReserve: {0: {Size: 1}},
+					},
+				},
+			}
+			cs := newTestCPUServer(t, advisor, []*v1.Pod{})
+			emitter := newFakeMetricEmitter()
+			cs.emitter = emitter
+			cs.gateGetAdvice = true
+			tt.setup(cs)
+
+			// a skipped advice fails, so that the plugin keeps its current allocation
+			resp, err := cs.GetAdvice(context.TODO(), request)
+			if tt.wantMetric == "" {
+				require.NoError(t, err)
+				require.NotNil(t, resp)
+				require.Equal(t, int32(1), atomic.LoadInt32(&updated))
+				return
+			}
+			require.Error(t, err)
+			require.Nil(t, resp)
+			require.Equal(t, int32(0), atomic.LoadInt32(&updated))
+			skipped, ok := emitter.get(cs.genMetricsName(tt.wantMetric))
+			require.True(t, ok)
+			require.Equal(t, int64(1), skipped)
+		})
+	}
+}
+
+func TestCPUServerGetAdvicePostProcessing(t *testing.T) {
+	t.Parallel()
+
+	advisor := &mockCPUResourceAdvisor{
+		provision: &types.InternalCPUCalculationResult{
+			PoolEntries: map[string]map[int]types.CPUResource{
+				commonstate.PoolNameReserve: {0: {Size: 1}},
+			},
+		},
+	}
+	cs := newTestCPUServer(t, advisor, []*v1.Pod{})
+	cs.emitter = newFakeMetricEmitter()
+	cs.gateGetAdvice = true
+	cs.cpuResponseHooks = []namedCPUResponseHook{
+		{name: "test", hook: func(resp *cpuadvisor.ListAndWatchResponse) error {
+			resp.ExtraEntries = append(resp.ExtraEntries, &advisorsvc.CalculationInfo{CgroupPath: "/hooked"})
+			return nil
+		}},
+	}
+	tracePath := path.Join(t.TempDir(), "advice-trace.log")
+	cs.adviceTracer = &adviceTracer{sink: &fileAdviceTraceSink{path: tracePath, maxBytes: 64 << 20}}
+	cs.lastAdvicePath = path.Join(t.TempDir(), lastAdviceFileName)
+	cs.lastAdviceMaxAge = time.Minute
+
+	reserveAllocationInfo := &cpuadvisor.AllocationInfo{
+		OwnerPoolName: commonstate.PoolNameReserve, TopologyAwareAssignments: map[uint64]string{0: "0"},
+	}
+	resp, err := cs.GetAdvice(context.TODO(), &cpuadvisor.GetAdviceRequest{
+		Entries: map[string]*cpuadvisor.ContainerAllocationInfoEntries{
+			commonstate.PoolNameReserve: {
+				Entries: map[string]*cpuadvisor.ContainerAllocationInfo{
+					commonstate.FakedContainerName: {AllocationInfo: reserveAllocationInfo},
+				},
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	// hooks run on the response of GetAdvice as well
+	require.NotEmpty(t, resp.ExtraEntries)
+	require.Equal(t, "/hooked", resp.ExtraEntries[len(resp.ExtraEntries)-1].CgroupPath)
+
+	// the advice is traced along with the allocation in the request
+	traces, err := LoadAdviceTraces(tracePath)
+	require.NoError(t, err)
+	require.Len(t, traces, 1)
+	require.Equal(t, reserveAllocationInfo.String(),
+		traces[0].Checkpoint.Entries[commonstate.PoolNameReserve].Entries[commonstate.FakedContainerName].String())
+
+	// the advice is persisted, and re-sent by a freshly started server
+	restored := newTestLastAdviceCPUServer(t, cs.lastAdvicePath)
+	restored.restoreLastAdvice()
+	s := &mockCPUServerService_ListAndWatchServer{ResultsChan: make(chan *cpuadvisor.ListAndWatchResponse, 1)}
+	require.NoError(t, restored.sendRestoredAdvice(s))
+	require.Len(t, s.ResultsChan, 1)
+	restoredResp := <-s.ResultsChan
+	require.Equal(t, (&cpuadvisor.ListAndWatchResponse{Entries: resp.Entries}).String(),
+		(&cpuadvisor.ListAndWatchResponse{Entries: restoredResp.Entries}).String())
+}
+
+func TestCPUServerGetAdviceUngated(t *testing.T) {
+	t.Parallel()
+
+	var updated int32
+	advisor := &mockCPUResourceAdvisor{
+		onUpdate: func() {
+			atomic.AddInt32(&updated, 1)
+		},
+		provision: &types.InternalCPUCalculationResult{
+			PoolEntries: map[string]map[int]types.CPUResource{
+				commonstate.PoolNameReserve: {0: {Size: 1}},
+			},
+		},
+	}
+	cs := newTestCPUServer(t, advisor, []*v1.Pod{})
+	cs.emitter = newFakeMetricEmitter()
+	// none of the gates, dry-run mode or hooks applies to GetAdvice unless it is gated
+	cs.startTime = time.Now()
+	cs.startUpPeriod = time.Hour
+	cs.reservePoolMinNUMACoverage = 2
+	cs.dryRun = true
+	cs.cpuResponseHooks = []namedCPUResponseHook{
+		{name: "test", hook: func(resp *cpuadvisor.ListAndWatchResponse) error {
+			return fmt.Errorf("hook should not run")
+		}},
+	}
+	cs.lastAdvicePath = path.Join(t.TempDir(), lastAdviceFileName)
+
+	resp, err := cs.GetAdvice(context.TODO(), &cpuadvisor.GetAdviceRequest{
+		Entries: map[string]*cpuadvisor.ContainerAllocationInfoEntries{
+			commonstate.PoolNameReserve: {
+				Entries: map[string]*cpuadvisor.ContainerAllocationInfo{
+					commonstate.FakedContainerName: {AllocationInfo: &cpuadvisor.AllocationInfo{
+						OwnerPoolName: commonstate.PoolNameReserve, TopologyAwareAssignments: map[uint64]string{0: "0"},
+					}},
+				},
+			},
+		},
+	})
+	require.NoError(t, err)
+	require.NotNil(t, resp)
+	require.Contains(t, resp.Entries, commonstate.PoolNameReserve)
+	require.Equal(t, int32(1), atomic.LoadInt32(&updated))
+	_, err = os.Stat(cs.lastAdvicePath)
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestCPUServerRejectIllegalQoSLevelChange(t *testing.T) {
+	t.Parallel()
+
+	cs := newTestCPUServer(t, nil, []*v1.Pod{})
+	emitter := newFakeMetricEmitter()
+	cs.emitter = emitter
+	cs.immutableQoSLevels = sets.NewString(consts.PodAnnotationQoSLevelDedicatedCores)
+	qosConf := cs.snapshotQoSConf()
+
+	newPod := func(qosLevel string) *v1.Pod {
+		return &v1.Pod{ObjectMeta: metav1.ObjectMeta{
+			UID:         "pod1",
+			Annotations: map[string]string{consts.PodAnnotationQoSLevelKey: qosLevel},
+		}}
+	}
+	require.NoError(t, cs.metaCache.AddContainer("pod1", "c1", &types.ContainerInfo{
+		PodUID:                   "pod1",
+		ContainerName:            "c1",
+		QoSLevel:                 consts.PodAnnotationQoSLevelDedicatedCores,
+		OwnerPoolName:            "pod1",
+		TopologyAwareAssignments: types.TopologyAwareAssignment{0: machine.NewCPUSet(4, 5)},
+	}))
+
+	// the change from dedicated_cores is rejected, and neither qos level nor assignments are applied
+	err := cs.updateContainerInfo(newQoSLevelResolver(qosConf), "pod1", "c1", newPod(consts.PodAnnotationQoSLevelSharedCores), &cpuadvisor.AllocationInfo{
+		OwnerPoolName:            commonstate.PoolNameShare,
+		TopologyAwareAssignments: map[uint64]string{0: "0-3"},
+	}, nil)
+	require.ErrorIs(t, err, errIllegalQoSLevelChange)
+	require.ErrorContains(t, err, "pod1")
+	require.ErrorContains(t, err, consts.PodAnnotationQoSLevelDedicatedCores+" to "+consts.PodAnnotationQoSLevelSharedCores)
+	ci, ok := cs.metaCache.GetContainerInfo("pod1", "c1")
+	require.True(t, ok)
+	require.Equal(t, consts.PodAnnotationQoSLevelDedicatedCores, ci.QoSLevel)
+	require.Equal(t, "4-5", ci.TopologyAwareAssignments[0].String())
+	rejected, ok := emitter.getTagged(cs.genMetricsName(metricCPUServerQoSLevelChangeRejected),
+		metrics.MetricTag{Key: "old", Val: consts.PodAnnotationQoSLevelDedicatedCores},
+		metrics.MetricTag{Key: "new", Val: consts.PodAnnotationQoSLevelSharedCores})
+	require.True(t, ok)
+	require.Equal(t, int64(1), rejected)
+
+	// illegal changes are not retried
+	retryBudget := 3
+	err = cs.updateContainerInfoWithRetry(newQoSLevelResolver(qosConf), "pod1", "c1", newPod(consts.PodAnnotationQoSLevelSharedCores),
+		&cpuadvisor.AllocationInfo{OwnerPoolName: commonstate.PoolNameShare}, &retryBudget, nil)
+	require.ErrorIs(t, err, errIllegalQoSLevelChange)
+	require.Equal(t, 3, retryBudget)
+
+	// changes between other qos levels are still allowed
+	require.NoError(t, cs.metaCache.AddContainer("pod1", "c2", &types.ContainerInfo{
+		PodUID:        "pod1",
+		ContainerName: "c2",
+		QoSLevel:      consts.PodAnnotationQoSLevelReclaimedCores,
+		OwnerPoolName: commonstate.PoolNameReclaim,
+	}))
+	require.NoError(t, cs.updateContainerInfo(newQoSLevelResolver(qosConf), "pod1", "c2", newPod(consts.PodAnnotationQoSLevelSharedCores),
+		&cpuadvisor.AllocationInfo{OwnerPoolName: commonstate.PoolNameShare}, nil))
+	ci, ok = cs.metaCache.GetContainerInfo("pod1", "c2")
+	require.True(t, ok)
+	require.Equal(t, consts.PodAnnotationQoSLevelSharedCores, ci.QoSLevel)
+}
+
+func TestCPUServerQoSLevelResolver(t *testing.T) {
+	t.Parallel()
+
+	cs := newTestCPUServer(t, nil, []*v1.Pod{})
+	pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{
+		UID:         "pod1",
+		Annotations: map[string]string{consts.PodAnnotationQoSLevelKey: consts.PodAnnotationQoSLevelSharedCores},
+	}}
+
+	// the qos level is resolved once per pod within a sync, regardless of annotation changes
+	resolver := newQoSLevelResolver(cs.snapshotQoSConf())
+	qosLevel, err := resolver.getQoSLevelForPod(pod)
+	require.NoError(t, err)
+	require.Equal(t, consts.PodAnnotationQoSLevelSharedCores, qosLevel)
+	pod.Annotations[consts.PodAnnotationQoSLevelKey] = consts.PodAnnotationQoSLevelReclaimedCores
+	qosLevel, err = resolver.getQoSLevelForPod(pod)
+	require.NoError(t, err)
+	require.Equal(t, consts.PodAnnotationQoSLevelSharedCores, qosLevel)
+	require.Len(t, resolver.qosLevels, 1)
+
+	// annotation changes are picked up by the next sync
+	resolver = newQoSLevelResolver(cs.snapshotQoSConf())
+	qosLevel, err = resolver.getQoSLevelForPod(pod)
+	require.NoError(t, err)
+	require.Equal(t, consts.PodAnnotationQoSLevelReclaimedCores, qosLevel)
+
+	// the resolution cost of a sync is emitted
+	emitter := newFakeMetricEmitter()
+	cs.emitter = emitter
+	cs.emitQoSLevelResolutionCost("syncCheckpoint", resolver)
+	cost, ok := emitter.getTagged(cs.genMetricsName(metricCPUServerQoSLevelResolutionCost),
+		metrics.MetricTag{Key: "api", Val: "syncCheckpoint"})
+	require.True(t, ok)
+	require.Equal(t, resolver.cost.Microseconds(), cost)
+}
+
+func TestCPUServerEmitStageDuration(t *testing.T) {
+	t.Parallel()
+
+	fakeClock := testingclock.NewFakeClock(time.Now())
+	advisor := &mockCPUResourceAdvisor{
+		onUpdate: func() {
+			fakeClock.Step(3 * time.Second)
+		},
+		provision: &types.InternalCPUCalculationResult{
+			PoolEntries: map[string]map[int]types.CPUResource{
+				commonstate.PoolNameReserve: {0: {Size: 2}},
+				commonstate.PoolNameShare:   {0: {Size: 4}},
+			},
+		},
+	}
+	cs := newTestCPUServer(t, advisor, []*v1.Pod{})
+	cs.clock = fakeClock
+	emitter := newFakeMetricEmitter()
+	cs.emitter = emitter
+
+	clients := []cpuadvisor.CPUPluginClient{
+		&mockCPUPluginClient{checkpoint: &cpuadvisor.GetCheckpointResponse{
+			Entries: map[string]*cpuadvisor.AllocationEntries{
+				commonstate.PoolNameReserve: {
+					Entries: map[string]*cpuadvisor.AllocationInfo{
+						commonstate.FakedContainerName: {OwnerPoolName: commonstate.PoolNameReserve, TopologyAwareAssignments: map[uint64]string{0: "0"}},
+					},
+				},
+				commonstate.PoolNameShare: {
+					Entries: map[string]*cpuadvisor.AllocationInfo{
+						commonstate.FakedContainerName: {OwnerPoolName: commonstate.PoolNameShare},
+					},
+				},
+			},
+		}},
+	}
+	server := &mockCPUServerService_ListAndWatchServer{ResultsChan: make(chan *cpuadvisor.ListAndWatchResponse, 1)}
+	require.NoError(t, cs.getAndPushAdvice(clients, server))
+	require.Len(t, server.ResultsChan, 1)
+
+	// latency is attributed to the advisor update, while other stages take no time on the fake clock
+	for stage, want := range map[string]int64{"advisor_update": 3000, "assemble": 0, "send": 0} {
+		cost, ok := emitter.getTagged(cs.genMetricsName(metricCPUServerStageDuration),
+			metrics.MetricTag{Key: "server", Val: cpuServerName},
+			metrics.MetricTag{Key: "stage", Val: stage})
+		require.True(t, ok, stage)
+		require.Equal(t, want, cost, stage)
+	}
+}
+
+func TestCPUServerObserveSecondaryPlugin(t *testing.T) {
+	t.Parallel()
+
+	cs := newTestCPUServer(t, nil, []*v1.Pod{})
+	emitter := newFakeMetricEmitter()
+	cs.emitter = emitter
+
+	// nothing is observed if the secondary plugin is disabled
+	require.Nil(t, cs.observeSecondaryPlugin(context.TODO(), nil))
+
+	// connect failures are only reported
+	cs.secondaryPluginSocketPath = path.Join(t.TempDir(), "secondary.sock")
+	require.Nil(t, cs.observeSecondaryPlugin(context.TODO(), nil))
+	failed, ok := emitter.getTagged(cs.genMetricsName(metricCPUServerSecondaryObserveFailed), metrics.MetricTag{Key: "reason", Val: "connect"})
+	require.True(t, ok)
+	require.Equal(t, int64(1), failed)
+
+	// the checkpoint of the secondary plugin is compared with meta cache, but never synced into it
+	require.NoError(t, cs.metaCache.AddContainer("pod1", "c1", &types.ContainerInfo{
+		PodUID: "pod1", ContainerName: "c1", OwnerPoolName: commonstate.PoolNameShare,
+	}))
+	require.NoError(t, cs.metaCache.AddContainer("pod1", "c2", &types.ContainerInfo{
+		PodUID: "pod1", ContainerName: "c2", OwnerPoolName: commonstate.PoolNameShare,
+	}))
+	require.NoError(t, os.WriteFile(cs.secondaryPluginSocketPath, nil, 0o644))
+	socketInfo, err := os.Stat(cs.secondaryPluginSocketPath)
+	require.NoError(t, err)
+	secondaryConn := &cpuPluginConn{
+		socketPath: cs.secondaryPluginSocketPath,
+		client: &mockCPUPluginClient{checkpoint: &cpuadvisor.GetCheckpointResponse{
+			Entries: map[string]*cpuadvisor.AllocationEntries{
+				commonstate.PoolNameShare: {
+					Entries: map[string]*cpuadvisor.AllocationInfo{
+						commonstate.FakedContainerName: {OwnerPoolName: commonstate.PoolNameShare},
+					},
+				},
+				"pod1": {
+					Entries: map[string]*cpuadvisor.AllocationInfo{
+						"c1": {OwnerPoolName: commonstate.PoolNameShare},
+						"c2": {OwnerPoolName: "share-a"},
+					},
+				},
+				"pod2": {
+					Entries: map[string]*cpuadvisor.AllocationInfo{
+						"c1": {OwnerPoolName: commonstate.PoolNameShare},
+					},
+				},
+			},
+		}},
+		closer:     io.NopCloser(nil),
+		socketInfo: socketInfo,
+	}
+	require.Equal(t, secondaryConn, cs.observeSecondaryPlugin(context.TODO(), secondaryConn))
+	diverged, ok := emitter.get(cs.genMetricsName(metricCPUServerSecondaryDiverged))
+	require.True(t, ok)
+	require.Equal(t, int64(2), diverged)
+	_, ok = cs.metaCache.GetContainerInfo("pod2", "c1")
+	require.False(t, ok)
+	ci, ok := cs.metaCache.GetContainerInfo("pod1", "c2")
+	require.True(t, ok)
+	require.Equal(t, commonstate.PoolNameShare, ci.OwnerPoolName)
+}
+
+func TestCPUServerDistinguishGonePods(t *testing.T) {
+	t.Parallel()
+
+	cs := newTestCPUServer(t, nil, []*v1.Pod{})
+	emitter := newFakeMetricEmitter()
+	cs.emitter = emitter
+	cs.getPodTimeout = 100 * time.Millisecond
+	cs.metaServer.PodFetcher = &slowPodFetcher{
+		PodFetcherStub: &pod.PodFetcherStub{PodList: []*v1.Pod{
+			{ObjectMeta: metav1.ObjectMeta{Name: "slow-pod", UID: "slow-pod"}},
+		}},
+		delays: map[string]time.Duration{"slow-pod": 2 * time.Second},
+	}
+
+	cs.syncCheckpoint(context.TODO(), &cpuadvisor.GetCheckpointResponse{
+		Entries: map[string]*cpuadvisor.AllocationEntries{
+			"slow-pod": {Entries: map[string]*cpuadvisor.AllocationInfo{"c1": {OwnerPoolName: commonstate.PoolNameShare}}},
+			"gone-pod": {Entries: map[string]*cpuadvisor.AllocationInfo{"c1": {OwnerPoolName: commonstate.PoolNameShare}}},
+		},
+	}, 0)
+
+	// both pods are handled as failed to be fetched, but only the timeout is reported as an error
+	require.Equal(t, []string{"gone-pod", "slow-pod"}, cs.podFetchFailed.List())
+	for reason, want := range map[string]int64{"pod_gone": 1, "error": 1} {
+		failed, ok := emitter.getTagged(cs.genMetricsName(metricCPUServerGetPodFailed), metrics.MetricTag{Key: "reason", Val: reason})
+		require.True(t, ok, reason)
+		require.Equal(t, want, failed, reason)
+	}
+}
+
+func TestCPUServerBlockIDs(t *testing.T) {
+	t.Parallel()
+
+	cs := newTestCPUServer(t, nil, []*v1.Pod{})
+	emitter := newFakeMetricEmitter()
+	cs.emitter = emitter
+	advisorResp := &types.InternalCPUCalculationResult{
+		PoolEntries: map[string]map[int]types.CPUResource{
+			commonstate.PoolNameReserve: {0: {Size: 2}},
+			"share-a":                   {0: {Size: 4}, 1: {Size: 4}},
+			"share-b":                   {0: {Size: 4}},
+		},
+	}
+	// poolBlockIDs returns ids of blocks keyed by pool and numa, and asserts no two live blocks share an id
+	poolBlockIDs := func(calculationEntriesMap map[string]*cpuadvisor.CalculationEntries) map[string]string {
+		blockIDs := make(map[string]string)
+		owners := make(map[string]string)
+		for poolName, entries := range calculationEntriesMap {
+			poolInfo, ok := entries.Entries[commonstate.FakedContainerName]
+			if !ok {
+				continue
+			}
+			for numaID, numaCalculationResult := range poolInfo.CalculationResultsByNumas {
+				for _, block := range numaCalculationResult.Blocks {
+					owner := fmt.Sprintf("%s/%d", poolName, numaID)
+					require.NotContains(t, owners, block.BlockId, "block %s is shared by %s and %s", block.BlockId, owners[block.BlockId], owner)
+					owners[block.BlockId] = owner
+					blockIDs[owner] = block.BlockId
+				}
+			}
+		}
+		return blockIDs
+	}
+
+	// deterministic block ids are stable cycle-to-cycle
+	cs.blockIDGenerator = NewDeterministicBlockIDGenerator()
+	blockIDs := poolBlockIDs(cs.assembleResponse(advisorResp).Entries)
+	require.Equal(t, map[string]string{
+		commonstate.PoolNameReserve + "/0": commonstate.PoolNameReserve + "/0/2",
+		"share-a/0":                        "share-a/0/4",
+		"share-a/1":                        "share-a/1/4",
+		"share-b/0":                        "share-b/0/4",
+	}, blockIDs)
+	require.Equal(t, blockIDs, poolBlockIDs(cs.assembleResponse(advisorResp).Entries))
+	_, ok := emitter.get(cs.genMetricsName(metricCPUServerBlockIDCollided))
+	require.False(t, ok)
+
+	// colliding block ids are suffixed rather than joined with live blocks
+	cs.blockIDGenerator = func(BlockIDKey) string { return "block" }
+	blockIDList := make([]string, 0)
+	for _, blockID := range poolBlockIDs(cs.assembleResponse(advisorResp).Entries) {
+		blockIDList = append(blockIDList, blockID)
+	}
+	require.ElementsMatch(t, []string{"block", "block-2", "block-3", "block-4"}, blockIDList)
+	_, ok = emitter.get(cs.genMetricsName(metricCPUServerBlockIDCollided))
+	require.True(t, ok)
+}
+
+func TestCPUServerReserveNUMAHeadroom(t *testing.T) {
+	t.Parallel()
+
+	cs := newTestCPUServer(t, nil, []*v1.Pod{})
+	emitter := newFakeMetricEmitter()
+	cs.emitter = emitter
+	cs.headroomResourceManager = &mockHeadroomResourceManager{
+		numaAllocatable: map[int]resource.Quantity{
+			0: resource.MustParse("8k"),
+			1: resource.MustParse("1500"),
+		},
+	}
+	getHeadroom := func() (cpuadvisor.CPUNUMAHeadroom, string) {
+		info := cs.assembleHeadroom(nil)
+		require.NotNil(t, info)
+		numaHeadroom := cpuadvisor.CPUNUMAHeadroom{}
+		require.NoError(t, json.Unmarshal([]byte(info.CalculationResult.Values[string(cpuadvisor.ControlKnobKeyCPUNUMAHeadroom)]), &numaHeadroom))
+		return numaHeadroom, info.CalculationResult.Values[string(cpuadvisor.ControlKnobKeyCPUNodeHeadroom)]
+	}
+
+	// the ratio holds back a fraction of each numa, and node headroom is summed up after reservation
+	cs.numaHeadroomReservedRatio = 0.25
+	numaHeadroom, nodeHeadroom := getHeadroom()
+	require.Equal(t, cpuadvisor.CPUNUMAHeadroom{0: 6, 1: 1.125}, numaHeadroom)
+	require.Equal(t, "7.125", nodeHeadroom)
+	before, ok := emitter.get(cs.genMetricsName(metricCPUServerNUMAHeadroomPreReserve))
+	require.True(t, ok)
+	require.Equal(t, int64(9500), before)
+	after, ok := emitter.get(cs.genMetricsName(metricCPUServerNUMAHeadroomPostReserve))
+	require.True(t, ok)
+	require.Equal(t, int64(7125), after)
+
+	// the larger margin takes effect, and headroom of a numa never goes negative
+	cs.numaHeadroomReservedMilliCores = 2000
+	numaHeadroom, nodeHeadroom = getHeadroom()
+	require.Equal(t, cpuadvisor.CPUNUMAHeadroom{0: 6, 1: 0}, numaHeadroom)
+	require.Equal(t, "6", nodeHeadroom)
+}
+
+func TestCPUServerDiscountOverlappedNUMAHeadroom(t *testing.T) {
+	t.Parallel()
+
+	cs := newTestCPUServer(t, nil, []*v1.Pod{})
+	emitter := newFakeMetricEmitter()
+	cs.emitter = emitter
+	cs.headroomResourceManager = &mockHeadroomResourceManager{
+		numaAllocatable: map[int]resource.Quantity{
+			0: resource.MustParse("8k"),
+			1: resource.MustParse("1500"),
+		},
+	}
+	advisorResp := &types.InternalCPUCalculationResult{
+		AllowSharedCoresOverlapReclaimedCores: true,
+		PoolOverlapInfo: map[string]map[int]map[string]int{
+			commonstate.PoolNameReclaim: {
+				0: {commonstate.PoolNameShare: 2, "share-a": 1},
+				1: {commonstate.PoolNameShare: 2},
+			},
+		},
+	}
+	getHeadroom := func() cpuadvisor.CPUNUMAHeadroom {
+		info := cs.assembleHeadroom(advisorResp)
+		require.NotNil(t, info)
+		numaHeadroom := cpuadvisor.CPUNUMAHeadroom{}
+		require.NoError(t, json.Unmarshal([]byte(info.CalculationResult.Values[string(cpuadvisor.ControlKnobKeyCPUNUMAHeadroom)]), &numaHeadroom))
+		return numaHeadroom
+	}
+
+	// overlapped cores are reported as headroom if discount is disabled
+	require.Equal(t, cpuadvisor.CPUNUMAHeadroom{0: 8, 1: 1.5}, getHeadroom())
+
+	// overlapped cores are discounted, and headroom of a numa never goes negative
+	cs.discountOverlappedHeadroom = true
+	require.Equal(t, cpuadvisor.CPUNUMAHeadroom{0: 5, 1: 0}, getHeadroom())
+	raw, ok := emitter.getTagged(cs.genMetricsName(metricCPUServerNUMAHeadroomRaw), metrics.MetricTag{Key: "numa", Val: "0"})
+	require.True(t, ok)
+	require.Equal(t, int64(8000), raw)
+	adjusted, ok := emitter.getTagged(cs.genMetricsName(metricCPUServerNUMAHeadroomAdjusted), metrics.MetricTag{Key: "numa", Val: "0"})
+	require.True(t, ok)
+	require.Equal(t, int64(5000), adjusted)
+
+	// headroom is unchanged if overlap is not allowed
+	advisorResp.AllowSharedCoresOverlapReclaimedCores = false
+	require.Equal(t, cpuadvisor.CPUNUMAHeadroom{0: 8, 1: 1.5}, getHeadroom())
+}
+
+func TestCPUServerSkipPushOnUncoveredReservePool(t *testing.T) {
+	t.Parallel()
+
+	cs := newTestCPUServer(t, nil, []*v1.Pod{})
+	emitter := newFakeMetricEmitter()
+	cs.emitter = emitter
+
+	// reserve pool without any non-empty numa assignment is regarded as a transient state
+	require.NoError(t, cs.metaCache.SetPoolInfo(commonstate.PoolNameReserve, &types.PoolInfo{
+		PoolName:                 commonstate.PoolNameReserve,
+		TopologyAwareAssignments: map[int]machine.CPUSet{0: machine.NewCPUSet()},
+	}))
+	require.Error(t, cs.checkAdviceGates())
+	skipped, ok := emitter.get(cs.genMetricsName(metricCPUServerSkipPushReserveUncovered))
+	require.True(t, ok)
+	require.Equal(t, int64(1), skipped)
+
+	// zero coverage only requires the reserve pool to exist
+	cs.reservePoolMinNUMACoverage = 0
+	require.NoError(t, cs.checkAdviceGates())
+
+	// the requirement is met only if enough numas are covered
+	cs.reservePoolMinNUMACoverage = 2
+	require.NoError(t, cs.metaCache.SetPoolInfo(commonstate.PoolNameReserve, &types.PoolInfo{
+		PoolName:                 commonstate.PoolNameReserve,
+		TopologyAwareAssignments: map[int]machine.CPUSet{0: machine.NewCPUSet(0), 1: machine.NewCPUSet()},
+	}))
+	require.Error(t, cs.checkAdviceGates())
+	require.NoError(t, cs.metaCache.SetPoolInfo(commonstate.PoolNameReserve, &types.PoolInfo{
+		PoolName:                 commonstate.PoolNameReserve,
+		TopologyAwareAssignments: map[int]machine.CPUSet{0: machine.NewCPUSet(0), 1: machine.NewCPUSet(16)},
+	}))
+	require.NoError(t, cs.checkAdviceGates())
+
+	// negative coverage is rejected
+	conf := generateTestConfiguration(t)
+	conf.CPUServerReservePoolMinNUMACoverage = -1
+	_, err := NewCPUServer(conf, &reporter.DummyHeadroomResourceManager{}, cs.metaCache, cs.metaServer, nil, metrics.DummyMetrics{})
+	require.Error(t, err)
+}
+
+func TestCPUServerSkipUnchangedCheckpointUpdates(t *testing.T) {
+	t.Parallel()
+
+	cs := newTestCPUServer(t, nil, []*v1.Pod{{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "pod1",
+			UID:         "pod1",
+			Annotations: map[string]string{consts.PodAnnotationQoSLevelKey: consts.PodAnnotationQoSLevelSharedCores},
+		},
+	}})
+	emitter := newFakeMetricEmitter()
+	cs.emitter = emitter
+	require.NoError(t, cs.metaCache.AddContainer("pod1", "c1", &types.ContainerInfo{
+		PodUID:        "pod1",
+		ContainerName: "c1",
+		QoSLevel:      consts.PodAnnotationQoSLevelSharedCores,
+	}))
+
+	newCheckpoint := func(containerCPUs string) *cpuadvisor.GetCheckpointResponse {
+		return &cpuadvisor.GetCheckpointResponse{
+			Entries: map[string]*cpuadvisor.AllocationEntries{
+				commonstate.PoolNameShare: {Entries: map[string]*cpuadvisor.AllocationInfo{
+					commonstate.FakedContainerName: {
+						OwnerPoolName:            commonstate.PoolNameShare,
+						TopologyAwareAssignments: map[uint64]string{0: "0-3"},
+					},
+				}},
+				"pod1": {Entries: map[string]*cpuadvisor.AllocationInfo{
+					"c1": {
+						OwnerPoolName:            commonstate.PoolNameShare,
+						TopologyAwareAssignments: map[uint64]string{0: containerCPUs},
+					},
+				}},
+			},
+		}
+	}
+	requireUpdates := func(skipped, applied int64) {
+		for result, want := range map[string]int64{"skipped": skipped, "applied": applied} {
+			got, ok := emitter.getTagged(cs.genMetricsName(metricCPUServerCheckpointUpdates), metrics.MetricTag{Key: "result", Val: result})
+			require.True(t, ok, result)
+			require.Equal(t, want, got, result)
+		}
+	}
+
+	// both the new pool and the changed container are applied
+	cs.syncCheckpoint(context.TODO(), newCheckpoint("0-3"), 0)
+	requireUpdates(0, 2)
+
+	// nothing is written back if the checkpoint is unchanged
+	cs.syncCheckpoint(context.TODO(), newCheckpoint("0-3"), 0)
+	requireUpdates(2, 0)
+
+	// only the changed container is applied
+	cs.syncCheckpoint(context.TODO(), newCheckpoint("0-1"), 0)
+	requireUpdates(1, 1)
+	ci, ok := cs.metaCache.GetContainerInfo("pod1", "c1")
+	require.True(t, ok)
+	require.Equal(t, "0-1", ci.TopologyAwareAssignments[0].String())
+}
+
+func TestCPUServerLWLoopRestartsAndCheckpointTime(t *testing.T) {
+	t.Parallel()
+
+	cs := newTestCPUServer(t, nil, []*v1.Pod{})
+	emitter := newFakeMetricEmitter()
+	cs.emitter = emitter
+	socketTag := metrics.MetricTag{Key: "socket", Val: cs.advisorSocketPath}
+
+	// the first loop is not regarded as a restart, and restarts are counted monotonically afterwards
+	for i, want := range []int64{0, 1, 2} {
+		cs.recordLWLoopStart()
+		restarts, ok := emitter.getTagged(cs.genMetricsName(metricCPUServerLWLoopRestarts), socketTag)
+		require.True(t, ok, i)
+		require.Equal(t, want, restarts, i)
+	}
+	require.True(t, cs.GetLWHealthDetail().LastCheckpointSuccessTime.IsZero())
+
+	require.NoError(t, cs.getAndSyncCheckpoint(context.TODO(), []cpuadvisor.CPUPluginClient{
+		&mockCPUPluginClient{checkpoint: &cpuadvisor.GetCheckpointResponse{}},
+	}))
+	timestamp, ok := emitter.getTagged(cs.genMetricsName(metricCPUServerLastCheckpointSuccess), socketTag)
+	require.True(t, ok)
+	require.Equal(t, cs.lastSyncSuccessTime.Unix(), timestamp)
+
+	// both are exported by the debug handler
+	recorder := httptest.NewRecorder()
+	cs.serveLWHealthDetail(recorder, httptest.NewRequest(http.MethodGet, general.DebugHandlerPathPrefix+cpuServerHealthDebugHandlerName, nil))
+	require.Equal(t, http.StatusOK, recorder.Code)
+	detail := CPUServerHealthDetail{}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &detail))
+	require.Equal(t, int64(2), detail.LoopRestarts)
+	require.True(t, detail.LastCheckpointSuccessTime.Equal(cs.lastSyncSuccessTime))
+}
+
+func TestCPUServerJitteredPeriod(t *testing.T) {
+	t.Parallel()
+
+	cs := newTestCPUServer(t, nil, []*v1.Pod{})
+	cs.period = 10 * time.Second
+	var gotMaxFactor float64
+	cs.jitter = func(duration time.Duration, maxFactor float64) time.Duration {
+		gotMaxFactor = maxFactor
+		return duration + time.Duration(maxFactor*float64(duration))
+	}
+
+	// jitter is disabled by default
+	require.Equal(t, 10*time.Second, cs.jitteredPeriod())
+	require.Zero(t, gotMaxFactor)
+
+	cs.periodJitterFactor = 0.2
+	require.Equal(t, 12*time.Second, cs.jitteredPeriod())
+	require.Equal(t, 0.2, gotMaxFactor)
+
+	// the default jitter source never shortens the period, and is bounded by the factor
+	cs.jitter = wait.Jitter
+	for i := 0; i < 10; i++ {
+		period := cs.jitteredPeriod()
+		require.GreaterOrEqual(t, period, 10*time.Second)
+		require.LessOrEqual(t, period, 12*time.Second)
+	}
+}
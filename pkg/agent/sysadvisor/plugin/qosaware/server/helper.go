@@ -18,9 +18,16 @@ package server
 
 import (
 	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
 
+	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/apimachinery/pkg/util/uuid"
 
+	"github.com/kubewharf/katalyst-core/pkg/agent/qrm-plugins/commonstate"
 	"github.com/kubewharf/katalyst-core/pkg/agent/qrm-plugins/cpu/dynamicpolicy/cpuadvisor"
 )
 
@@ -35,6 +42,41 @@ func NewPoolCalculationEntries(poolName string) *cpuadvisor.CalculationEntries {
 	return &cpuadvisor.CalculationEntries{Entries: map[string]*cpuadvisor.CalculationInfo{"": ci}}
 }
 
+// BlockIDKey describes the block to generate an id for
+type BlockIDKey struct {
+	// Owner is the name of the pool, or the uid of the pod for blocks of dedicated pods
+	Owner  string
+	NUMAID int64
+	Size   uint64
+}
+
+// BlockIDGenerator generates ids for newly constructed blocks
+type BlockIDGenerator func(key BlockIDKey) string
+
+// NewUUIDBlockIDGenerator returns a generator of random uuid block ids, which is used by default
+func NewUUIDBlockIDGenerator() BlockIDGenerator {
+	return func(BlockIDKey) string {
+		return string(uuid.NewUUID())
+	}
+}
+
+// NewDeterministicBlockIDGenerator returns a generator of block ids derived from the owner, numa and size
+// of blocks, so that the same advice is assembled with stable block ids cycle-to-cycle to ease diffing
+func NewDeterministicBlockIDGenerator() BlockIDGenerator {
+	return func(key BlockIDKey) string {
+		return fmt.Sprintf("%s/%d/%d", key.Owner, key.NUMAID, key.Size)
+	}
+}
+
+// NewSequentialBlockIDGenerator returns a generator of deterministic block ids composed of the prefix
+// and a sequence number starting from 1, so that assembled responses are reproducible in tests
+func NewSequentialBlockIDGenerator(prefix string) BlockIDGenerator {
+	var seq uint64
+	return func(BlockIDKey) string {
+		return fmt.Sprintf("%s%d", prefix, atomic.AddUint64(&seq, 1))
+	}
+}
+
 // NewBlock constructs a Block structure; generate a new one if blockID is missed
 func NewBlock(size uint64, blockID string) *cpuadvisor.Block {
 	if blockID == "" {
@@ -48,11 +90,104 @@ func NewBlock(size uint64, blockID string) *cpuadvisor.Block {
 	}
 }
 
+// CPUUnit is the unit of cpu values
+type CPUUnit string
+
+const (
+	CPUUnitCores      CPUUnit = "cores"
+	CPUUnitMilliCores CPUUnit = "millicores"
+)
+
+// milliCoresPerUnit returns the number of millicores in one unit
+func milliCoresPerUnit(unit CPUUnit) (float64, error) {
+	switch unit {
+	case CPUUnitCores, "":
+		return 1000, nil
+	case CPUUnitMilliCores:
+		return 1, nil
+	default:
+		return 0, fmt.Errorf("unknown cpu unit %q", unit)
+	}
+}
+
+// ConvertCPUValue converts the cpu value from one unit to another, and empty unit is regarded as cores
+func ConvertCPUValue(value float64, from, to CPUUnit) (float64, error) {
+	fromMilli, err := milliCoresPerUnit(from)
+	if err != nil {
+		return 0, err
+	}
+	toMilli, err := milliCoresPerUnit(to)
+	if err != nil {
+		return 0, err
+	}
+	return value * fromMilli / toMilli, nil
+}
+
+// cpuSizeToBlockResult converts the cpu size in the given unit to the result of block, which is always
+// in cores since cpusets are allocated by whole cpus; partial cores are rounded up, and non-positive sizes are zero.
+func cpuSizeToBlockResult(size int, unit CPUUnit) (uint64, error) {
+	cores, err := ConvertCPUValue(float64(size), unit, CPUUnitCores)
+	if err != nil {
+		return 0, err
+	}
+	if cores <= 0 {
+		return 0, nil
+	}
+	return uint64(math.Ceil(cores)), nil
+}
+
 type ContainerMeta struct {
 	PodUID        string
 	ContainerName string
 }
 
+// containerMetaSet is a set of ContainerMeta
+type containerMetaSet map[ContainerMeta]struct{}
+
+func (s containerMetaSet) Insert(meta ContainerMeta) {
+	s[meta] = struct{}{}
+}
+
+func (s containerMetaSet) Has(meta ContainerMeta) bool {
+	_, ok := s[meta]
+	return ok
+}
+
+// dailyTimeWindow is a time window repeated every day, and it crosses midnight if start is after end
+type dailyTimeWindow struct {
+	// start and end are offsets since midnight
+	start time.Duration
+	end   time.Duration
+}
+
+// parseDailyTimeWindow parses daily time window formatted as HH:MM-HH:MM
+func parseDailyTimeWindow(window string) (*dailyTimeWindow, error) {
+	parts := strings.Split(window, "-")
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("invalid daily time window %q, expected HH:MM-HH:MM", window)
+	}
+
+	offsets := make([]time.Duration, 0, len(parts))
+	for _, part := range parts {
+		t, err := time.Parse("15:04", strings.TrimSpace(part))
+		if err != nil {
+			return nil, fmt.Errorf("invalid daily time window %q: %w", window, err)
+		}
+		offsets = append(offsets, time.Duration(t.Hour())*time.Hour+time.Duration(t.Minute())*time.Minute)
+	}
+	return &dailyTimeWindow{start: offsets[0], end: offsets[1]}, nil
+}
+
+// contains returns true if the given time (in its own location) is within the window
+func (w *dailyTimeWindow) contains(t time.Time) bool {
+	offset := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute +
+		time.Duration(t.Second())*time.Second
+	if w.start <= w.end {
+		return offset >= w.start && offset < w.end
+	}
+	return offset >= w.start || offset < w.end
+}
+
 // internalBlock works as a packed structure for Block;
 // aside for Block, it also stores some extra info to speed up efficiency.
 type internalBlock struct {
@@ -91,6 +226,23 @@ func NewInnerBlock(block *cpuadvisor.Block, numaID int64, poolName string, conta
 	return ib
 }
 
+// ownerName returns the name of pool or container owning this block
+func (ib *internalBlock) ownerName() string {
+	if ib.ContainerMeta == nil {
+		return "pool:" + ib.PoolName
+	}
+	return "container:" + ib.ContainerMeta.PodUID + "/" + ib.ContainerMeta.ContainerName
+}
+
+// overlapTargetOwnerName returns the name of pool or container that the overlap target refers to,
+// and it is consistent with internalBlock.ownerName
+func overlapTargetOwnerName(target *cpuadvisor.OverlapTarget) string {
+	if target.OverlapType == cpuadvisor.OverlapType_OverlapWithPool {
+		return "pool:" + target.OverlapTargetPoolName
+	}
+	return "container:" + target.OverlapTargetPodUid + "/" + target.OverlapTargetContainerName
+}
+
 // initialOverlapTarget constructs cpuadvisor.OverlapTarget based on Block info
 func (ib *internalBlock) initialOverlapTarget() *cpuadvisor.OverlapTarget {
 	target := &cpuadvisor.OverlapTarget{}
@@ -224,6 +376,173 @@ func (bs blockSet) get(blockID string) []*internalBlock {
 	return internalBlocks
 }
 
+// BlockReference is a pool or container referring to a block, along with the overlap targets of its block
+type BlockReference struct {
+	Owner          string   `json:"owner"`
+	OverlapTargets []string `json:"overlapTargets,omitempty"`
+}
+
+// BlockSnapshot describes a block and all pools and containers referring to it
+type BlockSnapshot struct {
+	BlockID    string           `json:"blockID"`
+	NumaID     int64            `json:"numaID"`
+	Size       uint64           `json:"size"`
+	References []BlockReference `json:"references"`
+}
+
+// snapshot returns blocks in the order of block id, and owner names are consistent with renderDOT
+func (bs blockSet) snapshot() []BlockSnapshot {
+	blockIDs := make([]string, 0, len(bs))
+	for blockID := range bs {
+		blockIDs = append(blockIDs, blockID)
+	}
+	sort.Strings(blockIDs)
+
+	blocks := make([]BlockSnapshot, 0, len(blockIDs))
+	for _, blockID := range blockIDs {
+		internalBlocks := bs[blockID]
+		if len(internalBlocks) == 0 {
+			continue
+		}
+
+		block := BlockSnapshot{
+			BlockID:    blockID,
+			NumaID:     internalBlocks[0].NumaID,
+			Size:       internalBlocks[0].Block.Result,
+			References: make([]BlockReference, 0, len(internalBlocks)),
+		}
+		for _, ib := range internalBlocks {
+			reference := BlockReference{Owner: ib.ownerName()}
+			for _, target := range ib.Block.GetOverlapTargets() {
+				reference.OverlapTargets = append(reference.OverlapTargets, overlapTargetOwnerName(target))
+			}
+			sort.Strings(reference.OverlapTargets)
+			block.References = append(block.References, reference)
+		}
+		sort.Slice(block.References, func(i, j int) bool {
+			return block.References[i].Owner < block.References[j].Owner
+		})
+		blocks = append(blocks, block)
+	}
+	return blocks
+}
+
+// blockSetStat describes the size of the overlap graph of a blockSet
+type blockSetStat struct {
+	// blocks is the number of internalBlocks
+	blocks int
+	// overlapJoins is the number of internalBlocks joined to an existing block id, i.e. overlapping with others
+	overlapJoins int
+	// maxOverlapFanOut is the max number of overlap targets of any single block
+	maxOverlapFanOut int
+}
+
+func (bs blockSet) stat() blockSetStat {
+	stat := blockSetStat{}
+	for _, internalBlocks := range bs {
+		if len(internalBlocks) == 0 {
+			continue
+		}
+		stat.blocks += len(internalBlocks)
+		stat.overlapJoins += len(internalBlocks) - 1
+		for _, ib := range internalBlocks {
+			if fanOut := len(ib.Block.GetOverlapTargets()); fanOut > stat.maxOverlapFanOut {
+				stat.maxOverlapFanOut = fanOut
+			}
+		}
+	}
+	return stat
+}
+
+// reclaimOverlaps returns pools and containers sharing blocks with reclaim pool on each numa
+func (bs blockSet) reclaimOverlaps() map[int64][]string {
+	overlaps := make(map[int64]sets.String)
+	for _, internalBlocks := range bs {
+		for _, ib := range internalBlocks {
+			if ib.ContainerMeta != nil || ib.PoolName != commonstate.PoolNameReclaim {
+				continue
+			}
+
+			owners, ok := overlaps[ib.NumaID]
+			if !ok {
+				owners = sets.NewString()
+				overlaps[ib.NumaID] = owners
+			}
+			for _, target := range ib.Block.GetOverlapTargets() {
+				owners.Insert(overlapTargetOwnerName(target))
+			}
+			for _, other := range internalBlocks {
+				if other != ib {
+					owners.Insert(other.ownerName())
+				}
+			}
+		}
+	}
+
+	// overlap targets of split reclaim blocks may refer to reclaim pool itself
+	result := make(map[int64][]string, len(overlaps))
+	for numaID, owners := range overlaps {
+		result[numaID] = owners.Delete("pool:" + commonstate.PoolNameReclaim).List()
+	}
+	return result
+}
+
+// renderDOT renders the blockSet as an undirected Graphviz DOT graph, where each internalBlock is a node
+// labeled by its owner, numa and size, and each overlap target is an edge between blocks sharing the same id;
+// targets without any block of the same id (e.g. overlapping with reserve pool) are rendered as dashed boxes.
+func (bs blockSet) renderDOT() string {
+	blockIDs := make([]string, 0, len(bs))
+	for blockID := range bs {
+		blockIDs = append(blockIDs, blockID)
+	}
+	sort.Strings(blockIDs)
+
+	var sb strings.Builder
+	sb.WriteString("graph blocks {\n")
+
+	nodes := sets.NewString()
+	for _, blockID := range blockIDs {
+		for _, ib := range bs[blockID] {
+			node := blockID + "/" + ib.ownerName()
+			if nodes.Has(node) {
+				continue
+			}
+			nodes.Insert(node)
+			sb.WriteString(fmt.Sprintf("\t%q [label=%q];\n", node,
+				fmt.Sprintf("%s\nnuma %d, size %d\nblock %s", ib.ownerName(), ib.NumaID, ib.Block.Result, blockID)))
+		}
+	}
+
+	externals, edges := sets.NewString(), sets.NewString()
+	for _, blockID := range blockIDs {
+		for _, ib := range bs[blockID] {
+			src := blockID + "/" + ib.ownerName()
+			for _, target := range ib.Block.GetOverlapTargets() {
+				dst := blockID + "/" + overlapTargetOwnerName(target)
+				if !nodes.Has(dst) {
+					dst = overlapTargetOwnerName(target)
+					externals.Insert(dst)
+				} else if src > dst {
+					// overlap targets are mutual among blocks of the same id, so only render each pair once
+					src, dst = dst, src
+				}
+				if src != dst {
+					edges.Insert(fmt.Sprintf("\t%q -- %q;\n", src, dst))
+				}
+			}
+		}
+	}
+
+	for _, external := range externals.List() {
+		sb.WriteString(fmt.Sprintf("\t%q [shape=box, style=dashed];\n", external))
+	}
+	for _, edge := range edges.List() {
+		sb.WriteString(edge)
+	}
+	sb.WriteString("}\n")
+	return sb.String()
+}
+
 // getNumaCalculationResult returns numa-level calculation results
 func getNumaCalculationResult(calculationEntriesMap map[string]*cpuadvisor.CalculationEntries,
 	entryName, containerName string, numa int64,
@@ -0,0 +1,186 @@
+/*
+Copyright 2022 The Katalyst Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"k8s.io/klog/v2"
+
+	"github.com/kubewharf/katalyst-core/pkg/agent/qrm-plugins/cpu/dynamicpolicy/cpuadvisor"
+	"github.com/kubewharf/katalyst-core/pkg/metrics"
+)
+
+// Metric names for persisted advice
+const (
+	metricLastAdvicePersistFailed = "last_advice_persist_failed"
+	metricLastAdviceRestored      = "last_advice_restored"
+	metricLastAdviceDiscarded     = "last_advice_discarded"
+	metricLastAdviceResent        = "last_advice_resent"
+)
+
+const (
+	// lastAdviceFileName is the file of persisted advice under the state file directory
+	lastAdviceFileName = "cpu_server_last_advice"
+	// lastAdviceVersion is the schema version of persisted advice, and it must be bumped on any incompatible
+	// change of the envelope or the response, so that advice persisted by other versions is discarded
+	lastAdviceVersion = 1
+)
+
+// persistedAdvice is the envelope of the last advice sent by ListAndWatch
+type persistedAdvice struct {
+	Version   int       `json:"version"`
+	Timestamp time.Time `json:"timestamp"`
+	// Response is the ListAndWatchResponse in protobuf wire format
+	Response []byte `json:"response"`
+}
+
+// persistLastAdvice writes the advice to a temporary file and renames it to lastAdvicePath, so that
+// a partially written advice is never restored; failures are only reported, never affecting the push
+func (cs *cpuServer) persistLastAdvice(resp *cpuadvisor.ListAndWatchResponse) {
+	if cs.lastAdvicePath == "" {
+		return
+	}
+
+	if err := cs.doPersistLastAdvice(resp); err != nil {
+		klog.Errorf("[qosaware-server-cpu] persist last advice failed: %v", err)
+		_ = cs.emitter.StoreInt64(cs.genMetricsName(metricLastAdvicePersistFailed), 1, metrics.MetricTypeNameCount)
+	}
+}
+
+func (cs *cpuServer) doPersistLastAdvice(resp *cpuadvisor.ListAndWatchResponse) error {
+	data, err := resp.Marshal()
+	if err != nil {
+		return fmt.Errorf("marshal response failed: %w", err)
+	}
+	envelope, err := json.Marshal(&persistedAdvice{Version: lastAdviceVersion, Timestamp: cs.clock.Now(), Response: data})
+	if err != nil {
+		return fmt.Errorf("marshal envelope failed: %w", err)
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(cs.lastAdvicePath), filepath.Base(cs.lastAdvicePath)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = os.Remove(file.Name())
+	}()
+
+	if _, err := file.Write(envelope); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), cs.lastAdvicePath)
+}
+
+// restoreLastAdvice loads the advice at lastAdvicePath to be re-sent by the first ListAndWatch loop;
+// advice of another schema version, or older than lastAdviceMaxAge, is discarded along with the file
+func (cs *cpuServer) restoreLastAdvice() {
+	if cs.lastAdvicePath == "" {
+		return
+	}
+
+	data, err := os.ReadFile(cs.lastAdvicePath)
+	if os.IsNotExist(err) {
+		klog.Infof("[qosaware-server-cpu] persisted advice %s does not exist", cs.lastAdvicePath)
+		return
+	} else if err != nil {
+		klog.Warningf("[qosaware-server-cpu] read persisted advice failed: %v", err)
+		return
+	}
+
+	resp, timestamp, reason, err := cs.decodePersistedAdvice(data)
+	if err != nil {
+		klog.Warningf("[qosaware-server-cpu] discard persisted advice: %v", err)
+		_ = cs.emitter.StoreInt64(cs.genMetricsName(metricLastAdviceDiscarded), 1, metrics.MetricTypeNameCount,
+			metrics.MetricTag{Key: "reason", Val: reason})
+		_ = os.Remove(cs.lastAdvicePath)
+		return
+	}
+
+	cs.restoredAdviceMutex.Lock()
+	cs.restoredAdvice = resp
+	cs.restoredAdviceTimestamp = timestamp
+	cs.restoredAdviceMutex.Unlock()
+	klog.Infof("[qosaware-server-cpu] persisted advice with %d entries is restored", len(resp.Entries))
+	_ = cs.emitter.StoreInt64(cs.genMetricsName(metricLastAdviceRestored), 1, metrics.MetricTypeNameCount)
+}
+
+// decodePersistedAdvice decodes the envelope and the response along with the time it was persisted at,
+// and returns the reason along with the error
+func (cs *cpuServer) decodePersistedAdvice(data []byte) (*cpuadvisor.ListAndWatchResponse, time.Time, string, error) {
+	envelope := &persistedAdvice{}
+	if err := json.Unmarshal(data, envelope); err != nil {
+		return nil, time.Time{}, "corrupted", fmt.Errorf("decode envelope failed: %w", err)
+	}
+	if envelope.Version != lastAdviceVersion {
+		return nil, time.Time{}, "version", fmt.Errorf("version %d mismatches %d", envelope.Version, lastAdviceVersion)
+	}
+	if err := cs.checkLastAdviceAge(envelope.Timestamp); err != nil {
+		return nil, time.Time{}, "stale", err
+	}
+
+	resp := &cpuadvisor.ListAndWatchResponse{}
+	if err := resp.Unmarshal(envelope.Response); err != nil {
+		return nil, time.Time{}, "corrupted", fmt.Errorf("decode response failed: %w", err)
+	}
+	return resp, envelope.Timestamp, "", nil
+}
+
+// checkLastAdviceAge returns an error if the advice persisted at the timestamp is older than lastAdviceMaxAge
+func (cs *cpuServer) checkLastAdviceAge(timestamp time.Time) error {
+	if age := cs.clock.Since(timestamp); cs.lastAdviceMaxAge > 0 && age > cs.lastAdviceMaxAge {
+		return fmt.Errorf("advice persisted at %v is stale, age %v exceeds %v", timestamp, age, cs.lastAdviceMaxAge)
+	}
+	return nil
+}
+
+// sendRestoredAdvice re-sends the restored advice at most once, so that plugins receive advice right after
+// restart while the fresh computation catches up; it is skipped in dry-run mode, since nothing is ever sent,
+// and the age is checked again since the first ListAndWatch loop may start long after the advice is restored
+func (cs *cpuServer) sendRestoredAdvice(server cpuadvisor.CPUAdvisor_ListAndWatchServer) error {
+	cs.restoredAdviceMutex.Lock()
+	resp, timestamp := cs.restoredAdvice, cs.restoredAdviceTimestamp
+	cs.restoredAdvice = nil
+	cs.restoredAdviceMutex.Unlock()
+	if resp == nil || cs.dryRun {
+		return nil
+	}
+	if err := cs.checkLastAdviceAge(timestamp); err != nil {
+		klog.Warningf("[qosaware-server-cpu] discard restored advice: %v", err)
+		_ = cs.emitter.StoreInt64(cs.genMetricsName(metricLastAdviceDiscarded), 1, metrics.MetricTypeNameCount,
+			metrics.MetricTag{Key: "reason", Val: "stale"})
+		return nil
+	}
+
+	err := cs.sendToLWStreams(server, resp)
+	if err != nil {
+		klog.Errorf("[qosaware-server-cpu] re-send persisted advice failed: %v", err)
+	} else {
+		klog.Infof("[qosaware-server-cpu] persisted advice is re-sent")
+	}
+	_ = cs.emitter.StoreInt64(cs.genMetricsName(metricLastAdviceResent), 1, metrics.MetricTypeNameCount,
+		metrics.MetricTag{Key: "success", Val: fmt.Sprintf("%v", err == nil)})
+	return err
+}
@@ -0,0 +1,171 @@
+/*
+Copyright 2022 The Katalyst Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"encoding/json"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	testingclock "k8s.io/utils/clock/testing"
+
+	"github.com/kubewharf/katalyst-core/pkg/agent/qrm-plugins/commonstate"
+	"github.com/kubewharf/katalyst-core/pkg/agent/qrm-plugins/cpu/dynamicpolicy/cpuadvisor"
+	"github.com/kubewharf/katalyst-core/pkg/metrics"
+)
+
+func newTestLastAdviceCPUServer(t *testing.T, lastAdvicePath string) *cpuServer {
+	cs := newTestCPUServer(t, nil, []*v1.Pod{})
+	cs.emitter = newFakeMetricEmitter()
+	cs.lastAdvicePath = lastAdvicePath
+	cs.lastAdviceMaxAge = time.Minute
+	return cs
+}
+
+func newTestLastAdvice() *cpuadvisor.ListAndWatchResponse {
+	return &cpuadvisor.ListAndWatchResponse{
+		Entries: map[string]*cpuadvisor.CalculationEntries{
+			commonstate.PoolNameShare: {
+				Entries: map[string]*cpuadvisor.CalculationInfo{
+					commonstate.FakedContainerName: {
+						OwnerPoolName: commonstate.PoolNameShare,
+						CalculationResultsByNumas: map[int64]*cpuadvisor.NumaCalculationResult{
+							-1: {Blocks: []*cpuadvisor.Block{{Result: 4}}},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestLastAdviceRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	lastAdvicePath := path.Join(t.TempDir(), lastAdviceFileName)
+	cs := newTestLastAdviceCPUServer(t, lastAdvicePath)
+	cs.persistLastAdvice(newTestLastAdvice())
+
+	// the advice persisted by one server is re-sent once by a freshly started one
+	restored := newTestLastAdviceCPUServer(t, lastAdvicePath)
+	restored.restoreLastAdvice()
+	loaded, ok := restored.emitter.(*fakeMetricEmitter).get(restored.genMetricsName(metricLastAdviceRestored))
+	require.True(t, ok)
+	require.Equal(t, int64(1), loaded)
+
+	s := &mockCPUServerService_ListAndWatchServer{ResultsChan: make(chan *cpuadvisor.ListAndWatchResponse, 2)}
+	restored.sendRestoredAdvice(s)
+	restored.sendRestoredAdvice(s)
+	require.Len(t, s.ResultsChan, 1)
+	resp := <-s.ResultsChan
+	require.Equal(t, newTestLastAdvice().String(), resp.String())
+}
+
+func TestLastAdviceStaleOnSend(t *testing.T) {
+	t.Parallel()
+
+	lastAdvicePath := path.Join(t.TempDir(), lastAdviceFileName)
+	cs := newTestLastAdviceCPUServer(t, lastAdvicePath)
+	cs.persistLastAdvice(newTestLastAdvice())
+
+	// the advice is fresh when restored, but turns stale before the first ListAndWatch loop sends it
+	restored := newTestLastAdviceCPUServer(t, lastAdvicePath)
+	fakeClock := testingclock.NewFakeClock(time.Now())
+	restored.clock = fakeClock
+	restored.restoreLastAdvice()
+	require.NotNil(t, restored.restoredAdvice)
+	fakeClock.Step(2 * time.Minute)
+
+	s := &mockCPUServerService_ListAndWatchServer{ResultsChan: make(chan *cpuadvisor.ListAndWatchResponse, 1)}
+	require.NoError(t, restored.sendRestoredAdvice(s))
+	require.Empty(t, s.ResultsChan)
+	require.Nil(t, restored.restoredAdvice)
+	discarded, ok := restored.emitter.(*fakeMetricEmitter).getTagged(restored.genMetricsName(metricLastAdviceDiscarded),
+		metrics.MetricTag{Key: "reason", Val: "stale"})
+	require.True(t, ok)
+	require.Equal(t, int64(1), discarded)
+	_, ok = restored.emitter.(*fakeMetricEmitter).get(restored.genMetricsName(metricLastAdviceResent))
+	require.False(t, ok)
+}
+
+func TestLastAdviceDiscarded(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		age        time.Duration
+		version    int
+		corrupt    bool
+		wantReason string
+	}{
+		{
+			name:       "stale advice",
+			age:        2 * time.Minute,
+			version:    lastAdviceVersion,
+			wantReason: "stale",
+		},
+		{
+			name:       "version mismatched",
+			version:    lastAdviceVersion + 1,
+			wantReason: "version",
+		},
+		{
+			name:       "corrupted advice",
+			version:    lastAdviceVersion,
+			corrupt:    true,
+			wantReason: "corrupted",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			lastAdvicePath := path.Join(t.TempDir(), lastAdviceFileName)
+			data, err := newTestLastAdvice().Marshal()
+			require.NoError(t, err)
+			if tt.corrupt {
+				data = data[:len(data)/2]
+			}
+			envelope, err := json.Marshal(&persistedAdvice{Version: tt.version, Timestamp: time.Now(), Response: data})
+			require.NoError(t, err)
+			require.NoError(t, os.WriteFile(lastAdvicePath, envelope, 0o644))
+
+			restored := newTestLastAdviceCPUServer(t, lastAdvicePath)
+			restored.clock = testingclock.NewFakeClock(time.Now().Add(tt.age))
+			restored.restoreLastAdvice()
+			require.Nil(t, restored.restoredAdvice)
+			require.NoFileExists(t, lastAdvicePath)
+			discarded, ok := restored.emitter.(*fakeMetricEmitter).getTagged(restored.genMetricsName(metricLastAdviceDiscarded),
+				metrics.MetricTag{Key: "reason", Val: tt.wantReason})
+			require.True(t, ok)
+			require.Equal(t, int64(1), discarded)
+		})
+	}
+}
+
+func TestLastAdviceNotExist(t *testing.T) {
+	t.Parallel()
+
+	cs := newTestLastAdviceCPUServer(t, path.Join(t.TempDir(), lastAdviceFileName))
+	cs.restoreLastAdvice()
+	require.Nil(t, cs.restoredAdvice)
+}
@@ -21,6 +21,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"strconv"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -51,6 +52,11 @@ const (
 	memoryServerLWHealthCheckName = "memory-server-lw"
 )
 
+// Metric names for memory server
+const (
+	metricMemoryServerOverlapActive = "overlap_active"
+)
+
 var registerMemoryHealthCheckOnce sync.Once
 
 type memoryServer struct {
@@ -66,9 +72,10 @@ func NewMemoryServer(
 	metaServer *metaserver.MetaServer,
 	advisor subResourceAdvisor,
 	emitter metrics.MetricEmitter,
+	opts ...ServerOption,
 ) (*memoryServer, error) {
 	ms := &memoryServer{}
-	ms.baseServer = newBaseServer(memoryServerName, conf, metaCache, metaServer, emitter, advisor, ms)
+	ms.baseServer = newBaseServer(memoryServerName, conf, metaCache, metaServer, emitter, advisor, ms, opts...)
 	ms.hasListAndWatchLoop.Store(false)
 	ms.advisorSocketPath = conf.MemoryAdvisorSocketAbsPath
 	ms.pluginSocketPath = conf.MemoryPluginSocketAbsPath
@@ -225,7 +232,7 @@ func (ms *memoryServer) ListAndWatch(_ *advisorsvc.Empty, server advisorsvc.Advi
 	general.RegisterTemporaryHeartbeatCheck(memoryServerLWHealthCheckName, healthCheckTolerationDuration, general.HealthzCheckStateNotReady, healthCheckTolerationDuration)
 	defer general.UnregisterTemporaryHeartbeatCheck(memoryServerLWHealthCheckName)
 
-	timer := time.NewTimer(ms.period)
+	timer := time.NewTimer(ms.jitteredPeriod())
 	defer timer.Stop()
 
 	for {
@@ -244,7 +251,7 @@ func (ms *memoryServer) ListAndWatch(_ *advisorsvc.Empty, server advisorsvc.Advi
 			} else {
 				_ = general.UpdateHealthzStateByError(memoryServerLWHealthCheckName, nil)
 			}
-			timer.Reset(ms.period)
+			timer.Reset(ms.jitteredPeriod())
 		}
 	}
 }
@@ -386,6 +393,34 @@ func (ms *memoryServer) assembleResponse(result *types.InternalMemoryCalculation
 	if extraNumaHeadroom != nil {
 		resp.ExtraEntries = append(resp.ExtraEntries, extraNumaHeadroom)
 	}
+	ms.assembleOverlap(&resp, result.AllowSharedCoresOverlapReclaimedCores)
 
 	return &resp
 }
+
+// assembleOverlap attaches the overlap flag to the node-level extra entry, and it is only attached if overlap
+// is allowed so that memory plugins not aware of the flag (which ignore unknown control knobs) keep working
+// as if reclaimed_cores were isolated from shared_cores
+func (ms *memoryServer) assembleOverlap(resp *memoryInternalResult, allowSharedCoresOverlapReclaimedCores bool) {
+	overlapActive := int64(0)
+	if allowSharedCoresOverlapReclaimedCores {
+		overlapActive = 1
+	}
+	_ = ms.emitter.StoreInt64(ms.genMetricsName(metricMemoryServerOverlapActive), overlapActive, metrics.MetricTypeNameRaw)
+	if !allowSharedCoresOverlapReclaimedCores {
+		return
+	}
+
+	key := string(memoryadvisor.ControlKnobKeyAllowSharedCoresOverlapReclaimedCores)
+	for _, entry := range resp.ExtraEntries {
+		if entry.CgroupPath == "" {
+			entry.CalculationResult.Values[key] = strconv.FormatBool(true)
+			return
+		}
+	}
+	resp.ExtraEntries = append(resp.ExtraEntries, &advisorsvc.CalculationInfo{
+		CalculationResult: &advisorsvc.CalculationResult{
+			Values: map[string]string{key: strconv.FormatBool(true)},
+		},
+	})
+}
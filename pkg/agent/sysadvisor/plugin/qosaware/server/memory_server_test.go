@@ -305,6 +305,27 @@ func TestMemoryServerUpdate(t *testing.T) {
 				},
 			},
 		},
+		{
+			name:  "overlap allowed",
+			empty: &advisorsvc.Empty{},
+			provision: types.InternalMemoryCalculationResult{
+				TimeStamp:                             time.Now(),
+				AllowSharedCoresOverlapReclaimedCores: true,
+			},
+			wantRes: &advisorsvc.ListAndWatchResponse{
+				PodEntries: map[string]*advisorsvc.CalculationEntries{},
+				ExtraEntries: []*advisorsvc.CalculationInfo{
+					{
+						CalculationResult: &advisorsvc.CalculationResult{
+							Values: map[string]string{
+								"memory_numa_headroom":                       "{}",
+								"allow_shared_cores_overlap_reclaimed_cores": "true",
+							},
+						},
+					},
+				},
+			},
+		},
 	}
 
 	testWithListAndWatch := func(
@@ -0,0 +1,94 @@
+/*
+Copyright 2022 The Katalyst Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/kubewharf/katalyst-core/pkg/metrics"
+)
+
+// Metric names for reclaim overlap
+const (
+	metricReclaimOverlapSize = "reclaim_overlap_size"
+)
+
+// ReclaimOverlapSnapshot is the overlap between reclaim pool and shared pools of the latest sent advice
+type ReclaimOverlapSnapshot struct {
+	Timestamp time.Time `json:"timestamp"`
+	// Enabled is false if shared cores are not allowed to overlap reclaimed cores in the advice,
+	// in which case Overlaps is always empty
+	Enabled bool `json:"enabled"`
+	// Overlaps are the overlapped sizes in cores, keyed by reclaim numa id and shared pool name
+	Overlaps map[int]map[string]int `json:"overlaps"`
+}
+
+// recordSentReclaimOverlap keeps the overlap of the advice which is actually sent to plugins,
+// and emits overlapped sizes as metrics if enabled
+func (cs *cpuServer) recordSentReclaimOverlap(result *cpuInternalResult) {
+	snapshot := &ReclaimOverlapSnapshot{
+		Timestamp: cs.clock.Now(),
+		Enabled:   result.AllowSharedCoresOverlapReclaimedCores,
+		Overlaps:  make(map[int]map[string]int),
+	}
+	if snapshot.Enabled {
+		for numaID, overlapInfo := range result.ReclaimOverlapInfo {
+			snapshot.Overlaps[numaID] = make(map[string]int, len(overlapInfo))
+			for sharedPoolName, size := range overlapInfo {
+				snapshot.Overlaps[numaID][sharedPoolName] = size
+			}
+		}
+	}
+
+	cs.sentReclaimOverlapMutex.Lock()
+	cs.sentReclaimOverlap = snapshot
+	cs.sentReclaimOverlapMutex.Unlock()
+
+	if !cs.emitReclaimOverlapMetrics {
+		return
+	}
+	for numaID, overlapInfo := range snapshot.Overlaps {
+		for sharedPoolName, size := range overlapInfo {
+			_ = cs.emitter.StoreInt64(cs.genMetricsName(metricReclaimOverlapSize), int64(size), metrics.MetricTypeNameRaw,
+				metrics.MetricTag{Key: "pool", Val: sharedPoolName}, metrics.MetricTag{Key: "numa", Val: strconv.Itoa(numaID)})
+		}
+	}
+}
+
+// serveReclaimOverlap exports the overlap between reclaim pool and shared pools of the latest sent advice as json
+func (cs *cpuServer) serveReclaimOverlap(w http.ResponseWriter, _ *http.Request) {
+	cs.sentReclaimOverlapMutex.RLock()
+	snapshot := cs.sentReclaimOverlap
+	cs.sentReclaimOverlapMutex.RUnlock()
+	if snapshot == nil {
+		http.Error(w, "no advice has been sent yet", http.StatusNotFound)
+		return
+	}
+
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("marshal reclaim overlap failed: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(data)
+}
@@ -0,0 +1,86 @@
+/*
+Copyright 2022 The Katalyst Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+
+	"github.com/kubewharf/katalyst-core/pkg/agent/qrm-plugins/commonstate"
+	"github.com/kubewharf/katalyst-core/pkg/agent/sysadvisor/types"
+	"github.com/kubewharf/katalyst-core/pkg/metrics"
+	"github.com/kubewharf/katalyst-core/pkg/util/general"
+)
+
+func getReclaimOverlapSnapshot(t *testing.T, cs *cpuServer) (*ReclaimOverlapSnapshot, int) {
+	recorder := httptest.NewRecorder()
+	cs.serveReclaimOverlap(recorder, httptest.NewRequest(http.MethodGet, general.DebugHandlerPathPrefix+cpuServerReclaimOverlapDebugHandlerName, nil))
+	if recorder.Code != http.StatusOK {
+		return nil, recorder.Code
+	}
+
+	snapshot := &ReclaimOverlapSnapshot{}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), snapshot))
+	return snapshot, recorder.Code
+}
+
+func TestCPUServerReclaimOverlap(t *testing.T) {
+	t.Parallel()
+
+	cs := newTestCPUServer(t, nil, []*v1.Pod{})
+	emitter := newFakeMetricEmitter()
+	cs.emitter = emitter
+	cs.emitReclaimOverlapMetrics = true
+
+	// nothing is exported before any advice is sent
+	_, code := getReclaimOverlapSnapshot(t, cs)
+	require.Equal(t, http.StatusNotFound, code)
+
+	advisorResp := &types.InternalCPUCalculationResult{
+		PoolEntries: map[string]map[int]types.CPUResource{
+			commonstate.PoolNameShare:   {0: {Size: 4}},
+			"share-a":                   {0: {Size: 2}},
+			commonstate.PoolNameReclaim: {0: {Size: 3}},
+		},
+		PoolOverlapInfo: map[string]map[int]map[string]int{
+			commonstate.PoolNameReclaim: {0: {commonstate.PoolNameShare: 2, "share-a": 1}},
+		},
+		AllowSharedCoresOverlapReclaimedCores: true,
+	}
+	cs.recordSentReclaimOverlap(cs.assembleResponse(advisorResp))
+	snapshot, code := getReclaimOverlapSnapshot(t, cs)
+	require.Equal(t, http.StatusOK, code)
+	require.True(t, snapshot.Enabled)
+	require.Equal(t, map[int]map[string]int{0: {commonstate.PoolNameShare: 2, "share-a": 1}}, snapshot.Overlaps)
+	size, ok := emitter.getTagged(cs.genMetricsName(metricReclaimOverlapSize),
+		metrics.MetricTag{Key: "pool", Val: "share-a"}, metrics.MetricTag{Key: "numa", Val: "0"})
+	require.True(t, ok)
+	require.Equal(t, int64(1), size)
+
+	// disabled overlap is indicated explicitly
+	advisorResp.AllowSharedCoresOverlapReclaimedCores = false
+	cs.recordSentReclaimOverlap(cs.assembleResponse(advisorResp))
+	snapshot, code = getReclaimOverlapSnapshot(t, cs)
+	require.Equal(t, http.StatusOK, code)
+	require.False(t, snapshot.Enabled)
+	require.Empty(t, snapshot.Overlaps)
+}
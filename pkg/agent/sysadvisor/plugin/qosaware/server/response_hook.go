@@ -0,0 +1,99 @@
+/*
+Copyright 2022 The Katalyst Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"fmt"
+
+	"k8s.io/klog/v2"
+
+	"github.com/kubewharf/katalyst-core/pkg/agent/qrm-plugins/cpu/dynamicpolicy/cpuadvisor"
+	"github.com/kubewharf/katalyst-core/pkg/metrics"
+)
+
+// Metric names for response hooks
+const (
+	metricCPUServerResponseHookFailed = "response_hook_failed"
+)
+
+// CPUResponseHook post-processes the assembled response before it is sent to cpu plugins,
+// e.g. to append extra entries of cgroup knobs for node-local daemons
+type CPUResponseHook func(resp *cpuadvisor.ListAndWatchResponse) error
+
+type namedCPUResponseHook struct {
+	name string
+	hook CPUResponseHook
+}
+
+// WithCPUResponseHook adds a hook to the cpu server, and hooks run in the order they are given;
+// it's a no-op for servers of other resources
+func WithCPUResponseHook(name string, hook CPUResponseHook) ServerOption {
+	return func(bs *baseServer) {
+		bs.cpuResponseHooks = append(bs.cpuResponseHooks, namedCPUResponseHook{name: name, hook: hook})
+	}
+}
+
+// runResponseHooks runs hooks in the given order on a deep copy of the response, since entries of the assembled
+// response are kept for debugging, and returns the copy to be sent; a failed or panicked hook is only reported
+// without aborting the send, while changes it has made are kept
+func (cs *cpuServer) runResponseHooks(resp *cpuadvisor.ListAndWatchResponse) *cpuadvisor.ListAndWatchResponse {
+	if len(cs.cpuResponseHooks) == 0 {
+		return resp
+	}
+
+	hooked, err := deepCopyListAndWatchResponse(resp)
+	if err != nil {
+		klog.Errorf("[qosaware-server-cpu] copy response for hooks failed, skip all hooks: %v", err)
+		for _, h := range cs.cpuResponseHooks {
+			_ = cs.emitter.StoreInt64(cs.genMetricsName(metricCPUServerResponseHookFailed), 1, metrics.MetricTypeNameCount,
+				metrics.MetricTag{Key: "hook", Val: h.name})
+		}
+		return resp
+	}
+
+	for _, h := range cs.cpuResponseHooks {
+		if err := runResponseHook(h, hooked); err != nil {
+			klog.Errorf("[qosaware-server-cpu] run response hook %s failed: %v", h.name, err)
+			_ = cs.emitter.StoreInt64(cs.genMetricsName(metricCPUServerResponseHookFailed), 1, metrics.MetricTypeNameCount,
+				metrics.MetricTag{Key: "hook", Val: h.name})
+		}
+	}
+	return hooked
+}
+
+// deepCopyListAndWatchResponse copies the response through its protobuf encoding
+func deepCopyListAndWatchResponse(resp *cpuadvisor.ListAndWatchResponse) (*cpuadvisor.ListAndWatchResponse, error) {
+	data, err := resp.Marshal()
+	if err != nil {
+		return nil, fmt.Errorf("marshal response failed: %w", err)
+	}
+	copied := &cpuadvisor.ListAndWatchResponse{}
+	if err := copied.Unmarshal(data); err != nil {
+		return nil, fmt.Errorf("unmarshal response failed: %w", err)
+	}
+	return copied, nil
+}
+
+// runResponseHook runs the hook and turns its panic into an error
+func runResponseHook(h namedCPUResponseHook, resp *cpuadvisor.ListAndWatchResponse) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("recover from: %v", r)
+		}
+	}()
+	return h.hook(resp)
+}
@@ -0,0 +1,202 @@
+/*
+Copyright 2022 The Katalyst Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+
+	"github.com/kubewharf/katalyst-core/pkg/agent/qrm-plugins/advisorsvc"
+	"github.com/kubewharf/katalyst-core/pkg/agent/qrm-plugins/commonstate"
+	"github.com/kubewharf/katalyst-core/pkg/agent/qrm-plugins/cpu/dynamicpolicy/cpuadvisor"
+	"github.com/kubewharf/katalyst-core/pkg/agent/sysadvisor/plugin/qosaware/reporter"
+	"github.com/kubewharf/katalyst-core/pkg/agent/sysadvisor/types"
+	"github.com/kubewharf/katalyst-core/pkg/metrics"
+	"github.com/kubewharf/katalyst-core/pkg/util/general"
+)
+
+func TestWithCPUResponseHook(t *testing.T) {
+	t.Parallel()
+
+	base := newTestCPUServer(t, nil, []*v1.Pod{})
+	noop := func(*cpuadvisor.ListAndWatchResponse) error { return nil }
+
+	// hooks are kept in the given order, and only owned by the server constructed with them
+	cs, err := NewCPUServer(generateTestConfiguration(t), &reporter.DummyHeadroomResourceManager{}, base.metaCache, base.metaServer, nil,
+		metrics.DummyMetrics{}, WithCPUResponseHook("test-a", noop), WithCPUResponseHook("test-b", noop))
+	require.NoError(t, err)
+	var names []string
+	for _, h := range cs.cpuResponseHooks {
+		names = append(names, h.name)
+	}
+	require.Equal(t, []string{"test-a", "test-b"}, names)
+	require.Empty(t, base.cpuResponseHooks)
+}
+
+func TestCPUServerRunResponseHooks(t *testing.T) {
+	t.Parallel()
+
+	advisor := &mockCPUResourceAdvisor{
+		provision: &types.InternalCPUCalculationResult{
+			PoolEntries: map[string]map[int]types.CPUResource{
+				commonstate.PoolNameReserve: {0: {Size: 2}},
+			},
+		},
+	}
+	cs := newTestCPUServer(t, advisor, []*v1.Pod{})
+	emitter := newFakeMetricEmitter()
+	cs.emitter = emitter
+
+	appendEntry := func(cgroupPath string, err error) CPUResponseHook {
+		return func(resp *cpuadvisor.ListAndWatchResponse) error {
+			resp.ExtraEntries = append(resp.ExtraEntries, &advisorsvc.CalculationInfo{CgroupPath: cgroupPath})
+			return err
+		}
+	}
+	cs.cpuResponseHooks = []namedCPUResponseHook{
+		{name: "failed", hook: appendEntry("/failed", fmt.Errorf("test error"))},
+		{name: "panicked", hook: func(resp *cpuadvisor.ListAndWatchResponse) error {
+			resp.ExtraEntries = append(resp.ExtraEntries, &advisorsvc.CalculationInfo{CgroupPath: "/panicked"})
+			panic("test panic")
+		}},
+		{name: "succeeded", hook: appendEntry("/succeeded", nil)},
+	}
+
+	clients := []cpuadvisor.CPUPluginClient{
+		&mockCPUPluginClient{checkpoint: &cpuadvisor.GetCheckpointResponse{
+			Entries: map[string]*cpuadvisor.AllocationEntries{
+				commonstate.PoolNameReserve: {
+					Entries: map[string]*cpuadvisor.AllocationInfo{
+						commonstate.FakedContainerName: {OwnerPoolName: commonstate.PoolNameReserve, TopologyAwareAssignments: map[uint64]string{0: "0"}},
+					},
+				},
+			},
+		}},
+	}
+	server := &mockCPUServerService_ListAndWatchServer{ResultsChan: make(chan *cpuadvisor.ListAndWatchResponse, 1)}
+	require.NoError(t, cs.getAndPushAdvice(clients, server))
+	require.Len(t, server.ResultsChan, 1)
+
+	// a failed or panicked hook does not abort the send nor the following hooks, and hooks run in order
+	resp := <-server.ResultsChan
+	var cgroupPaths []string
+	for _, entry := range resp.ExtraEntries {
+		cgroupPaths = append(cgroupPaths, entry.CgroupPath)
+	}
+	require.Equal(t, []string{"/failed", "/panicked", "/succeeded"}, cgroupPaths[len(cgroupPaths)-3:])
+
+	for _, name := range []string{"failed", "panicked"} {
+		_, ok := emitter.getTagged(cs.genMetricsName(metricCPUServerResponseHookFailed), metrics.MetricTag{Key: "hook", Val: name})
+		require.True(t, ok, name)
+	}
+	_, ok := emitter.getTagged(cs.genMetricsName(metricCPUServerResponseHookFailed), metrics.MetricTag{Key: "hook", Val: "succeeded"})
+	require.False(t, ok)
+}
+
+func TestCPUServerResponseHooksOnCopy(t *testing.T) {
+	t.Parallel()
+
+	advisor := &mockCPUResourceAdvisor{
+		provision: &types.InternalCPUCalculationResult{
+			PoolEntries: map[string]map[int]types.CPUResource{
+				commonstate.PoolNameReserve: {0: {Size: 2}},
+			},
+		},
+	}
+	cs := newTestCPUServer(t, advisor, []*v1.Pod{})
+	cs.emitter = newFakeMetricEmitter()
+	cs.cpuResponseHooks = []namedCPUResponseHook{
+		{name: "test", hook: func(resp *cpuadvisor.ListAndWatchResponse) error {
+			for _, calculationEntries := range resp.Entries {
+				for _, calculationInfo := range calculationEntries.Entries {
+					calculationInfo.OwnerPoolName = "hooked"
+				}
+			}
+			resp.Entries["hooked"] = &cpuadvisor.CalculationEntries{}
+			return nil
+		}},
+	}
+	tracePath := path.Join(t.TempDir(), "advice-trace.log")
+	cs.adviceTracer = &adviceTracer{sink: &fileAdviceTraceSink{path: tracePath, maxBytes: 64 << 20}}
+
+	clients := []cpuadvisor.CPUPluginClient{
+		&mockCPUPluginClient{checkpoint: &cpuadvisor.GetCheckpointResponse{
+			Entries: map[string]*cpuadvisor.AllocationEntries{
+				commonstate.PoolNameReserve: {
+					Entries: map[string]*cpuadvisor.AllocationInfo{
+						commonstate.FakedContainerName: {OwnerPoolName: commonstate.PoolNameReserve, TopologyAwareAssignments: map[uint64]string{0: "0"}},
+					},
+				},
+			},
+		}},
+	}
+	getBlockAssignments := func() *BlockAssignments {
+		recorder := httptest.NewRecorder()
+		cs.serveBlockAssignments(recorder, httptest.NewRequest(http.MethodGet, general.DebugHandlerPathPrefix+cpuServerBlockAssignmentsDebugHandlerName, nil))
+		require.Equal(t, http.StatusOK, recorder.Code)
+		assignments := &BlockAssignments{}
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), assignments))
+		return assignments
+	}
+
+	// the debug handler is read while hooks run, which is a data race under -race if hooks run on the kept entries
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				getBlockAssignments()
+			}
+		}
+	}()
+	const pushes = 5
+	server := &mockCPUServerService_ListAndWatchServer{ResultsChan: make(chan *cpuadvisor.ListAndWatchResponse, pushes)}
+	for i := 0; i < pushes; i++ {
+		require.NoError(t, cs.getAndPushAdvice(clients, server))
+	}
+	close(stop)
+	wg.Wait()
+
+	// the sent response is hooked, while the entries kept for debugging are not
+	require.Len(t, server.ResultsChan, pushes)
+	resp := <-server.ResultsChan
+	require.Contains(t, resp.Entries, "hooked")
+	require.Equal(t, "hooked", resp.Entries[commonstate.PoolNameReserve].Entries[commonstate.FakedContainerName].OwnerPoolName)
+	assignments := getBlockAssignments()
+	require.NotContains(t, assignments.Entries, "hooked")
+	require.Equal(t, commonstate.PoolNameReserve,
+		assignments.Entries[commonstate.PoolNameReserve].Entries[commonstate.FakedContainerName].OwnerPoolName)
+
+	// the advice is traced as it is sent, i.e. after hooks
+	traces, err := LoadAdviceTraces(tracePath)
+	require.NoError(t, err)
+	require.Len(t, traces, pushes)
+	require.Contains(t, traces[pushes-1].Response.Entries, "hooked")
+}
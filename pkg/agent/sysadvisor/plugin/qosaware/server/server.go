@@ -61,9 +61,9 @@ type qrmServerWrapper struct {
 }
 
 // NewQRMServer returns a qrm server wrapper, which instantiates
-// all required qrm plugin servers according to config
+// all required qrm plugin servers according to config, and opts are applied to each of them
 func NewQRMServer(advisorWrapper resource.ResourceAdvisor, headroomResourceGetter reporter.HeadroomResourceGetter, conf *config.Configuration,
-	metaCache metacache.MetaCache, metaServer *metaserver.MetaServer, emitter metrics.MetricEmitter,
+	metaCache metacache.MetaCache, metaServer *metaserver.MetaServer, emitter metrics.MetricEmitter, opts ...ServerOption,
 ) (QRMServer, error) {
 	if headroomResourceGetter == nil {
 		return nil, fmt.Errorf("invalid headroom resource getter")
@@ -91,7 +91,7 @@ func NewQRMServer(advisorWrapper resource.ResourceAdvisor, headroomResourceGette
 		default:
 			klog.Warningf("[qosaware-server] resource %s do NOT has headroomResourceManager, be care not to use the invalid manager", resourceName)
 		}
-		server, err := newSubQRMServer(resourceName, advisorWrapper, headroomResourceManager, conf, metaCache, metaServer, emitter)
+		server, err := newSubQRMServer(resourceName, advisorWrapper, headroomResourceManager, conf, metaCache, metaServer, emitter, opts...)
 		if err != nil {
 			return nil, fmt.Errorf("new qrm plugin server for %v failed: %v", resourceName, err)
 		} else {
@@ -132,6 +132,7 @@ func (qs *qrmServerWrapper) Run(ctx context.Context) {
 
 func newSubQRMServer(resourceName v1.ResourceName, advisorWrapper resource.ResourceAdvisor, headroomResourceManager reporter.HeadroomResourceManager,
 	conf *config.Configuration, metaCache metacache.MetaCache, metaServer *metaserver.MetaServer, emitter metrics.MetricEmitter,
+	opts ...ServerOption,
 ) (subQRMServer, error) {
 	switch resourceName {
 	case v1.ResourceCPU:
@@ -139,13 +140,13 @@ func newSubQRMServer(resourceName v1.ResourceName, advisorWrapper resource.Resou
 		if err != nil {
 			return nil, err
 		}
-		return NewCPUServer(conf, headroomResourceManager, metaCache, metaServer, subAdvisor, emitter)
+		return NewCPUServer(conf, headroomResourceManager, metaCache, metaServer, subAdvisor, emitter, opts...)
 	case v1.ResourceMemory:
 		subAdvisor, err := advisorWrapper.GetSubAdvisor(types.QoSResourceMemory)
 		if err != nil {
 			return nil, err
 		}
-		return NewMemoryServer(conf, headroomResourceManager, metaCache, metaServer, subAdvisor, emitter)
+		return NewMemoryServer(conf, headroomResourceManager, metaCache, metaServer, subAdvisor, emitter, opts...)
 	default:
 		return nil, fmt.Errorf("illegal resource %v", resourceName)
 	}
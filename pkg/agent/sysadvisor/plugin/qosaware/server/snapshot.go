@@ -0,0 +1,191 @@
+/*
+Copyright 2022 The Katalyst Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"k8s.io/klog/v2"
+
+	"github.com/kubewharf/katalyst-core/pkg/agent/sysadvisor/types"
+	"github.com/kubewharf/katalyst-core/pkg/metrics"
+)
+
+// Metric names for meta cache snapshots
+const (
+	metricMetaCacheSnapshotWritten  = "metacache_snapshot_written"
+	metricMetaCacheSnapshotLoaded   = "metacache_snapshot_loaded"
+	metricMetaCacheSnapshotRejected = "metacache_snapshot_rejected"
+)
+
+// metaCacheSnapshot is a snapshot of pools and containers in meta cache; it is written periodically as gzip
+// compressed json, and loaded at startup to shorten warmup before the first checkpoint sync.
+type metaCacheSnapshot struct {
+	Timestamp   time.Time         `json:"timestamp"`
+	PoolEntries types.PoolEntries `json:"poolEntries"`
+	PodEntries  types.PodEntries  `json:"podEntries"`
+}
+
+func encodeMetaCacheSnapshot(w io.Writer, snapshot *metaCacheSnapshot) error {
+	zw := gzip.NewWriter(w)
+	if err := json.NewEncoder(zw).Encode(snapshot); err != nil {
+		_ = zw.Close()
+		return fmt.Errorf("encode snapshot failed: %w", err)
+	}
+	return zw.Close()
+}
+
+// decodeMetaCacheSnapshot decodes a snapshot, and corrupted data is detected by the gzip checksum
+func decodeMetaCacheSnapshot(r io.Reader) (*metaCacheSnapshot, error) {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("read snapshot failed: %w", err)
+	}
+	defer func() {
+		_ = zr.Close()
+	}()
+
+	snapshot := &metaCacheSnapshot{}
+	if err := json.NewDecoder(zr).Decode(snapshot); err != nil {
+		return nil, fmt.Errorf("decode snapshot failed: %w", err)
+	}
+	// drain the stream to verify the checksum
+	if _, err := io.Copy(io.Discard, zr); err != nil {
+		return nil, fmt.Errorf("read snapshot failed: %w", err)
+	}
+	return snapshot, nil
+}
+
+// takeMetaCacheSnapshot collects pools and containers currently in meta cache
+func (cs *cpuServer) takeMetaCacheSnapshot() *metaCacheSnapshot {
+	snapshot := &metaCacheSnapshot{
+		Timestamp:   cs.clock.Now(),
+		PoolEntries: make(types.PoolEntries),
+		PodEntries:  make(types.PodEntries),
+	}
+	cs.metaCache.RangePoolInfo(func(poolName string, poolInfo *types.PoolInfo) bool {
+		snapshot.PoolEntries[poolName] = poolInfo
+		return true
+	})
+	cs.metaCache.RangeContainer(func(podUID string, containerName string, ci *types.ContainerInfo) bool {
+		if _, ok := snapshot.PodEntries[podUID]; !ok {
+			snapshot.PodEntries[podUID] = make(types.ContainerEntries)
+		}
+		snapshot.PodEntries[podUID][containerName] = ci
+		return true
+	})
+	return snapshot
+}
+
+// writeMetaCacheSnapshot writes a snapshot of meta cache to a temporary file and renames it to
+// metaCacheSnapshotPath, so that a partially written snapshot is never loaded
+func (cs *cpuServer) writeMetaCacheSnapshot() {
+	if err := cs.doWriteMetaCacheSnapshot(); err != nil {
+		klog.Errorf("[qosaware-server-cpu] write meta cache snapshot failed: %v", err)
+		return
+	}
+	_ = cs.emitter.StoreInt64(cs.genMetricsName(metricMetaCacheSnapshotWritten), 1, metrics.MetricTypeNameCount)
+}
+
+func (cs *cpuServer) doWriteMetaCacheSnapshot() error {
+	file, err := os.CreateTemp(filepath.Dir(cs.metaCacheSnapshotPath), filepath.Base(cs.metaCacheSnapshotPath)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = os.Remove(file.Name())
+	}()
+
+	if err := encodeMetaCacheSnapshot(file, cs.takeMetaCacheSnapshot()); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), cs.metaCacheSnapshotPath)
+}
+
+// loadMetaCacheSnapshot loads the snapshot at metaCacheSnapshotPath into meta cache if it is trusted;
+// snapshots older than metaCacheSnapshotMaxAge, or referring to pods no longer alive, are rejected
+func (cs *cpuServer) loadMetaCacheSnapshot(ctx context.Context) error {
+	file, err := os.Open(cs.metaCacheSnapshotPath)
+	if os.IsNotExist(err) {
+		klog.Infof("[qosaware-server-cpu] meta cache snapshot %s does not exist", cs.metaCacheSnapshotPath)
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	snapshot, err := decodeMetaCacheSnapshot(file)
+	if err != nil {
+		cs.rejectMetaCacheSnapshot("corrupted")
+		return err
+	}
+	if err := cs.validateMetaCacheSnapshot(ctx, snapshot); err != nil {
+		return err
+	}
+
+	for poolName, poolInfo := range snapshot.PoolEntries {
+		if err := cs.metaCache.SetPoolInfo(poolName, poolInfo); err != nil {
+			return fmt.Errorf("restore pool %s failed: %w", poolName, err)
+		}
+	}
+	for podUID, containerEntries := range snapshot.PodEntries {
+		for containerName, ci := range containerEntries {
+			if err := cs.metaCache.SetContainerInfo(podUID, containerName, ci); err != nil {
+				return fmt.Errorf("restore container %s/%s failed: %w", podUID, containerName, err)
+			}
+		}
+	}
+
+	klog.Infof("[qosaware-server-cpu] meta cache snapshot taken at %v is loaded with %d pools and %d pods",
+		snapshot.Timestamp, len(snapshot.PoolEntries), len(snapshot.PodEntries))
+	_ = cs.emitter.StoreInt64(cs.genMetricsName(metricMetaCacheSnapshotLoaded), 1, metrics.MetricTypeNameCount)
+	return nil
+}
+
+// validateMetaCacheSnapshot checks the snapshot against live state before trusting it
+func (cs *cpuServer) validateMetaCacheSnapshot(ctx context.Context, snapshot *metaCacheSnapshot) error {
+	if age := cs.clock.Since(snapshot.Timestamp); age > cs.metaCacheSnapshotMaxAge {
+		cs.rejectMetaCacheSnapshot("stale")
+		return fmt.Errorf("snapshot taken at %v is stale, age %v exceeds %v", snapshot.Timestamp, age, cs.metaCacheSnapshotMaxAge)
+	}
+
+	for podUID := range snapshot.PodEntries {
+		if _, err := cs.metaServer.GetPod(ctx, podUID); err != nil {
+			cs.rejectMetaCacheSnapshot("pod-not-alive")
+			return fmt.Errorf("snapshot refers to pod %s not alive: %w", podUID, err)
+		}
+	}
+	return nil
+}
+
+func (cs *cpuServer) rejectMetaCacheSnapshot(reason string) {
+	_ = cs.emitter.StoreInt64(cs.genMetricsName(metricMetaCacheSnapshotRejected), 1, metrics.MetricTypeNameCount,
+		metrics.MetricTag{Key: "reason", Val: reason})
+}
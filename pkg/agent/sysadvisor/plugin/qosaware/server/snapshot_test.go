@@ -0,0 +1,163 @@
+/*
+Copyright 2022 The Katalyst Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+	testingclock "k8s.io/utils/clock/testing"
+
+	"github.com/kubewharf/katalyst-api/pkg/consts"
+	"github.com/kubewharf/katalyst-core/pkg/agent/qrm-plugins/commonstate"
+	"github.com/kubewharf/katalyst-core/pkg/agent/sysadvisor/types"
+	"github.com/kubewharf/katalyst-core/pkg/metrics"
+	"github.com/kubewharf/katalyst-core/pkg/util/machine"
+)
+
+func newTestSnapshotCPUServer(t *testing.T, snapshotPath string, podUIDs ...string) *cpuServer {
+	pods := make([]*v1.Pod, 0, len(podUIDs))
+	for _, podUID := range podUIDs {
+		pods = append(pods, &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: podUID, UID: k8stypes.UID(podUID)}})
+	}
+
+	cs := newTestCPUServer(t, nil, pods)
+	cs.emitter = newFakeMetricEmitter()
+	cs.metaCacheSnapshotPath = snapshotPath
+	cs.metaCacheSnapshotMaxAge = time.Minute
+	return cs
+}
+
+func addSnapshotTestEntries(t *testing.T, cs *cpuServer) {
+	require.NoError(t, cs.metaCache.SetPoolInfo(commonstate.PoolNameShare, &types.PoolInfo{
+		PoolName:                 commonstate.PoolNameShare,
+		TopologyAwareAssignments: types.TopologyAwareAssignment{0: machine.NewCPUSet(1, 2, 3)},
+	}))
+	require.NoError(t, cs.metaCache.AddContainer("pod1", "c1", &types.ContainerInfo{
+		PodUID:                   "pod1",
+		ContainerName:            "c1",
+		QoSLevel:                 consts.PodAnnotationQoSLevelSharedCores,
+		OwnerPoolName:            commonstate.PoolNameShare,
+		TopologyAwareAssignments: types.TopologyAwareAssignment{0: machine.NewCPUSet(1, 2, 3)},
+	}))
+}
+
+func TestMetaCacheSnapshotRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	snapshotPath := path.Join(t.TempDir(), "metacache.snapshot")
+	cs := newTestSnapshotCPUServer(t, snapshotPath, "pod1")
+	addSnapshotTestEntries(t, cs)
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, encodeMetaCacheSnapshot(buf, cs.takeMetaCacheSnapshot()))
+	snapshot, err := decodeMetaCacheSnapshot(buf)
+	require.NoError(t, err)
+	require.Contains(t, snapshot.PoolEntries, commonstate.PoolNameShare)
+	require.Contains(t, snapshot.PodEntries["pod1"], "c1")
+
+	// the snapshot written by one server is loaded by a freshly started one
+	cs.writeMetaCacheSnapshot()
+	restored := newTestSnapshotCPUServer(t, snapshotPath, "pod1")
+	require.NoError(t, restored.loadMetaCacheSnapshot(context.Background()))
+
+	poolInfo, ok := restored.metaCache.GetPoolInfo(commonstate.PoolNameShare)
+	require.True(t, ok)
+	require.Equal(t, "1-3", poolInfo.TopologyAwareAssignments[0].String())
+	ci, ok := restored.metaCache.GetContainerInfo("pod1", "c1")
+	require.True(t, ok)
+	require.Equal(t, commonstate.PoolNameShare, ci.OwnerPoolName)
+	require.Equal(t, consts.PodAnnotationQoSLevelSharedCores, ci.QoSLevel)
+	require.Equal(t, "1-3", ci.TopologyAwareAssignments[0].String())
+	loaded, ok := restored.emitter.(*fakeMetricEmitter).get(restored.genMetricsName(metricMetaCacheSnapshotLoaded))
+	require.True(t, ok)
+	require.Equal(t, int64(1), loaded)
+}
+
+func TestMetaCacheSnapshotRejected(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		livePods   []string
+		age        time.Duration
+		corrupt    bool
+		wantReason string
+	}{
+		{
+			name:       "stale snapshot",
+			livePods:   []string{"pod1"},
+			age:        2 * time.Minute,
+			wantReason: "stale",
+		},
+		{
+			name:       "pod not alive",
+			livePods:   []string{},
+			wantReason: "pod-not-alive",
+		},
+		{
+			name:       "corrupted snapshot",
+			livePods:   []string{"pod1"},
+			corrupt:    true,
+			wantReason: "corrupted",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			snapshotPath := path.Join(t.TempDir(), "metacache.snapshot")
+			cs := newTestSnapshotCPUServer(t, snapshotPath, "pod1")
+			addSnapshotTestEntries(t, cs)
+			cs.writeMetaCacheSnapshot()
+			if tt.corrupt {
+				data, err := os.ReadFile(snapshotPath)
+				require.NoError(t, err)
+				require.NoError(t, os.WriteFile(snapshotPath, data[:len(data)/2], 0o644))
+			}
+
+			restored := newTestSnapshotCPUServer(t, snapshotPath, tt.livePods...)
+			restored.clock = testingclock.NewFakeClock(time.Now().Add(tt.age))
+			require.Error(t, restored.loadMetaCacheSnapshot(context.Background()))
+
+			_, ok := restored.metaCache.GetPoolInfo(commonstate.PoolNameShare)
+			require.False(t, ok)
+			_, ok = restored.metaCache.GetContainerInfo("pod1", "c1")
+			require.False(t, ok)
+			rejected, ok := restored.emitter.(*fakeMetricEmitter).getTagged(restored.genMetricsName(metricMetaCacheSnapshotRejected),
+				metrics.MetricTag{Key: "reason", Val: tt.wantReason})
+			require.True(t, ok)
+			require.Equal(t, int64(1), rejected)
+		})
+	}
+}
+
+func TestMetaCacheSnapshotNotExist(t *testing.T) {
+	t.Parallel()
+
+	cs := newTestSnapshotCPUServer(t, path.Join(t.TempDir(), "metacache.snapshot"))
+	require.NoError(t, cs.loadMetaCacheSnapshot(context.Background()))
+}
@@ -184,6 +184,7 @@ type InternalCPUCalculationResult struct {
 	PoolEntries                           map[string]map[int]CPUResource               // map[poolName][numaId]CPUResource
 	PoolOverlapInfo                       map[string]map[int]map[string]int            // map[poolName][numaId][targetOverlapPoolName]int
 	PoolOverlapPodContainerInfo           map[string]map[int]map[string]map[string]int // map[poolName][numaId][targetOverlapPodUID][targetOverlapContainerName]int
+	PoolEntryProvenance                   map[string]map[int]string                    // map[poolName][numaId]provenance, i.e. region and policy producing the entry
 	TimeStamp                             time.Time
 	AllowSharedCoresOverlapReclaimedCores bool
 }
@@ -24,6 +24,7 @@ import (
 
 	"github.com/kubewharf/katalyst-api/pkg/consts"
 	"github.com/kubewharf/katalyst-core/pkg/agent/qrm-plugins/commonstate"
+	coreconsts "github.com/kubewharf/katalyst-core/pkg/consts"
 	"github.com/kubewharf/katalyst-core/pkg/util/general"
 	"github.com/kubewharf/katalyst-core/pkg/util/machine"
 	qosutil "github.com/kubewharf/katalyst-core/pkg/util/qos"
@@ -37,6 +38,11 @@ func (ci *ContainerInfo) IsNumaExclusive() bool {
 	return qosutil.AnnotationsIndicateNUMAExclusive(ci.Annotations)
 }
 
+// IsReclaimOverlapIneligible returns true if reclaimed cores should not overlap onto current container's cpus
+func (ci *ContainerInfo) IsReclaimOverlapIneligible() bool {
+	return ci.Annotations[coreconsts.PodAnnotationReclaimOverlapIneligibleKey] == coreconsts.PodAnnotationReclaimOverlapIneligibleTrue
+}
+
 func (ci *ContainerInfo) IsSharedNumaBinding() bool {
 	return ci.QoSLevel == consts.PodAnnotationQoSLevelSharedCores && ci.IsNumaBinding()
 }
@@ -292,6 +298,24 @@ func (r *InternalCPUCalculationResult) SetPoolEntry(poolName string, numaID int,
 	r.PoolEntries[poolName][numaID] = CPUResource{Size: poolSize, Quota: cpuLimit}
 }
 
+// SetPoolEntryProvenance records which region and provision policy produced the pool entry; empty provenance is ignored
+func (r *InternalCPUCalculationResult) SetPoolEntryProvenance(poolName string, numaID int, provenance string) {
+	if provenance == "" {
+		return
+	}
+	if r.PoolEntryProvenance == nil {
+		r.PoolEntryProvenance = make(map[string]map[int]string)
+	}
+	if r.PoolEntryProvenance[poolName] == nil {
+		r.PoolEntryProvenance[poolName] = make(map[int]string)
+	}
+	r.PoolEntryProvenance[poolName][numaID] = provenance
+}
+
+func (r *InternalCPUCalculationResult) GetPoolEntryProvenance(poolName string, numaID int) string {
+	return r.PoolEntryProvenance[poolName][numaID]
+}
+
 func (r *InternalCPUCalculationResult) SetPoolOverlapInfo(poolName string, numaID int, overlapPoolName string, poolSize int) {
 	if poolSize <= 0 {
 		return
@@ -71,6 +71,12 @@ type InternalMemoryCalculationResult struct {
 	ContainerEntries []ContainerMemoryAdvices
 	ExtraEntries     []ExtraMemoryAdvices
 	TimeStamp        time.Time
+	// AllowSharedCoresOverlapReclaimedCores mirrors the flag of InternalCPUCalculationResult, so that memory
+	// and cpu advisors agree on whether reclaimed workloads share resources with shared_cores. Both are taken
+	// from the same dynamic config, and they may only diverge for a single round after the config is reloaded;
+	// if cpu allows overlap but memory does not, reclaimed_cores may run on cpus of shared_cores while the memory
+	// side still regards them as isolated, which is the conservative side for memory reclaim decisions.
+	AllowSharedCoresOverlapReclaimedCores bool
 }
 
 type NumaMemoryBalanceContainerInfo struct {
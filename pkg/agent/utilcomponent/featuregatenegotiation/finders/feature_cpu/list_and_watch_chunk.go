@@ -0,0 +1,37 @@
+/*
+Copyright 2022 The Katalyst Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package feature_cpu
+
+import (
+	"github.com/kubewharf/katalyst-core/pkg/agent/qrm-plugins/advisorsvc"
+	"github.com/kubewharf/katalyst-core/pkg/agent/utilcomponent/featuregatenegotiation/finders"
+	"github.com/kubewharf/katalyst-core/pkg/config"
+)
+
+// NegotiationFeatureGateListAndWatchChunk indicates the cpu plugin reassembles ListAndWatch responses split
+// into chunks, so that sysadvisor may split large responses; plugins without it always receive whole responses
+const NegotiationFeatureGateListAndWatchChunk = "feature_gate_list_and_watch_chunk"
+
+type ListAndWatchChunk struct{}
+
+func (l *ListAndWatchChunk) GetFeatureGate(_ *config.Configuration) *advisorsvc.FeatureGate {
+	return &advisorsvc.FeatureGate{
+		Name:                  NegotiationFeatureGateListAndWatchChunk,
+		Type:                  finders.FeatureGateTypeCPU,
+		MustMutuallySupported: false,
+	}
+}
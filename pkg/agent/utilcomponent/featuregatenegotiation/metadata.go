@@ -0,0 +1,57 @@
+/*
+Copyright 2022 The Katalyst Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package featuregatenegotiation
+
+import (
+	"context"
+
+	"google.golang.org/grpc/metadata"
+
+	"github.com/kubewharf/katalyst-core/pkg/agent/qrm-plugins/advisorsvc"
+)
+
+// wantedFeatureGatesMetadataKey carries names of wanted feature gates in grpc metadata, for calls without
+// a request to carry them, e.g. ListAndWatch
+const wantedFeatureGatesMetadataKey = "katalyst-wanted-feature-gates"
+
+// AppendWantedFeatureGatesToOutgoingContext appends names of the wanted feature gates to grpc metadata of
+// outgoing calls with the context
+func AppendWantedFeatureGatesToOutgoingContext(ctx context.Context, featureGates map[string]*advisorsvc.FeatureGate) context.Context {
+	kv := make([]string, 0, 2*len(featureGates))
+	for name := range featureGates {
+		kv = append(kv, wantedFeatureGatesMetadataKey, name)
+	}
+	return metadata.AppendToOutgoingContext(ctx, kv...)
+}
+
+// GetWantedFeatureGatesFromIncomingContext returns the wanted feature gates carried by grpc metadata of the
+// incoming call; only names are carried, so they are of featureGateType and never must be mutually supported
+func GetWantedFeatureGatesFromIncomingContext(ctx context.Context, featureGateType string) map[string]*advisorsvc.FeatureGate {
+	featureGates := make(map[string]*advisorsvc.FeatureGate)
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return featureGates
+	}
+
+	for _, name := range md.Get(wantedFeatureGatesMetadataKey) {
+		featureGates[name] = &advisorsvc.FeatureGate{
+			Name: name,
+			Type: featureGateType,
+		}
+	}
+	return featureGates
+}
@@ -0,0 +1,46 @@
+/*
+Copyright 2022 The Katalyst Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package featuregatenegotiation
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/kubewharf/katalyst-core/pkg/agent/qrm-plugins/advisorsvc"
+	"github.com/kubewharf/katalyst-core/pkg/agent/utilcomponent/featuregatenegotiation/finders"
+)
+
+func Test_WantedFeatureGatesMetadata(t *testing.T) {
+	t.Parallel()
+
+	// no feature gates are wanted without metadata
+	require.Empty(t, GetWantedFeatureGatesFromIncomingContext(context.Background(), finders.FeatureGateTypeCPU))
+
+	ctx := AppendWantedFeatureGatesToOutgoingContext(context.Background(), map[string]*advisorsvc.FeatureGate{
+		"fg1": {Name: "fg1", Type: finders.FeatureGateTypeCPU, MustMutuallySupported: true},
+		"fg2": {Name: "fg2", Type: finders.FeatureGateTypeCPU},
+	})
+	md, ok := metadata.FromOutgoingContext(ctx)
+	require.True(t, ok)
+	require.Equal(t, map[string]*advisorsvc.FeatureGate{
+		"fg1": {Name: "fg1", Type: finders.FeatureGateTypeCPU},
+		"fg2": {Name: "fg2", Type: finders.FeatureGateTypeCPU},
+	}, GetWantedFeatureGatesFromIncomingContext(metadata.NewIncomingContext(context.Background(), md), finders.FeatureGateTypeCPU))
+}
@@ -27,6 +27,8 @@ import (
 
 func init() {
 	RegisterNegotiationTypeFeatureGatesFinder(feature_cpu.NegotiationFeatureGateQuotaCtrlKnob, &feature_cpu.QuotaCtrlKnob{})
+	RegisterNegotiationTypeFeatureGatesFinder(feature_cpu.NegotiationFeatureGateExplicitCPUList, &feature_cpu.ExplicitCPUList{})
+	RegisterNegotiationTypeFeatureGatesFinder(feature_cpu.NegotiationFeatureGateListAndWatchChunk, &feature_cpu.ListAndWatchChunk{})
 }
 
 var negotiationTypeFeatureGatesFinder sync.Map
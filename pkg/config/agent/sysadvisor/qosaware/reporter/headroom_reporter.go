@@ -45,7 +45,13 @@ func NewHeadroomReporterConfiguration() *HeadroomReporterConfiguration {
 	}
 }
 
-type CPUHeadroomManagerConfiguration struct{}
+type CPUHeadroomManagerConfiguration struct {
+	// CPUNUMAHeadroomReservedRatio and CPUNUMAHeadroomReservedMilliCores hold back a safety margin of each numa
+	// from reported headroom, and the larger one takes effect if both are set; they apply on top of node-level
+	// reservations, which are already excluded from the headroom before it is reported
+	CPUNUMAHeadroomReservedRatio      float64
+	CPUNUMAHeadroomReservedMilliCores int64
+}
 
 func NewCPUHeadroomManagerConfiguration() *CPUHeadroomManagerConfiguration {
 	return &CPUHeadroomManagerConfiguration{}
@@ -17,7 +17,14 @@ limitations under the License.
 package region
 
 // CPUShareConfiguration stores configurations of cpu share
-type CPUShareConfiguration struct{}
+type CPUShareConfiguration struct {
+	// ShareRegionTargetCPUUsageRatio is the target cpu usage ratio of share regions, which is only used
+	// if no target of cpu usage ratio is given by the dynamic indicator targets, and zero means disabled
+	ShareRegionTargetCPUUsageRatio float64
+	// ShareRegionHeadroomBufferCores is the number of cores added on top of the cpu requirement
+	// of share regions when sizing share pools, to absorb bursts before the next provision
+	ShareRegionHeadroomBufferCores float64
+}
 
 // NewCPUShareConfiguration creates new resource advisor configurations
 func NewCPUShareConfiguration() *CPUShareConfiguration {
@@ -16,9 +16,245 @@ limitations under the License.
 
 package server
 
+import "time"
+
 // QRMServerConfiguration stores configurations of qrm servers in qos aware plugin
 type QRMServerConfiguration struct {
 	QRMServers []string
+
+	// CPUServerDeniedControlKnobKeys are control knob keys filtered out of cpu server ExtraEntries
+	CPUServerDeniedControlKnobKeys []string
+	// CPUServerPushCycleDeadline is the hard deadline for a whole push cycle of cpu server,
+	// cpu server health check will be not ready if a cycle exceeds it; zero means no deadline
+	CPUServerPushCycleDeadline time.Duration
+	// CPUServerReportNUMAHeadroomQuantity indicates whether to report raw quantity of
+	// per-numa headroom alongside the float cores
+	CPUServerReportNUMAHeadroomQuantity bool
+	// CPUServerUpdateContainerRetryBudget is the max number of retries for updating container info
+	// with transient errors within a single checkpoint sync
+	CPUServerUpdateContainerRetryBudget int
+	// CPUServerReconnectOnPluginSocketLost indicates whether to tear down and recreate the plugin client
+	// within ListAndWatch loop once the plugin socket is removed or recreated
+	CPUServerReconnectOnPluginSocketLost bool
+	// CPUServerContainerInfoMaxAge is the max age of cached container info used in assembly,
+	// containers not updated within it are considered stale and excluded; zero means no limit
+	CPUServerContainerInfoMaxAge time.Duration
+	// CPUServerExtraPluginSocketAbsPaths are extra cpu plugin sockets for cpu server to fan out,
+	// besides the primary one configured by CPUPluginSocketAbsPath
+	CPUServerExtraPluginSocketAbsPaths []string
+	// CPUServerSyncFreshnessWindow is the max age of the latest successful checkpoint sync
+	// for cpu server to push advice, zero means no limit
+	CPUServerSyncFreshnessWindow time.Duration
+	// CPUServerHeadroomNUMAKeyFormat is the format of numa keys in cpu headroom payload, which is one of
+	// plain (e.g. "1"), zero-padded (e.g. "01") and prefixed (e.g. "numa1")
+	CPUServerHeadroomNUMAKeyFormat string
+	// CPUServerMinReadySuccessCycles is the number of consecutive successful push cycles required
+	// before cpu server ListAndWatch health check reports ready, and any failure resets the counting
+	CPUServerMinReadySuccessCycles int
+	// CPUServerAdvicePushWindow is the daily time window in local time during which cpu server is allowed
+	// to push advice, formatted as HH:MM-HH:MM (e.g. 01:00-05:00, and 22:00-02:00 crosses midnight);
+	// checkpoint sync still runs outside the window, GetAdvice fails so that plugins keep their current
+	// allocation, and empty means pushing is always allowed
+	CPUServerAdvicePushWindow string
+	// CPUServerContainerGCCapPerCycle is the max number of containers absent from checkpoint deleted
+	// in a single sync, and the longest-absent ones are deleted first; zero means no limit
+	CPUServerContainerGCCapPerCycle int
+	// CPUServerEnableExplicitCPUList indicates whether to negotiate with cpu plugin to carry explicit
+	// cpu lists of blocks in advice, besides the default size-based blocks
+	CPUServerEnableExplicitCPUList bool
+	// CPUServerPoolHeadroomDivergenceThreshold is the max ratio that the sum of pool sizes and headroom
+	// may diverge from the cpu count per numa before it is flagged; zero means the check is disabled
+	CPUServerPoolHeadroomDivergenceThreshold float64
+	// CPUServerSkipPodFetchFailedContainers indicates whether to skip assembling containers whose pod
+	// failed to be fetched from meta server in the latest checkpoint sync, since their info may be incomplete
+	CPUServerSkipPodFetchFailedContainers bool
+	// CPUServerDisableGC indicates whether to disable gc of containers and pools in cpu server meta cache,
+	// which leaks memory and is intended for short debugging sessions only
+	CPUServerDisableGC bool
+	// CPUServerMaxBlocksPerNUMAPerPool is the max number of blocks a single pool may have on one numa, and
+	// blocks without overlap targets are merged if it is exceeded; zero means no limit
+	CPUServerMaxBlocksPerNUMAPerPool int
+	// CPUServerAggregatorAddress is the grpc address of the central aggregator that cpu server forwards
+	// assembled advice to besides local cpu plugin, and empty means forwarding is disabled
+	CPUServerAggregatorAddress string
+	// CPUServerAggregatorBufferSize is the max number of advice buffered to be forwarded to the aggregator,
+	// and the oldest one is dropped once it is full so that local push is never blocked
+	CPUServerAggregatorBufferSize int
+	// CPUServerAggregatorMaxRetries is the max number of retries for forwarding a single advice to the aggregator
+	CPUServerAggregatorMaxRetries int
+	// CPUServerRefusePushOnReserveReclaimOverlap indicates whether to refuse pushing advice if reclaim pool
+	// is found overlapping with the exclusive reserve pool, either in assembled blocks or in checkpoint
+	CPUServerRefusePushOnReserveReclaimOverlap bool
+	// CPUServerAggregateMetricsInterval is the min interval for cpu server to emit expensive aggregate metrics,
+	// e.g. overlap, pool headroom consistency and pool numa distribution; zero means emitting them in every push
+	CPUServerAggregateMetricsInterval time.Duration
+	// CPUServerMaxHeadroomRatio is the max fraction of node cpus that total reported numa headroom may take,
+	// and headroom of each numa is scaled down proportionally if exceeded; zero means no limit
+	CPUServerMaxHeadroomRatio float64
+	// CPUServerEnableTracing indicates whether to emit opentelemetry spans for each push cycle of cpu server,
+	// with child spans for sync, advisor update, assemble and send, using the global tracer provider
+	CPUServerEnableTracing bool
+	// CPUServerEmptyDedicatedAssignmentsPolicy is the policy to handle dedicated numa binding containers without
+	// topology aware assignments, which is one of skip and fallback-pool
+	CPUServerEmptyDedicatedAssignmentsPolicy string
+	// CPUServerMergeIdenticalPoolNUMABlocks indicates whether to merge blocks of a pool spanning multiple numa nodes
+	// identically into a single block without numa affinity, and per-numa blocks are kept by default
+	CPUServerMergeIdenticalPoolNUMABlocks bool
+	// CPUServerAdviceInputSnapshotLimit is the number of latest push cycles whose advisor input snapshots are kept
+	// for the debug endpoint, zero means snapshots are disabled
+	CPUServerAdviceInputSnapshotLimit int
+	// CPUServerOrphanContainerFallbackPool is the pool that shared_cores and reclaimed_cores containers are placed in
+	// if their owner pool is gone during assembly (e.g. gc-ed mid-cycle), empty means such containers are dropped
+	CPUServerOrphanContainerFallbackPool string
+	// CPUServerGCAfterAdvisorUpdate indicates whether to defer gc of containers and pools synced from checkpoint
+	// until advisor is updated successfully in the same cycle, so that a failed update leaves the cache un-gc-ed
+	CPUServerGCAfterAdvisorUpdate bool
+	// CPUServerHeadroomUnit is the unit of per-numa headroom values in cpu headroom payload, which is one of
+	// cores and millicores
+	CPUServerHeadroomUnit string
+	// CPUServerPoolSizeUnits are units of pool sizes in advisor results keyed by pool name, which are one of
+	// cores and millicores and default to cores; sizes are converted to cores (rounded up) for blocks
+	CPUServerPoolSizeUnits map[string]string
+	// CPUServerLWWatchdogWindow is the max duration without any successful push before cpu server returns from
+	// ListAndWatch to force qrm plugin to reconnect, zero means the watchdog is disabled
+	CPUServerLWWatchdogWindow time.Duration
+	// CPUServerAbsentPoolCarryForwardWindow is the grace window during which pools cached in meta cache but absent from
+	// advisor result are carried forward at their cached sizes, zero means such pools are dropped immediately
+	CPUServerAbsentPoolCarryForwardWindow time.Duration
+	// CPUServerIsolationTransitionMinGap is the min duration a container must stay isolated or non-isolated before
+	// the owner-pool switch is reflected in advice, zero means no damping
+	CPUServerIsolationTransitionMinGap time.Duration
+	// CPUServerValidateNUMAHeadroomAgainstDedicated indicates whether to check that per-numa headroom plus cpus bound
+	// by dedicated containers does not exceed numa capacity
+	CPUServerValidateNUMAHeadroomAgainstDedicated bool
+	// CPUServerMetaCacheSnapshotPath is the file that compact snapshots of pools and containers in meta cache
+	// are written to periodically and loaded from at startup, empty means snapshots are disabled
+	CPUServerMetaCacheSnapshotPath string
+	// CPUServerMetaCacheSnapshotInterval is the interval of writing meta cache snapshots
+	CPUServerMetaCacheSnapshotInterval time.Duration
+	// CPUServerMetaCacheSnapshotMaxAge is the max age of a meta cache snapshot to be trusted at startup
+	CPUServerMetaCacheSnapshotMaxAge time.Duration
+	// CPUServerPoolOverlapPriorities are priorities of shared pools keyed by pool name when reclaim overlaps them,
+	// and reclaim overlaps lower-priority pools first; pools not listed are of priority zero
+	CPUServerPoolOverlapPriorities map[string]int
+	// CPUServerReportCPUManagerPolicy indicates whether to report the effective kubelet cpu manager policy in advice
+	CPUServerReportCPUManagerPolicy bool
+	// CPUServerContainerMinCPUFloors are the min cpus in cores that containers of each qos level keep in assembly,
+	// and the pool (or dedicated pod) a container is placed in is clamped up to the floor if it is sized below
+	CPUServerContainerMinCPUFloors map[string]int
+	// CPUServerAdviceAuditLogPath is the file that change events between consecutively pushed advice are appended
+	// to as json lines, empty means audit is disabled
+	CPUServerAdviceAuditLogPath string
+	// CPUServerDrainTimeout bounds the last advice push of ListAndWatch loop when cpu server stops,
+	// zero means the loop exits without draining
+	CPUServerDrainTimeout time.Duration
+	// CPUServerReclaimPoolMaxShrinkPerCycle is the max cpus in cores that reclaim pool may shrink on each numa
+	// in a single push, zero means no limit
+	CPUServerReclaimPoolMaxShrinkPerCycle int
+	// CPUServerPluginDialBackoffInitialInterval is the initial interval to retry dialing cpu plugin socket, and
+	// it doubles after each failure until capped at sync period
+	CPUServerPluginDialBackoffInitialInterval time.Duration
+	// CPUServerPluginDialBackoffMaxElapsedTime is the max elapsed time to retry dialing cpu plugin socket before
+	// ListAndWatch gives up, zero means no retry
+	CPUServerPluginDialBackoffMaxElapsedTime time.Duration
+	// CPUServerGetPodTimeout is the timeout to get each pod from meta server in checkpoint sync, and the pod
+	// is handled as failed to be fetched on timeout; zero means no timeout
+	CPUServerGetPodTimeout time.Duration
+	// CPUServerPoolStabilityWindow is the number of latest cycles over which the stability score of each pool
+	// is computed from changes of its numa distribution, zero means the score is disabled
+	CPUServerPoolStabilityWindow int
+	// CPUServerEmptyReclaimBlocksPolicy is the policy to represent reclaim pool on numa nodes without reclaim capacity,
+	// which is one of keep, omit and empty-marker
+	CPUServerEmptyReclaimBlocksPolicy string
+	// CPUServerStartUpPeriod is the duration after startup during which pushing advice is skipped,
+	// zero means no skipping
+	CPUServerStartUpPeriod time.Duration
+	// CPUServerReclaimDisablingNodeConditions are node condition types, e.g. MemoryPressure, under which
+	// overlap between reclaim pool and others is turned off
+	CPUServerReclaimDisablingNodeConditions []string
+	// CPUServerCallTimeout bounds each GetCheckpoint call to cpu plugins and each advisor update,
+	// zero means no bound
+	CPUServerCallTimeout time.Duration
+	// CPUServerContainerSettleDelay is the min duration since a container is first seen before it is assembled,
+	// zero means containers are assembled at once
+	CPUServerContainerSettleDelay time.Duration
+	// CPUServerSuspectCheckpointDropRatio is the max ratio that the number of containers in a checkpoint may drop
+	// versus the previous one, beyond which the checkpoint is regarded as suspect and gc is skipped; zero means no check
+	CPUServerSuspectCheckpointDropRatio float64
+	// CPUServerStrictAssembly indicates whether to abort pushing advice on any inconsistency found in assembly,
+	// e.g. containers referring to missing or empty owner pools, rather than skipping the inconsistent entries
+	CPUServerStrictAssembly bool
+	// CPUServerDryRun indicates whether to compute advice without sending it to cpu plugins, while checkpoint
+	// is still synced; it is intended for validating advisor changes on production nodes
+	CPUServerDryRun bool
+	// CPUServerGateGetAdvice indicates whether GetAdvice is subject to the same gates, dry-run mode and
+	// post-processing as ListAndWatch; otherwise GetAdvice answers with the advisor result within the push window
+	CPUServerGateGetAdvice bool
+	// CPUServerImmutableQoSLevels are qos levels that containers are not allowed to change to or from,
+	// and such changes are rejected with the previous qos level kept
+	CPUServerImmutableQoSLevels []string
+	// CPUServerSecondaryPluginSocketAbsPath is the socket of a canary cpu plugin, whose checkpoint is only
+	// observed and compared with the primary one, and it is disabled if empty
+	CPUServerSecondaryPluginSocketAbsPath string
+	// CPUServerDeterministicBlockIDs indicates whether to derive block ids from the owner, numa and size of blocks
+	// rather than random uuids, so that the same advice is assembled with stable block ids cycle-to-cycle
+	CPUServerDeterministicBlockIDs bool
+	// CPUServerReservePoolMinNUMACoverage is the minimum number of numas with non-empty cpus the reserve pool
+	// must cover for advice to be pushed, and zero only requires the reserve pool to exist
+	CPUServerReservePoolMinNUMACoverage int
+	// QRMServerPeriodJitterFactor is the max fraction of period randomly added to each ListAndWatch cycle of qrm servers,
+	// including the first one, so that advisor runs across servers and nodes are spread out; non-positive disables jitter
+	QRMServerPeriodJitterFactor float64
+	// CPUServerPersistLastAdvice indicates whether to persist the last advice sent by ListAndWatch under the state file
+	// directory, and re-send it once the first loop after restart starts, before fresh advice is computed
+	CPUServerPersistLastAdvice bool
+	// CPUServerLastAdviceMaxAge is the max age of persisted advice to be re-sent after restart, zero means no limit
+	CPUServerLastAdviceMaxAge time.Duration
+	// CPUServerDiscountOverlappedHeadroom indicates whether to discount cores of shared pools overlapped by reclaim pool
+	// from reported numa headroom, so that reclaimed workloads never over-commit cores counted as both shared and reclaimed
+	CPUServerDiscountOverlappedHeadroom bool
+	// CPUServerManagedQoSLevels are qos levels whose containers are assembled into advice, and containers of
+	// other qos levels are left out, as a kill-switch per qos level; empty means all qos levels are managed
+	CPUServerManagedQoSLevels []string
+	// CPUServerMaxPoolMissingContainers is the max number of containers referring to empty or missing owner pools
+	// in a single assembly, above which the cycle fails since meta cache is regarded as inconsistent; zero means no limit
+	CPUServerMaxPoolMissingContainers int
+	// CPUServerGetCheckpointMaxAttempts is the max number of GetCheckpoint calls to each cpu plugin within a single
+	// cycle, which are retried while the checkpoint is nil or empty, e.g. during plugin warmup
+	CPUServerGetCheckpointMaxAttempts int
+	// CPUServerLWSendTimeout bounds each Send of ListAndWatch response to a stream, so that a slow plugin never
+	// stalls the loop; a stream timed out is regarded as broken, and zero means no bound
+	CPUServerLWSendTimeout time.Duration
+	// CPUServerLWChunkMaxEntries is the max number of entries in a single Send of ListAndWatch response, and
+	// larger responses are split into chunks for plugins negotiated to reassemble them; zero means never split
+	CPUServerLWChunkMaxEntries int
+	// CPUServerEmitReclaimOverlapMetrics indicates whether to emit the size of overlap between reclaim pool and each
+	// shared pool on each numa as metrics, along with each sent advice
+	CPUServerEmitReclaimOverlapMetrics bool
+	// CPUServerReclaimPoolMinCoresPerNUMA is the min size in cores of reclaim pool on each numa enforced in assembly,
+	// which is borrowed from shared pools on the numa if necessary; zero means no floor
+	CPUServerReclaimPoolMinCoresPerNUMA int
+	// CPUServerReclaimPoolMinRatioPerNUMA is the min size of reclaim pool on each numa as a fraction of numa cpus,
+	// and the larger one of it and CPUServerReclaimPoolMinCoresPerNUMA takes effect; zero means no floor
+	CPUServerReclaimPoolMinRatioPerNUMA float64
+	// CPUServerAdviceTracePath is the file that each assembled ListAndWatch response is appended to as a json line,
+	// along with its input checkpoint and advisor result, as replayable traces; empty means disabled
+	CPUServerAdviceTracePath string
+	// CPUServerAdviceTraceMaxBytes is the max size of the advice trace file, above which it is rotated
+	CPUServerAdviceTraceMaxBytes int64
+	// CPUServerAdviceTraceMaxBackups is the max number of rotated advice trace files kept
+	CPUServerAdviceTraceMaxBackups int
+	// CPUServerAdviceTraceHashPodUIDs indicates whether to replace pod uids in advice traces with their hashes
+	CPUServerAdviceTraceHashPodUIDs bool
+	// CPUServerCheckpointFrozenCycles is the max number of consecutive cycles with an unchanged checkpoint despite pod
+	// churn, above which the checkpoint freshness health check is not ready since the plugin may be frozen; zero means disabled
+	CPUServerCheckpointFrozenCycles int
+	// CPUServerCheckpointCompareMethod is the method to tell whether checkpoints of consecutive cycles are unchanged,
+	// i.e. bytes or entries
+	CPUServerCheckpointCompareMethod string
+	// CPUServerPodEntryAssemblyWorkers is the number of workers assembling entries of dedicated numa binding pods
+	// in parallel, and one means they are assembled serially
+	CPUServerPodEntryAssemblyWorkers int
 }
 
 // NewQRMServerConfiguration creates new qrm server configurations
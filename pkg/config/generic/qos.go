@@ -138,6 +138,22 @@ func (c *QoSConfiguration) SetEnhancementDefaultValues(enhancementDefaultValues
 	c.QoSEnhancementDefaultValues = general.MergeMap(c.QoSEnhancementDefaultValues, enhancementDefaultValues)
 }
 
+// Clone returns a deep copy of the qos configuration, so that callers can work on
+// a consistent snapshot while the original one may still be updated
+func (c *QoSConfiguration) Clone() *QoSConfiguration {
+	c.RLock()
+	defer c.RUnlock()
+
+	clone := NewQoSConfiguration()
+	clone.QoSClassAnnotationSelector = make(map[string]map[string]string, len(c.QoSClassAnnotationSelector))
+	for qosLevel, selector := range c.QoSClassAnnotationSelector {
+		clone.QoSClassAnnotationSelector[qosLevel] = general.DeepCopyMap(selector)
+	}
+	clone.QoSEnhancementAnnotationKey = general.DeepCopyMap(c.QoSEnhancementAnnotationKey)
+	clone.QoSEnhancementDefaultValues = general.DeepCopyMap(c.QoSEnhancementDefaultValues)
+	return clone
+}
+
 // FilterQoSMap filter map that are related to katalyst QoS.
 // it works both for default katalyst QoS keys and expanded QoS keys
 func (c *QoSConfiguration) FilterQoSMap(annotations map[string]string) map[string]string {
@@ -26,4 +26,15 @@ const (
 const (
 	// QRMResourceAnnotationKeyNUMABindResult is the annotation key for the numa binding result
 	QRMResourceAnnotationKeyNUMABindResult = "qrm.katalyst.kubewharf.io/numa_bind_result"
+
+	// PodAnnotationReclaimOverlapIneligibleKey is the annotation key to mark a container (and its owner pool)
+	// as not eligible for reclaimed cores overlapping, even if overlapping is allowed globally
+	PodAnnotationReclaimOverlapIneligibleKey  = "qrm.katalyst.kubewharf.io/reclaim_overlap_ineligible"
+	PodAnnotationReclaimOverlapIneligibleTrue = "true"
+
+	// PodAnnotationForceRampUpKey is the annotation key to force ramp-up state of all containers in a pod,
+	// overriding the one in checkpoint; values other than true and false are ignored
+	PodAnnotationForceRampUpKey   = "qrm.katalyst.kubewharf.io/force_ramp_up"
+	PodAnnotationForceRampUpTrue  = "true"
+	PodAnnotationForceRampUpFalse = "false"
 )
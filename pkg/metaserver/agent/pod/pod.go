@@ -18,6 +18,7 @@ package pod
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"sync"
 	"time"
@@ -44,6 +45,9 @@ const (
 
 type ContextKey string
 
+// ErrPodNotFound indicates the pod is not found by uid, e.g. it has been deleted
+var ErrPodNotFound = errors.New("pod not found")
+
 type ContainerInfo struct {
 	SandboxID   string `json:"sandboxID"`
 	RuntimeType string `json:"runtimeType"`
@@ -227,7 +231,7 @@ func (w *podFetcherImpl) GetPod(ctx context.Context, podUID string) (*v1.Pod, er
 	if pod, ok := kubeletPodsCache[podUID]; ok {
 		return pod, nil
 	}
-	return nil, fmt.Errorf("failed to find pod by uid %v", podUID)
+	return nil, fmt.Errorf("failed to find pod by uid %v: %w", podUID, ErrPodNotFound)
 }
 
 func (w *podFetcherImpl) getKubeletPodsCache(ctx context.Context) (map[string]*v1.Pod, error) {
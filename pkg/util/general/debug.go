@@ -0,0 +1,70 @@
+/*
+Copyright 2022 The Katalyst Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package general
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+
+	"k8s.io/klog/v2"
+)
+
+// DebugHandlerPathPrefix is the http path prefix for all registered debug handlers,
+// i.e. a handler registered with name xxx is served at /debug/handlers/xxx
+const DebugHandlerPathPrefix = "/debug/handlers/"
+
+var (
+	debugHandlerMap  = make(map[string]http.HandlerFunc)
+	debugHandlerLock sync.RWMutex
+)
+
+// RegisterDebugHandler registers a handler to export debug info, and the former
+// handler with the same name will be replaced.
+func RegisterDebugHandler(name string, handler http.HandlerFunc) {
+	debugHandlerLock.Lock()
+	defer debugHandlerLock.Unlock()
+
+	if _, ok := debugHandlerMap[name]; ok {
+		klog.Infof("debug handler %s is replaced", name)
+	}
+	debugHandlerMap[name] = handler
+}
+
+// UnregisterDebugHandler removes the handler registered with the name, and it's a no-op
+// if no such handler exists.
+func UnregisterDebugHandler(name string) {
+	debugHandlerLock.Lock()
+	defer debugHandlerLock.Unlock()
+
+	delete(debugHandlerMap, name)
+}
+
+// ServeDebugHandlers dispatches the request to the debug handler registered with the name in path
+func ServeDebugHandlers(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, DebugHandlerPathPrefix)
+
+	debugHandlerLock.RLock()
+	handler, ok := debugHandlerMap[name]
+	debugHandlerLock.RUnlock()
+
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	handler(w, r)
+}
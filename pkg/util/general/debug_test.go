@@ -0,0 +1,44 @@
+/*
+Copyright 2022 The Katalyst Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package general
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServeDebugHandlers(t *testing.T) {
+	t.Parallel()
+
+	testHandlerName := "testDebugHandler"
+	RegisterDebugHandler(testHandlerName, func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("debug info"))
+	})
+
+	recorder := httptest.NewRecorder()
+	ServeDebugHandlers(recorder, httptest.NewRequest(http.MethodGet, DebugHandlerPathPrefix+testHandlerName, nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "debug info", recorder.Body.String())
+
+	UnregisterDebugHandler(testHandlerName)
+	recorder = httptest.NewRecorder()
+	ServeDebugHandlers(recorder, httptest.NewRequest(http.MethodGet, DebugHandlerPathPrefix+testHandlerName, nil))
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+}